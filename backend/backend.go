@@ -3,15 +3,63 @@ package backend
 import (
 	"fmt"
 	"sync"
+	"time"
 )
 
 type NotificationBackend interface {
 	Name() string
 	QueueNotification(notification Notification) error
+
+	// Queues the notifications in one transaction and returns a result for each
+	// of them, in order. The notifications for channels that do not exist are
+	// not stored and their result has ChannelNotFound as the error, and neither
+	// are the duplicates of ones already queued (see IdempotencyKey). If an
+	// error is returned, none of the notifications were stored.
+	QueueNotifications(notifications []Notification) ([]QueueResult, error)
+
+	// The id of the notification the origin queued with the idempotency key
+	// within the window, 0 if there is none. A retry can be answered with it
+	// before the checks that only apply to new notifications.
+	FindIdempotentNotification(origin, key string) (int64, error)
+
+	// Counts a notification that was not queued because its channel was over
+	// its rate limit. Once retryAfter has passed since the first one, a single
+	// notification from SuppressedSummaryOrigin saying how many were suppressed
+	// is queued to the channel, by whichever process delivers the scheduled
+	// notifications.
+	SuppressNotification(notification Notification, retryAfter time.Duration) error
+
 	Initialize(openString string) error
 	Start(wg *sync.WaitGroup)
 	BlockUntilReady()
 	Shutdown()
+
+	// Newest first.
+	QueryNotifications(query NotificationQuery) ([]*StoredNotification, error)
+
+	// Returns NotificationNotFound if there is no notification with the id.
+	GetNotification(id int64) (*StoredNotification, error)
+
+	// Sorted by name.
+	ListChannels() []ChannelInfo
+
+	// The origins that sent at least one notification, sorted.
+	ListOrigins() ([]string, error)
+
+	// The deliveries of a notification, which is empty if it was not sent yet.
+	ListDeliveries(notificationId int64) ([]*DeliveryStatus, error)
+
+	// Where the backend publishes what happens to the notifications. It is
+	// closed on Shutdown.
+	Hub() *Hub
+
+	// Checks what restarting the process would fix, such as background tasks
+	// that stopped or are stuck. It is called often, so it should be cheap.
+	CheckLiveness() []HealthCheck
+
+	// Checks whether notifications can be queued and sent, such as whether the
+	// database is writable, in addition to the checks of CheckLiveness.
+	CheckReadiness() []HealthCheck
 }
 
 var availableBackends map[string]NotificationBackend = make(map[string]NotificationBackend)
@@ -2,6 +2,8 @@ package backend
 
 import (
 	"bytes"
+	"crypto/x509"
+	"encoding/json"
 	"fmt"
 	"net/smtp"
 	"regexp"
@@ -61,12 +63,45 @@ func newNotificationData(notification Notification) notificationData {
 	}
 }
 
+const EmailViaSMTPNotifierType = "EmailViaSMTP"
+
+func init() {
+	RegisterNotifierFactory(EmailViaSMTPNotifierType, func(name string, settings json.RawMessage) (Notifier, error) {
+		var config EmailViaSMTPConfig
+		err := DecodeNotifierSettings(settings, &config)
+		if err != nil {
+			return nil, err
+		}
+
+		notifier, err := config.ToNotifier()
+		if err != nil {
+			return nil, err
+		}
+
+		notifier.InstanceName = name
+		return notifier, nil
+	})
+}
+
 type EmailViaSMTPNotifier struct {
+	// Defaults to the name of the type.
+	InstanceName string
+
 	Hostname      string
 	Port          int
 	SelfEmailAddr string
 	Authenticator smtp.Auth
 
+	// One of SMTPStartTLS (the default), SMTPImplicitTLS or SMTPPlaintext.
+	TLSMode string
+
+	// The CAs to verify the server with. The ones of the system are used if it
+	// is nil.
+	RootCAs *x509.CertPool
+
+	// Defaults to defaultSMTPTimeout.
+	Timeout time.Duration
+
 	// For testing...
 	sendMailFunc func(string, smtp.Auth, string, []string, []byte) error
 }
@@ -79,43 +114,109 @@ func printMail(addr string, a smtp.Auth, from string, to []string, body []byte)
 	return nil
 }
 
+// Without a Host, the notifier sends through Gmail with STARTTLS and PLAIN
+// auth, as it used to be the only option.
 type EmailViaSMTPConfig struct {
+	Host string
+
+	// Defaults to 587, or 465 with the "tls" TLSMode.
+	Port int
+
+	// "starttls", "tls" or "none", see SMTPStartTLS. Defaults to "starttls".
+	TLSMode string
+
+	// "plain", "login", "cram-md5" or "none". Defaults to "plain" if there is a
+	// Username and to "none" otherwise.
+	AuthMechanism string
+
 	Username  string
 	Password  string
 	SelfEmail string
+
+	// A PEM file with the CAs to trust instead of the ones of the system.
+	CAFile string
+
+	// Defaults to 30 seconds.
+	TimeoutSeconds int
+
 	DoNotSend bool
 }
 
-func (c EmailViaSMTPConfig) ToNotifier() *EmailViaSMTPNotifier {
-	notifier := NewEmailViaGmailNotifier(c.Username, c.Password, c.SelfEmail)
+func (c EmailViaSMTPConfig) ToNotifier() (*EmailViaSMTPNotifier, error) {
+	if c.Host == "" {
+		c.Host = "smtp.gmail.com"
+		if c.AuthMechanism == "" {
+			c.AuthMechanism = SMTPAuthPlain
+		}
+	}
+
+	if c.TLSMode == "" {
+		c.TLSMode = SMTPStartTLS
+	}
+
+	if c.TLSMode != SMTPStartTLS && c.TLSMode != SMTPImplicitTLS && c.TLSMode != SMTPPlaintext {
+		return nil, fmt.Errorf("unknown smtp tls mode '%s'", c.TLSMode)
+	}
+
+	if c.Port == 0 {
+		c.Port = 587
+		if c.TLSMode == SMTPImplicitTLS {
+			c.Port = 465
+		}
+	}
+
+	if c.AuthMechanism == "" {
+		c.AuthMechanism = SMTPAuthNone
+		if c.Username != "" {
+			c.AuthMechanism = SMTPAuthPlain
+		}
+	}
+
+	authenticator, err := newSMTPAuth(c.AuthMechanism, c.Username, c.Password, c.Host)
+	if err != nil {
+		return nil, err
+	}
+
+	notifier := NewEmailViaSMTPNotifier(c.Host, c.Port, authenticator, c.SelfEmail)
+	notifier.TLSMode = c.TLSMode
+	notifier.Timeout = time.Duration(c.TimeoutSeconds) * time.Second
+
+	if c.CAFile != "" {
+		notifier.RootCAs, err = loadCABundle(c.CAFile)
+		if err != nil {
+			return nil, err
+		}
+	}
+
 	if c.DoNotSend {
 		notifier.sendMailFunc = printMail
 	}
-	return notifier
+	return notifier, nil
 }
 
 func NewEmailViaSMTPNotifier(hostname string, port int, authenticator smtp.Auth, selfEmail string) *EmailViaSMTPNotifier {
-	return &EmailViaSMTPNotifier{
+	notifier := &EmailViaSMTPNotifier{
 		Hostname:      hostname,
 		Port:          port,
 		Authenticator: authenticator,
 		SelfEmailAddr: selfEmail,
-		sendMailFunc:  smtp.SendMail,
+		TLSMode:       SMTPStartTLS,
 	}
+
+	notifier.sendMailFunc = notifier.smtpSendMail
+	return notifier
 }
 
 func NewEmailViaGmailNotifier(username string, password string, selfEmail string) *EmailViaSMTPNotifier {
-	return &EmailViaSMTPNotifier{
-		Hostname:      "smtp.gmail.com",
-		Port:          587,
-		Authenticator: smtp.PlainAuth("", username, password, "smtp.gmail.com"),
-		SelfEmailAddr: selfEmail,
-		sendMailFunc:  smtp.SendMail,
-	}
+	return NewEmailViaSMTPNotifier("smtp.gmail.com", 587, smtp.PlainAuth("", username, password, "smtp.gmail.com"), selfEmail)
 }
 
 func (n *EmailViaSMTPNotifier) Name() string {
-	return "EmailViaSMTP"
+	if n.InstanceName != "" {
+		return n.InstanceName
+	}
+
+	return EmailViaSMTPNotifierType
 }
 
 func (n *EmailViaSMTPNotifier) Send(notifications []Notification, subscriber Subscriber) error {
@@ -9,3 +9,11 @@ type ChannelNotFound struct {
 func (err ChannelNotFound) Error() string {
 	return fmt.Sprintf("channel '%s' not found", err.ChannelName)
 }
+
+type NotificationNotFound struct {
+	Id int64
+}
+
+func (err NotificationNotFound) Error() string {
+	return fmt.Sprintf("notification %d not found", err.Id)
+}
@@ -0,0 +1,37 @@
+package backend
+
+type HealthStatus string
+
+const (
+	HealthOK HealthStatus = "ok"
+
+	// Works, but something should be looked at.
+	HealthDegraded HealthStatus = "degraded"
+
+	HealthFailing HealthStatus = "failing"
+)
+
+var healthStatusSeverity = map[HealthStatus]int{
+	HealthOK:       0,
+	HealthDegraded: 1,
+	HealthFailing:  2,
+}
+
+// The result of checking one part of a backend.
+type HealthCheck struct {
+	Name    string
+	Status  HealthStatus
+	Message string
+}
+
+// The worst status of the checks, which is ok if there are none.
+func WorstHealthStatus(checks []HealthCheck) HealthStatus {
+	worst := HealthOK
+	for _, check := range checks {
+		if healthStatusSeverity[check.Status] > healthStatusSeverity[worst] {
+			worst = check.Status
+		}
+	}
+
+	return worst
+}
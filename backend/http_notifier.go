@@ -0,0 +1,64 @@
+package backend
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// What the notifiers posting to an HTTP API have in common.
+
+const (
+	defaultHTTPNotifierTimeout = 30 * time.Second
+
+	// How much of the response is kept in the error when the status is not a
+	// successful one.
+	maxHTTPErrorBody = 512
+
+	// How much of a successful response is read so the connection can be
+	// reused.
+	maxHTTPDrainedBody = 1 << 20
+)
+
+// The client of a notifier with TimeoutSeconds in its config, which defaults to
+// defaultHTTPNotifierTimeout.
+func newHTTPNotifierClient(timeoutSeconds int) *http.Client {
+	timeout := time.Duration(timeoutSeconds) * time.Second
+	if timeout == 0 {
+		timeout = defaultHTTPNotifierTimeout
+	}
+
+	return &http.Client{Timeout: timeout}
+}
+
+func isHTTPURL(rawURL string) bool {
+	u, err := url.Parse(rawURL)
+	return err == nil && (u.Scheme == "http" || u.Scheme == "https") && u.Host != ""
+}
+
+func isSuccessStatus(status int) bool {
+	return status >= 200 && status < 300
+}
+
+// Sends the request and checks the status of the response with isSuccess.
+// Otherwise, the error says what the service answered, with the start of the
+// body.
+func postAndCheck(client *http.Client, req *http.Request, service string, isSuccess func(int) bool) error {
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if isSuccess(resp.StatusCode) {
+		io.Copy(ioutil.Discard, io.LimitReader(resp.Body, maxHTTPDrainedBody))
+		return nil
+	}
+
+	body, _ := ioutil.ReadAll(io.LimitReader(resp.Body, maxHTTPErrorBody))
+	return fmt.Errorf("%s answered %s: %s", service, resp.Status, strings.TrimSpace(string(body)))
+}
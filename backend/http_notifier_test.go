@@ -0,0 +1,80 @@
+package backend
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"time"
+
+	. "gopkg.in/check.v1"
+)
+
+type recordedRequest struct {
+	method string
+	path   string
+	header http.Header
+	body   string
+}
+
+// Stands in for the HTTP APIs the notifiers post to. It records the requests
+// and answers them with status and response, after delay.
+type recordingServer struct {
+	*httptest.Server
+
+	sync.Mutex
+	status   int
+	response string
+	delay    time.Duration
+	requests []recordedRequest
+}
+
+func newRecordingServer(status int, response string) *recordingServer {
+	s := &recordingServer{status: status, response: response}
+	s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+
+		s.Lock()
+		s.requests = append(s.requests, recordedRequest{method: r.Method, path: r.URL.Path, header: r.Header, body: string(body)})
+		status, response, delay := s.status, s.response, s.delay
+		s.Unlock()
+
+		time.Sleep(delay)
+		w.WriteHeader(status)
+		w.Write([]byte(response))
+	}))
+
+	return s
+}
+
+func (s *recordingServer) answer(status int, response string) {
+	s.Lock()
+	defer s.Unlock()
+
+	s.status = status
+	s.response = response
+}
+
+func (s *recordingServer) answerAfter(delay time.Duration) {
+	s.Lock()
+	defer s.Unlock()
+
+	s.delay = delay
+}
+
+func (s *recordingServer) recorded() []recordedRequest {
+	s.Lock()
+	defer s.Unlock()
+
+	return append([]recordedRequest{}, s.requests...)
+}
+
+// Embedded by the suites of the notifiers posting to an HTTP API, which start
+// the server in their SetUpTest.
+type httpNotifierSuite struct {
+	server *recordingServer
+}
+
+func (s *httpNotifierSuite) TearDownTest(c *C) {
+	s.server.Close()
+}
@@ -0,0 +1,144 @@
+package backend
+
+import "sync"
+
+// The types of the events published to the hub.
+const (
+	NotificationQueued    = "queued"    // the notification was accepted
+	DeliveryUpdated       = "delivery"  // a delivery was attempted
+	NotificationDelivered = "delivered" // all of the deliveries were attempted
+)
+
+// Events are buffered up to this many per subscription. Once the buffer is
+// full, the events are dropped for that subscription rather than holding up
+// the backend.
+const subscriptionBufferSize = 64
+
+type Event struct {
+	Type         string
+	Notification StoredNotification
+
+	// Only set for DeliveryUpdated.
+	Delivery *DeliveryStatus
+}
+
+// Filters for Subscribe. The zero value of every field means it is not
+// filtered on.
+type EventFilter struct {
+	Channel     string
+	Tag         string
+	MinPriority Priority
+}
+
+func (f EventFilter) Matches(n Notification) bool {
+	if f.Channel != "" && n.Channel != f.Channel {
+		return false
+	}
+
+	if n.Priority < f.MinPriority {
+		return false
+	}
+
+	if f.Tag == "" {
+		return true
+	}
+
+	for _, tag := range n.Tags {
+		if tag == f.Tag {
+			return true
+		}
+	}
+
+	return false
+}
+
+// An in-process pub/sub hub of what happens to the notifications. The backend
+// publishes to it and anyone interested subscribes, such as the live stream of
+// the dashboard.
+//
+// Only the events of this process are published. With many processes sharing a
+// database, a notification is seen by the subscribers of the process that
+// received it and its deliveries by those of the process that sent it.
+type Hub struct {
+	lock          sync.Mutex
+	subscriptions map[*Subscription]struct{}
+	closed        bool
+}
+
+type Subscription struct {
+	hub    *Hub
+	filter EventFilter
+	events chan Event
+}
+
+func NewHub() *Hub {
+	return &Hub{
+		subscriptions: make(map[*Subscription]struct{}),
+	}
+}
+
+// Subscribes to the events of the notifications matching the filter. The
+// subscription must be closed once done with.
+func (h *Hub) Subscribe(filter EventFilter) *Subscription {
+	s := &Subscription{
+		hub:    h,
+		filter: filter,
+		events: make(chan Event, subscriptionBufferSize),
+	}
+
+	h.lock.Lock()
+	defer h.lock.Unlock()
+
+	if h.closed {
+		close(s.events)
+		return s
+	}
+
+	h.subscriptions[s] = struct{}{}
+	return s
+}
+
+// Never blocks, see subscriptionBufferSize.
+func (h *Hub) Publish(event Event) {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+
+	for s, _ := range h.subscriptions {
+		if !s.filter.Matches(event.Notification.Notification) {
+			continue
+		}
+
+		select {
+		case s.events <- event:
+		default:
+		}
+	}
+}
+
+// Closes every subscription, which is done when the backend shuts down.
+func (h *Hub) Close() {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+
+	for s, _ := range h.subscriptions {
+		close(s.events)
+		delete(h.subscriptions, s)
+	}
+
+	h.closed = true
+}
+
+// Closed once the subscription or the hub is closed.
+func (s *Subscription) Events() <-chan Event {
+	return s.events
+}
+
+func (s *Subscription) Close() {
+	s.hub.lock.Lock()
+	defer s.hub.lock.Unlock()
+
+	if _, found := s.hub.subscriptions[s]; found {
+		close(s.events)
+		delete(s.hub.subscriptions, s)
+	}
+}
@@ -0,0 +1,87 @@
+package backend
+
+import (
+	. "gopkg.in/check.v1"
+)
+
+type HubSuite struct {
+	hub *Hub
+}
+
+var _ = Suite(&HubSuite{})
+
+func (s *HubSuite) SetUpTest(c *C) {
+	s.hub = NewHub()
+}
+
+func event(channel string, priority Priority, tags ...string) Event {
+	return Event{
+		Type: NotificationQueued,
+		Notification: StoredNotification{
+			Notification: Notification{
+				Channel:  channel,
+				Priority: priority,
+				Tags:     tags,
+			},
+		},
+	}
+}
+
+func (s *HubSuite) TestEventFilterMatches(c *C) {
+	n := event("Channel1", NormalPriority, "disk", "db").Notification.Notification
+
+	c.Assert(EventFilter{}.Matches(n), Equals, true)
+	c.Assert(EventFilter{Channel: "Channel1"}.Matches(n), Equals, true)
+	c.Assert(EventFilter{Channel: "Channel2"}.Matches(n), Equals, false)
+	c.Assert(EventFilter{Tag: "db"}.Matches(n), Equals, true)
+	c.Assert(EventFilter{Tag: "web"}.Matches(n), Equals, false)
+	c.Assert(EventFilter{MinPriority: LowPriority}.Matches(n), Equals, true)
+	c.Assert(EventFilter{MinPriority: NormalPriority}.Matches(n), Equals, true)
+	c.Assert(EventFilter{MinPriority: UrgentPriority}.Matches(n), Equals, false)
+	c.Assert(EventFilter{Channel: "Channel1", Tag: "disk", MinPriority: NormalPriority}.Matches(n), Equals, true)
+}
+
+func (s *HubSuite) TestPublishToMatchingSubscriptions(c *C) {
+	all := s.hub.Subscribe(EventFilter{})
+	urgent := s.hub.Subscribe(EventFilter{MinPriority: UrgentPriority})
+
+	s.hub.Publish(event("Channel1", NormalPriority))
+	s.hub.Publish(event("Channel2", UrgentPriority))
+
+	c.Assert((<-all.Events()).Notification.Channel, Equals, "Channel1")
+	c.Assert((<-all.Events()).Notification.Channel, Equals, "Channel2")
+	c.Assert((<-urgent.Events()).Notification.Channel, Equals, "Channel2")
+	c.Assert(urgent.Events(), HasLen, 0)
+
+	all.Close()
+	urgent.Close()
+
+	_, ok := <-all.Events()
+	c.Assert(ok, Equals, false)
+
+	// Closing twice or publishing after closing is fine.
+	all.Close()
+	s.hub.Publish(event("Channel1", NormalPriority))
+}
+
+func (s *HubSuite) TestSlowSubscriptionDoesNotBlock(c *C) {
+	subscription := s.hub.Subscribe(EventFilter{})
+	for i := 0; i < subscriptionBufferSize+10; i++ {
+		s.hub.Publish(event("Channel1", NormalPriority))
+	}
+
+	c.Assert(subscription.Events(), HasLen, subscriptionBufferSize)
+}
+
+func (s *HubSuite) TestCloseEndsSubscriptions(c *C) {
+	subscription := s.hub.Subscribe(EventFilter{})
+	s.hub.Close()
+
+	_, ok := <-subscription.Events()
+	c.Assert(ok, Equals, false)
+	subscription.Close()
+
+	subscription = s.hub.Subscribe(EventFilter{})
+	_, ok = <-subscription.Events()
+	c.Assert(ok, Equals, false)
+}
@@ -1,5 +1,7 @@
 package backend
 
+import "strconv"
+
 type Priority int64
 
 const (
@@ -8,19 +10,96 @@ const (
 	UrgentPriority Priority = 100 // notify now
 )
 
+// The origin of the notifications summarizing the ones suppressed by a rate
+// limit, see NotificationBackend.SuppressNotification.
+const SuppressedSummaryOrigin = "towncrier"
+
 var PriorityMap map[string]Priority = map[string]Priority{
 	"low":    LowPriority,
 	"normal": NormalPriority,
 	"urgent": UrgentPriority,
 }
 
+// The name of the priority as in PriorityMap, or the number if it has none.
+func (p Priority) String() string {
+	for name, priority := range PriorityMap {
+		if priority == p {
+			return name
+		}
+	}
+
+	return strconv.FormatInt(int64(p), 10)
+}
+
 type Notification struct {
 	Subject   string
 	Content   string
 	Channel   string
 	Origin    string
 	Tags      []string
+	Labels    map[string]string
 	Priority  Priority
+	SendAt    int64 // UnixNano, not sent before then if set
 	CreatedAt int64 // UnixNano
 	UpdatedAt int64 // UnixNano
+
+	// If set, the notification is not queued again when the same origin
+	// already queued one with this key recently.
+	IdempotencyKey string
+}
+
+// A notification as it was stored by the backend.
+type StoredNotification struct {
+	Id        int64
+	Delivered bool
+	Notification
+}
+
+// The outcome of queueing one notification of a batch: the id it was stored
+// with, or why it was not stored.
+type QueueResult struct {
+	Id    int64
+	Error error
+
+	// The notification has the idempotency key of one queued before, whose id
+	// is given instead.
+	Duplicate bool
+}
+
+// The state of sending a notification to one subscriber via one notifier.
+type DeliveryStatus struct {
+	Subscriber    string // the subscriber unique name
+	Notifier      string
+	Status        string // pending, sent, failed or abandoned
+	Attempts      int64
+	LastError     string
+	NextAttemptAt int64 // UnixNano, 0 if it will not be attempted again
+	UpdatedAt     int64 // UnixNano
+}
+
+// A channel as configured in the backend.
+type ChannelInfo struct {
+	Name         string
+	TimeToNotify string
+	Subscribers  []string
+	Notifiers    []string
+}
+
+// Filters for QueryNotifications. The zero value of every field means it is
+// not filtered on.
+type NotificationQuery struct {
+	Channel   string
+	Channels  []string // Any of them
+	Origin    string
+	Tag       string
+	Priority  Priority
+	Delivered *bool
+	Since     int64 // UnixNano, CreatedAt >= Since
+	Until     int64 // UnixNano, CreatedAt < Until
+
+	// For pagination, only the notifications with an id lower than this. As the
+	// notifications are returned newest first, this is the id of the last
+	// notification of the previous page.
+	BeforeId int64
+	Limit    int
 }
@@ -1,13 +1,28 @@
 package backend
 
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"sort"
+)
+
 type Subscriber struct {
 	UniqueName  string
 	Name        string
 	Email       string
 	PhoneNumber string
+
+	// Where the chat notifiers post to for this subscriber, instead of their
+	// own webhook and channel. The channel is a chat channel such as "#ops" or
+	// a user such as "@jimmy".
+	ChatWebhookURL string
+	ChatChannel    string
 }
 
 type Notifier interface {
+	// The name the channels refer to the notifier by, which is the name of the
+	// instance in the config.
 	Name() string
 	Send(notifications []Notification, subscriber Subscriber) error
 }
@@ -30,3 +45,128 @@ func GetNotifier(name string) Notifier {
 	notifier, _ := availableNotifiers[name]
 	return notifier
 }
+
+// Creates a notifier named name from the settings of its instance in the
+// config, which are in whatever format the type wants.
+type NotifierFactory func(name string, settings json.RawMessage) (Notifier, error)
+
+var notifierFactories map[string]NotifierFactory = make(map[string]NotifierFactory)
+
+func RegisterNotifierFactory(notifierType string, factory NotifierFactory) {
+	notifierFactories[notifierType] = factory
+}
+
+// The types of notifiers that can be configured, sorted.
+func NotifierTypes() []string {
+	types := make([]string, 0, len(notifierFactories))
+	for notifierType := range notifierFactories {
+		types = append(types, notifierType)
+	}
+	sort.Strings(types)
+	return types
+}
+
+// An instance of a notifier in the config:
+//
+//     {"Name": "internal-mail", "Type": "EmailViaSMTP", "Settings": {"Host": "..."}}
+//
+// Channels refer to it by its Name.
+type NotifierConfig struct {
+	Name     string
+	Type     string
+	Settings json.RawMessage
+}
+
+func (c NotifierConfig) ToNotifier() (Notifier, error) {
+	factory, found := notifierFactories[c.Type]
+	if !found {
+		return nil, fmt.Errorf("notifier '%s' has an unknown type '%s'", c.Name, c.Type)
+	}
+
+	notifier, err := factory(c.Name, c.Settings)
+	if err != nil {
+		return nil, fmt.Errorf("notifier '%s' is invalid: %v", c.Name, err)
+	}
+
+	return notifier, nil
+}
+
+// A list of instances, or the object of the old config with one instance of
+// each type, named after it:
+//
+//     {"EmailViaSMTP": {"Host": "..."}}
+type NotifiersConfig []NotifierConfig
+
+func (c *NotifiersConfig) UnmarshalJSON(data []byte) error {
+	if len(data) > 0 && data[0] == '[' {
+		return json.Unmarshal(data, (*[]NotifierConfig)(c))
+	}
+
+	var byType map[string]json.RawMessage
+	err := json.Unmarshal(data, &byType)
+	if err != nil {
+		return err
+	}
+
+	*c = make(NotifiersConfig, 0, len(byType))
+	for _, notifierType := range sortedRawMessageKeys(byType) {
+		*c = append(*c, NotifierConfig{
+			Name:     notifierType,
+			Type:     notifierType,
+			Settings: byType[notifierType],
+		})
+	}
+
+	return nil
+}
+
+func sortedRawMessageKeys(m map[string]json.RawMessage) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// Creates every instance and registers them. Nothing is registered if any of
+// them is invalid.
+func (c NotifiersConfig) HookAllNotifiers() error {
+	notifiers := make([]Notifier, 0, len(c))
+	names := make(map[string]bool)
+	for _, instance := range c {
+		if instance.Name == "" {
+			return fmt.Errorf("a notifier of type '%s' has no name", instance.Type)
+		}
+
+		if names[instance.Name] {
+			return fmt.Errorf("notifier '%s' is configured twice", instance.Name)
+		}
+		names[instance.Name] = true
+
+		notifier, err := instance.ToNotifier()
+		if err != nil {
+			return err
+		}
+
+		notifiers = append(notifiers, notifier)
+	}
+
+	for _, notifier := range notifiers {
+		RegisterNotifier(notifier)
+	}
+
+	return nil
+}
+
+// Decodes the settings of a notifier, refusing the fields it does not have so
+// typos do not go unnoticed. Missing settings are the same as empty ones.
+func DecodeNotifierSettings(settings json.RawMessage, v interface{}) error {
+	if len(settings) == 0 {
+		return nil
+	}
+
+	decoder := json.NewDecoder(bytes.NewReader(settings))
+	decoder.DisallowUnknownFields()
+	return decoder.Decode(v)
+}
@@ -0,0 +1,83 @@
+package backend
+
+import (
+	"encoding/json"
+
+	. "gopkg.in/check.v1"
+)
+
+type NotifierSuite struct{}
+
+var _ = Suite(&NotifierSuite{})
+
+func (s *NotifierSuite) SetUpTest(c *C) {
+	ClearAllNotifiers()
+}
+
+func (s *NotifierSuite) TearDownTest(c *C) {
+	ClearAllNotifiers()
+}
+
+func (s *NotifierSuite) parse(c *C, data string) NotifiersConfig {
+	var config NotifiersConfig
+	c.Assert(json.Unmarshal([]byte(data), &config), IsNil)
+	return config
+}
+
+func (s *NotifierSuite) TestHookNamedInstances(c *C) {
+	config := s.parse(c, `[
+		{"Name": "internal-mail", "Type": "EmailViaSMTP", "Settings": {"Host": "relay.internal", "TLSMode": "none", "SelfEmail": "towncrier@internal"}},
+		{"Name": "customer-mail", "Type": "EmailViaSMTP", "Settings": {"Host": "smtp.example.com", "Port": 2525, "SelfEmail": "alerts@example.com"}}
+	]`)
+
+	c.Assert(config.HookAllNotifiers(), IsNil)
+
+	internal, ok := GetNotifier("internal-mail").(*EmailViaSMTPNotifier)
+	c.Assert(ok, Equals, true)
+	c.Assert(internal.Name(), Equals, "internal-mail")
+	c.Assert(internal.addr(), Equals, "relay.internal:587")
+	c.Assert(internal.TLSMode, Equals, SMTPPlaintext)
+	c.Assert(internal.SelfEmailAddr, Equals, "towncrier@internal")
+
+	customer, ok := GetNotifier("customer-mail").(*EmailViaSMTPNotifier)
+	c.Assert(ok, Equals, true)
+	c.Assert(customer.addr(), Equals, "smtp.example.com:2525")
+	c.Assert(customer.SelfEmailAddr, Equals, "alerts@example.com")
+
+	c.Assert(GetNotifier(EmailViaSMTPNotifierType), IsNil)
+}
+
+func (s *NotifierSuite) TestOldConfig(c *C) {
+	config := s.parse(c, `{"EmailViaSMTP": {"Username": "user", "Password": "password", "SelfEmail": "towncrier@localhost"}}`)
+	c.Assert(config, HasLen, 1)
+	c.Assert(config[0].Name, Equals, "EmailViaSMTP")
+	c.Assert(config[0].Type, Equals, "EmailViaSMTP")
+
+	c.Assert(config.HookAllNotifiers(), IsNil)
+
+	notifier, ok := GetNotifier("EmailViaSMTP").(*EmailViaSMTPNotifier)
+	c.Assert(ok, Equals, true)
+	c.Assert(notifier.addr(), Equals, "smtp.gmail.com:587")
+}
+
+func (s *NotifierSuite) TestInvalidConfigs(c *C) {
+	invalid := map[string]string{
+		`[{"Name": "mail", "Type": "Pigeon"}]`: "notifier 'mail' has an unknown type 'Pigeon'",
+		`[{"Type": "EmailViaSMTP"}]`:           "a notifier of type 'EmailViaSMTP' has no name",
+		`[{"Name": "mail", "Type": "EmailViaSMTP"}, {"Name": "mail", "Type": "EmailViaSMTP"}]`:                               "notifier 'mail' is configured twice",
+		`[{"Name": "mail", "Type": "EmailViaSMTP", "Settings": {"Hostname": "smtp.example.com"}}]`:                           `notifier 'mail' is invalid: json: unknown field "Hostname"`,
+		`[{"Name": "ok", "Type": "EmailViaSMTP"}, {"Name": "mail", "Type": "EmailViaSMTP", "Settings": {"TLSMode": "ssl"}}]`: "notifier 'mail' is invalid: unknown smtp tls mode 'ssl'",
+	}
+
+	for data, expected := range invalid {
+		err := s.parse(c, data).HookAllNotifiers()
+		c.Assert(err, ErrorMatches, expected, Commentf(data))
+	}
+
+	// Nothing is registered if any of the instances is invalid.
+	c.Assert(GetNotifier("ok"), IsNil)
+}
+
+func (s *NotifierSuite) TestNotifierTypes(c *C) {
+	c.Assert(NotifierTypes(), DeepEquals, []string{"EmailViaSMTP", "SMSViaTwilio", "Slack", "Webhook"})
+}
@@ -0,0 +1,218 @@
+package backend
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+)
+
+const SlackNotifierType = "Slack"
+
+// Slack refuses messages with more attachments than this.
+const maxSlackAttachments = 100
+
+var defaultSlackColors = map[string]string{
+	"low":    "#439FE0",
+	"normal": "good",
+	"urgent": "danger",
+}
+
+func init() {
+	RegisterNotifierFactory(SlackNotifierType, func(name string, settings json.RawMessage) (Notifier, error) {
+		var config SlackConfig
+		err := DecodeNotifierSettings(settings, &config)
+		if err != nil {
+			return nil, err
+		}
+
+		return config.ToNotifier(name)
+	})
+}
+
+// Posts the notifications to a Slack incoming webhook, or to anything that
+// accepts the same messages such as Mattermost. Each notification is an
+// attachment colored by its priority, and the notifications sent together are
+// one message with an attachment for each, which the chat clients collapse
+// when they are long.
+type SlackConfig struct {
+	// Used for the subscribers without a ChatWebhookURL.
+	WebhookURL string
+
+	// Overrides the channel, the name and the icon the webhook posts with, if
+	// the webhook allows it. The subscribers' ChatChannel takes precedence over
+	// Channel.
+	Channel   string
+	Username  string
+	IconURL   string
+	IconEmoji string
+
+	// The colors of the attachments by priority name, as hex colors or as
+	// good, warning and danger. Merged with defaultSlackColors.
+	Colors map[string]string
+
+	// Defaults to 30 seconds.
+	TimeoutSeconds int
+}
+
+type SlackNotifier struct {
+	name   string
+	config SlackConfig
+	client *http.Client
+}
+
+func (c SlackConfig) ToNotifier(name string) (*SlackNotifier, error) {
+	if c.WebhookURL != "" {
+		err := validateWebhookURL(c.WebhookURL)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	colors := make(map[string]string)
+	for priority, color := range defaultSlackColors {
+		colors[priority] = color
+	}
+
+	for priority, color := range c.Colors {
+		if _, found := PriorityMap[priority]; !found {
+			return nil, fmt.Errorf("unknown priority '%s'", priority)
+		}
+		colors[priority] = color
+	}
+	c.Colors = colors
+
+	return &SlackNotifier{
+		name:   name,
+		config: c,
+		client: newHTTPNotifierClient(c.TimeoutSeconds),
+	}, nil
+}
+
+func (n *SlackNotifier) Name() string {
+	return n.name
+}
+
+type slackFieldJSON struct {
+	Title string `json:"title"`
+	Value string `json:"value"`
+	Short bool   `json:"short"`
+}
+
+type slackAttachmentJSON struct {
+	Fallback   string           `json:"fallback"`
+	Color      string           `json:"color,omitempty"`
+	Title      string           `json:"title"`
+	Text       string           `json:"text,omitempty"`
+	Fields     []slackFieldJSON `json:"fields,omitempty"`
+	Timestamp  int64            `json:"ts,omitempty"`
+	MarkdownIn []string         `json:"mrkdwn_in,omitempty"`
+}
+
+type slackMessageJSON struct {
+	Text        string                `json:"text,omitempty"`
+	Channel     string                `json:"channel,omitempty"`
+	Username    string                `json:"username,omitempty"`
+	IconURL     string                `json:"icon_url,omitempty"`
+	IconEmoji   string                `json:"icon_emoji,omitempty"`
+	Attachments []slackAttachmentJSON `json:"attachments"`
+}
+
+// Slack only wants these three escaped, the rest of the text is left as is.
+var slackEscaper = strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;")
+
+func (n *SlackNotifier) attachment(notification Notification) slackAttachmentJSON {
+	title := fmt.Sprintf("[%s] %s", notification.Channel, notification.Subject)
+	createdAt := time.Unix(0, notification.CreatedAt).UTC()
+
+	fields := []slackFieldJSON{
+		{Title: "Origin", Value: slackEscaper.Replace(notification.Origin), Short: true},
+		{Title: "Priority", Value: notification.Priority.String(), Short: true},
+	}
+
+	if len(notification.Tags) > 0 {
+		fields = append(fields, slackFieldJSON{Title: "Tags", Value: slackEscaper.Replace(strings.Join(notification.Tags, ", ")), Short: true})
+	}
+
+	fields = append(fields, slackFieldJSON{Title: "Created At", Value: createdAt.Format(time.RFC3339), Short: true})
+
+	return slackAttachmentJSON{
+		Fallback:   slackEscaper.Replace(title),
+		Color:      n.config.Colors[notification.Priority.String()],
+		Title:      slackEscaper.Replace(title),
+		Text:       slackEscaper.Replace(notification.Content),
+		Fields:     fields,
+		Timestamp:  createdAt.Unix(),
+		MarkdownIn: []string{"text"},
+	}
+}
+
+func (n *SlackNotifier) message(notifications []Notification, subscriber Subscriber) slackMessageJSON {
+	message := slackMessageJSON{
+		Channel:   n.config.Channel,
+		Username:  n.config.Username,
+		IconURL:   n.config.IconURL,
+		IconEmoji: n.config.IconEmoji,
+	}
+
+	if subscriber.ChatChannel != "" {
+		message.Channel = subscriber.ChatChannel
+	}
+
+	if len(notifications) > 1 {
+		message.Text = slackEscaper.Replace(fmt.Sprintf("[%s] Received %d notifications", notifications[0].Channel, len(notifications)))
+	}
+
+	shown := notifications
+	if len(shown) > maxSlackAttachments {
+		shown = shown[:maxSlackAttachments-1]
+	}
+
+	for _, notification := range shown {
+		message.Attachments = append(message.Attachments, n.attachment(notification))
+	}
+
+	if hidden := len(notifications) - len(shown); hidden > 0 {
+		message.Attachments = append(message.Attachments, slackAttachmentJSON{
+			Fallback: fmt.Sprintf("%d more notifications", hidden),
+			Title:    fmt.Sprintf("%d more notifications", hidden),
+			Text:     "They are listed on the dashboard.",
+		})
+	}
+
+	return message
+}
+
+func (n *SlackNotifier) Send(notifications []Notification, subscriber Subscriber) error {
+	if len(notifications) == 0 {
+		return nil
+	}
+
+	webhookURL := n.config.WebhookURL
+	if subscriber.ChatWebhookURL != "" {
+		webhookURL = subscriber.ChatWebhookURL
+		err := validateWebhookURL(webhookURL)
+		if err != nil {
+			return fmt.Errorf("subscriber '%s' has an %v", subscriber.UniqueName, err)
+		}
+	}
+
+	if webhookURL == "" {
+		return fmt.Errorf("subscriber '%s' has no ChatWebhookURL and the notifier has no WebhookURL", subscriber.UniqueName)
+	}
+
+	body, err := json.Marshal(n.message(notifications, subscriber))
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequest("POST", webhookURL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	return postAndCheck(n.client, req, "chat webhook", isSuccessStatus)
+}
@@ -0,0 +1,191 @@
+package backend
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+
+	. "gopkg.in/check.v1"
+)
+
+type slackRequest struct {
+	path    string
+	message slackMessageJSON
+}
+
+type SlackNotifierSuite struct {
+	httpNotifierSuite
+
+	notification Notification
+	jimmy        Subscriber
+}
+
+var _ = Suite(&SlackNotifierSuite{})
+
+func (s *SlackNotifierSuite) SetUpTest(c *C) {
+	s.server = newRecordingServer(http.StatusOK, "ok")
+
+	createdAt, err := time.Parse(time.RFC3339, testStandardTime)
+	c.Assert(err, IsNil)
+
+	s.notification = Notification{
+		Subject:   "disk <full>",
+		Content:   "/dev/sda1 is at 99% & growing",
+		Channel:   "alerts",
+		Origin:    "db1",
+		Tags:      []string{"disk", "db"},
+		Priority:  UrgentPriority,
+		CreatedAt: createdAt.UnixNano(),
+	}
+
+	s.jimmy = Subscriber{
+		UniqueName: "jimmy",
+		Name:       "Jimmy the Cat",
+	}
+}
+
+// The messages posted to the server so far.
+func (s *SlackNotifierSuite) posted(c *C) []slackRequest {
+	requests := []slackRequest{}
+	for _, r := range s.server.recorded() {
+		c.Assert(r.header.Get("Content-Type"), Equals, "application/json")
+
+		var message slackMessageJSON
+		c.Assert(json.Unmarshal([]byte(r.body), &message), IsNil)
+		requests = append(requests, slackRequest{path: r.path, message: message})
+	}
+
+	return requests
+}
+
+func (s *SlackNotifierSuite) notifier(c *C, config SlackConfig) *SlackNotifier {
+	if config.WebhookURL == "" {
+		config.WebhookURL = s.server.URL + "/hooks/default"
+	}
+
+	notifier, err := config.ToNotifier("chat")
+	c.Assert(err, IsNil)
+	return notifier
+}
+
+func (s *SlackNotifierSuite) TestSendOne(c *C) {
+	notifier := s.notifier(c, SlackConfig{Username: "towncrier", IconEmoji: ":bell:"})
+	c.Assert(notifier.Name(), Equals, "chat")
+
+	err := notifier.Send([]Notification{s.notification}, s.jimmy)
+	c.Assert(err, IsNil)
+
+	requests := s.posted(c)
+	c.Assert(requests, HasLen, 1)
+	c.Assert(requests[0].path, Equals, "/hooks/default")
+	c.Assert(requests[0].message, DeepEquals, slackMessageJSON{
+		Username:  "towncrier",
+		IconEmoji: ":bell:",
+		Attachments: []slackAttachmentJSON{
+			{
+				Fallback: "[alerts] disk &lt;full&gt;",
+				Color:    "danger",
+				Title:    "[alerts] disk &lt;full&gt;",
+				Text:     "/dev/sda1 is at 99% &amp; growing",
+				Fields: []slackFieldJSON{
+					{Title: "Origin", Value: "db1", Short: true},
+					{Title: "Priority", Value: "urgent", Short: true},
+					{Title: "Tags", Value: "disk, db", Short: true},
+					{Title: "Created At", Value: testStandardTime, Short: true},
+				},
+				Timestamp:  1441412100,
+				MarkdownIn: []string{"text"},
+			},
+		},
+	})
+}
+
+func (s *SlackNotifierSuite) TestSendDigest(c *C) {
+	normal := s.notification
+	normal.Priority = NormalPriority
+	normal.Tags = nil
+
+	notifier := s.notifier(c, SlackConfig{Colors: map[string]string{"normal": "#cccccc"}})
+	err := notifier.Send([]Notification{s.notification, normal}, s.jimmy)
+	c.Assert(err, IsNil)
+
+	requests := s.posted(c)
+	c.Assert(requests, HasLen, 1)
+	message := requests[0].message
+	c.Assert(message.Text, Equals, "[alerts] Received 2 notifications")
+	c.Assert(message.Attachments, HasLen, 2)
+	c.Assert(message.Attachments[0].Color, Equals, "danger")
+	c.Assert(message.Attachments[1].Color, Equals, "#cccccc")
+	c.Assert(message.Attachments[1].Fields, HasLen, 3)
+}
+
+func (s *SlackNotifierSuite) TestSendDigestTooManyAttachments(c *C) {
+	notifications := make([]Notification, 150)
+	for i := range notifications {
+		notifications[i] = s.notification
+	}
+
+	err := s.notifier(c, SlackConfig{}).Send(notifications, s.jimmy)
+	c.Assert(err, IsNil)
+
+	attachments := s.posted(c)[0].message.Attachments
+	c.Assert(attachments, HasLen, maxSlackAttachments)
+	c.Assert(attachments[maxSlackAttachments-1].Title, Equals, "51 more notifications")
+}
+
+func (s *SlackNotifierSuite) TestSubscriberWebhookAndChannel(c *C) {
+	s.jimmy.ChatWebhookURL = s.server.URL + "/hooks/jimmy"
+	s.jimmy.ChatChannel = "@jimmy"
+
+	err := s.notifier(c, SlackConfig{Channel: "#ops"}).Send([]Notification{s.notification}, s.jimmy)
+	c.Assert(err, IsNil)
+
+	requests := s.posted(c)
+	c.Assert(requests, HasLen, 1)
+	c.Assert(requests[0].path, Equals, "/hooks/jimmy")
+	c.Assert(requests[0].message.Channel, Equals, "@jimmy")
+
+	notifier, err := SlackConfig{}.ToNotifier("chat")
+	c.Assert(err, IsNil)
+	c.Assert(notifier.Send([]Notification{s.notification}, s.jimmy), IsNil)
+	c.Assert(s.posted(c), HasLen, 2)
+}
+
+func (s *SlackNotifierSuite) TestNoWebhook(c *C) {
+	notifier, err := SlackConfig{}.ToNotifier("chat")
+	c.Assert(err, IsNil)
+
+	err = notifier.Send([]Notification{s.notification}, s.jimmy)
+	c.Assert(err, ErrorMatches, "subscriber 'jimmy' has no ChatWebhookURL and the notifier has no WebhookURL")
+
+	s.jimmy.ChatWebhookURL = "not a url"
+	err = notifier.Send([]Notification{s.notification}, s.jimmy)
+	c.Assert(err, ErrorMatches, "subscriber 'jimmy' has an invalid webhook url 'not a url'")
+}
+
+func (s *SlackNotifierSuite) TestFailureStatus(c *C) {
+	s.server.answer(http.StatusNotFound, "channel_not_found")
+
+	err := s.notifier(c, SlackConfig{}).Send([]Notification{s.notification}, s.jimmy)
+	c.Assert(err, ErrorMatches, "chat webhook answered 404 Not Found: channel_not_found")
+}
+
+func (s *SlackNotifierSuite) TestInvalidConfigs(c *C) {
+	_, err := SlackConfig{WebhookURL: "hooks.slack.com"}.ToNotifier("chat")
+	c.Assert(err, ErrorMatches, "invalid webhook url 'hooks.slack.com'")
+
+	_, err = SlackConfig{Colors: map[string]string{"critical": "danger"}}.ToNotifier("chat")
+	c.Assert(err, ErrorMatches, "unknown priority 'critical'")
+}
+
+func (s *SlackNotifierSuite) TestFactory(c *C) {
+	defer ClearAllNotifiers()
+
+	var config NotifiersConfig
+	c.Assert(json.Unmarshal([]byte(`[{"Name": "mattermost", "Type": "Slack", "Settings": {"WebhookURL": "https://chat.example.com/hooks/abc", "Channel": "town-square"}}]`), &config), IsNil)
+	c.Assert(config.HookAllNotifiers(), IsNil)
+
+	notifier, ok := GetNotifier("mattermost").(*SlackNotifier)
+	c.Assert(ok, Equals, true)
+	c.Assert(notifier.config.Channel, Equals, "town-square")
+}
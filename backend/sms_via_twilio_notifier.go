@@ -0,0 +1,310 @@
+package backend
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"unicode/utf16"
+)
+
+const SMSViaTwilioNotifierType = "SMSViaTwilio"
+
+const (
+	defaultTwilioBaseURL = "https://api.twilio.com"
+	defaultSMSSegments   = 3
+
+	smsEllipsis = "..."
+
+	// A word is only kept whole when truncating if it does not cost more than
+	// this many characters.
+	maxSMSWordCut = 20
+)
+
+func init() {
+	RegisterNotifierFactory(SMSViaTwilioNotifierType, func(name string, settings json.RawMessage) (Notifier, error) {
+		var config SMSViaTwilioConfig
+		err := DecodeNotifierSettings(settings, &config)
+		if err != nil {
+			return nil, err
+		}
+
+		return config.ToNotifier(name)
+	})
+}
+
+// Sends the notifications as text messages to the PhoneNumber of the
+// subscribers, through the REST API of Twilio or of anything compatible with
+// it.
+type SMSViaTwilioConfig struct {
+	// Defaults to https://api.twilio.com.
+	BaseURL string
+
+	AccountSID string
+	AuthToken  string
+
+	// The number the messages are sent from, in E.164 format.
+	From string
+
+	// The text is truncated to fit in this many segments. Defaults to 3.
+	MaxSegments int
+
+	// Defaults to 30 seconds.
+	TimeoutSeconds int
+}
+
+type SMSViaTwilioNotifier struct {
+	name   string
+	config SMSViaTwilioConfig
+	client *http.Client
+}
+
+// An error reported by the provider, as described in its response.
+type SMSProviderError struct {
+	Status  string
+	Code    int
+	Message string
+}
+
+func (e SMSProviderError) Error() string {
+	if e.Code == 0 {
+		return fmt.Sprintf("sms provider answered %s: %s", e.Status, e.Message)
+	}
+
+	return fmt.Sprintf("sms provider answered %s: error %d: %s", e.Status, e.Code, e.Message)
+}
+
+func (c SMSViaTwilioConfig) ToNotifier(name string) (*SMSViaTwilioNotifier, error) {
+	if c.BaseURL == "" {
+		c.BaseURL = defaultTwilioBaseURL
+	}
+
+	if !isHTTPURL(c.BaseURL) {
+		return nil, fmt.Errorf("invalid base url '%s'", c.BaseURL)
+	}
+	c.BaseURL = strings.TrimRight(c.BaseURL, "/")
+
+	if c.AccountSID == "" || c.AuthToken == "" || c.From == "" {
+		return nil, fmt.Errorf("AccountSID, AuthToken and From are required")
+	}
+
+	if c.MaxSegments == 0 {
+		c.MaxSegments = defaultSMSSegments
+	}
+
+	if c.MaxSegments < 0 {
+		return nil, fmt.Errorf("invalid MaxSegments %d", c.MaxSegments)
+	}
+
+	return &SMSViaTwilioNotifier{
+		name:   name,
+		config: c,
+		client: newHTTPNotifierClient(c.TimeoutSeconds),
+	}, nil
+}
+
+func (n *SMSViaTwilioNotifier) Name() string {
+	return n.name
+}
+
+func (n *SMSViaTwilioNotifier) messagesURL() string {
+	return fmt.Sprintf("%s/2010-04-01/Accounts/%s/Messages.json", n.config.BaseURL, url.PathEscape(n.config.AccountSID))
+}
+
+func (n *SMSViaTwilioNotifier) Send(notifications []Notification, subscriber Subscriber) error {
+	if len(notifications) == 0 {
+		return nil
+	}
+
+	if subscriber.PhoneNumber == "" {
+		return fmt.Errorf("subscriber '%s' has no PhoneNumber", subscriber.UniqueName)
+	}
+
+	var text string
+	if len(notifications) == 1 {
+		text = smsTextForOne(notifications[0], n.config.MaxSegments)
+	} else {
+		text = smsTextForMany(notifications, n.config.MaxSegments)
+	}
+
+	form := url.Values{
+		"To":   {subscriber.PhoneNumber},
+		"From": {n.config.From},
+		"Body": {text},
+	}
+
+	req, err := http.NewRequest("POST", n.messagesURL(), strings.NewReader(form.Encode()))
+	if err != nil {
+		return err
+	}
+
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.SetBasicAuth(n.config.AccountSID, n.config.AuthToken)
+
+	resp, err := n.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	body, _ := ioutil.ReadAll(io.LimitReader(resp.Body, maxHTTPDrainedBody))
+	if isSuccessStatus(resp.StatusCode) {
+		return nil
+	}
+
+	providerErr := SMSProviderError{Status: resp.Status}
+
+	var twilioErr struct {
+		Code    int    `json:"code"`
+		Message string `json:"message"`
+	}
+
+	if json.Unmarshal(body, &twilioErr) == nil && twilioErr.Message != "" {
+		providerErr.Code = twilioErr.Code
+		providerErr.Message = twilioErr.Message
+	} else {
+		if len(body) > maxHTTPErrorBody {
+			body = body[:maxHTTPErrorBody]
+		}
+		providerErr.Message = strings.TrimSpace(string(body))
+	}
+
+	return providerErr
+}
+
+func smsTextForOne(notification Notification, maxSegments int) string {
+	text := fmt.Sprintf("[%s][%s] %s", notification.Channel, notification.Origin, notification.Subject)
+	content := strings.Join(strings.Fields(notification.Content), " ")
+	if content != "" {
+		text += "\n" + content
+	}
+
+	return truncateSMS(text, maxSegments)
+}
+
+// Lists the subjects, as many as fit.
+func smsTextForMany(notifications []Notification, maxSegments int) string {
+	text := fmt.Sprintf("[%s] %d notifications", notifications[0].Channel, len(notifications))
+
+	for i, notification := range notifications {
+		line := fmt.Sprintf("\n- [%s] %s", notification.Origin, notification.Subject)
+
+		rest := ""
+		if i < len(notifications)-1 {
+			rest = fmt.Sprintf("\n+%d more", len(notifications)-i-1)
+		}
+
+		if !smsFits(text+line+rest, maxSegments) {
+			if i == 0 {
+				return truncateSMS(text+line, maxSegments)
+			}
+
+			return text + fmt.Sprintf("\n+%d more", len(notifications)-i)
+		}
+
+		text += line
+	}
+
+	return text
+}
+
+// The characters of the GSM 03.38 alphabet, which take 7 bits each. Those of
+// its extension take two characters. Any other character makes the message
+// UCS-2, with fewer characters per segment.
+const (
+	gsm7Basic     = "@£$¥èéùìòÇ\nØø\rÅåΔ_ΦΓΛΩΠΨΣΘΞÆæßÉ !\"#¤%&'()*+,-./0123456789:;<=>?¡ABCDEFGHIJKLMNOPQRSTUVWXYZÄÖÑÜ§¿abcdefghijklmnopqrstuvwxyzäöñüà"
+	gsm7Extension = "\f^{}\\[~]|€"
+)
+
+func isGSM7(text string) bool {
+	for _, r := range text {
+		if !strings.ContainsRune(gsm7Basic, r) && !strings.ContainsRune(gsm7Extension, r) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// How many characters the rune takes in the encoding.
+func smsRuneLength(r rune, gsm bool) int {
+	if gsm {
+		if strings.ContainsRune(gsm7Extension, r) {
+			return 2
+		}
+		return 1
+	}
+
+	return len(utf16.Encode([]rune{r}))
+}
+
+func smsLength(text string, gsm bool) int {
+	length := 0
+	for _, r := range text {
+		length += smsRuneLength(r, gsm)
+	}
+
+	return length
+}
+
+// How many characters fit in that many segments. A message of several
+// segments loses a few characters of each to the header joining them.
+func smsCapacity(gsm bool, segments int) int {
+	single, multi := 70, 67
+	if gsm {
+		single, multi = 160, 153
+	}
+
+	if segments <= 1 {
+		return single
+	}
+
+	return multi * segments
+}
+
+// The number of segments the text is sent as.
+func smsSegments(text string) int {
+	gsm := isGSM7(text)
+	length := smsLength(text, gsm)
+	if length <= smsCapacity(gsm, 1) {
+		return 1
+	}
+
+	perSegment := smsCapacity(gsm, 2) / 2
+	return (length + perSegment - 1) / perSegment
+}
+
+func smsFits(text string, maxSegments int) bool {
+	return smsSegments(text) <= maxSegments
+}
+
+// Cuts the text to fit in maxSegments, at the end of a word if that does not
+// lose too much, and marks it as cut with an ellipsis.
+func truncateSMS(text string, maxSegments int) string {
+	if smsFits(text, maxSegments) {
+		return text
+	}
+
+	gsm := isGSM7(text)
+	capacity := smsCapacity(gsm, maxSegments) - smsLength(smsEllipsis, gsm)
+
+	runes := []rune(text)
+	length := 0
+	cut := 0
+	for cut < len(runes) && length+smsRuneLength(runes[cut], gsm) <= capacity {
+		length += smsRuneLength(runes[cut], gsm)
+		cut++
+	}
+
+	for i := cut; i > 0 && i < len(runes) && cut-i <= maxSMSWordCut; i-- {
+		if runes[i] == ' ' || runes[i] == '\n' {
+			cut = i
+			break
+		}
+	}
+
+	return strings.TrimRight(string(runes[:cut]), " \n") + smsEllipsis
+}
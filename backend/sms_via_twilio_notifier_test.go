@@ -0,0 +1,217 @@
+package backend
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"strings"
+
+	. "gopkg.in/check.v1"
+)
+
+type twilioRequest struct {
+	path     string
+	username string
+	password string
+	form     url.Values
+}
+
+// The server stands in for the API of Twilio.
+type SMSViaTwilioNotifierSuite struct {
+	httpNotifierSuite
+
+	notification Notification
+	jimmy        Subscriber
+}
+
+var _ = Suite(&SMSViaTwilioNotifierSuite{})
+
+func (s *SMSViaTwilioNotifierSuite) SetUpTest(c *C) {
+	s.server = newRecordingServer(http.StatusCreated, `{"sid": "SM123", "status": "queued"}`)
+
+	s.notification = Notification{
+		Subject: "disk full",
+		Content: "/dev/sda1 is at 99%\n\nand growing",
+		Channel: "alerts",
+		Origin:  "db1",
+	}
+
+	s.jimmy = Subscriber{
+		UniqueName:  "jimmy",
+		PhoneNumber: "+15550001111",
+	}
+}
+
+// The messages sent to the server so far.
+func (s *SMSViaTwilioNotifierSuite) sent(c *C) []twilioRequest {
+	requests := []twilioRequest{}
+	for _, r := range s.server.recorded() {
+		c.Assert(r.method, Equals, "POST")
+
+		form, err := url.ParseQuery(r.body)
+		c.Assert(err, IsNil)
+
+		username, password, _ := (&http.Request{Header: r.header}).BasicAuth()
+		requests = append(requests, twilioRequest{
+			path:     r.path,
+			username: username,
+			password: password,
+			form:     form,
+		})
+	}
+
+	return requests
+}
+
+func (s *SMSViaTwilioNotifierSuite) notifier(c *C) *SMSViaTwilioNotifier {
+	notifier, err := SMSViaTwilioConfig{
+		BaseURL:    s.server.URL + "/",
+		AccountSID: "AC123",
+		AuthToken:  "t0ken",
+		From:       "+15559990000",
+	}.ToNotifier("sms")
+	c.Assert(err, IsNil)
+	return notifier
+}
+
+func (s *SMSViaTwilioNotifierSuite) TestSendOne(c *C) {
+	notifier := s.notifier(c)
+	c.Assert(notifier.Name(), Equals, "sms")
+
+	err := notifier.Send([]Notification{s.notification}, s.jimmy)
+	c.Assert(err, IsNil)
+
+	requests := s.sent(c)
+	c.Assert(requests, HasLen, 1)
+	c.Assert(requests[0].path, Equals, "/2010-04-01/Accounts/AC123/Messages.json")
+	c.Assert(requests[0].username, Equals, "AC123")
+	c.Assert(requests[0].password, Equals, "t0ken")
+	c.Assert(requests[0].form.Get("To"), Equals, "+15550001111")
+	c.Assert(requests[0].form.Get("From"), Equals, "+15559990000")
+	c.Assert(requests[0].form.Get("Body"), Equals, "[alerts][db1] disk full\n/dev/sda1 is at 99% and growing")
+}
+
+func (s *SMSViaTwilioNotifierSuite) TestSendMany(c *C) {
+	other := s.notification
+	other.Origin = "db2"
+	other.Subject = "disk almost full"
+
+	err := s.notifier(c).Send([]Notification{s.notification, other}, s.jimmy)
+	c.Assert(err, IsNil)
+
+	c.Assert(s.sent(c)[0].form.Get("Body"), Equals, "[alerts] 2 notifications\n- [db1] disk full\n- [db2] disk almost full")
+}
+
+func (s *SMSViaTwilioNotifierSuite) TestProviderError(c *C) {
+	s.server.answer(http.StatusBadRequest, `{"code": 21211, "message": "The 'To' number +1555 is not a valid phone number.", "status": 400}`)
+
+	err := s.notifier(c).Send([]Notification{s.notification}, s.jimmy)
+	c.Assert(err, DeepEquals, SMSProviderError{
+		Status:  "400 Bad Request",
+		Code:    21211,
+		Message: "The 'To' number +1555 is not a valid phone number.",
+	})
+	c.Assert(err, ErrorMatches, "sms provider answered 400 Bad Request: error 21211: The 'To' number .* is not a valid phone number.")
+
+	s.server.answer(http.StatusBadGateway, "upstream unavailable\n")
+	err = s.notifier(c).Send([]Notification{s.notification}, s.jimmy)
+	c.Assert(err, ErrorMatches, "sms provider answered 502 Bad Gateway: upstream unavailable")
+}
+
+func (s *SMSViaTwilioNotifierSuite) TestNoPhoneNumber(c *C) {
+	s.jimmy.PhoneNumber = ""
+
+	err := s.notifier(c).Send([]Notification{s.notification}, s.jimmy)
+	c.Assert(err, ErrorMatches, "subscriber 'jimmy' has no PhoneNumber")
+	c.Assert(s.sent(c), HasLen, 0)
+}
+
+func (s *SMSViaTwilioNotifierSuite) TestSegments(c *C) {
+	c.Assert(smsSegments(strings.Repeat("a", 160)), Equals, 1)
+	c.Assert(smsSegments(strings.Repeat("a", 161)), Equals, 2)
+	c.Assert(smsSegments(strings.Repeat("a", 306)), Equals, 2)
+	c.Assert(smsSegments(strings.Repeat("a", 307)), Equals, 3)
+
+	// The extension characters take two.
+	c.Assert(smsSegments(strings.Repeat("€", 80)), Equals, 1)
+	c.Assert(smsSegments(strings.Repeat("€", 81)), Equals, 2)
+
+	// Anything else makes it UCS-2.
+	c.Assert(smsSegments(strings.Repeat("a", 69)+"ł"), Equals, 1)
+	c.Assert(smsSegments(strings.Repeat("a", 70)+"ł"), Equals, 2)
+	c.Assert(smsSegments(strings.Repeat("a", 68)+"😀"), Equals, 1)
+	c.Assert(smsSegments(strings.Repeat("a", 69)+"😀"), Equals, 2)
+}
+
+func (s *SMSViaTwilioNotifierSuite) TestTruncate(c *C) {
+	c.Assert(truncateSMS("short", 1), Equals, "short")
+
+	words := strings.Repeat("word ", 40)
+	truncated := truncateSMS(words, 1)
+	c.Assert(truncated, Equals, strings.Repeat("word ", 30)+"word...")
+	c.Assert(smsSegments(truncated), Equals, 1)
+
+	// A long word is cut rather than dropped.
+	long := strings.Repeat("x", 400)
+	c.Assert(truncateSMS(long, 2), Equals, strings.Repeat("x", 303)+"...")
+
+	unicode := strings.Repeat("ż", 200)
+	truncated = truncateSMS(unicode, 1)
+	c.Assert(truncated, Equals, strings.Repeat("ż", 67)+"...")
+	c.Assert(smsSegments(truncated), Equals, 1)
+}
+
+func (s *SMSViaTwilioNotifierSuite) TestSendTruncated(c *C) {
+	s.notification.Content = strings.Repeat("a very long line of content ", 50)
+
+	notifier := s.notifier(c)
+	notifier.config.MaxSegments = 1
+	c.Assert(notifier.Send([]Notification{s.notification}, s.jimmy), IsNil)
+
+	body := s.sent(c)[0].form.Get("Body")
+	c.Assert(strings.HasPrefix(body, "[alerts][db1] disk full\na very long line"), Equals, true)
+	c.Assert(strings.HasSuffix(body, "..."), Equals, true)
+	c.Assert(smsSegments(body), Equals, 1)
+}
+
+func (s *SMSViaTwilioNotifierSuite) TestSendManyTruncated(c *C) {
+	notifications := make([]Notification, 30)
+	for i := range notifications {
+		notifications[i] = s.notification
+	}
+
+	notifier := s.notifier(c)
+	notifier.config.MaxSegments = 1
+	c.Assert(notifier.Send(notifications, s.jimmy), IsNil)
+
+	body := s.sent(c)[0].form.Get("Body")
+	c.Assert(body, Equals, "[alerts] 30 notifications"+strings.Repeat("\n- [db1] disk full", 6)+"\n+24 more")
+	c.Assert(smsSegments(body), Equals, 1)
+}
+
+func (s *SMSViaTwilioNotifierSuite) TestInvalidConfigs(c *C) {
+	invalid := map[string]SMSViaTwilioConfig{
+		"AccountSID, AuthToken and From are required": {AccountSID: "AC123"},
+		"invalid base url 'localhost:8080'":           {BaseURL: "localhost:8080", AccountSID: "AC123", AuthToken: "t", From: "+1"},
+		"invalid base url 'ftp://api.example.com'":    {BaseURL: "ftp://api.example.com", AccountSID: "AC123", AuthToken: "t", From: "+1"},
+		"invalid MaxSegments -1":                      {AccountSID: "AC123", AuthToken: "t", From: "+1", MaxSegments: -1},
+	}
+
+	for expected, config := range invalid {
+		_, err := config.ToNotifier("sms")
+		c.Assert(err, ErrorMatches, expected)
+	}
+}
+
+func (s *SMSViaTwilioNotifierSuite) TestFactory(c *C) {
+	defer ClearAllNotifiers()
+
+	var config NotifiersConfig
+	c.Assert(json.Unmarshal([]byte(`[{"Name": "sms", "Type": "SMSViaTwilio", "Settings": {"AccountSID": "AC123", "AuthToken": "t0ken", "From": "+15559990000"}}]`), &config), IsNil)
+	c.Assert(config.HookAllNotifiers(), IsNil)
+
+	notifier, ok := GetNotifier("sms").(*SMSViaTwilioNotifier)
+	c.Assert(ok, Equals, true)
+	c.Assert(notifier.messagesURL(), Equals, "https://api.twilio.com/2010-04-01/Accounts/AC123/Messages.json")
+	c.Assert(notifier.config.MaxSegments, Equals, 3)
+}
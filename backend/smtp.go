@@ -0,0 +1,200 @@
+package backend
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/smtp"
+	"time"
+)
+
+// How the connection to the SMTP server is secured.
+const (
+	// Connect in plain text and upgrade with STARTTLS, which must be supported.
+	SMTPStartTLS = "starttls"
+
+	// Connect with TLS right away, usually on port 465.
+	SMTPImplicitTLS = "tls"
+
+	// Never use TLS. Only meant for servers on the same host.
+	SMTPPlaintext = "none"
+)
+
+// How to authenticate with the SMTP server.
+const (
+	SMTPAuthPlain   = "plain"
+	SMTPAuthLogin   = "login"
+	SMTPAuthCRAMMD5 = "cram-md5"
+	SMTPAuthNone    = "none"
+)
+
+const defaultSMTPTimeout = 30 * time.Second
+
+func newSMTPAuth(mechanism, username, password, hostname string) (smtp.Auth, error) {
+	switch mechanism {
+	case SMTPAuthPlain:
+		return smtp.PlainAuth("", username, password, hostname), nil
+	case SMTPAuthLogin:
+		return &loginAuth{username: username, password: password, hostname: hostname}, nil
+	case SMTPAuthCRAMMD5:
+		return smtp.CRAMMD5Auth(username, password), nil
+	case SMTPAuthNone:
+		return nil, nil
+	}
+
+	return nil, fmt.Errorf("unknown smtp auth mechanism '%s'", mechanism)
+}
+
+// The LOGIN mechanism, which net/smtp does not have but some servers only
+// support. Like PLAIN, it sends the password as is, so it is refused over
+// connections that are not encrypted unless the server is local.
+type loginAuth struct {
+	username string
+	password string
+	hostname string
+}
+
+func isLocalhost(name string) bool {
+	return name == "localhost" || name == "127.0.0.1" || name == "::1"
+}
+
+func (a *loginAuth) Start(server *smtp.ServerInfo) (string, []byte, error) {
+	if !server.TLS && !isLocalhost(server.Name) {
+		return "", nil, errors.New("unencrypted connection")
+	}
+
+	if server.Name != a.hostname {
+		return "", nil, errors.New("wrong host name")
+	}
+
+	return "LOGIN", nil, nil
+}
+
+func (a *loginAuth) Next(fromServer []byte, more bool) ([]byte, error) {
+	if !more {
+		return nil, nil
+	}
+
+	switch string(fromServer) {
+	case "Username:":
+		return []byte(a.username), nil
+	case "Password:":
+		return []byte(a.password), nil
+	}
+
+	return nil, fmt.Errorf("unexpected server challenge '%s'", fromServer)
+}
+
+// Reads the PEM encoded certificates to trust instead of the ones of the
+// system.
+func loadCABundle(path string) (*x509.CertPool, error) {
+	pem, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(pem) {
+		return nil, fmt.Errorf("no certificates found in '%s'", path)
+	}
+
+	return pool, nil
+}
+
+func (n *EmailViaSMTPNotifier) tlsConfig() *tls.Config {
+	return &tls.Config{
+		ServerName: n.Hostname,
+		RootCAs:    n.RootCAs,
+	}
+}
+
+// Like smtp.SendMail, but with the TLS mode, the CAs and the timeout of the
+// notifier. The timeout covers the whole conversation with the server, not
+// only connecting to it.
+func (n *EmailViaSMTPNotifier) smtpSendMail(addr string, a smtp.Auth, from string, to []string, msg []byte) error {
+	timeout := n.Timeout
+	if timeout == 0 {
+		timeout = defaultSMTPTimeout
+	}
+
+	dialer := &net.Dialer{Timeout: timeout}
+
+	var conn net.Conn
+	var err error
+	if n.TLSMode == SMTPImplicitTLS {
+		conn, err = tls.DialWithDialer(dialer, "tcp", addr, n.tlsConfig())
+	} else {
+		conn, err = dialer.Dial("tcp", addr)
+	}
+
+	if err != nil {
+		return err
+	}
+
+	err = conn.SetDeadline(time.Now().Add(timeout))
+	if err != nil {
+		conn.Close()
+		return err
+	}
+
+	client, err := smtp.NewClient(conn, n.Hostname)
+	if err != nil {
+		conn.Close()
+		return err
+	}
+	defer client.Close()
+
+	if n.TLSMode == SMTPStartTLS || n.TLSMode == "" {
+		if ok, _ := client.Extension("STARTTLS"); !ok {
+			return errors.New("smtp server does not support STARTTLS")
+		}
+
+		err = client.StartTLS(n.tlsConfig())
+		if err != nil {
+			return err
+		}
+	}
+
+	if a != nil {
+		if ok, _ := client.Extension("AUTH"); !ok {
+			return errors.New("smtp server does not support AUTH")
+		}
+
+		err = client.Auth(a)
+		if err != nil {
+			return err
+		}
+	}
+
+	err = client.Mail(from)
+	if err != nil {
+		return err
+	}
+
+	for _, addr := range to {
+		err = client.Rcpt(addr)
+		if err != nil {
+			return err
+		}
+	}
+
+	w, err := client.Data()
+	if err != nil {
+		return err
+	}
+
+	_, err = w.Write(msg)
+	if err != nil {
+		return err
+	}
+
+	err = w.Close()
+	if err != nil {
+		return err
+	}
+
+	return client.Quit()
+}
@@ -0,0 +1,451 @@
+package backend
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/hmac"
+	"crypto/md5"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"net"
+	"net/smtp"
+	"net/textproto"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	. "gopkg.in/check.v1"
+)
+
+const (
+	fakeSMTPUsername = "towncrier"
+	fakeSMTPPassword = "s3cret"
+)
+
+type fakeSMTPMessage struct {
+	from string
+	to   []string
+	data string
+	tls  bool
+	auth string
+}
+
+// Just enough of an SMTP server to test the notifier against, on 127.0.0.1.
+type fakeSMTPServer struct {
+	listener net.Listener
+
+	// Used for STARTTLS, or for every connection with implicitTLS.
+	tlsConfig   *tls.Config
+	implicitTLS bool
+	noStartTLS  bool
+
+	// Accepts connections but never says anything.
+	silent bool
+
+	sync.Mutex
+	messages []fakeSMTPMessage
+}
+
+func (s *fakeSMTPServer) start(c *C) {
+	var err error
+	if s.implicitTLS {
+		s.listener, err = tls.Listen("tcp", "127.0.0.1:0", s.tlsConfig)
+	} else {
+		s.listener, err = net.Listen("tcp", "127.0.0.1:0")
+	}
+	c.Assert(err, IsNil)
+
+	go func() {
+		for {
+			conn, err := s.listener.Accept()
+			if err != nil {
+				return
+			}
+
+			go s.serve(conn)
+		}
+	}()
+}
+
+func (s *fakeSMTPServer) port() int {
+	return s.listener.Addr().(*net.TCPAddr).Port
+}
+
+func (s *fakeSMTPServer) close() {
+	if s.listener != nil {
+		s.listener.Close()
+	}
+}
+
+func (s *fakeSMTPServer) received() []fakeSMTPMessage {
+	s.Lock()
+	defer s.Unlock()
+	return append([]fakeSMTPMessage{}, s.messages...)
+}
+
+func (s *fakeSMTPServer) serve(conn net.Conn) {
+	defer conn.Close()
+
+	if s.silent {
+		ioutil.ReadAll(conn)
+		return
+	}
+
+	_, isTLS := conn.(*tls.Conn)
+	text := textproto.NewConn(conn)
+	text.PrintfLine("220 fake ESMTP")
+
+	var message fakeSMTPMessage
+	for {
+		line, err := text.ReadLine()
+		if err != nil {
+			return
+		}
+
+		verb := strings.ToUpper(strings.SplitN(line, " ", 2)[0])
+		argument := strings.TrimSpace(line[len(verb):])
+
+		switch verb {
+		case "EHLO":
+			text.PrintfLine("250-fake")
+			if !isTLS && !s.noStartTLS && s.tlsConfig != nil {
+				text.PrintfLine("250-STARTTLS")
+			}
+			text.PrintfLine("250-AUTH PLAIN LOGIN CRAM-MD5")
+			text.PrintfLine("250 8BITMIME")
+		case "STARTTLS":
+			text.PrintfLine("220 ready")
+			tlsConn := tls.Server(conn, s.tlsConfig)
+			if tlsConn.Handshake() != nil {
+				return
+			}
+			conn = tlsConn
+			isTLS = true
+			text = textproto.NewConn(conn)
+		case "AUTH":
+			mechanism, ok := s.authenticate(text, argument)
+			if !ok {
+				text.PrintfLine("535 authentication failed")
+				continue
+			}
+			message.auth = mechanism
+			text.PrintfLine("235 authenticated")
+		case "MAIL":
+			message.from = parseSMTPPath(argument)
+			text.PrintfLine("250 ok")
+		case "RCPT":
+			message.to = append(message.to, parseSMTPPath(argument))
+			text.PrintfLine("250 ok")
+		case "DATA":
+			text.PrintfLine("354 go ahead")
+			data, err := ioutil.ReadAll(text.DotReader())
+			if err != nil {
+				return
+			}
+
+			message.data = string(data)
+			message.tls = isTLS
+			s.Lock()
+			s.messages = append(s.messages, message)
+			s.Unlock()
+			message = fakeSMTPMessage{auth: message.auth}
+			text.PrintfLine("250 queued")
+		case "QUIT":
+			text.PrintfLine("221 bye")
+			return
+		default:
+			text.PrintfLine("502 not implemented")
+		}
+	}
+}
+
+// The address in FROM:<address> or TO:<address>, without the parameters after
+// it.
+func parseSMTPPath(argument string) string {
+	start := strings.Index(argument, "<")
+	end := strings.Index(argument, ">")
+	if start < 0 || end < start {
+		return ""
+	}
+
+	return argument[start+1 : end]
+}
+
+func (s *fakeSMTPServer) authenticate(text *textproto.Conn, argument string) (string, bool) {
+	parts := strings.SplitN(argument, " ", 2)
+	mechanism := strings.ToUpper(parts[0])
+
+	readResponse := func(challenge string) (string, bool) {
+		text.PrintfLine("334 %s", base64.StdEncoding.EncodeToString([]byte(challenge)))
+		line, err := text.ReadLine()
+		if err != nil {
+			return "", false
+		}
+
+		decoded, err := base64.StdEncoding.DecodeString(line)
+		return string(decoded), err == nil
+	}
+
+	switch mechanism {
+	case "PLAIN":
+		var response string
+		if len(parts) == 2 {
+			decoded, err := base64.StdEncoding.DecodeString(parts[1])
+			if err != nil {
+				return mechanism, false
+			}
+			response = string(decoded)
+		} else {
+			var ok bool
+			if response, ok = readResponse(""); !ok {
+				return mechanism, false
+			}
+		}
+
+		return mechanism, response == "\x00"+fakeSMTPUsername+"\x00"+fakeSMTPPassword
+	case "LOGIN":
+		username, ok := readResponse("Username:")
+		if !ok {
+			return mechanism, false
+		}
+
+		password, ok := readResponse("Password:")
+		return mechanism, ok && username == fakeSMTPUsername && password == fakeSMTPPassword
+	case "CRAM-MD5":
+		challenge := "<1234.5678@fake>"
+		response, ok := readResponse(challenge)
+		if !ok {
+			return mechanism, false
+		}
+
+		d := hmac.New(md5.New, []byte(fakeSMTPPassword))
+		d.Write([]byte(challenge))
+		return mechanism, response == fakeSMTPUsername+" "+hex.EncodeToString(d.Sum(nil))
+	}
+
+	return mechanism, false
+}
+
+// A self signed certificate for 127.0.0.1, and the path of a CA bundle with
+// it.
+func generateTestCertificate(c *C) (tls.Certificate, string) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	c.Assert(err, IsNil)
+
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "fake smtp"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+		IPAddresses:           []net.IP{net.ParseIP("127.0.0.1")},
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	c.Assert(err, IsNil)
+
+	caFile := filepath.Join(c.MkDir(), "ca.pem")
+	certPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+	c.Assert(ioutil.WriteFile(caFile, certPEM, 0644), IsNil)
+
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key}, caFile
+}
+
+type SMTPSuite struct {
+	server *fakeSMTPServer
+	caFile string
+
+	notification Notification
+	jimmy        Subscriber
+}
+
+var _ = Suite(&SMTPSuite{})
+
+func (s *SMTPSuite) SetUpTest(c *C) {
+	certificate, caFile := generateTestCertificate(c)
+	s.caFile = caFile
+	s.server = &fakeSMTPServer{
+		tlsConfig: &tls.Config{Certificates: []tls.Certificate{certificate}},
+	}
+
+	s.notification = Notification{
+		Subject: "subject",
+		Content: "content abc",
+		Channel: "channel",
+		Origin:  "origin",
+	}
+
+	s.jimmy = Subscriber{
+		UniqueName: "jimmy",
+		Email:      "jimmy@the.cat",
+	}
+}
+
+func (s *SMTPSuite) TearDownTest(c *C) {
+	s.server.close()
+}
+
+func (s *SMTPSuite) config() EmailViaSMTPConfig {
+	return EmailViaSMTPConfig{
+		Host:      "127.0.0.1",
+		Port:      s.server.port(),
+		Username:  fakeSMTPUsername,
+		Password:  fakeSMTPPassword,
+		SelfEmail: testSelfEmail,
+		CAFile:    s.caFile,
+	}
+}
+
+func (s *SMTPSuite) send(c *C, config EmailViaSMTPConfig) error {
+	notifier, err := config.ToNotifier()
+	c.Assert(err, IsNil)
+
+	return notifier.Send([]Notification{s.notification}, s.jimmy)
+}
+
+func (s *SMTPSuite) TestStartTLSWithPlainAuth(c *C) {
+	s.server.start(c)
+
+	c.Assert(s.send(c, s.config()), IsNil)
+
+	messages := s.server.received()
+	c.Assert(messages, HasLen, 1)
+	c.Assert(messages[0].from, Equals, testSelfEmail)
+	c.Assert(messages[0].to, DeepEquals, []string{s.jimmy.Email})
+	c.Assert(messages[0].tls, Equals, true)
+	c.Assert(messages[0].auth, Equals, "PLAIN")
+	c.Assert(strings.Contains(messages[0].data, "Subject: [channel][origin] subject\n"), Equals, true)
+	c.Assert(strings.Contains(messages[0].data, "content abc"), Equals, true)
+}
+
+func (s *SMTPSuite) TestImplicitTLSWithLoginAuth(c *C) {
+	s.server.implicitTLS = true
+	s.server.start(c)
+
+	config := s.config()
+	config.TLSMode = "tls"
+	config.AuthMechanism = "login"
+	c.Assert(s.send(c, config), IsNil)
+
+	messages := s.server.received()
+	c.Assert(messages, HasLen, 1)
+	c.Assert(messages[0].tls, Equals, true)
+	c.Assert(messages[0].auth, Equals, "LOGIN")
+}
+
+func (s *SMTPSuite) TestPlaintextWithCRAMMD5Auth(c *C) {
+	s.server.start(c)
+
+	config := s.config()
+	config.TLSMode = "none"
+	config.AuthMechanism = "cram-md5"
+	c.Assert(s.send(c, config), IsNil)
+
+	messages := s.server.received()
+	c.Assert(messages, HasLen, 1)
+	c.Assert(messages[0].tls, Equals, false)
+	c.Assert(messages[0].auth, Equals, "CRAM-MD5")
+}
+
+func (s *SMTPSuite) TestPlaintextWithoutAuth(c *C) {
+	s.server.start(c)
+
+	config := s.config()
+	config.TLSMode = "none"
+	config.Username = ""
+	config.Password = ""
+	c.Assert(s.send(c, config), IsNil)
+
+	messages := s.server.received()
+	c.Assert(messages, HasLen, 1)
+	c.Assert(messages[0].auth, Equals, "")
+}
+
+func (s *SMTPSuite) TestWrongPassword(c *C) {
+	s.server.start(c)
+
+	config := s.config()
+	config.Password = "wrong"
+	err := s.send(c, config)
+	c.Assert(err, ErrorMatches, `535 .*authentication failed.*`)
+	c.Assert(s.server.received(), HasLen, 0)
+}
+
+func (s *SMTPSuite) TestStartTLSNotSupported(c *C) {
+	s.server.noStartTLS = true
+	s.server.start(c)
+
+	err := s.send(c, s.config())
+	c.Assert(err, ErrorMatches, "smtp server does not support STARTTLS")
+	c.Assert(s.server.received(), HasLen, 0)
+}
+
+func (s *SMTPSuite) TestUntrustedCertificate(c *C) {
+	s.server.start(c)
+
+	config := s.config()
+	config.CAFile = ""
+	err := s.send(c, config)
+	c.Assert(err, ErrorMatches, ".*certificate.*")
+	c.Assert(s.server.received(), HasLen, 0)
+}
+
+func (s *SMTPSuite) TestTimeout(c *C) {
+	s.server.silent = true
+	s.server.start(c)
+
+	notifier, err := s.config().ToNotifier()
+	c.Assert(err, IsNil)
+	notifier.Timeout = 100 * time.Millisecond
+
+	start := time.Now()
+	err = notifier.Send([]Notification{s.notification}, s.jimmy)
+	c.Assert(err, ErrorMatches, ".*i/o timeout")
+	c.Assert(time.Since(start) < 5*time.Second, Equals, true)
+}
+
+func (s *SMTPSuite) TestConfigDefaults(c *C) {
+	notifier, err := EmailViaSMTPConfig{Username: "user", Password: "password", SelfEmail: testSelfEmail}.ToNotifier()
+	c.Assert(err, IsNil)
+	c.Assert(notifier.addr(), Equals, "smtp.gmail.com:587")
+	c.Assert(notifier.TLSMode, Equals, SMTPStartTLS)
+	c.Assert(notifier.Authenticator, DeepEquals, smtp.PlainAuth("", "user", "password", "smtp.gmail.com"))
+	c.Assert(notifier.RootCAs, IsNil)
+
+	notifier, err = EmailViaSMTPConfig{Host: "mail.example.com", TLSMode: "tls"}.ToNotifier()
+	c.Assert(err, IsNil)
+	c.Assert(notifier.addr(), Equals, "mail.example.com:465")
+	c.Assert(notifier.Authenticator, IsNil)
+
+	notifier, err = EmailViaSMTPConfig{Host: "mail.example.com", Port: 2525, TimeoutSeconds: 5}.ToNotifier()
+	c.Assert(err, IsNil)
+	c.Assert(notifier.addr(), Equals, "mail.example.com:2525")
+	c.Assert(notifier.Timeout, Equals, 5*time.Second)
+}
+
+func (s *SMTPSuite) TestConfigInvalid(c *C) {
+	_, err := EmailViaSMTPConfig{TLSMode: "ssl"}.ToNotifier()
+	c.Assert(err, ErrorMatches, "unknown smtp tls mode 'ssl'")
+
+	_, err = EmailViaSMTPConfig{AuthMechanism: "xoauth2"}.ToNotifier()
+	c.Assert(err, ErrorMatches, "unknown smtp auth mechanism 'xoauth2'")
+
+	_, err = EmailViaSMTPConfig{CAFile: "missing.pem"}.ToNotifier()
+	c.Assert(err, ErrorMatches, "open missing.pem: no such file or directory")
+
+	notCA := filepath.Join(c.MkDir(), "empty.pem")
+	c.Assert(ioutil.WriteFile(notCA, []byte("not a certificate"), 0644), IsNil)
+	_, err = EmailViaSMTPConfig{CAFile: notCA}.ToNotifier()
+	c.Assert(err, ErrorMatches, "no certificates found in '.*'")
+}
@@ -0,0 +1,278 @@
+package backend
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"text/template"
+	"time"
+)
+
+const WebhookNotifierType = "Webhook"
+
+func init() {
+	RegisterNotifierFactory(WebhookNotifierType, func(name string, settings json.RawMessage) (Notifier, error) {
+		var config WebhookConfig
+		err := DecodeNotifierSettings(settings, &config)
+		if err != nil {
+			return nil, err
+		}
+
+		return config.ToNotifier(name)
+	})
+}
+
+// Sends the notifications as an HTTP request, to push them into systems that
+// know nothing about towncrier.
+//
+// The body and the values of the headers are text/template templates, given
+// the notifications sent together as .Notifications, the subscriber they are
+// sent to as .Subscriber and their channel as .Channel. They can use the
+// functions json, to encode a value as JSON, time, to format a UnixNano time
+// such as .CreatedAt as RFC3339, and join. For example:
+//
+//     {"text": {{json (printf "[%s] %s" .Channel (index .Notifications 0).Subject)}}}
+//
+// Without a body template, the body is the JSON of webhookPayloadJSON.
+type WebhookConfig struct {
+	URL string
+
+	// Defaults to POST.
+	Method string
+
+	BodyTemplate string
+
+	// Content-Type defaults to application/json.
+	Headers map[string]string
+
+	// Sent as an Authorization header, either as a bearer token or with basic
+	// auth.
+	BearerToken       string
+	BasicAuthUsername string
+	BasicAuthPassword string
+
+	// Defaults to 30 seconds.
+	TimeoutSeconds int
+
+	// The statuses that mean the notifications were received. Defaults to any
+	// 2xx status.
+	SuccessStatusCodes []int
+}
+
+type WebhookNotifier struct {
+	name    string
+	config  WebhookConfig
+	body    *template.Template
+	headers map[string]*template.Template
+	client  *http.Client
+}
+
+var webhookTemplateFuncs = template.FuncMap{
+	"json": func(v interface{}) (string, error) {
+		encoded, err := json.Marshal(v)
+		return string(encoded), err
+	},
+	"time": func(unixNano int64) string {
+		return time.Unix(0, unixNano).UTC().Format(time.RFC3339)
+	},
+	"join": strings.Join,
+}
+
+func validateWebhookURL(rawURL string) error {
+	if !isHTTPURL(rawURL) {
+		return fmt.Errorf("invalid webhook url '%s'", rawURL)
+	}
+
+	return nil
+}
+
+func (c WebhookConfig) ToNotifier(name string) (*WebhookNotifier, error) {
+	err := validateWebhookURL(c.URL)
+	if err != nil {
+		return nil, err
+	}
+
+	if c.Method == "" {
+		c.Method = "POST"
+	}
+
+	if c.BearerToken != "" && c.BasicAuthUsername != "" {
+		return nil, fmt.Errorf("only one of BearerToken and BasicAuthUsername can be set")
+	}
+
+	n := &WebhookNotifier{
+		name:    name,
+		config:  c,
+		headers: make(map[string]*template.Template),
+	}
+
+	if c.BodyTemplate != "" {
+		n.body, err = template.New("body").Funcs(webhookTemplateFuncs).Parse(c.BodyTemplate)
+		if err != nil {
+			return nil, fmt.Errorf("invalid body template: %v", err)
+		}
+	}
+
+	for header, value := range c.Headers {
+		n.headers[header], err = template.New(header).Funcs(webhookTemplateFuncs).Parse(value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid template for header %s: %v", header, err)
+		}
+	}
+
+	n.client = newHTTPNotifierClient(c.TimeoutSeconds)
+
+	return n, nil
+}
+
+func (n *WebhookNotifier) Name() string {
+	return n.name
+}
+
+type webhookTemplateData struct {
+	Notifications []Notification
+	Subscriber    Subscriber
+	Channel       string
+}
+
+type webhookSubscriberJSON struct {
+	UniqueName  string `json:"unique_name"`
+	Name        string `json:"name"`
+	Email       string `json:"email"`
+	PhoneNumber string `json:"phone_number"`
+}
+
+type webhookNotificationJSON struct {
+	Channel   string            `json:"channel"`
+	Subject   string            `json:"subject"`
+	Content   string            `json:"content"`
+	Origin    string            `json:"origin"`
+	Tags      []string          `json:"tags"`
+	Labels    map[string]string `json:"labels"`
+	Priority  string            `json:"priority"`
+	CreatedAt string            `json:"created_at"` // RFC3339
+}
+
+// The body sent without a body template.
+type webhookPayloadJSON struct {
+	Channel       string                    `json:"channel"`
+	Subscriber    webhookSubscriberJSON     `json:"subscriber"`
+	Notifications []webhookNotificationJSON `json:"notifications"`
+}
+
+func newWebhookPayloadJSON(data webhookTemplateData) webhookPayloadJSON {
+	payload := webhookPayloadJSON{
+		Channel: data.Channel,
+		Subscriber: webhookSubscriberJSON{
+			UniqueName:  data.Subscriber.UniqueName,
+			Name:        data.Subscriber.Name,
+			Email:       data.Subscriber.Email,
+			PhoneNumber: data.Subscriber.PhoneNumber,
+		},
+		Notifications: make([]webhookNotificationJSON, len(data.Notifications)),
+	}
+
+	for i, notification := range data.Notifications {
+		tags := notification.Tags
+		if tags == nil {
+			tags = []string{}
+		}
+
+		labels := notification.Labels
+		if labels == nil {
+			labels = map[string]string{}
+		}
+
+		payload.Notifications[i] = webhookNotificationJSON{
+			Channel:   notification.Channel,
+			Subject:   notification.Subject,
+			Content:   notification.Content,
+			Origin:    notification.Origin,
+			Tags:      tags,
+			Labels:    labels,
+			Priority:  notification.Priority.String(),
+			CreatedAt: time.Unix(0, notification.CreatedAt).UTC().Format(time.RFC3339),
+		}
+	}
+
+	return payload
+}
+
+func (n *WebhookNotifier) render(data webhookTemplateData) ([]byte, error) {
+	if n.body == nil {
+		return json.Marshal(newWebhookPayloadJSON(data))
+	}
+
+	var body bytes.Buffer
+	err := n.body.Execute(&body, data)
+	if err != nil {
+		return nil, fmt.Errorf("cannot render the body: %v", err)
+	}
+
+	return body.Bytes(), nil
+}
+
+func (n *WebhookNotifier) newRequest(data webhookTemplateData) (*http.Request, error) {
+	body, err := n.render(data)
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequest(n.config.Method, n.config.URL, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+	for header, value := range n.headers {
+		var rendered bytes.Buffer
+		err = value.Execute(&rendered, data)
+		if err != nil {
+			return nil, fmt.Errorf("cannot render header %s: %v", header, err)
+		}
+
+		req.Header.Set(header, rendered.String())
+	}
+
+	if n.config.BearerToken != "" {
+		req.Header.Set("Authorization", "Bearer "+n.config.BearerToken)
+	} else if n.config.BasicAuthUsername != "" {
+		req.SetBasicAuth(n.config.BasicAuthUsername, n.config.BasicAuthPassword)
+	}
+
+	return req, nil
+}
+
+func (n *WebhookNotifier) isSuccess(status int) bool {
+	if len(n.config.SuccessStatusCodes) == 0 {
+		return isSuccessStatus(status)
+	}
+
+	for _, code := range n.config.SuccessStatusCodes {
+		if status == code {
+			return true
+		}
+	}
+
+	return false
+}
+
+// All the notifications are sent in one request.
+func (n *WebhookNotifier) Send(notifications []Notification, subscriber Subscriber) error {
+	if len(notifications) == 0 {
+		return nil
+	}
+
+	req, err := n.newRequest(webhookTemplateData{
+		Notifications: notifications,
+		Subscriber:    subscriber,
+		Channel:       notifications[0].Channel,
+	})
+	if err != nil {
+		return err
+	}
+
+	return postAndCheck(n.client, req, "webhook", n.isSuccess)
+}
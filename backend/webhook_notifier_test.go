@@ -0,0 +1,173 @@
+package backend
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+
+	. "gopkg.in/check.v1"
+)
+
+type WebhookNotifierSuite struct {
+	httpNotifierSuite
+
+	notification Notification
+	jimmy        Subscriber
+}
+
+var _ = Suite(&WebhookNotifierSuite{})
+
+func (s *WebhookNotifierSuite) SetUpTest(c *C) {
+	s.server = newRecordingServer(http.StatusOK, "the answer\n")
+
+	createdAt, err := time.Parse(time.RFC3339, testStandardTime)
+	c.Assert(err, IsNil)
+
+	s.notification = Notification{
+		Subject:   "subject",
+		Content:   "content \"abc\"",
+		Channel:   "channel",
+		Origin:    "origin",
+		Tags:      []string{"tag1", "tag2"},
+		Priority:  UrgentPriority,
+		CreatedAt: createdAt.UnixNano(),
+	}
+
+	s.jimmy = Subscriber{
+		UniqueName: "jimmy",
+		Name:       "Jimmy the Cat",
+		Email:      "jimmy@the.cat",
+	}
+}
+
+func (s *WebhookNotifierSuite) notifier(c *C, config WebhookConfig) *WebhookNotifier {
+	config.URL = s.server.URL + "/hook"
+	notifier, err := config.ToNotifier("hook")
+	c.Assert(err, IsNil)
+	return notifier
+}
+
+func (s *WebhookNotifierSuite) TestDefaultPayload(c *C) {
+	notifier := s.notifier(c, WebhookConfig{})
+	c.Assert(notifier.Name(), Equals, "hook")
+
+	err := notifier.Send([]Notification{s.notification, s.notification}, s.jimmy)
+	c.Assert(err, IsNil)
+
+	requests := s.server.recorded()
+	c.Assert(requests, HasLen, 1)
+	c.Assert(requests[0].method, Equals, "POST")
+	c.Assert(requests[0].header.Get("Content-Type"), Equals, "application/json")
+
+	var payload webhookPayloadJSON
+	c.Assert(json.Unmarshal([]byte(requests[0].body), &payload), IsNil)
+	c.Assert(payload.Channel, Equals, "channel")
+	c.Assert(payload.Subscriber, DeepEquals, webhookSubscriberJSON{UniqueName: "jimmy", Name: "Jimmy the Cat", Email: "jimmy@the.cat"})
+	c.Assert(payload.Notifications, HasLen, 2)
+	c.Assert(payload.Notifications[0], DeepEquals, webhookNotificationJSON{
+		Channel:   "channel",
+		Subject:   "subject",
+		Content:   "content \"abc\"",
+		Origin:    "origin",
+		Tags:      []string{"tag1", "tag2"},
+		Labels:    map[string]string{},
+		Priority:  "urgent",
+		CreatedAt: testStandardTime,
+	})
+}
+
+func (s *WebhookNotifierSuite) TestTemplates(c *C) {
+	notifier := s.notifier(c, WebhookConfig{
+		Method:       "PUT",
+		BodyTemplate: `{"to": {{json .Subscriber.Email}}, "lines": [{{range $i, $n := .Notifications}}{{if $i}}, {{end}}{{json (printf "%s %s: %s (%s)" (time $n.CreatedAt) $n.Priority $n.Content (join $n.Tags ","))}}{{end}}]}`,
+		Headers: map[string]string{
+			"Content-Type": "application/vnd.alerts+json",
+			"X-Channel":    "{{.Channel}}",
+			"X-Count":      "{{len .Notifications}}",
+		},
+		BearerToken: "t0ken",
+	})
+
+	err := notifier.Send([]Notification{s.notification}, s.jimmy)
+	c.Assert(err, IsNil)
+
+	requests := s.server.recorded()
+	c.Assert(requests, HasLen, 1)
+	c.Assert(requests[0].method, Equals, "PUT")
+	c.Assert(requests[0].body, Equals, `{"to": "jimmy@the.cat", "lines": ["2015-09-05T00:15:00Z urgent: content \"abc\" (tag1,tag2)"]}`)
+	c.Assert(requests[0].header.Get("Content-Type"), Equals, "application/vnd.alerts+json")
+	c.Assert(requests[0].header.Get("X-Channel"), Equals, "channel")
+	c.Assert(requests[0].header.Get("X-Count"), Equals, "1")
+	c.Assert(requests[0].header.Get("Authorization"), Equals, "Bearer t0ken")
+}
+
+func (s *WebhookNotifierSuite) TestBasicAuth(c *C) {
+	notifier := s.notifier(c, WebhookConfig{BasicAuthUsername: "user", BasicAuthPassword: "password"})
+
+	c.Assert(notifier.Send([]Notification{s.notification}, s.jimmy), IsNil)
+	c.Assert(s.server.recorded()[0].header.Get("Authorization"), Equals, "Basic dXNlcjpwYXNzd29yZA==")
+}
+
+func (s *WebhookNotifierSuite) TestFailureStatus(c *C) {
+	s.server.answer(http.StatusInternalServerError, "the answer\n")
+	notifier := s.notifier(c, WebhookConfig{})
+
+	err := notifier.Send([]Notification{s.notification}, s.jimmy)
+	c.Assert(err, ErrorMatches, "webhook answered 500 Internal Server Error: the answer")
+}
+
+func (s *WebhookNotifierSuite) TestSuccessStatusCodes(c *C) {
+	s.server.answer(http.StatusAccepted, "the answer\n")
+	notifier := s.notifier(c, WebhookConfig{SuccessStatusCodes: []int{http.StatusNoContent}})
+
+	err := notifier.Send([]Notification{s.notification}, s.jimmy)
+	c.Assert(err, ErrorMatches, "webhook answered 202 Accepted: the answer")
+
+	s.server.answer(http.StatusNoContent, "")
+	c.Assert(notifier.Send([]Notification{s.notification}, s.jimmy), IsNil)
+}
+
+func (s *WebhookNotifierSuite) TestTimeout(c *C) {
+	s.server.answerAfter(200 * time.Millisecond)
+	notifier := s.notifier(c, WebhookConfig{})
+	notifier.client.Timeout = 50 * time.Millisecond
+
+	err := notifier.Send([]Notification{s.notification}, s.jimmy)
+	c.Assert(err, ErrorMatches, ".*Client.Timeout exceeded.*")
+}
+
+func (s *WebhookNotifierSuite) TestTemplateError(c *C) {
+	notifier := s.notifier(c, WebhookConfig{BodyTemplate: "{{.Missing}}"})
+
+	err := notifier.Send([]Notification{s.notification}, s.jimmy)
+	c.Assert(err, ErrorMatches, "cannot render the body: .*can't evaluate field Missing.*")
+	c.Assert(s.server.recorded(), HasLen, 0)
+}
+
+func (s *WebhookNotifierSuite) TestInvalidConfigs(c *C) {
+	invalid := map[string]WebhookConfig{
+		"invalid webhook url ''":                           {},
+		"invalid webhook url 'ftp://example.com'":          {URL: "ftp://example.com"},
+		"invalid body template: .*":                        {URL: "http://example.com", BodyTemplate: "{{.Subject"},
+		"invalid template for header X-Test: .*":           {URL: "http://example.com", Headers: map[string]string{"X-Test": "{{end}}"}},
+		"only one of BearerToken and BasicAuthUsername .*": {URL: "http://example.com", BearerToken: "a", BasicAuthUsername: "b"},
+	}
+
+	for expected, config := range invalid {
+		_, err := config.ToNotifier("hook")
+		c.Assert(err, ErrorMatches, expected)
+	}
+}
+
+func (s *WebhookNotifierSuite) TestFactory(c *C) {
+	defer ClearAllNotifiers()
+
+	var config NotifiersConfig
+	c.Assert(json.Unmarshal([]byte(`[{"Name": "ops", "Type": "Webhook", "Settings": {"URL": "`+s.server.URL+`", "Method": "PATCH", "TimeoutSeconds": 5}}]`), &config), IsNil)
+	c.Assert(config.HookAllNotifiers(), IsNil)
+
+	notifier, ok := GetNotifier("ops").(*WebhookNotifier)
+	c.Assert(ok, Equals, true)
+	c.Assert(notifier.config.Method, Equals, "PATCH")
+	c.Assert(notifier.client.Timeout, Equals, 5*time.Second)
+}
@@ -5,25 +5,21 @@ import (
 	"os"
 
 	"gitlab.com/shuhao/towncrier/backend"
+	"gitlab.com/shuhao/towncrier/webfeed"
 	"gitlab.com/shuhao/towncrier/webreceiver"
 )
 
-type NotifiersConfig struct {
-	EmailViaSMTP backend.EmailViaSMTPConfig
-}
-
-func (nc NotifiersConfig) HookAllNotifiers() {
-	backend.RegisterNotifier(nc.EmailViaSMTP.ToNotifier())
-}
-
 type ApplicationConfig struct {
 	BackendName       string
 	BackendOpenString string
 
 	Receiver webreceiver.ReceiverConfig
-	// Feed webfeed.FeedConfig
 
-	Notifiers NotifiersConfig
+	// The dashboard is not served if its ListenPort is not set.
+	Feed webfeed.FeedConfig
+
+	// The channels refer to the notifiers by their names.
+	Notifiers backend.NotifiersConfig
 }
 
 func NewApplicationConfig(path string) (*ApplicationConfig, error) {
@@ -0,0 +1,17 @@
+-- +goose Up
+-- SQL in section 'Up' is executed when this migration is applied
+
+CREATE TABLE outbox (
+  id INTEGER PRIMARY KEY ASC,
+  NotificationId INTEGER NOT NULL,
+  ClaimedUntil INTEGER DEFAULT 0,
+  CreatedAt INTEGER
+);
+
+CREATE UNIQUE INDEX outbox_notification ON outbox (NotificationId);
+
+-- +goose Down
+-- SQL section 'Down' is executed when this migration is rolled back
+
+DROP INDEX outbox_notification;
+DROP TABLE outbox;
@@ -0,0 +1,12 @@
+-- +goose Up
+-- SQL in section 'Up' is executed when this migration is applied
+
+CREATE TABLE channel_runs (
+  Channel VARCHAR(64) PRIMARY KEY,
+  LastRunAt INTEGER NOT NULL
+);
+
+-- +goose Down
+-- SQL section 'Down' is executed when this migration is rolled back
+
+DROP TABLE channel_runs;
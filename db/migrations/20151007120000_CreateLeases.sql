@@ -0,0 +1,13 @@
+-- +goose Up
+-- SQL in section 'Up' is executed when this migration is applied
+
+CREATE TABLE leases (
+  Name VARCHAR(64) PRIMARY KEY,
+  Holder VARCHAR(128) NOT NULL,
+  ExpiresAt INTEGER NOT NULL
+);
+
+-- +goose Down
+-- SQL section 'Down' is executed when this migration is rolled back
+
+DROP TABLE leases;
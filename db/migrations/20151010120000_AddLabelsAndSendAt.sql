@@ -0,0 +1,13 @@
+-- +goose Up
+-- SQL in section 'Up' is executed when this migration is applied
+
+ALTER TABLE notifications ADD COLUMN LabelsString TEXT;
+ALTER TABLE notifications ADD COLUMN SendAt INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE outbox ADD COLUMN NotBefore INTEGER NOT NULL DEFAULT 0;
+
+-- +goose Down
+-- SQL section 'Down' is executed when this migration is rolled back
+
+ALTER TABLE outbox DROP COLUMN NotBefore;
+ALTER TABLE notifications DROP COLUMN SendAt;
+ALTER TABLE notifications DROP COLUMN LabelsString;
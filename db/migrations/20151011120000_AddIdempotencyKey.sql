@@ -0,0 +1,11 @@
+-- +goose Up
+-- SQL in section 'Up' is executed when this migration is applied
+
+ALTER TABLE notifications ADD COLUMN IdempotencyKey VARCHAR(255) NOT NULL DEFAULT '';
+CREATE INDEX notifications_idempotency_key ON notifications (IdempotencyKey);
+
+-- +goose Down
+-- SQL section 'Down' is executed when this migration is rolled back
+
+DROP INDEX notifications_idempotency_key;
+ALTER TABLE notifications DROP COLUMN IdempotencyKey;
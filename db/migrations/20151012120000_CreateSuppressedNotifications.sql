@@ -0,0 +1,16 @@
+-- +goose Up
+-- SQL in section 'Up' is executed when this migration is applied
+
+CREATE TABLE suppressed_notifications (
+  Channel VARCHAR(64) NOT NULL,
+  Origin VARCHAR(128) NOT NULL,
+  Count INTEGER NOT NULL,
+  Since INTEGER NOT NULL,
+  SummarizeAt INTEGER NOT NULL,
+  PRIMARY KEY (Channel, Origin)
+);
+
+-- +goose Down
+-- SQL section 'Down' is executed when this migration is rolled back
+
+DROP TABLE suppressed_notifications;
@@ -0,0 +1,20 @@
+-- +goose Up
+-- SQL in section 'Up' is executed when this migration is applied
+
+CREATE TABLE notifications (
+  id BIGINT AUTO_INCREMENT PRIMARY KEY,
+  Channel VARCHAR(64) NOT NULL,
+  Subject TEXT NOT NULL,
+  Content TEXT,
+  Origin TEXT,
+  TagsString TEXT,
+  PriorityInt BIGINT,
+  Delivered BOOLEAN DEFAULT FALSE,
+  CreatedAt BIGINT,
+  UpdatedAt BIGINT
+) ENGINE=InnoDB DEFAULT CHARSET=utf8;
+
+-- +goose Down
+-- SQL section 'Down' is executed when this migration is rolled back
+
+DROP TABLE notifications;
@@ -0,0 +1,22 @@
+-- +goose Up
+-- SQL in section 'Up' is executed when this migration is applied
+
+CREATE TABLE deliveries (
+  id BIGINT AUTO_INCREMENT PRIMARY KEY,
+  NotificationId BIGINT NOT NULL,
+  Subscriber VARCHAR(128) NOT NULL,
+  Notifier VARCHAR(128) NOT NULL,
+  Status VARCHAR(16) NOT NULL,
+  Attempts BIGINT DEFAULT 0,
+  LastError TEXT,
+  NextAttemptAt BIGINT,
+  CreatedAt BIGINT,
+  UpdatedAt BIGINT,
+  UNIQUE INDEX deliveries_leg (NotificationId, Subscriber, Notifier),
+  INDEX deliveries_retry (Status, NextAttemptAt)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8;
+
+-- +goose Down
+-- SQL section 'Down' is executed when this migration is rolled back
+
+DROP TABLE deliveries;
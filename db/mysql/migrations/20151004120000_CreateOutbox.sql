@@ -0,0 +1,15 @@
+-- +goose Up
+-- SQL in section 'Up' is executed when this migration is applied
+
+CREATE TABLE outbox (
+  id BIGINT AUTO_INCREMENT PRIMARY KEY,
+  NotificationId BIGINT NOT NULL,
+  ClaimedUntil BIGINT DEFAULT 0,
+  CreatedAt BIGINT,
+  UNIQUE INDEX outbox_notification (NotificationId)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8;
+
+-- +goose Down
+-- SQL section 'Down' is executed when this migration is rolled back
+
+DROP TABLE outbox;
@@ -0,0 +1,25 @@
+-- +goose Up
+-- SQL in section 'Up' is executed when this migration is applied
+
+CREATE TABLE deliveries (
+  id BIGSERIAL PRIMARY KEY,
+  NotificationId BIGINT NOT NULL,
+  Subscriber VARCHAR(128) NOT NULL,
+  Notifier VARCHAR(128) NOT NULL,
+  Status VARCHAR(16) NOT NULL,
+  Attempts BIGINT DEFAULT 0,
+  LastError TEXT,
+  NextAttemptAt BIGINT,
+  CreatedAt BIGINT,
+  UpdatedAt BIGINT
+);
+
+CREATE UNIQUE INDEX deliveries_leg ON deliveries (NotificationId, Subscriber, Notifier);
+CREATE INDEX deliveries_retry ON deliveries (Status, NextAttemptAt);
+
+-- +goose Down
+-- SQL section 'Down' is executed when this migration is rolled back
+
+DROP INDEX deliveries_retry;
+DROP INDEX deliveries_leg;
+DROP TABLE deliveries;
@@ -0,0 +1,17 @@
+-- +goose Up
+-- SQL in section 'Up' is executed when this migration is applied
+
+CREATE TABLE outbox (
+  id BIGSERIAL PRIMARY KEY,
+  NotificationId BIGINT NOT NULL,
+  ClaimedUntil BIGINT DEFAULT 0,
+  CreatedAt BIGINT
+);
+
+CREATE UNIQUE INDEX outbox_notification ON outbox (NotificationId);
+
+-- +goose Down
+-- SQL section 'Down' is executed when this migration is rolled back
+
+DROP INDEX outbox_notification;
+DROP TABLE outbox;
@@ -19,14 +19,58 @@ post_notifications_via_curl() {
   tags=$4
   priority=$5
 
+  # The same key is sent with every retry so the notification is only queued
+  # once.
+  idempotency_key=$(cat /proc/sys/kernel/random/uuid 2>/dev/null || date +%s%N)
+
   # --data-binary is import for us to pass in the heredoc
   # @- is for getting data from stdin
-  curl -XPOST -v \
+  curl -XPOST -v --retry 3 \
     --header "Authorization: Token token=$token" \
     --header "X-Towncrier-Subject: $subject" \
     --header "X-Towncrier-Tags: $tags" \
     --header "X-Towncrier-Priority: $priority" \
+    --header "Idempotency-Key: $idempotency_key" \
     --header "Content-Type: text/plain" \
     --data-binary @- \
     $TOWNCRIER_BASE_URL/notifications/$channel
 }
+
+# The same as above, but the request is signed with the secret of the origin
+# instead of sending a token. Needs openssl.
+#
+# post_signed_notifications_via_curl origin secret channel subject tag1,tag2 normal <<REQ
+# Hello world!
+# REQ
+post_signed_notifications_via_curl() {
+  origin=$1
+  secret=$2
+  channel=$3
+  subject=$4
+  tags=$5
+  priority=$6
+
+  path_prefix=/${TOWNCRIER_BASE_URL#*://*/}
+  path=$path_prefix/notifications/$channel
+
+  body_file=$(mktemp)
+  cat > "$body_file"
+
+  timestamp=$(date +%s)
+  nonce=$(cat /proc/sys/kernel/random/uuid 2>/dev/null || date +%s%N)
+  body_hash=$(openssl dgst -sha256 -hex < "$body_file" | sed 's/^.* //')
+  signature=$(printf 'POST\n%s\n%s\n%s\n%s' "$path" "$timestamp" "$nonce" "$body_hash" \
+    | openssl dgst -sha256 -hmac "$secret" -hex | sed 's/^.* //')
+
+  # No retries, as the nonce cannot be used twice.
+  curl -XPOST -v \
+    --header "Authorization: Towncrier-HMAC-SHA256 origin=$origin, timestamp=$timestamp, nonce=$nonce, signature=$signature" \
+    --header "X-Towncrier-Subject: $subject" \
+    --header "X-Towncrier-Tags: $tags" \
+    --header "X-Towncrier-Priority: $priority" \
+    --header "Content-Type: text/plain" \
+    --data-binary @"$body_file" \
+    $TOWNCRIER_BASE_URL/notifications/$channel
+
+  rm -f "$body_file"
+}
@@ -10,7 +10,10 @@ import (
 	"sync"
 
 	"gitlab.com/shuhao/towncrier/backend"
+	_ "gitlab.com/shuhao/towncrier/mysql_backend"
+	_ "gitlab.com/shuhao/towncrier/postgres_backend"
 	_ "gitlab.com/shuhao/towncrier/sqlite_backend"
+	"gitlab.com/shuhao/towncrier/webfeed"
 	"gitlab.com/shuhao/towncrier/webreceiver"
 
 	"github.com/Sirupsen/logrus"
@@ -30,6 +33,10 @@ var logger = realLogger.WithField("component", "main")
 func init() {
 	flag.StringVar(&configPath, "config", "", "the master config file for the server")
 	flag.StringVar(&pidPath, "pidfile", "", "the pid file path for the server")
+	flag.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: %s -config <path> [migrate up|down|status]\n", os.Args[0])
+		flag.PrintDefaults()
+	}
 	flag.Parse()
 
 	if configPath == "" || !pathExists(configPath) {
@@ -37,6 +44,26 @@ func init() {
 	}
 
 	var err error
+	applicationConfig, err = NewApplicationConfig(configPath)
+	if err != nil {
+		logger.WithField("error", err).Panic("cannot parse application config")
+	}
+}
+
+func main() {
+	if flag.Arg(0) == "migrate" {
+		err := migrateCommand(flag.Args()[1:])
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	serve()
+}
+
+func serve() {
 	pid := os.Getpid()
 	if pidPath != "" {
 		logger.WithFields(logrus.Fields{
@@ -44,25 +71,21 @@ func init() {
 			"pid":  pid,
 		}).Info("creating pid file")
 
-		err = ioutil.WriteFile(pidPath, []byte(strconv.Itoa(pid)), 0644)
+		err := ioutil.WriteFile(pidPath, []byte(strconv.Itoa(pid)), 0644)
 		if err != nil {
 			logger.WithField("error", err).Panic("cannot write to pid file")
 		}
 	}
 
-	applicationConfig, err = NewApplicationConfig(configPath)
+	err := applicationConfig.Notifiers.HookAllNotifiers()
 	if err != nil {
-		logger.WithField("error", err).Panic("cannot parse application config")
+		logger.WithField("error", err).Panic("cannot set up notifiers")
 	}
 
-	applicationConfig.Notifiers.HookAllNotifiers()
-}
-
-func main() {
 	wg := &sync.WaitGroup{}
 
 	notificationBackend := backend.GetBackend(applicationConfig.BackendName)
-	err := notificationBackend.Initialize(applicationConfig.BackendOpenString)
+	err = notificationBackend.Initialize(applicationConfig.BackendOpenString)
 	if err != nil {
 		logger.WithField("error", err).Panic("cannot initialize backend")
 	}
@@ -81,5 +104,15 @@ func main() {
 		Handler: receiverApp,
 	}
 
-	gracehttp.Serve(receiverServer)
+	servers := []*http.Server{receiverServer}
+
+	if applicationConfig.Feed.ListenPort != 0 {
+		feedApp := webfeed.NewApp(notificationBackend, applicationConfig.Feed)
+		servers = append(servers, &http.Server{
+			Addr:    fmt.Sprintf("%s:%d", applicationConfig.Feed.ListenHost, applicationConfig.Feed.ListenPort),
+			Handler: feedApp,
+		})
+	}
+
+	gracehttp.Serve(servers...)
 }
@@ -0,0 +1,158 @@
+// Counters, histograms and gauges exposed in the Prometheus text format. This
+// only implements what towncrier needs, so that the Prometheus client and its
+// dependencies do not have to be vendored.
+//
+// The metrics are registered globally when they are created, usually as
+// package variables, and are all written by Handler.
+package metrics
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/Sirupsen/logrus"
+)
+
+var realLogger = logrus.New()
+var logger = realLogger.WithField("component", "metrics")
+
+// The buckets of the histograms of durations, in seconds.
+var DefaultBuckets = []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}
+
+type metric interface {
+	name() string
+	write(w io.Writer) error
+}
+
+type registry struct {
+	sync.Mutex
+	metrics map[string]metric
+}
+
+var defaultRegistry = &registry{
+	metrics: make(map[string]metric),
+}
+
+// Panics if a metric already has the name, unless replace is set.
+func (r *registry) register(m metric, replace bool) {
+	r.Lock()
+	defer r.Unlock()
+
+	if _, found := r.metrics[m.name()]; found && !replace {
+		panic(fmt.Sprintf("metric %s is already registered", m.name()))
+	}
+
+	r.metrics[m.name()] = m
+}
+
+// Writes every metric, sorted by name. A metric that fails to be collected is
+// left out rather than failing the others.
+func WriteTo(w io.Writer) error {
+	defaultRegistry.Lock()
+	metrics := make([]metric, 0, len(defaultRegistry.metrics))
+	for _, m := range defaultRegistry.metrics {
+		metrics = append(metrics, m)
+	}
+	defaultRegistry.Unlock()
+
+	sort.Sort(metricsByName(metrics))
+
+	for _, m := range metrics {
+		var buf bytes.Buffer
+		err := m.write(&buf)
+		if err != nil {
+			logger.WithFields(logrus.Fields{
+				"metric": m.name(),
+				"error":  err,
+			}).Error("failed to collect metric")
+			continue
+		}
+
+		_, err = buf.WriteTo(w)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var buf bytes.Buffer
+		WriteTo(&buf)
+
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		buf.WriteTo(w)
+	})
+}
+
+type metricsByName []metric
+
+func (m metricsByName) Len() int           { return len(m) }
+func (m metricsByName) Swap(i, j int)      { m[i], m[j] = m[j], m[i] }
+func (m metricsByName) Less(i, j int) bool { return m[i].name() < m[j].name() }
+
+var helpEscaper = strings.NewReplacer(`\`, `\\`, "\n", `\n`)
+var labelValueEscaper = strings.NewReplacer(`\`, `\\`, "\n", `\n`, `"`, `\"`)
+
+func formatFloat(v float64) string {
+	switch {
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	case math.IsNaN(v):
+		return "NaN"
+	}
+
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+// Formats {name="value",...}, or nothing without labels.
+func formatLabels(names, values []string) string {
+	if len(names) == 0 {
+		return ""
+	}
+
+	pairs := make([]string, len(names))
+	for i, name := range names {
+		pairs[i] = name + `="` + labelValueEscaper.Replace(values[i]) + `"`
+	}
+
+	return "{" + strings.Join(pairs, ",") + "}"
+}
+
+func writeHeader(w io.Writer, name, help, metricType string) error {
+	_, err := fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", name, helpEscaper.Replace(help), name, metricType)
+	return err
+}
+
+// The values of a metric are kept by their label values, joined with a byte
+// that is not valid UTF-8 and so is not expected in them.
+func labelKey(values []string) string {
+	return strings.Join(values, "\xff")
+}
+
+func checkLabelValues(name string, labels, values []string) {
+	if len(labels) != len(values) {
+		panic(fmt.Sprintf("metric %s has %d labels, got %d values", name, len(labels), len(values)))
+	}
+}
+
+// The values of the label keys, sorted so the output is stable.
+func sortedKeys(values map[string][]string) []string {
+	keys := make([]string, 0, len(values))
+	for key := range values {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
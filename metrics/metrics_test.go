@@ -0,0 +1,114 @@
+package metrics
+
+import (
+	"bytes"
+	"errors"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	. "gopkg.in/check.v1"
+)
+
+func Test(t *testing.T) {
+	TestingT(t)
+}
+
+type MetricsSuite struct{}
+
+var _ = Suite(&MetricsSuite{})
+
+func (s *MetricsSuite) SetUpTest(c *C) {
+	defaultRegistry = &registry{
+		metrics: make(map[string]metric),
+	}
+}
+
+func (s *MetricsSuite) write(c *C) string {
+	var buf bytes.Buffer
+	c.Assert(WriteTo(&buf), IsNil)
+	return buf.String()
+}
+
+func (s *MetricsSuite) TestCounterVec(c *C) {
+	counter := NewCounterVec("test_total", "A test\ncounter.", "channel", "code")
+	counter.Inc("b", "202")
+	counter.Inc("a", "202")
+	counter.Add(2.5, "a", "202")
+	counter.Inc(`we"ird\`+"\n", "404")
+
+	c.Assert(counter.Value("a", "202"), Equals, 3.5)
+	c.Assert(counter.Value("c", "202"), Equals, 0.0)
+	c.Assert(s.write(c), Equals, `# HELP test_total A test\ncounter.
+# TYPE test_total counter
+test_total{channel="a",code="202"} 3.5
+test_total{channel="b",code="202"} 1
+test_total{channel="we\"ird\\\n",code="404"} 1
+`)
+
+	c.Assert(func() { counter.Inc("a") }, PanicMatches, "metric test_total has 2 labels, got 1 values")
+	c.Assert(func() { NewCounterVec("test_total", "Again.") }, PanicMatches, "metric test_total is already registered")
+}
+
+func (s *MetricsSuite) TestHistogramVec(c *C) {
+	histogram := NewHistogramVec("test_seconds", "A test histogram.", []float64{0.1, 1})
+	histogram.Observe(0.05)
+	histogram.Observe(0.5)
+	histogram.Observe(0.5)
+	histogram.Observe(5)
+
+	c.Assert(histogram.Count(), Equals, uint64(4))
+	c.Assert(s.write(c), Equals, `# HELP test_seconds A test histogram.
+# TYPE test_seconds histogram
+test_seconds_bucket{le="0.1"} 1
+test_seconds_bucket{le="1"} 3
+test_seconds_bucket{le="+Inf"} 4
+test_seconds_sum 6.05
+test_seconds_count 4
+`)
+}
+
+func (s *MetricsSuite) TestHistogramVecWithLabels(c *C) {
+	histogram := NewHistogramVec("test_seconds", "A test histogram.", []float64{1}, "notifier")
+	histogram.Observe(2, "email")
+
+	c.Assert(s.write(c), Equals, `# HELP test_seconds A test histogram.
+# TYPE test_seconds histogram
+test_seconds_bucket{notifier="email",le="1"} 0
+test_seconds_bucket{notifier="email",le="+Inf"} 1
+test_seconds_sum{notifier="email"} 2
+test_seconds_count{notifier="email"} 1
+`)
+}
+
+func (s *MetricsSuite) TestGaugeFunc(c *C) {
+	RegisterGaugeFunc("test_gauge", "Replaced.", nil, func() ([]Sample, error) {
+		return nil, nil
+	})
+	RegisterGaugeFunc("test_gauge", "A test gauge.", []string{"channel"}, func() ([]Sample, error) {
+		return []Sample{{LabelValues: []string{"a"}, Value: 2}, {LabelValues: []string{"b"}, Value: math.Inf(1)}}, nil
+	})
+	RegisterGaugeFunc("test_broken_gauge", "Fails to be collected.", nil, func() ([]Sample, error) {
+		return nil, errors.New("no database")
+	})
+	NewCounterVec("a_total", "Sorted first.")
+
+	c.Assert(s.write(c), Equals, `# HELP a_total Sorted first.
+# TYPE a_total counter
+# HELP test_gauge A test gauge.
+# TYPE test_gauge gauge
+test_gauge{channel="a"} 2
+test_gauge{channel="b"} +Inf
+`)
+}
+
+func (s *MetricsSuite) TestHandler(c *C) {
+	NewCounterVec("test_total", "A test counter.").Inc()
+
+	recorder := httptest.NewRecorder()
+	Handler().ServeHTTP(recorder, &http.Request{Method: "GET"})
+	c.Assert(recorder.Code, Equals, http.StatusOK)
+	c.Assert(recorder.Header().Get("Content-Type"), Equals, "text/plain; version=0.0.4; charset=utf-8")
+	c.Assert(recorder.Body.String(), Equals, "# HELP test_total A test counter.\n# TYPE test_total counter\ntest_total 1\n")
+}
@@ -0,0 +1,244 @@
+package metrics
+
+import (
+	"fmt"
+	"io"
+	"sync"
+)
+
+// A counter per combination of label values.
+type CounterVec struct {
+	sync.Mutex
+	metricName  string
+	help        string
+	labels      []string
+	labelValues map[string][]string
+	values      map[string]float64
+}
+
+func NewCounterVec(name, help string, labels ...string) *CounterVec {
+	c := &CounterVec{
+		metricName:  name,
+		help:        help,
+		labels:      labels,
+		labelValues: make(map[string][]string),
+		values:      make(map[string]float64),
+	}
+
+	defaultRegistry.register(c, false)
+	return c
+}
+
+func (c *CounterVec) name() string {
+	return c.metricName
+}
+
+func (c *CounterVec) Inc(labelValues ...string) {
+	c.Add(1, labelValues...)
+}
+
+func (c *CounterVec) Add(v float64, labelValues ...string) {
+	checkLabelValues(c.metricName, c.labels, labelValues)
+	key := labelKey(labelValues)
+
+	c.Lock()
+	defer c.Unlock()
+
+	if _, found := c.labelValues[key]; !found {
+		c.labelValues[key] = append([]string{}, labelValues...)
+	}
+	c.values[key] += v
+}
+
+// The current value, mostly for the tests.
+func (c *CounterVec) Value(labelValues ...string) float64 {
+	checkLabelValues(c.metricName, c.labels, labelValues)
+
+	c.Lock()
+	defer c.Unlock()
+	return c.values[labelKey(labelValues)]
+}
+
+func (c *CounterVec) write(w io.Writer) error {
+	c.Lock()
+	defer c.Unlock()
+
+	err := writeHeader(w, c.metricName, c.help, "counter")
+	if err != nil {
+		return err
+	}
+
+	for _, key := range sortedKeys(c.labelValues) {
+		_, err = fmt.Fprintf(w, "%s%s %s\n", c.metricName, formatLabels(c.labels, c.labelValues[key]), formatFloat(c.values[key]))
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+type histogram struct {
+	counts []uint64 // per bucket, not cumulative
+	count  uint64
+	sum    float64
+}
+
+// A histogram per combination of label values.
+type HistogramVec struct {
+	sync.Mutex
+	metricName  string
+	help        string
+	labels      []string
+	buckets     []float64 // upper bounds, sorted
+	labelValues map[string][]string
+	histograms  map[string]*histogram
+}
+
+func NewHistogramVec(name, help string, buckets []float64, labels ...string) *HistogramVec {
+	h := &HistogramVec{
+		metricName:  name,
+		help:        help,
+		labels:      labels,
+		buckets:     buckets,
+		labelValues: make(map[string][]string),
+		histograms:  make(map[string]*histogram),
+	}
+
+	defaultRegistry.register(h, false)
+	return h
+}
+
+func (h *HistogramVec) name() string {
+	return h.metricName
+}
+
+func (h *HistogramVec) Observe(v float64, labelValues ...string) {
+	checkLabelValues(h.metricName, h.labels, labelValues)
+	key := labelKey(labelValues)
+
+	h.Lock()
+	defer h.Unlock()
+
+	hist, found := h.histograms[key]
+	if !found {
+		hist = &histogram{counts: make([]uint64, len(h.buckets))}
+		h.histograms[key] = hist
+		h.labelValues[key] = append([]string{}, labelValues...)
+	}
+
+	for i, upperBound := range h.buckets {
+		if v <= upperBound {
+			hist.counts[i]++
+			break
+		}
+	}
+
+	hist.count++
+	hist.sum += v
+}
+
+// The number of observations, mostly for the tests.
+func (h *HistogramVec) Count(labelValues ...string) uint64 {
+	checkLabelValues(h.metricName, h.labels, labelValues)
+
+	h.Lock()
+	defer h.Unlock()
+
+	hist, found := h.histograms[labelKey(labelValues)]
+	if !found {
+		return 0
+	}
+	return hist.count
+}
+
+func (h *HistogramVec) write(w io.Writer) error {
+	h.Lock()
+	defer h.Unlock()
+
+	err := writeHeader(w, h.metricName, h.help, "histogram")
+	if err != nil {
+		return err
+	}
+
+	bucketLabels := append(append([]string{}, h.labels...), "le")
+
+	for _, key := range sortedKeys(h.labelValues) {
+		values := h.labelValues[key]
+		hist := h.histograms[key]
+
+		cumulative := uint64(0)
+		for i, upperBound := range h.buckets {
+			cumulative += hist.counts[i]
+			_, err = fmt.Fprintf(w, "%s_bucket%s %d\n", h.metricName, formatLabels(bucketLabels, append(append([]string{}, values...), formatFloat(upperBound))), cumulative)
+			if err != nil {
+				return err
+			}
+		}
+
+		labels := formatLabels(h.labels, values)
+		_, err = fmt.Fprintf(w, "%s_bucket%s %d\n%s_sum%s %s\n%s_count%s %d\n",
+			h.metricName, formatLabels(bucketLabels, append(append([]string{}, values...), "+Inf")), hist.count,
+			h.metricName, labels, formatFloat(hist.sum),
+			h.metricName, labels, hist.count)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// A value of a gauge, with the values of its labels in the order they were
+// given when registering it.
+type Sample struct {
+	LabelValues []string
+	Value       float64
+}
+
+// A gauge whose values are collected when the metrics are written, for what
+// is easier to look up than to keep track of.
+type gaugeFunc struct {
+	metricName string
+	help       string
+	labels     []string
+	collect    func() ([]Sample, error)
+}
+
+// Registers the gauge, replacing any gauge with the same name. This is so the
+// backends can register the gauges of their database whenever they are
+// initialized.
+func RegisterGaugeFunc(name, help string, labels []string, collect func() ([]Sample, error)) {
+	defaultRegistry.register(&gaugeFunc{
+		metricName: name,
+		help:       help,
+		labels:     labels,
+		collect:    collect,
+	}, true)
+}
+
+func (g *gaugeFunc) name() string {
+	return g.metricName
+}
+
+func (g *gaugeFunc) write(w io.Writer) error {
+	samples, err := g.collect()
+	if err != nil {
+		return err
+	}
+
+	err = writeHeader(w, g.metricName, g.help, "gauge")
+	if err != nil {
+		return err
+	}
+
+	for _, sample := range samples {
+		checkLabelValues(g.metricName, g.labels, sample.LabelValues)
+		_, err = fmt.Fprintf(w, "%s%s %s\n", g.metricName, formatLabels(g.labels, sample.LabelValues), formatFloat(sample.Value))
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+
+	"gitlab.com/shuhao/towncrier/backend"
+	"gitlab.com/shuhao/towncrier/schema"
+)
+
+// Implemented by the backends that keep their data in an SQL database.
+type migratableBackend interface {
+	OpenDatabase(openString string) (*sql.DB, error)
+	Migrations() *schema.Migrations
+}
+
+// towncrier -config <path> migrate up|down|status
+//
+// Runs against the database of the backend in the application config. The
+// backend migrates the database to the latest version on start anyway, this is
+// for rolling back or checking before upgrading.
+func migrateCommand(args []string) error {
+	if len(args) != 1 {
+		return fmt.Errorf("usage: migrate up|down|status")
+	}
+
+	b, ok := backend.GetBackend(applicationConfig.BackendName).(migratableBackend)
+	if !ok {
+		return fmt.Errorf("backend %s does not have a database to migrate", applicationConfig.BackendName)
+	}
+
+	db, err := b.OpenDatabase(applicationConfig.BackendOpenString)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	migrations := b.Migrations()
+
+	switch args[0] {
+	case "up":
+		return migrations.Up(db)
+	case "down":
+		return migrations.Down(db)
+	case "status":
+		return printMigrationStatus(migrations, db)
+	default:
+		return fmt.Errorf("unknown migrate command %s, expected up, down or status", args[0])
+	}
+}
+
+func printMigrationStatus(migrations *schema.Migrations, db *sql.DB) error {
+	statuses, err := migrations.Status(db)
+	if err != nil {
+		return err
+	}
+
+	version, err := migrations.Version(db)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("database version: %d\n", version)
+	for _, status := range statuses {
+		state := "pending"
+		if status.Applied {
+			state = "applied"
+		}
+
+		fmt.Printf("%-8s %s\n", state, status.Name)
+	}
+
+	return nil
+}
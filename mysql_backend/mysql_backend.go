@@ -0,0 +1,121 @@
+package mysql_backend
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+
+	"github.com/Sirupsen/logrus"
+	"github.com/go-sql-driver/mysql"
+	"gitlab.com/shuhao/towncrier/backend"
+	"gitlab.com/shuhao/towncrier/schema"
+	"gitlab.com/shuhao/towncrier/sql_backend"
+	"gopkg.in/gorp.v1"
+)
+
+const (
+	BackendName = "mysql"
+
+	// ER_DUP_ENTRY
+	duplicateEntryErrorNumber = 1062
+)
+
+type MySQLNotificationBackend struct {
+	*sql_backend.SQLNotificationBackend
+}
+
+var realLogger = logrus.New()
+var logger = realLogger.WithField("component", "mysql_backend")
+
+func init() {
+	notificationBackend := &MySQLNotificationBackend{
+		SQLNotificationBackend: &sql_backend.SQLNotificationBackend{
+			NeverSendNotifications: false,
+			IsUniqueViolation:      isUniqueViolation,
+		},
+	}
+
+	backend.RegisterBackend(notificationBackend)
+}
+
+func isUniqueViolation(err error) bool {
+	mysqlErr, ok := err.(*mysql.MySQLError)
+	return ok && mysqlErr.Number == duplicateEntryErrorNumber
+}
+
+// Initializes a new instance of the backend
+//
+// This function must be called once only after getting a backend as per the
+// NotificationBackend specification.
+//
+// The openString format is as follows:
+//
+//     <dsn>,<config_file_path>
+//
+// The dsn is anything go-sql-driver/mysql accepts, such as
+// user:password@tcp(localhost:3306)/towncrier. As it could contain a comma,
+// the config file path is everything after the last one.
+//
+// The database is migrated to the latest schema if needed.
+func (b *MySQLNotificationBackend) Initialize(openString string) error {
+	db, err := b.OpenDatabase(openString)
+	if err != nil {
+		return err
+	}
+
+	err = b.Migrations().Up(db)
+	if err != nil {
+		return fmt.Errorf("could not migrate db with error: %v", err)
+	}
+
+	_, configPath, _ := splitOpenString(openString)
+	return b.InitializeWithDb(db, gorp.MySQLDialect{Engine: "InnoDB", Encoding: "UTF8"}, configPath)
+}
+
+// Opens the database of the open string, as given to Initialize.
+func (b *MySQLNotificationBackend) OpenDatabase(openString string) (*sql.DB, error) {
+	dsn, _, err := splitOpenString(openString)
+	if err != nil {
+		return nil, err
+	}
+
+	logger.Info("initializing database")
+	db, err := sql.Open("mysql", withFoundRows(dsn))
+	if err != nil {
+		return nil, fmt.Errorf("could not open db with error: %v", err)
+	}
+
+	return db, nil
+}
+
+func (b *MySQLNotificationBackend) Migrations() *schema.Migrations {
+	return schema.MySQL
+}
+
+func (b *MySQLNotificationBackend) Name() string {
+	return BackendName
+}
+
+func splitOpenString(openString string) (string, string, error) {
+	i := strings.LastIndex(openString, ",")
+	if i == -1 {
+		return "", "", fmt.Errorf("open string '%s' is not <dsn>,<config_file_path>", openString)
+	}
+
+	return openString[:i], openString[i+1:], nil
+}
+
+// By default MySQL reports the rows that were changed rather than the rows
+// that were matched by an UPDATE. The backend relies on the latter to know if
+// a row exists, so it is always turned on.
+func withFoundRows(dsn string) string {
+	if strings.Contains(dsn, "clientFoundRows=") {
+		return dsn
+	}
+
+	if strings.Contains(dsn, "?") {
+		return dsn + "&clientFoundRows=true"
+	}
+
+	return dsn + "?clientFoundRows=true"
+}
@@ -0,0 +1,150 @@
+package mysql_backend
+
+import (
+	"os"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/facebookgo/clock"
+	"gitlab.com/shuhao/towncrier/backend"
+	"gitlab.com/shuhao/towncrier/sql_backend"
+	"gitlab.com/shuhao/towncrier/testhelpers"
+
+	. "gopkg.in/check.v1"
+)
+
+// The tests that need a database only run if this is set to the dsn of a
+// database that can be wiped, for example:
+//
+//     TOWNCRIER_TEST_MYSQL="towncrier:towncrier@tcp(localhost:3306)/towncrier_test"
+const testDatabaseEnv = "TOWNCRIER_TEST_MYSQL"
+
+const testConfigPath = "../sql_backend/test_config/standard.conf.json"
+
+func Test(t *testing.T) {
+	TestingT(t)
+}
+
+type MySQLNotificationBackendSuite struct {
+	backend  *MySQLNotificationBackend
+	notifier *testhelpers.TestNotifier
+}
+
+var _ = Suite(&MySQLNotificationBackendSuite{})
+
+var _ = Suite(&testhelpers.BackendConformanceSuite{
+	NewBackend: func(c *C, clock clock.Clock) backend.NotificationBackend {
+		dsn := os.Getenv(testDatabaseEnv)
+		if dsn == "" {
+			c.Skip(testDatabaseEnv + " is not set")
+		}
+
+		b := &MySQLNotificationBackend{
+			SQLNotificationBackend: &sql_backend.SQLNotificationBackend{Clock: clock},
+		}
+
+		err := b.Initialize(dsn + "," + testConfigPath)
+		c.Assert(err, IsNil)
+
+		testhelpers.ResetMySQLTestDatabase(b.DbMap)
+		return b
+	},
+})
+
+func (s *MySQLNotificationBackendSuite) SetUpTest(c *C) {
+	s.backend = backend.GetBackend(BackendName).(*MySQLNotificationBackend)
+
+	s.notifier = testhelpers.NewTestNotifier()
+	backend.ClearAllNotifiers()
+	backend.RegisterNotifier(s.notifier)
+}
+
+func (s *MySQLNotificationBackendSuite) initializeOrSkip(c *C) {
+	dsn := os.Getenv(testDatabaseEnv)
+	if dsn == "" {
+		c.Skip(testDatabaseEnv + " is not set")
+	}
+
+	err := s.backend.Initialize(dsn + "," + testConfigPath)
+	c.Assert(err, IsNil)
+
+	testhelpers.ResetMySQLTestDatabase(s.backend.DbMap)
+}
+
+func (s *MySQLNotificationBackendSuite) TestName(c *C) {
+	c.Assert(s.backend.Name(), Equals, BackendName)
+}
+
+func (s *MySQLNotificationBackendSuite) TestInitializeRejectsBadOpenString(c *C) {
+	err := s.backend.Initialize("towncrier@tcp(localhost:3306)/towncrier_test")
+	c.Assert(err, NotNil)
+}
+
+func (s *MySQLNotificationBackendSuite) TestWithFoundRows(c *C) {
+	c.Assert(withFoundRows("u@tcp(h:3306)/db"), Equals, "u@tcp(h:3306)/db?clientFoundRows=true")
+	c.Assert(withFoundRows("u@tcp(h:3306)/db?parseTime=true"), Equals, "u@tcp(h:3306)/db?parseTime=true&clientFoundRows=true")
+	c.Assert(withFoundRows("u@tcp(h:3306)/db?clientFoundRows=false"), Equals, "u@tcp(h:3306)/db?clientFoundRows=false")
+}
+
+func (s *MySQLNotificationBackendSuite) TestQueueNotificationSendImmediately(c *C) {
+	s.initializeOrSkip(c)
+
+	s.backend.Start(&sync.WaitGroup{})
+	s.backend.BlockUntilReady()
+
+	err := s.backend.QueueNotification(backend.Notification{
+		Channel: "Channel1",
+		Subject: "subject",
+		Content: "content",
+		Origin:  "origin",
+		Tags:    []string{"tag1", "tag2"},
+	})
+	c.Assert(err, IsNil)
+
+	timedout := testhelpers.BlockUntilSatisfiedOrTimeout(func() bool {
+		return len(s.notifier.Logs) >= 1
+	}, 5*time.Second)
+	c.Assert(timedout, Equals, false)
+
+	s.backend.Shutdown()
+
+	var notifications []*sql_backend.Notification
+	_, err = s.backend.Select(&notifications, "SELECT * FROM notifications WHERE Channel = ?", "Channel1")
+	c.Assert(err, IsNil)
+	c.Assert(notifications, HasLen, 1)
+	c.Assert(notifications[0].Delivered, Equals, true)
+	c.Assert(notifications[0].Tags, DeepEquals, []string{"tag1", "tag2"})
+
+	count, err := s.backend.SelectInt("SELECT COUNT(*) FROM outbox")
+	c.Assert(err, IsNil)
+	c.Assert(count, Equals, int64(0))
+}
+
+// The scheduled delivery goes through the same queries that differ the most
+// between databases: the boolean in the select and the channel run upsert.
+func (s *MySQLNotificationBackendSuite) TestForceNotificationDelivery(c *C) {
+	s.initializeOrSkip(c)
+
+	s.backend.Start(&sync.WaitGroup{})
+	s.backend.BlockUntilReady()
+	defer s.backend.Shutdown()
+
+	_, err := s.backend.Exec("INSERT INTO channel_runs (Channel, LastRunAt) VALUES (?, ?)", "Channel2", time.Now().Add(-48*time.Hour).UnixNano())
+	c.Assert(err, IsNil)
+
+	err = s.backend.QueueNotification(backend.Notification{
+		Channel: "Channel2",
+		Subject: "subject",
+		Content: "content",
+		Origin:  "origin",
+	})
+	c.Assert(err, IsNil)
+
+	s.backend.ForceNotificationDelivery()
+
+	timedout := testhelpers.BlockUntilSatisfiedOrTimeout(func() bool {
+		return len(s.notifier.Logs) >= 2
+	}, 5*time.Second)
+	c.Assert(timedout, Equals, false)
+}
@@ -0,0 +1,181 @@
+package postgres_backend
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/Sirupsen/logrus"
+	"github.com/lib/pq"
+	"gitlab.com/shuhao/towncrier/backend"
+	"gitlab.com/shuhao/towncrier/schema"
+	"gitlab.com/shuhao/towncrier/sql_backend"
+	"gopkg.in/gorp.v1"
+)
+
+const (
+	BackendName = "postgres"
+
+	// The channel used with LISTEN/NOTIFY to tell every towncrier process using
+	// the database that something was put into the outbox.
+	outboxNotifyChannel = "towncrier_outbox"
+
+	minListenerReconnectInterval = 10 * time.Second
+	maxListenerReconnectInterval = time.Minute
+)
+
+type PostgresNotificationBackend struct {
+	*sql_backend.SQLNotificationBackend
+
+	listener *pq.Listener
+	wakeups  chan struct{}
+}
+
+var realLogger = logrus.New()
+var logger = realLogger.WithField("component", "postgres_backend")
+
+func init() {
+	notificationBackend := &PostgresNotificationBackend{
+		SQLNotificationBackend: &sql_backend.SQLNotificationBackend{
+			NeverSendNotifications: false,
+			IsUniqueViolation:      isUniqueViolation,
+		},
+	}
+
+	backend.RegisterBackend(notificationBackend)
+}
+
+func isUniqueViolation(err error) bool {
+	pqErr, ok := err.(*pq.Error)
+	return ok && pqErr.Code.Name() == "unique_violation"
+}
+
+// Initializes a new instance of the backend
+//
+// This function must be called once only after getting a backend as per the
+// NotificationBackend specification.
+//
+// The openString format is as follows:
+//
+//     <connection_string>,<config_file_path>
+//
+// The connection string is anything lib/pq accepts. As it could contain a
+// comma, the config file path is everything after the last one.
+//
+// The database is migrated to the latest schema if needed.
+func (b *PostgresNotificationBackend) Initialize(openString string) error {
+	db, err := b.OpenDatabase(openString)
+	if err != nil {
+		return err
+	}
+
+	err = b.Migrations().Up(db)
+	if err != nil {
+		return fmt.Errorf("could not migrate db with error: %v", err)
+	}
+
+	connectionString, configPath, _ := splitOpenString(openString)
+	err = b.InitializeWithDb(db, gorp.PostgresDialect{}, configPath)
+	if err != nil {
+		return err
+	}
+
+	b.wakeups = make(chan struct{}, 1)
+	b.listener = pq.NewListener(connectionString, minListenerReconnectInterval, maxListenerReconnectInterval, logListenerEvent)
+	err = b.listener.Listen(outboxNotifyChannel)
+	if err != nil {
+		b.listener.Close()
+		return fmt.Errorf("could not listen on %s with error: %v", outboxNotifyChannel, err)
+	}
+
+	go b.forwardNotifications()
+
+	b.OutboxSignal = b
+	return nil
+}
+
+// Opens the database of the open string, as given to Initialize.
+func (b *PostgresNotificationBackend) OpenDatabase(openString string) (*sql.DB, error) {
+	connectionString, _, err := splitOpenString(openString)
+	if err != nil {
+		return nil, err
+	}
+
+	logger.Info("initializing database")
+	db, err := sql.Open("postgres", connectionString)
+	if err != nil {
+		return nil, fmt.Errorf("could not open db with error: %v", err)
+	}
+
+	// Listening blocks until it is connected, so make sure we can connect.
+	err = db.Ping()
+	if err != nil {
+		return nil, fmt.Errorf("could not connect to db with error: %v", err)
+	}
+
+	return db, nil
+}
+
+func (b *PostgresNotificationBackend) Migrations() *schema.Migrations {
+	return schema.Postgres
+}
+
+func (b *PostgresNotificationBackend) Name() string {
+	return BackendName
+}
+
+func splitOpenString(openString string) (string, string, error) {
+	i := strings.LastIndex(openString, ",")
+	if i == -1 {
+		return "", "", fmt.Errorf("open string '%s' is not <connection_string>,<config_file_path>", openString)
+	}
+
+	return openString[:i], openString[i+1:], nil
+}
+
+// Notifies the listeners when the transaction commits, which is when the
+// outbox entry becomes visible to them.
+func (b *PostgresNotificationBackend) Notify(s gorp.SqlExecutor) error {
+	_, err := s.Exec("NOTIFY " + outboxNotifyChannel)
+	return err
+}
+
+func (b *PostgresNotificationBackend) Wakeups() <-chan struct{} {
+	return b.wakeups
+}
+
+func (b *PostgresNotificationBackend) Shutdown() {
+	b.SQLNotificationBackend.Shutdown()
+
+	err := b.listener.Close()
+	if err != nil {
+		logger.WithField("error", err).Error("cannot close the listener")
+	}
+}
+
+// The listener sends a nil notification after it reconnects, as anything
+// could have been missed in between. We wake up the dispatcher for that too.
+//
+// Wakeups are collapsed the same way as the ones within the process.
+func (b *PostgresNotificationBackend) forwardNotifications() {
+	for _ = range b.listener.NotificationChannel() {
+		select {
+		case b.wakeups <- struct{}{}:
+		default:
+		}
+	}
+}
+
+func logListenerEvent(event pq.ListenerEventType, err error) {
+	switch event {
+	case pq.ListenerEventConnected:
+		logger.Info("listening for outbox notifications")
+	case pq.ListenerEventDisconnected:
+		logger.WithField("error", err).Warn("lost the connection for outbox notifications")
+	case pq.ListenerEventReconnected:
+		logger.Info("reconnected for outbox notifications")
+	case pq.ListenerEventConnectionAttemptFailed:
+		logger.WithField("error", err).Error("cannot connect for outbox notifications")
+	}
+}
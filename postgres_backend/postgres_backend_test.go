@@ -0,0 +1,147 @@
+package postgres_backend
+
+import (
+	"os"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/facebookgo/clock"
+	"gitlab.com/shuhao/towncrier/backend"
+	"gitlab.com/shuhao/towncrier/sql_backend"
+	"gitlab.com/shuhao/towncrier/testhelpers"
+
+	. "gopkg.in/check.v1"
+)
+
+// The tests that need a database only run if this is set to the connection
+// string of a database that can be wiped, for example:
+//
+//     TOWNCRIER_TEST_POSTGRES="dbname=towncrier_test sslmode=disable"
+const testDatabaseEnv = "TOWNCRIER_TEST_POSTGRES"
+
+const testConfigPath = "../sql_backend/test_config/standard.conf.json"
+
+func Test(t *testing.T) {
+	TestingT(t)
+}
+
+type PostgresNotificationBackendSuite struct {
+	backend  *PostgresNotificationBackend
+	notifier *testhelpers.TestNotifier
+}
+
+var _ = Suite(&PostgresNotificationBackendSuite{})
+
+var _ = Suite(&testhelpers.BackendConformanceSuite{
+	NewBackend: func(c *C, clock clock.Clock) backend.NotificationBackend {
+		connectionString := os.Getenv(testDatabaseEnv)
+		if connectionString == "" {
+			c.Skip(testDatabaseEnv + " is not set")
+		}
+
+		b := &PostgresNotificationBackend{
+			SQLNotificationBackend: &sql_backend.SQLNotificationBackend{Clock: clock},
+		}
+
+		err := b.Initialize(connectionString + "," + testConfigPath)
+		c.Assert(err, IsNil)
+
+		testhelpers.ResetPostgresTestDatabase(b.DbMap)
+		return b
+	},
+})
+
+func (s *PostgresNotificationBackendSuite) SetUpTest(c *C) {
+	s.backend = backend.GetBackend(BackendName).(*PostgresNotificationBackend)
+
+	s.notifier = testhelpers.NewTestNotifier()
+	backend.ClearAllNotifiers()
+	backend.RegisterNotifier(s.notifier)
+}
+
+func (s *PostgresNotificationBackendSuite) initializeOrSkip(c *C) {
+	connectionString := os.Getenv(testDatabaseEnv)
+	if connectionString == "" {
+		c.Skip(testDatabaseEnv + " is not set")
+	}
+
+	err := s.backend.Initialize(connectionString + "," + testConfigPath)
+	c.Assert(err, IsNil)
+
+	testhelpers.ResetPostgresTestDatabase(s.backend.DbMap)
+}
+
+func (s *PostgresNotificationBackendSuite) TestName(c *C) {
+	c.Assert(s.backend.Name(), Equals, BackendName)
+}
+
+func (s *PostgresNotificationBackendSuite) TestInitializeRejectsBadOpenString(c *C) {
+	err := s.backend.Initialize("dbname=towncrier_test")
+	c.Assert(err, NotNil)
+}
+
+func (s *PostgresNotificationBackendSuite) TestQueueNotificationSendImmediately(c *C) {
+	s.initializeOrSkip(c)
+
+	s.backend.Start(&sync.WaitGroup{})
+	s.backend.BlockUntilReady()
+
+	err := s.backend.QueueNotification(backend.Notification{
+		Channel: "Channel1",
+		Subject: "subject",
+		Content: "content",
+		Origin:  "origin",
+		Tags:    []string{"tag1", "tag2"},
+	})
+	c.Assert(err, IsNil)
+
+	timedout := testhelpers.BlockUntilSatisfiedOrTimeout(func() bool {
+		return len(s.notifier.Logs) >= 1
+	}, 5*time.Second)
+	c.Assert(timedout, Equals, false)
+
+	s.backend.Shutdown()
+
+	var notifications []*sql_backend.Notification
+	_, err = s.backend.Select(&notifications, "SELECT * FROM notifications WHERE Channel = $1", "Channel1")
+	c.Assert(err, IsNil)
+	c.Assert(notifications, HasLen, 1)
+	c.Assert(notifications[0].Delivered, Equals, true)
+	c.Assert(notifications[0].Tags, DeepEquals, []string{"tag1", "tag2"})
+
+	count, err := s.backend.SelectInt("SELECT COUNT(*) FROM outbox")
+	c.Assert(err, IsNil)
+	c.Assert(count, Equals, int64(0))
+}
+
+// Another process putting something into the outbox wakes us up right away
+// rather than on the next poll.
+func (s *PostgresNotificationBackendSuite) TestOutboxNotifyWakesUpDispatcher(c *C) {
+	s.initializeOrSkip(c)
+
+	s.backend.Start(&sync.WaitGroup{})
+	s.backend.BlockUntilReady()
+	defer s.backend.Shutdown()
+
+	notification := &sql_backend.Notification{
+		Notification: backend.Notification{
+			Channel: "Channel2",
+			Subject: "subject",
+			Content: "content",
+			Origin:  "origin",
+		},
+	}
+
+	tx, err := s.backend.Begin()
+	c.Assert(err, IsNil)
+	c.Assert(tx.Insert(notification), IsNil)
+	c.Assert(tx.Insert(&sql_backend.OutboxEntry{NotificationId: notification.Id}), IsNil)
+	c.Assert(s.backend.Notify(tx), IsNil)
+	c.Assert(tx.Commit(), IsNil)
+
+	timedout := testhelpers.BlockUntilSatisfiedOrTimeout(func() bool {
+		return len(s.notifier.Logs) >= 2
+	}, 5*time.Second)
+	c.Assert(timedout, Equals, false)
+}
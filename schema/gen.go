@@ -0,0 +1,69 @@
+// +build ignore
+
+// Generates migrations.go from the migrations in the db directory. Run it with
+// go generate after adding or changing a migration.
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"go/format"
+	"io/ioutil"
+	"log"
+	"path/filepath"
+	"sort"
+	"strconv"
+)
+
+// The same keys as the name of the Migrations in schema.go
+var migrationDirs = map[string]string{
+	"sqlite3":  filepath.Join("..", "db", "migrations"),
+	"postgres": filepath.Join("..", "db", "postgres", "migrations"),
+	"mysql":    filepath.Join("..", "db", "mysql", "migrations"),
+}
+
+func main() {
+	names := make([]string, 0, len(migrationDirs))
+	for name, _ := range migrationDirs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	buf := &bytes.Buffer{}
+	fmt.Fprintln(buf, "// generated by gen.go from the db directory, do not edit")
+	fmt.Fprintln(buf)
+	fmt.Fprintln(buf, "package schema")
+	fmt.Fprintln(buf)
+	fmt.Fprintln(buf, "var embeddedMigrations = map[string]map[string]string{")
+
+	for _, name := range names {
+		files, err := filepath.Glob(filepath.Join(migrationDirs[name], "*.sql"))
+		if err != nil {
+			log.Fatal(err)
+		}
+		sort.Strings(files)
+
+		fmt.Fprintf(buf, "%s: {\n", strconv.Quote(name))
+		for _, file := range files {
+			content, err := ioutil.ReadFile(file)
+			if err != nil {
+				log.Fatal(err)
+			}
+
+			fmt.Fprintf(buf, "%s: %s,\n", strconv.Quote(filepath.Base(file)), strconv.Quote(string(content)))
+		}
+		fmt.Fprintln(buf, "},")
+	}
+
+	fmt.Fprintln(buf, "}")
+
+	source, err := format.Source(buf.Bytes())
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	err = ioutil.WriteFile("migrations.go", source, 0644)
+	if err != nil {
+		log.Fatal(err)
+	}
+}
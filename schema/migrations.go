@@ -0,0 +1,36 @@
+// generated by gen.go from the db directory, do not edit
+
+package schema
+
+var embeddedMigrations = map[string]map[string]string{
+	"mysql": {
+		"20150808093917_CreateInitialTables.sql":           "-- +goose Up\n-- SQL in section 'Up' is executed when this migration is applied\n\nCREATE TABLE notifications (\n  id BIGINT AUTO_INCREMENT PRIMARY KEY,\n  Channel VARCHAR(64) NOT NULL,\n  Subject TEXT NOT NULL,\n  Content TEXT,\n  Origin TEXT,\n  TagsString TEXT,\n  PriorityInt BIGINT,\n  Delivered BOOLEAN DEFAULT FALSE,\n  CreatedAt BIGINT,\n  UpdatedAt BIGINT\n) ENGINE=InnoDB DEFAULT CHARSET=utf8;\n\n-- +goose Down\n-- SQL section 'Down' is executed when this migration is rolled back\n\nDROP TABLE notifications;\n",
+		"20151003120000_CreateDeliveries.sql":              "-- +goose Up\n-- SQL in section 'Up' is executed when this migration is applied\n\nCREATE TABLE deliveries (\n  id BIGINT AUTO_INCREMENT PRIMARY KEY,\n  NotificationId BIGINT NOT NULL,\n  Subscriber VARCHAR(128) NOT NULL,\n  Notifier VARCHAR(128) NOT NULL,\n  Status VARCHAR(16) NOT NULL,\n  Attempts BIGINT DEFAULT 0,\n  LastError TEXT,\n  NextAttemptAt BIGINT,\n  CreatedAt BIGINT,\n  UpdatedAt BIGINT,\n  UNIQUE INDEX deliveries_leg (NotificationId, Subscriber, Notifier),\n  INDEX deliveries_retry (Status, NextAttemptAt)\n) ENGINE=InnoDB DEFAULT CHARSET=utf8;\n\n-- +goose Down\n-- SQL section 'Down' is executed when this migration is rolled back\n\nDROP TABLE deliveries;\n",
+		"20151004120000_CreateOutbox.sql":                  "-- +goose Up\n-- SQL in section 'Up' is executed when this migration is applied\n\nCREATE TABLE outbox (\n  id BIGINT AUTO_INCREMENT PRIMARY KEY,\n  NotificationId BIGINT NOT NULL,\n  ClaimedUntil BIGINT DEFAULT 0,\n  CreatedAt BIGINT,\n  UNIQUE INDEX outbox_notification (NotificationId)\n) ENGINE=InnoDB DEFAULT CHARSET=utf8;\n\n-- +goose Down\n-- SQL section 'Down' is executed when this migration is rolled back\n\nDROP TABLE outbox;\n",
+		"20151005120000_CreateChannelRuns.sql":             "-- +goose Up\n-- SQL in section 'Up' is executed when this migration is applied\n\nCREATE TABLE channel_runs (\n  Channel VARCHAR(64) PRIMARY KEY,\n  LastRunAt BIGINT NOT NULL\n) ENGINE=InnoDB DEFAULT CHARSET=utf8;\n\n-- +goose Down\n-- SQL section 'Down' is executed when this migration is rolled back\n\nDROP TABLE channel_runs;\n",
+		"20151007120000_CreateLeases.sql":                  "-- +goose Up\n-- SQL in section 'Up' is executed when this migration is applied\n\nCREATE TABLE leases (\n  Name VARCHAR(64) PRIMARY KEY,\n  Holder VARCHAR(128) NOT NULL,\n  ExpiresAt BIGINT NOT NULL\n) ENGINE=InnoDB DEFAULT CHARSET=utf8;\n\n-- +goose Down\n-- SQL section 'Down' is executed when this migration is rolled back\n\nDROP TABLE leases;\n",
+		"20151010120000_AddLabelsAndSendAt.sql":            "-- +goose Up\n-- SQL in section 'Up' is executed when this migration is applied\n\nALTER TABLE notifications ADD COLUMN LabelsString TEXT;\nALTER TABLE notifications ADD COLUMN SendAt BIGINT NOT NULL DEFAULT 0;\nALTER TABLE outbox ADD COLUMN NotBefore BIGINT NOT NULL DEFAULT 0;\n\n-- +goose Down\n-- SQL section 'Down' is executed when this migration is rolled back\n\nALTER TABLE outbox DROP COLUMN NotBefore;\nALTER TABLE notifications DROP COLUMN SendAt;\nALTER TABLE notifications DROP COLUMN LabelsString;\n",
+		"20151011120000_AddIdempotencyKey.sql":             "-- +goose Up\n-- SQL in section 'Up' is executed when this migration is applied\n\nALTER TABLE notifications ADD COLUMN IdempotencyKey VARCHAR(255) NOT NULL DEFAULT '';\nCREATE INDEX notifications_idempotency_key ON notifications (IdempotencyKey);\n\n-- +goose Down\n-- SQL section 'Down' is executed when this migration is rolled back\n\nDROP INDEX notifications_idempotency_key ON notifications;\nALTER TABLE notifications DROP COLUMN IdempotencyKey;\n",
+		"20151012120000_CreateSuppressedNotifications.sql": "-- +goose Up\n-- SQL in section 'Up' is executed when this migration is applied\n\nCREATE TABLE suppressed_notifications (\n  Channel VARCHAR(64) NOT NULL,\n  Origin VARCHAR(128) NOT NULL,\n  Count BIGINT NOT NULL,\n  Since BIGINT NOT NULL,\n  SummarizeAt BIGINT NOT NULL,\n  PRIMARY KEY (Channel, Origin)\n) ENGINE=InnoDB DEFAULT CHARSET=utf8;\n\n-- +goose Down\n-- SQL section 'Down' is executed when this migration is rolled back\n\nDROP TABLE suppressed_notifications;\n",
+	},
+	"postgres": {
+		"20150808093917_CreateInitialTables.sql":           "-- +goose Up\n-- SQL in section 'Up' is executed when this migration is applied\n\nCREATE TABLE notifications (\n  id BIGSERIAL PRIMARY KEY,\n  Channel VARCHAR(64) NOT NULL,\n  Subject TEXT NOT NULL,\n  Content TEXT,\n  Origin TEXT,\n  TagsString TEXT,\n  PriorityInt BIGINT,\n  Delivered BOOLEAN DEFAULT FALSE,\n  CreatedAt BIGINT,\n  UpdatedAt BIGINT\n);\n\n-- +goose Down\n-- SQL section 'Down' is executed when this migration is rolled back\n\nDROP TABLE notifications;\n",
+		"20151003120000_CreateDeliveries.sql":              "-- +goose Up\n-- SQL in section 'Up' is executed when this migration is applied\n\nCREATE TABLE deliveries (\n  id BIGSERIAL PRIMARY KEY,\n  NotificationId BIGINT NOT NULL,\n  Subscriber VARCHAR(128) NOT NULL,\n  Notifier VARCHAR(128) NOT NULL,\n  Status VARCHAR(16) NOT NULL,\n  Attempts BIGINT DEFAULT 0,\n  LastError TEXT,\n  NextAttemptAt BIGINT,\n  CreatedAt BIGINT,\n  UpdatedAt BIGINT\n);\n\nCREATE UNIQUE INDEX deliveries_leg ON deliveries (NotificationId, Subscriber, Notifier);\nCREATE INDEX deliveries_retry ON deliveries (Status, NextAttemptAt);\n\n-- +goose Down\n-- SQL section 'Down' is executed when this migration is rolled back\n\nDROP INDEX deliveries_retry;\nDROP INDEX deliveries_leg;\nDROP TABLE deliveries;\n",
+		"20151004120000_CreateOutbox.sql":                  "-- +goose Up\n-- SQL in section 'Up' is executed when this migration is applied\n\nCREATE TABLE outbox (\n  id BIGSERIAL PRIMARY KEY,\n  NotificationId BIGINT NOT NULL,\n  ClaimedUntil BIGINT DEFAULT 0,\n  CreatedAt BIGINT\n);\n\nCREATE UNIQUE INDEX outbox_notification ON outbox (NotificationId);\n\n-- +goose Down\n-- SQL section 'Down' is executed when this migration is rolled back\n\nDROP INDEX outbox_notification;\nDROP TABLE outbox;\n",
+		"20151005120000_CreateChannelRuns.sql":             "-- +goose Up\n-- SQL in section 'Up' is executed when this migration is applied\n\nCREATE TABLE channel_runs (\n  Channel VARCHAR(64) PRIMARY KEY,\n  LastRunAt BIGINT NOT NULL\n);\n\n-- +goose Down\n-- SQL section 'Down' is executed when this migration is rolled back\n\nDROP TABLE channel_runs;\n",
+		"20151007120000_CreateLeases.sql":                  "-- +goose Up\n-- SQL in section 'Up' is executed when this migration is applied\n\nCREATE TABLE leases (\n  Name VARCHAR(64) PRIMARY KEY,\n  Holder VARCHAR(128) NOT NULL,\n  ExpiresAt BIGINT NOT NULL\n);\n\n-- +goose Down\n-- SQL section 'Down' is executed when this migration is rolled back\n\nDROP TABLE leases;\n",
+		"20151010120000_AddLabelsAndSendAt.sql":            "-- +goose Up\n-- SQL in section 'Up' is executed when this migration is applied\n\nALTER TABLE notifications ADD COLUMN LabelsString TEXT;\nALTER TABLE notifications ADD COLUMN SendAt BIGINT NOT NULL DEFAULT 0;\nALTER TABLE outbox ADD COLUMN NotBefore BIGINT NOT NULL DEFAULT 0;\n\n-- +goose Down\n-- SQL section 'Down' is executed when this migration is rolled back\n\nALTER TABLE outbox DROP COLUMN NotBefore;\nALTER TABLE notifications DROP COLUMN SendAt;\nALTER TABLE notifications DROP COLUMN LabelsString;\n",
+		"20151011120000_AddIdempotencyKey.sql":             "-- +goose Up\n-- SQL in section 'Up' is executed when this migration is applied\n\nALTER TABLE notifications ADD COLUMN IdempotencyKey VARCHAR(255) NOT NULL DEFAULT '';\nCREATE INDEX notifications_idempotency_key ON notifications (IdempotencyKey);\n\n-- +goose Down\n-- SQL section 'Down' is executed when this migration is rolled back\n\nDROP INDEX notifications_idempotency_key;\nALTER TABLE notifications DROP COLUMN IdempotencyKey;\n",
+		"20151012120000_CreateSuppressedNotifications.sql": "-- +goose Up\n-- SQL in section 'Up' is executed when this migration is applied\n\nCREATE TABLE suppressed_notifications (\n  Channel VARCHAR(64) NOT NULL,\n  Origin VARCHAR(128) NOT NULL,\n  Count BIGINT NOT NULL,\n  Since BIGINT NOT NULL,\n  SummarizeAt BIGINT NOT NULL,\n  PRIMARY KEY (Channel, Origin)\n);\n\n-- +goose Down\n-- SQL section 'Down' is executed when this migration is rolled back\n\nDROP TABLE suppressed_notifications;\n",
+	},
+	"sqlite3": {
+		"20150808093917_CreateInitialTables.sql":           "\n-- +goose Up\n-- SQL in section 'Up' is executed when this migration is applied\n\nCREATE TABLE notifications (\n  id INTEGER PRIMARY KEY ASC,\n  Channel VARCHAR(64) NOT NULL,\n  Subject TEXT NOT NULL,\n  Content TEXT,\n  Origin TEXT,\n  TagsString TEXT,\n  PriorityInt INTEGER,\n  Delivered BOOLEAN DEFAULT 0,\n  CreatedAt INTEGER,\n  UpdatedAt INTEGER\n);\n\n-- +goose Down\n-- SQL section 'Down' is executed when this migration is rolled back\n\nDROP TABLE notifications;\n",
+		"20151003120000_CreateDeliveries.sql":              "-- +goose Up\n-- SQL in section 'Up' is executed when this migration is applied\n\nCREATE TABLE deliveries (\n  id INTEGER PRIMARY KEY ASC,\n  NotificationId INTEGER NOT NULL,\n  Subscriber VARCHAR(128) NOT NULL,\n  Notifier VARCHAR(128) NOT NULL,\n  Status VARCHAR(16) NOT NULL,\n  Attempts INTEGER DEFAULT 0,\n  LastError TEXT,\n  NextAttemptAt INTEGER,\n  CreatedAt INTEGER,\n  UpdatedAt INTEGER\n);\n\nCREATE UNIQUE INDEX deliveries_leg ON deliveries (NotificationId, Subscriber, Notifier);\nCREATE INDEX deliveries_retry ON deliveries (Status, NextAttemptAt);\n\n-- +goose Down\n-- SQL section 'Down' is executed when this migration is rolled back\n\nDROP INDEX deliveries_retry;\nDROP INDEX deliveries_leg;\nDROP TABLE deliveries;\n",
+		"20151004120000_CreateOutbox.sql":                  "-- +goose Up\n-- SQL in section 'Up' is executed when this migration is applied\n\nCREATE TABLE outbox (\n  id INTEGER PRIMARY KEY ASC,\n  NotificationId INTEGER NOT NULL,\n  ClaimedUntil INTEGER DEFAULT 0,\n  CreatedAt INTEGER\n);\n\nCREATE UNIQUE INDEX outbox_notification ON outbox (NotificationId);\n\n-- +goose Down\n-- SQL section 'Down' is executed when this migration is rolled back\n\nDROP INDEX outbox_notification;\nDROP TABLE outbox;\n",
+		"20151005120000_CreateChannelRuns.sql":             "-- +goose Up\n-- SQL in section 'Up' is executed when this migration is applied\n\nCREATE TABLE channel_runs (\n  Channel VARCHAR(64) PRIMARY KEY,\n  LastRunAt INTEGER NOT NULL\n);\n\n-- +goose Down\n-- SQL section 'Down' is executed when this migration is rolled back\n\nDROP TABLE channel_runs;\n",
+		"20151007120000_CreateLeases.sql":                  "-- +goose Up\n-- SQL in section 'Up' is executed when this migration is applied\n\nCREATE TABLE leases (\n  Name VARCHAR(64) PRIMARY KEY,\n  Holder VARCHAR(128) NOT NULL,\n  ExpiresAt INTEGER NOT NULL\n);\n\n-- +goose Down\n-- SQL section 'Down' is executed when this migration is rolled back\n\nDROP TABLE leases;\n",
+		"20151010120000_AddLabelsAndSendAt.sql":            "-- +goose Up\n-- SQL in section 'Up' is executed when this migration is applied\n\nALTER TABLE notifications ADD COLUMN LabelsString TEXT;\nALTER TABLE notifications ADD COLUMN SendAt INTEGER NOT NULL DEFAULT 0;\nALTER TABLE outbox ADD COLUMN NotBefore INTEGER NOT NULL DEFAULT 0;\n\n-- +goose Down\n-- SQL section 'Down' is executed when this migration is rolled back\n\nALTER TABLE outbox DROP COLUMN NotBefore;\nALTER TABLE notifications DROP COLUMN SendAt;\nALTER TABLE notifications DROP COLUMN LabelsString;\n",
+		"20151011120000_AddIdempotencyKey.sql":             "-- +goose Up\n-- SQL in section 'Up' is executed when this migration is applied\n\nALTER TABLE notifications ADD COLUMN IdempotencyKey VARCHAR(255) NOT NULL DEFAULT '';\nCREATE INDEX notifications_idempotency_key ON notifications (IdempotencyKey);\n\n-- +goose Down\n-- SQL section 'Down' is executed when this migration is rolled back\n\nDROP INDEX notifications_idempotency_key;\nALTER TABLE notifications DROP COLUMN IdempotencyKey;\n",
+		"20151012120000_CreateSuppressedNotifications.sql": "-- +goose Up\n-- SQL in section 'Up' is executed when this migration is applied\n\nCREATE TABLE suppressed_notifications (\n  Channel VARCHAR(64) NOT NULL,\n  Origin VARCHAR(128) NOT NULL,\n  Count INTEGER NOT NULL,\n  Since INTEGER NOT NULL,\n  SummarizeAt INTEGER NOT NULL,\n  PRIMARY KEY (Channel, Origin)\n);\n\n-- +goose Down\n-- SQL section 'Down' is executed when this migration is rolled back\n\nDROP TABLE suppressed_notifications;\n",
+	},
+}
@@ -0,0 +1,222 @@
+// The database schema of the SQL backends.
+//
+// The migrations in the db directory are compiled into the binary (see
+// gen.go), so towncrier can set up and upgrade its database on its own.
+package schema
+
+//go:generate go run gen.go
+
+import (
+	"database/sql"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"bitbucket.org/liamstask/goose/lib/goose"
+	"github.com/Sirupsen/logrus"
+)
+
+var realLogger = logrus.New()
+var logger = realLogger.WithField("component", "schema")
+
+// The migrations of one kind of database.
+type Migrations struct {
+	// The key in embeddedMigrations
+	name   string
+	driver goose.DBDriver
+}
+
+var SQLite = &Migrations{
+	name: "sqlite3",
+	driver: goose.DBDriver{
+		Name:    "sqlite3",
+		Import:  "github.com/mattn/go-sqlite3",
+		Dialect: &goose.Sqlite3Dialect{},
+	},
+}
+
+var Postgres = &Migrations{
+	name: "postgres",
+	driver: goose.DBDriver{
+		Name:    "postgres",
+		Import:  "github.com/lib/pq",
+		Dialect: &goose.PostgresDialect{},
+	},
+}
+
+var MySQL = &Migrations{
+	name: "mysql",
+	driver: goose.DBDriver{
+		Name:    "mysql",
+		Import:  "github.com/go-sql-driver/mysql",
+		Dialect: &goose.MySqlDialect{},
+	},
+}
+
+type MigrationStatus struct {
+	Version int64
+	Name    string
+	Applied bool
+}
+
+// Returned when the database was migrated by a newer towncrier. We refuse to
+// use it as we do not know what changed.
+type SchemaTooNew struct {
+	Version       int64
+	LatestVersion int64
+}
+
+func (e SchemaTooNew) Error() string {
+	return fmt.Sprintf("the database schema is at version %d but the latest migration known is %d, is this an older towncrier?", e.Version, e.LatestVersion)
+}
+
+// goose only reads migrations from a directory, so they are written to a
+// temporary one for every operation. The caller must remove it.
+func (m *Migrations) extract() (string, error) {
+	dir, err := ioutil.TempDir("", "towncrier-migrations")
+	if err != nil {
+		return "", err
+	}
+
+	for name, content := range embeddedMigrations[m.name] {
+		err = ioutil.WriteFile(filepath.Join(dir, name), []byte(content), 0600)
+		if err != nil {
+			os.RemoveAll(dir)
+			return "", err
+		}
+	}
+
+	return dir, nil
+}
+
+func (m *Migrations) conf(dir string) *goose.DBConf {
+	return &goose.DBConf{
+		MigrationsDir: dir,
+		Env:           "towncrier",
+		Driver:        m.driver,
+	}
+}
+
+// The names of the migrations, sorted by version.
+func (m *Migrations) names() []string {
+	names := make([]string, 0, len(embeddedMigrations[m.name]))
+	for name, _ := range embeddedMigrations[m.name] {
+		names = append(names, name)
+	}
+
+	// The names start with the version, which all have the same length.
+	sort.Strings(names)
+	return names
+}
+
+func (m *Migrations) LatestVersion() (int64, error) {
+	names := m.names()
+	if len(names) == 0 {
+		return 0, nil
+	}
+
+	return goose.NumericComponent(names[len(names)-1])
+}
+
+// The version of the database, which is 0 if nothing was applied yet.
+func (m *Migrations) Version(db *sql.DB) (int64, error) {
+	return goose.EnsureDBVersion(m.conf(""), db)
+}
+
+// Applies all the migrations that have not been applied yet.
+func (m *Migrations) Up(db *sql.DB) error {
+	current, err := m.Version(db)
+	if err != nil {
+		return err
+	}
+
+	latest, err := m.LatestVersion()
+	if err != nil {
+		return err
+	}
+
+	if current > latest {
+		return SchemaTooNew{Version: current, LatestVersion: latest}
+	}
+
+	if current == latest {
+		return nil
+	}
+
+	logger.WithFields(logrus.Fields{
+		"from": current,
+		"to":   latest,
+	}).Info("migrating the database")
+
+	return m.migrateTo(db, latest)
+}
+
+// Rolls back the last applied migration.
+func (m *Migrations) Down(db *sql.DB) error {
+	current, err := m.Version(db)
+	if err != nil {
+		return err
+	}
+
+	if current == 0 {
+		return fmt.Errorf("no migration to roll back")
+	}
+
+	var previous int64 = 0
+	for _, name := range m.names() {
+		version, err := goose.NumericComponent(name)
+		if err != nil {
+			return err
+		}
+
+		if version < current {
+			previous = version
+		}
+	}
+
+	logger.WithFields(logrus.Fields{
+		"from": current,
+		"to":   previous,
+	}).Info("rolling back the database")
+
+	return m.migrateTo(db, previous)
+}
+
+func (m *Migrations) migrateTo(db *sql.DB, target int64) error {
+	dir, err := m.extract()
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(dir)
+
+	return goose.RunMigrationsOnDb(m.conf(dir), dir, target, db)
+}
+
+// Lists every migration known and whether it is applied to the database.
+func (m *Migrations) Status(db *sql.DB) ([]MigrationStatus, error) {
+	current, err := m.Version(db)
+	if err != nil {
+		return nil, err
+	}
+
+	names := m.names()
+	statuses := make([]MigrationStatus, len(names))
+	for i, name := range names {
+		version, err := goose.NumericComponent(name)
+		if err != nil {
+			return nil, err
+		}
+
+		// goose applies and rolls back in order, so everything up to the
+		// current version is applied.
+		statuses[i] = MigrationStatus{
+			Version: version,
+			Name:    name,
+			Applied: version <= current,
+		}
+	}
+
+	return statuses, nil
+}
@@ -0,0 +1,114 @@
+package schema
+
+import (
+	"database/sql"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+
+	_ "github.com/mattn/go-sqlite3"
+
+	. "gopkg.in/check.v1"
+)
+
+func Test(t *testing.T) {
+	TestingT(t)
+}
+
+type SchemaSuite struct {
+	db *sql.DB
+}
+
+var _ = Suite(&SchemaSuite{})
+
+func (s *SchemaSuite) SetUpTest(c *C) {
+	var err error
+	s.db, err = sql.Open("sqlite3", ":memory:")
+	c.Assert(err, IsNil)
+
+	s.db.SetMaxOpenConns(1)
+}
+
+func (s *SchemaSuite) TearDownTest(c *C) {
+	s.db.Close()
+}
+
+func (s *SchemaSuite) TestEmbeddedMigrationsAreUpToDate(c *C) {
+	for name, dir := range map[string]string{
+		"sqlite3":  filepath.Join("..", "db", "migrations"),
+		"postgres": filepath.Join("..", "db", "postgres", "migrations"),
+		"mysql":    filepath.Join("..", "db", "mysql", "migrations"),
+	} {
+		files, err := filepath.Glob(filepath.Join(dir, "*.sql"))
+		c.Assert(err, IsNil)
+		c.Assert(embeddedMigrations[name], HasLen, len(files), Commentf("run go generate in schema"))
+
+		for _, file := range files {
+			content, err := ioutil.ReadFile(file)
+			c.Assert(err, IsNil)
+			c.Assert(embeddedMigrations[name][filepath.Base(file)], Equals, string(content), Commentf("run go generate in schema"))
+		}
+	}
+}
+
+func (s *SchemaSuite) TestUpAppliesEverything(c *C) {
+	latest, err := SQLite.LatestVersion()
+	c.Assert(err, IsNil)
+
+	err = SQLite.Up(s.db)
+	c.Assert(err, IsNil)
+
+	version, err := SQLite.Version(s.db)
+	c.Assert(err, IsNil)
+	c.Assert(version, Equals, latest)
+
+	_, err = s.db.Exec("INSERT INTO notifications (Channel, Subject) VALUES ('channel', 'subject')")
+	c.Assert(err, IsNil)
+
+	// Nothing to do the second time around
+	err = SQLite.Up(s.db)
+	c.Assert(err, IsNil)
+}
+
+func (s *SchemaSuite) TestDownRollsBackOne(c *C) {
+	err := SQLite.Up(s.db)
+	c.Assert(err, IsNil)
+
+	statuses, err := SQLite.Status(s.db)
+	c.Assert(err, IsNil)
+	c.Assert(len(statuses) > 1, Equals, true)
+	for _, status := range statuses {
+		c.Assert(status.Applied, Equals, true)
+	}
+
+	err = SQLite.Down(s.db)
+	c.Assert(err, IsNil)
+
+	version, err := SQLite.Version(s.db)
+	c.Assert(err, IsNil)
+	c.Assert(version, Equals, statuses[len(statuses)-2].Version)
+
+	statuses, err = SQLite.Status(s.db)
+	c.Assert(err, IsNil)
+	c.Assert(statuses[len(statuses)-2].Applied, Equals, true)
+	c.Assert(statuses[len(statuses)-1].Applied, Equals, false)
+}
+
+func (s *SchemaSuite) TestDownWithNothingApplied(c *C) {
+	err := SQLite.Down(s.db)
+	c.Assert(err, NotNil)
+}
+
+func (s *SchemaSuite) TestUpRefusesNewerSchema(c *C) {
+	err := SQLite.Up(s.db)
+	c.Assert(err, IsNil)
+
+	latest, err := SQLite.LatestVersion()
+	c.Assert(err, IsNil)
+
+	_, err = s.db.Exec("INSERT INTO goose_db_version (version_id, is_applied) VALUES (?, ?)", latest+1, true)
+	c.Assert(err, IsNil)
+
+	err = SQLite.Up(s.db)
+	c.Assert(err, DeepEquals, SchemaTooNew{Version: latest + 1, LatestVersion: latest})
+}
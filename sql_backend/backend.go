@@ -0,0 +1,502 @@
+package sql_backend
+
+import (
+	"bytes"
+	"database/sql"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Sirupsen/logrus"
+	"github.com/facebookgo/clock"
+	"gitlab.com/shuhao/towncrier/backend"
+	"gopkg.in/gorp.v1"
+)
+
+const defaultOutboxWorkers = 4
+
+// Wakes up the outbox dispatchers of other processes using the same database
+// when something is put into the outbox.
+type OutboxSignal interface {
+	// Called in the transaction that puts the notification into the outbox.
+	Notify(s gorp.SqlExecutor) error
+
+	// Receives whenever something may have been put into the outbox by
+	// another process.
+	Wakeups() <-chan struct{}
+}
+
+// The core of the backends storing notifications in an SQL database. It does
+// not register itself, the backends for each database embed it and only deal
+// with opening the database.
+type SQLNotificationBackend struct {
+	*gorp.DbMap
+
+	// Set this if you are embedding this struct directly or via a variable
+	// as you just want to use the web to show a dashboard and want to use
+	// maybe another way to send notifications.
+	NeverSendNotifications bool
+
+	// The number of workers sending notifications from the outbox. Defaults to
+	// defaultOutboxWorkers if not set.
+	OutboxWorkers int
+
+	// Set this if no other process uses the database, so anything left claimed
+	// in the outbox at start comes from a previous run that did not finish.
+	ExclusiveDatabase bool
+
+	// Optional, see OutboxSignal.
+	OutboxSignal OutboxSignal
+
+	// Whether an error of the database driver is a unique or primary key
+	// violation. Without it, any such error is treated as a database error.
+	IsUniqueViolation func(err error) bool
+
+	// The holder of the lease that decides which of the processes sharing the
+	// database delivers the scheduled notifications. Defaults to a name made of
+	// the hostname and the pid if not set.
+	NodeName string
+
+	// The clock used for scheduling. Defaults to the real clock if not set, tests
+	// can set a mock clock to control time.
+	Clock clock.Clock
+
+	config      *Config
+	quitChannel chan struct{}
+
+	forceConfigReload         chan struct{}
+	forceNotificationDelivery chan struct{}
+
+	outboxWakeup  chan struct{}
+	outboxJobs    chan *OutboxEntry
+	outboxWorkers sync.WaitGroup
+
+	leaseLock      sync.Mutex
+	leaseExpiresAt time.Time
+
+	hub *backend.Hub
+
+	health *healthMonitor
+
+	// This channel needs information on it n times before the backend is ready
+	started chan struct{}
+}
+
+var realLogger = logrus.New()
+var logger = realLogger.WithField("component", "sql_backend")
+
+// Initializes the backend with an already opened database.
+//
+// This is meant to be called by the Initialize function of the backends built
+// on top of this one, which know how to open their database and which dialect
+// to use.
+func (b *SQLNotificationBackend) InitializeWithDb(db *sql.DB, dialect gorp.Dialect, configPath string) error {
+	if b.Clock == nil {
+		b.Clock = clock.New()
+	}
+
+	if b.NodeName == "" {
+		b.NodeName = defaultNodeName()
+	}
+
+	dbmap := &gorp.DbMap{Db: db, Dialect: dialect}
+
+	// We need to ignore tags as that's a []string
+	table := dbmap.AddTableWithName(Notification{}, "notifications").SetKeys(true, "id")
+	table.ColMap("Tags").SetTransient(true)
+	table.ColMap("Priority").SetTransient(true)
+	table.ColMap("Labels").SetTransient(true)
+
+	dbmap.AddTableWithName(Delivery{}, "deliveries").SetKeys(true, "id")
+	dbmap.AddTableWithName(OutboxEntry{}, "outbox").SetKeys(true, "id")
+	dbmap.AddTableWithName(ChannelRun{}, "channel_runs").SetKeys(false, "Channel")
+	dbmap.AddTableWithName(SuppressedNotifications{}, "suppressed_notifications").SetKeys(false, "Channel", "Origin")
+
+	config, err := LoadConfig(configPath)
+	if err != nil {
+		return fmt.Errorf("could not open config at '%s' with error: %v", configPath, err)
+	}
+
+	channelNames := make([]string, len(config.Channels))
+	i := 0
+	for cn, _ := range config.Channels {
+		channelNames[i] = cn
+		i++
+	}
+
+	logger.Infof("initialized with channels: %v", strings.Join(channelNames, ", "))
+
+	b.DbMap = dbmap
+	b.config = config
+
+	b.quitChannel = make(chan struct{})
+	b.forceConfigReload = make(chan struct{})
+	b.forceNotificationDelivery = make(chan struct{})
+	b.outboxWakeup = make(chan struct{}, 1)
+	b.outboxJobs = make(chan *OutboxEntry)
+	b.started = make(chan struct{})
+	b.hub = backend.NewHub()
+	b.health = newHealthMonitor(b.Clock.Now())
+	b.registerGauges()
+	return nil
+}
+
+// Rewrites the ? placeholders of a query into the ones of the dialect. All the
+// queries in this package are written with ? and must go through this.
+func (b *SQLNotificationBackend) rebind(query string) string {
+	var buf bytes.Buffer
+	n := 0
+	for _, r := range query {
+		if r == '?' {
+			buf.WriteString(b.Dialect.BindVar(n))
+			n++
+			continue
+		}
+
+		buf.WriteRune(r)
+	}
+
+	return buf.String()
+}
+
+// The algorithm of this function goes as follows:
+//
+// 0. Ensure the channel exists
+// 1. Save it regardless of what happens.
+// 2. Check if the backend disabled sending of notifications
+// 3. See if the channel should send immediately.
+// 4. If yes, put it in the outbox in the same transaction, otherwise don't.
+//    If it is to be sent later, the outbox holds on to it until then.
+// 5. Publish it to the hub once it is committed.
+// 6. Wake up the outbox dispatcher, which hands it to a worker to be sent.
+func (b *SQLNotificationBackend) QueueNotification(notification backend.Notification) error {
+	results, err := b.QueueNotifications([]backend.Notification{notification})
+	if err != nil {
+		return err
+	}
+
+	return results[0].Error
+}
+
+// Every notification of the batch goes through the steps of QueueNotification,
+// except that they are all saved in one transaction. The notifications for
+// channels that do not exist are left out of it, as are the ones with the
+// idempotency key of a notification created by the same origin within the
+// window. The duplicates within the batch are found as well, as the lookup is
+// done in the transaction.
+func (b *SQLNotificationBackend) QueueNotifications(notifications []backend.Notification) ([]backend.QueueResult, error) {
+	return b.queueNotificationsWith(notifications, nil)
+}
+
+// Queues the notifications as QueueNotifications does, and also runs along in
+// the same transaction if it is set.
+func (b *SQLNotificationBackend) queueNotificationsWith(notifications []backend.Notification, along func(tx *gorp.Transaction) error) ([]backend.QueueResult, error) {
+	results := make([]backend.QueueResult, len(notifications))
+	queued := make([]*Notification, 0, len(notifications))
+	anySentNow := false
+
+	// The notifications are created at currentTime, so that the window is
+	// measured with the same clock.
+	currentTime := b.Clock.Now()
+	idempotencyKeySince := b.idempotencyKeySince(currentTime)
+
+	start := time.Now()
+	tx, err := b.Begin()
+	if err != nil {
+		return nil, err
+	}
+
+	for i, notification := range notifications {
+		if notification.IdempotencyKey != "" {
+			id, err := b.findIdempotentNotification(tx, notification.Origin, notification.IdempotencyKey, idempotencyKeySince)
+			if err != nil {
+				tx.Rollback()
+				return nil, err
+			}
+
+			if id != 0 {
+				results[i] = backend.QueueResult{Id: id, Duplicate: true}
+				continue
+			}
+		}
+
+		channel, _ := b.GetChannelAndItsSubscribers(notification.Channel)
+		if channel == nil {
+			results[i].Error = backend.ChannelNotFound{ChannelName: notification.Channel}
+			continue
+		}
+
+		localNotification := &Notification{
+			Notification: notification,
+		}
+		localNotification.CreatedAt = currentTime.UnixNano()
+
+		sendNow, err := b.queueNotification(tx, localNotification, channel)
+		if err != nil {
+			tx.Rollback()
+			return nil, err
+		}
+
+		results[i].Id = localNotification.Id
+		queued = append(queued, localNotification)
+		anySentNow = anySentNow || sendNow
+	}
+
+	if along != nil {
+		err = along(tx)
+		if err != nil {
+			tx.Rollback()
+			return nil, err
+		}
+	}
+
+	if anySentNow && b.OutboxSignal != nil {
+		err = b.OutboxSignal.Notify(tx)
+		if err != nil {
+			tx.Rollback()
+			return nil, err
+		}
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return nil, err
+	}
+
+	insertDuration.Observe(time.Since(start).Seconds())
+
+	for _, n := range queued {
+		b.hub.Publish(backend.Event{
+			Type:         backend.NotificationQueued,
+			Notification: *n.toStored(),
+		})
+	}
+
+	if anySentNow {
+		b.wakeOutboxDispatcher()
+	}
+
+	return results, nil
+}
+
+func (b *SQLNotificationBackend) FindIdempotentNotification(origin, key string) (int64, error) {
+	return b.findIdempotentNotification(b.DbMap, origin, key, b.idempotencyKeySince(b.Clock.Now()))
+}
+
+// Notifications created before then no longer make others with their
+// idempotency key duplicates.
+func (b *SQLNotificationBackend) idempotencyKeySince(currentTime time.Time) int64 {
+	b.config.Lock()
+	idempotencyKeyWindow := b.config.IdempotencyKeyWindow
+	b.config.Unlock()
+
+	return currentTime.Add(-idempotencyKeyWindow).UnixNano()
+}
+
+// The id of the latest notification of the origin with the idempotency key
+// created since then, 0 if there is none.
+//
+// This guards against retries. Two transactions queueing the same key at the
+// same time can still both store their notification.
+func (b *SQLNotificationBackend) findIdempotentNotification(s gorp.SqlExecutor, origin, key string, since int64) (int64, error) {
+	return s.SelectInt(b.rebind("SELECT COALESCE(MAX(id), 0) FROM notifications WHERE IdempotencyKey = ? AND Origin = ? AND CreatedAt >= ?"), key, origin, since)
+}
+
+// Saves the notification and, if it is to be sent now, its outbox entry.
+// Returns whether it is to be sent now.
+func (b *SQLNotificationBackend) queueNotification(tx *gorp.Transaction, n *Notification, channel *Channel) (bool, error) {
+	sendNow := !b.NeverSendNotifications && (channel.ShouldSendImmediately() || n.Priority == backend.UrgentPriority)
+
+	err := n.insert(tx)
+	if err != nil {
+		return false, err
+	}
+
+	if !sendNow {
+		return false, nil
+	}
+
+	// Held in the outbox until then if it is to be sent later.
+	entry := &OutboxEntry{NotificationId: n.Id}
+	if n.SendAt > b.Clock.Now().UnixNano() {
+		entry.NotBefore = n.SendAt
+	}
+
+	return true, tx.Insert(entry)
+}
+
+// Only the leader delivers scheduled notifications and retries failed ones.
+// Whether we are the leader is found out before starting, so the leader
+// catches up on missed runs right away.
+func (b *SQLNotificationBackend) Start(wg *sync.WaitGroup) {
+	if !b.NeverSendNotifications {
+		b.renewLeaseLogIfError(b.Clock.Now())
+	}
+
+	wg.Add(numberOfBackgroundTasks)
+	go func() {
+		defer wg.Done()
+
+		b.startLeaseKeeper()
+	}()
+
+	go func() {
+		defer wg.Done()
+
+		b.startConfigReloader()
+	}()
+
+	go func() {
+		defer wg.Done()
+
+		b.startNotificationDelivery()
+	}()
+
+	go func() {
+		defer wg.Done()
+
+		b.startDeliveryRetrier()
+	}()
+
+	go func() {
+		defer wg.Done()
+
+		b.startOutboxDispatcher()
+	}()
+
+	workers := b.OutboxWorkers
+	if workers <= 0 {
+		workers = defaultOutboxWorkers
+	}
+
+	wg.Add(workers)
+	b.outboxWorkers.Add(workers)
+	for i := 0; i < workers; i++ {
+		go func() {
+			defer wg.Done()
+			defer b.outboxWorkers.Done()
+
+			b.startOutboxWorker()
+		}()
+	}
+}
+
+// Stops the background tasks and waits for the notifications that are being
+// sent from the outbox to finish. Whatever is left in the outbox is sent on
+// the next start.
+func (b *SQLNotificationBackend) Shutdown() {
+	close(b.quitChannel)
+	close(b.forceConfigReload)
+	close(b.forceNotificationDelivery)
+
+	b.BlockUntilReady()
+	b.outboxWorkers.Wait()
+	b.hub.Close()
+}
+
+// The events of the notifications of this process.
+func (b *SQLNotificationBackend) Hub() *backend.Hub {
+	return b.hub
+}
+
+func (b *SQLNotificationBackend) BlockUntilReady() {
+	for i := 0; i < numberOfBackgroundTasks; i++ {
+		_, open := <-b.started
+		if !open {
+			return
+		}
+	}
+
+	close(b.started)
+}
+
+func (b *SQLNotificationBackend) startedOneTask(name string) {
+	b.taskRan(name)
+	b.started <- struct{}{}
+}
+
+// When using this function in combination with GetSubscribers(), there is no
+// guarentee that the two lists are not coming from two different versions of
+// the configuration.
+//
+// There is no public methods for getting them under one version.
+func (b *SQLNotificationBackend) GetChannels() []*Channel {
+	b.config.Lock()
+	defer b.config.Unlock()
+
+	channelsList := make([]*Channel, len(b.config.Channels))
+	i := 0
+	for _, channel := range b.config.Channels {
+		channelsList[i] = channel
+		i++
+	}
+
+	return channelsList
+}
+
+func (b *SQLNotificationBackend) ForceConfigReload() {
+	b.forceConfigReload <- struct{}{}
+}
+
+func (b *SQLNotificationBackend) ForceNotificationDelivery() {
+	b.forceNotificationDelivery <- struct{}{}
+}
+
+// Gets the channel and its subscribers.
+//
+// This function guarentees that both channels and subscribers are from one
+// version of the config, but it does not guarentee that this happens.
+func (b *SQLNotificationBackend) GetChannelAndItsSubscribers(channelName string) (*Channel, []backend.Subscriber) {
+	// We need to lock here because we want to make sure that when we do send
+	// a notification, we are not in the middle of a reload for configuration
+	// and try to send to the wrong subscriber.
+	//
+	// Basically, always ensure that we are using one version of the config,
+	// not two half copies.
+	// Stupid.
+	b.config.Lock()
+	channel, found := b.config.Channels[channelName]
+	subscribers := b.config.Subscribers
+	b.config.Unlock()
+
+	if !found {
+		return nil, nil
+	}
+
+	channelSubscribers := make([]backend.Subscriber, 0)
+
+	for _, subscriberName := range channel.Subscribers {
+		subscriber, found := subscribers[subscriberName]
+		if !found {
+			logger.WithField("subscriber", subscriberName).Warnf("subscriber not found")
+			continue
+		}
+
+		channelSubscribers = append(channelSubscribers, subscriber)
+	}
+
+	return channel, channelSubscribers
+}
+
+func (b *SQLNotificationBackend) getSubscriber(uniqueName string) (backend.Subscriber, bool) {
+	b.config.Lock()
+	subscriber, found := b.config.Subscribers[uniqueName]
+	b.config.Unlock()
+
+	return subscriber, found
+}
+
+func (b *SQLNotificationBackend) GetSubscribers() []backend.Subscriber {
+	b.config.Lock()
+	defer b.config.Unlock()
+
+	subscribersList := make([]backend.Subscriber, len(b.config.Subscribers))
+	i := 0
+	for _, subscriber := range b.config.Subscribers {
+		subscribersList[i] = subscriber
+		i++
+	}
+
+	return subscribersList
+}
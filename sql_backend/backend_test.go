@@ -0,0 +1,365 @@
+package sql_backend
+
+import (
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/facebookgo/clock"
+	"gitlab.com/shuhao/towncrier/backend"
+	"gitlab.com/shuhao/towncrier/testhelpers"
+
+	. "gopkg.in/check.v1"
+	"gopkg.in/gorp.v1"
+)
+
+var logrusTestHook = testhelpers.NewLogrusTestHook()
+
+func Test(t *testing.T) {
+	realLogger.Hooks.Add(logrusTestHook)
+
+	TestingT(t)
+}
+
+const testQueueNotificationSendTimeout = 5 * time.Second
+
+type SQLNotificationBackendSuite struct {
+	backend  *SQLNotificationBackend
+	notifier *testhelpers.TestNotifier
+
+	jimmy        backend.Subscriber
+	timmy        backend.Subscriber
+	bob          backend.Subscriber
+	notification backend.Notification
+	channel1     *Channel
+	channel2     *Channel
+}
+
+var _ = Suite(&SQLNotificationBackendSuite{})
+
+func (s *SQLNotificationBackendSuite) SetUpSuite(c *C) {
+	s.jimmy = backend.Subscriber{
+		UniqueName:  "jimmy",
+		Name:        "Jimmy the Cat",
+		Email:       "jimmy@the.cat",
+		PhoneNumber: "123-456-7890",
+	}
+
+	s.timmy = backend.Subscriber{
+		UniqueName:  "timmy",
+		Name:        "Timmy the Cat",
+		Email:       "timmy@the.cat",
+		PhoneNumber: "123-456-7890",
+	}
+
+	s.bob = backend.Subscriber{
+		UniqueName:  "bob",
+		Name:        "Bob the Cat",
+		Email:       "bob@the.cat",
+		PhoneNumber: "098-765-4321",
+	}
+
+	s.notification = backend.Notification{
+		Subject:  "subject",
+		Content:  "content",
+		Origin:   "origin",
+		Tags:     []string{"tag1", "tag2"},
+		Priority: backend.NormalPriority,
+	}
+
+	s.channel1 = &Channel{
+		Name:         "Channel1",
+		Subscribers:  []string{"jimmy"},
+		Notifiers:    []string{"testnotify"},
+		TimeToNotify: "@immediately",
+	}
+
+	s.channel2 = &Channel{
+		Name:         "Channel2",
+		Subscribers:  []string{"jimmy", "bob"},
+		Notifiers:    []string{"testnotify"},
+		TimeToNotify: "@daily",
+	}
+}
+
+func (s *SQLNotificationBackendSuite) SetUpTest(c *C) {
+	logrusTestHook.ClearLogs()
+
+	s.backend = &SQLNotificationBackend{ExclusiveDatabase: true}
+	err := initializeTestBackend(s.backend)
+	c.Assert(err, IsNil)
+
+	testhelpers.ResetTestDatabase(s.backend.DbMap)
+
+	// Most tests run the background tasks directly at arbitrary times, which
+	// only do something for the leader.
+	s.backend.leaseExpiresAt = time.Now().Add(24 * time.Hour)
+
+	s.notifier = testhelpers.NewTestNotifier()
+	backend.ClearAllNotifiers()
+	backend.RegisterNotifier(s.notifier)
+
+	logrusTestHook.ClearLogs()
+}
+
+func (s *SQLNotificationBackendSuite) TestBackendInitialize(c *C) {
+	s.backend = &SQLNotificationBackend{
+		NeverSendNotifications: false,
+		quitChannel:            make(chan struct{}),
+	}
+
+	err := initializeTestBackend(s.backend)
+	c.Assert(err, IsNil)
+
+	c.Assert(s.backend.config, NotNil)
+	c.Assert(s.backend.config.Subscribers, HasLen, 2)
+	c.Assert(s.backend.config.Subscribers["jimmy"], DeepEquals, s.jimmy)
+	c.Assert(s.backend.config.Subscribers["bob"], DeepEquals, s.bob)
+
+	c.Assert(s.backend.config.Channels, HasLen, 2)
+	c.Assert(s.backend.config.Channels["Channel1"], DeepEquals, s.channel1)
+	c.Assert(s.backend.config.Channels["Channel2"], DeepEquals, s.channel2)
+}
+
+func (s *SQLNotificationBackendSuite) TestQueueNotificationSendImmediately(c *C) {
+	s.startBackend()
+
+	notification := s.notification
+	notification.Channel = "Channel1"
+
+	err := s.backend.QueueNotification(notification)
+	c.Assert(err, IsNil)
+
+	timedout := testhelpers.BlockUntilSatisfiedOrTimeout(func() bool {
+		s.notifier.Lock()
+		defer s.notifier.Unlock()
+		return len(s.notifier.Logs) >= 1
+	}, testQueueNotificationSendTimeout)
+	c.Assert(timedout, Equals, false)
+
+	s.notifier.Lock()
+	c.Assert(s.notifier.Logs, HasLen, 1)
+	c.Assert(s.notifier.Logs[0].Notifications, HasLen, 1)
+	s.checkNotificationEquality(c, s.notifier.Logs[0].Notifications[0], notification)
+	c.Assert(s.notifier.Logs[0].Subscriber, DeepEquals, s.jimmy)
+	s.notifier.Unlock()
+
+	// Waits for the outbox workers to finish up.
+	s.backend.Shutdown()
+
+	notifications := []*Notification{}
+	_, err = s.backend.Select(&notifications, "SELECT * FROM notifications WHERE Channel = ?", notification.Channel)
+	c.Assert(err, IsNil)
+	c.Assert(notifications, HasLen, 1)
+
+	s.checkNotificationEquality(c, notifications[0].Notification, notification)
+	c.Assert(notifications[0].Delivered, Equals, true)
+}
+
+func (s *SQLNotificationBackendSuite) TestQueueNotificationPublishesEvents(c *C) {
+	subscription := s.backend.Hub().Subscribe(backend.EventFilter{Channel: "Channel1"})
+	s.startBackend()
+
+	notification := s.notification
+	notification.Channel = "Channel2"
+	c.Assert(s.backend.QueueNotification(notification), IsNil)
+
+	notification.Channel = "Channel1"
+	c.Assert(s.backend.QueueNotification(notification), IsNil)
+
+	nextEvent := func() backend.Event {
+		select {
+		case event := <-subscription.Events():
+			return event
+		case <-time.After(testQueueNotificationSendTimeout):
+			c.Fatal("timed out waiting for an event")
+			return backend.Event{}
+		}
+	}
+
+	event := nextEvent()
+	c.Assert(event.Type, Equals, backend.NotificationQueued)
+	c.Assert(event.Notification.Id, Not(Equals), int64(0))
+	c.Assert(event.Notification.Delivered, Equals, false)
+	s.checkNotificationEquality(c, event.Notification.Notification, notification)
+
+	event = nextEvent()
+	c.Assert(event.Type, Equals, backend.DeliveryUpdated)
+	c.Assert(event.Delivery.Subscriber, Equals, "jimmy")
+	c.Assert(event.Delivery.Status, Equals, DeliverySent)
+
+	event = nextEvent()
+	c.Assert(event.Type, Equals, backend.NotificationDelivered)
+	c.Assert(event.Notification.Delivered, Equals, true)
+
+	s.backend.Shutdown()
+
+	_, open := <-subscription.Events()
+	c.Assert(open, Equals, false)
+}
+
+func (s *SQLNotificationBackendSuite) TestQueueUrgentNotificationSendImmediately(c *C) {
+	s.startBackend()
+
+	notification := s.notification
+	notification.Channel = "Channel2"
+	notification.Priority = backend.UrgentPriority
+
+	err := s.backend.QueueNotification(notification)
+	c.Assert(err, IsNil)
+
+	timedout := testhelpers.BlockUntilSatisfiedOrTimeout(func() bool {
+		s.notifier.Lock()
+		defer s.notifier.Unlock()
+		return len(s.notifier.Logs) >= 2
+	}, testQueueNotificationSendTimeout)
+	c.Assert(timedout, Equals, false)
+
+	s.notifier.Lock()
+	c.Assert(s.notifier.Logs, HasLen, 2)
+	c.Assert(s.notifier.Logs[0].Notifications, HasLen, 1)
+	s.checkNotificationEquality(c, s.notifier.Logs[0].Notifications[0], notification)
+
+	c.Assert(s.notifier.Logs[1].Notifications, HasLen, 1)
+	s.checkNotificationEquality(c, s.notifier.Logs[1].Notifications[0], notification)
+
+	subscribersMatched := 0
+	for _, subscriber := range []backend.Subscriber{s.bob, s.jimmy} {
+		for _, log := range s.notifier.Logs {
+			if log.Subscriber.Name == subscriber.Name {
+				subscribersMatched++
+			}
+		}
+	}
+
+	s.notifier.Unlock()
+	c.Assert(subscribersMatched, Equals, 2)
+
+	// Waits for the outbox workers to finish up.
+	s.backend.Shutdown()
+
+	notifications := []*Notification{}
+	_, err = s.backend.Select(&notifications, "SELECT * FROM notifications WHERE Channel = ?", notification.Channel)
+	c.Assert(err, IsNil)
+	c.Assert(notifications, HasLen, 1)
+
+	s.checkNotificationEquality(c, notifications[0].Notification, notification)
+	c.Assert(notifications[0].Delivered, Equals, true)
+}
+
+func (s *SQLNotificationBackendSuite) TestQueueNotificationDoNotSendImmediately(c *C) {
+	notification := s.notification
+	notification.Channel = "Channel2"
+
+	err := s.backend.QueueNotification(notification)
+	c.Assert(err, IsNil)
+
+	time.Sleep(200 * time.Microsecond)
+
+	c.Assert(s.notifier.Logs, HasLen, 0)
+
+	notifications := []*Notification{}
+	_, err = s.backend.Select(&notifications, "SELECT * FROM notifications WHERE Channel = ?", notification.Channel)
+	c.Assert(err, IsNil)
+	c.Assert(notifications, HasLen, 1)
+
+	s.checkNotificationEquality(c, notifications[0].Notification, notification)
+	c.Assert(notifications[0].Delivered, Equals, false)
+}
+
+func (s *SQLNotificationBackendSuite) TestQueueNotificationNeverSendNotification(c *C) {
+	s.backend.NeverSendNotifications = true
+	defer func() { s.backend.NeverSendNotifications = false }()
+
+	notification := s.notification
+	notification.Channel = "Channel1"
+
+	err := s.backend.QueueNotification(notification)
+	c.Assert(err, IsNil)
+
+	time.Sleep(200 * time.Microsecond)
+
+	c.Assert(s.notifier.Logs, HasLen, 0)
+
+	notifications := []*Notification{}
+	_, err = s.backend.Select(&notifications, "SELECT * FROM notifications WHERE Channel = ?", notification.Channel)
+	c.Assert(err, IsNil)
+	c.Assert(notifications, HasLen, 1)
+
+	s.checkNotificationEquality(c, notifications[0].Notification, notification)
+	c.Assert(notifications[0].Delivered, Equals, false)
+}
+
+func (s *SQLNotificationBackendSuite) TestQueueNotificationWithInvalidChannelWillNotSave(c *C) {
+	notification := s.notification
+	notification.Channel = "invalid-channel"
+
+	err := s.backend.QueueNotification(notification)
+	c.Assert(err, NotNil)
+	channelNotFoundErr, ok := err.(backend.ChannelNotFound)
+	c.Assert(ok, Equals, true)
+	c.Assert(channelNotFoundErr.ChannelName, Equals, "invalid-channel")
+
+	notifications := []*Notification{}
+	_, err = s.backend.Select(&notifications, "SELECT * FROM notifications WHERE Channel = ?", notification.Channel)
+	c.Assert(err, IsNil)
+	c.Assert(notifications, HasLen, 0)
+}
+
+func (s *SQLNotificationBackendSuite) TestQueueNotificationIdempotencyKeyExpires(c *C) {
+	// A CreatedAt of 0 is taken as not set, so the mock clock has to be past
+	// its zero time.
+	mock := clock.NewMock()
+	mock.Add(time.Hour)
+	s.backend.Clock = mock
+
+	notification := s.notification
+	notification.Channel = s.channel2.Name
+	notification.IdempotencyKey = "key"
+
+	results, err := s.backend.QueueNotifications([]backend.Notification{notification})
+	c.Assert(err, IsNil)
+	c.Assert(results[0].Error, IsNil)
+	c.Assert(results[0].Duplicate, Equals, false)
+	firstId := results[0].Id
+
+	mock.Add(s.backend.config.IdempotencyKeyWindow)
+	results, err = s.backend.QueueNotifications([]backend.Notification{notification})
+	c.Assert(err, IsNil)
+	c.Assert(results[0].Duplicate, Equals, true)
+	c.Assert(results[0].Id, Equals, firstId)
+
+	mock.Add(time.Nanosecond)
+	results, err = s.backend.QueueNotifications([]backend.Notification{notification})
+	c.Assert(err, IsNil)
+	c.Assert(results[0].Duplicate, Equals, false)
+	c.Assert(results[0].Id, Not(Equals), firstId)
+}
+
+func (s *SQLNotificationBackendSuite) TestRebind(c *C) {
+	query := "SELECT * FROM outbox WHERE id = ? AND ClaimedUntil <= ?"
+	c.Assert(s.backend.rebind(query), Equals, query)
+
+	s.backend.Dialect = gorp.PostgresDialect{}
+	c.Assert(s.backend.rebind(query), Equals, "SELECT * FROM outbox WHERE id = $1 AND ClaimedUntil <= $2")
+}
+
+func (s *SQLNotificationBackendSuite) TestGetChannels(c *C) {
+	channels := channelsArray(s.backend.GetChannels())
+	c.Assert(channels, HasLen, 2)
+
+	sort.Sort(channels)
+
+	c.Assert(channels[0], DeepEquals, s.channel1)
+	c.Assert(channels[1], DeepEquals, s.channel2)
+}
+
+func (s *SQLNotificationBackendSuite) TestGetSubscribers(c *C) {
+	subscribers := subscribersArray(s.backend.GetSubscribers())
+	c.Assert(subscribers, HasLen, 2)
+
+	sort.Sort(subscribers)
+
+	c.Assert(subscribers[0], DeepEquals, s.bob)
+	c.Assert(subscribers[1], DeepEquals, s.jimmy)
+}
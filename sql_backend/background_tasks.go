@@ -0,0 +1,339 @@
+package sql_backend
+
+import (
+	"time"
+
+	"github.com/facebookgo/clock"
+	"gitlab.com/shuhao/towncrier/backend"
+)
+
+const (
+	reloadConfigInterval         = 5 * time.Minute
+	notificationDeliveryInterval = time.Minute
+	deliveryRetryInterval        = 30 * time.Second
+	outboxPollInterval           = 30 * time.Second
+	outboxClaimTimeout           = 5 * time.Minute
+	scheduledDeliveryTimeout     = 5 * time.Minute
+	numberOfBackgroundTasks      = 5
+)
+
+func (b *SQLNotificationBackend) doConfigReloadLogIfError() {
+	logger.Info("reloading config")
+	err := b.config.Reload()
+	b.configReloaded(err)
+	if err != nil {
+		configReloads.Inc("failure")
+		logger.WithField("error", err).Error("failed to reload configuration")
+		return
+	}
+
+	configReloads.Inc("success")
+}
+
+// The algorithm of this function goes as follows:
+//
+// 0. Queue the summaries of the suppressed notifications that are due, so the
+//    scheduled channels send them with this run
+// 1. For each channel, compute the scheduled runs since the last run that are
+//    due now. Missed runs are collapsed into one.
+// 2. If there are any, get the list of notifications that's unsent
+// 3. Create their deliveries and record the run, in one transaction, so the run
+//    either happens again or its deliveries are left for the retrier
+// 4. Send each notifications
+//
+func (b *SQLNotificationBackend) deliverNotificationsLogIfError(currentTime time.Time) {
+	if !b.isLeader(currentTime) {
+		return
+	}
+
+	logger.Info("checking for notification delivery")
+
+	b.queueSuppressedSummariesLogIfError(currentTime)
+
+	b.config.Lock()
+	channels := b.config.Channels
+	b.config.Unlock()
+
+	for _, channel := range channels {
+		if channel.ShouldSendImmediately() {
+			continue
+		}
+
+		localLog := logger.WithField("channel", channel.Name)
+
+		lastRun, err := b.getLastChannelRun(b.DbMap, channel, currentTime)
+		if err != nil {
+			localLog.WithField("error", err).Error("cannot get the last run from the database")
+			continue
+		}
+
+		dueRun, dueRuns := channel.DueRunsSince(lastRun, currentTime)
+		if dueRuns == 0 {
+			continue
+		}
+
+		if dueRuns > 1 {
+			localLog.WithField("last_run", lastRun).Warnf("catching up on %d missed runs with one delivery", dueRuns)
+		}
+
+		// Notifications in the outbox are already being sent on their own, and
+		// the ones to be sent later wait for the first run after their SendAt.
+		var notifications []*Notification
+		_, err = b.Select(&notifications, b.rebind("SELECT * FROM notifications WHERE Delivered = ? AND Channel = ? AND SendAt <= ? AND id NOT IN (SELECT NotificationId FROM outbox)"), false, channel.Name, currentTime.UnixNano())
+		if err != nil {
+			localLog.WithField("error", err).Error("cannot select notifications from the database")
+			continue
+		}
+
+		c, subscribers := b.GetChannelAndItsSubscribers(channel.Name)
+		if c == nil {
+			localLog.Warnf("channel disappeared during sending, ignoring")
+			continue
+		}
+
+		// The notifications are marked as delivered asynchronously, so the run
+		// has to be recorded now to not pick them up again on the next check.
+		err = b.recordChannelRunWithDeliveries(c, subscribers, notifications, dueRun, currentTime.Add(scheduledDeliveryTimeout))
+		if err != nil {
+			localLog.WithField("error", err).Error("cannot record the run in the database")
+			continue
+		}
+
+		if len(notifications) == 0 {
+			continue
+		}
+
+		localLog.Infof("found %d notifications to deliver to %d subscribers", len(notifications), len(channel.Subscribers))
+
+		// We need this to be parallel as things can block and be really slow.
+		go func(notifications []*Notification, channel *Channel, subscribers []backend.Subscriber) {
+			err := b.sendNotifications(notifications, channel, subscribers)
+			if err != nil {
+				localLog.WithField("error", err).Error("failed to send notification")
+			}
+
+			localLog.Info("notifications successfully sent")
+		}(notifications, c, subscribers)
+	}
+}
+
+func (b *SQLNotificationBackend) startConfigReloader() {
+	// The timers of a mock clock block until they are received from, so they
+	// are always stopped.
+	var timer *clock.Timer
+
+	logger.Info("started config reloader")
+	b.startedOneTask(configReloaderTask)
+	for {
+		timer = b.Clock.Timer(reloadConfigInterval)
+		select {
+		case <-b.quitChannel:
+			goto shutdown
+		case <-timer.C:
+			b.doConfigReloadLogIfError()
+		case _, open := <-b.forceConfigReload:
+			if !open {
+				goto shutdown
+			}
+
+			b.doConfigReloadLogIfError()
+		}
+
+		timer.Stop()
+		b.taskRan(configReloaderTask)
+	}
+
+shutdown:
+	if timer != nil {
+		timer.Stop()
+	}
+
+	b.taskStopped(configReloaderTask)
+	logger.Info("shutting down config reloader")
+	return
+}
+
+func (b *SQLNotificationBackend) startLeaseKeeper() {
+	var timer *clock.Timer
+
+	logger.Info("started lease keeper")
+	b.startedOneTask(leaseKeeperTask)
+
+	if b.NeverSendNotifications {
+		b.taskDisabled(leaseKeeperTask)
+		logger.Info("we should never send notifications, shutting down...")
+		goto shutdown
+	}
+
+	for {
+		timer = b.Clock.Timer(leaseRenewInterval)
+		select {
+		case <-b.quitChannel:
+			b.releaseLeaseLogIfError()
+			goto shutdown
+		case <-timer.C:
+			b.renewLeaseLogIfError(b.Clock.Now())
+		}
+
+		timer.Stop()
+		b.taskRan(leaseKeeperTask)
+	}
+
+shutdown:
+	if timer != nil {
+		timer.Stop()
+	}
+
+	b.taskStopped(leaseKeeperTask)
+	logger.Info("shutting down lease keeper")
+	return
+}
+
+func (b *SQLNotificationBackend) startNotificationDelivery() {
+	var timer *clock.Timer
+
+	logger.Info("started notification delivery")
+
+	if b.NeverSendNotifications {
+		b.startedOneTask(notificationDeliveryTask)
+		b.taskDisabled(notificationDeliveryTask)
+		logger.Info("we should never send notifications, shutting down...")
+		goto shutdown
+	}
+
+	// Catch up on what was missed while we were not running before we say we
+	// are ready.
+	b.deliverNotificationsLogIfError(b.Clock.Now())
+	b.startedOneTask(notificationDeliveryTask)
+
+	for {
+		timer = b.Clock.Timer(notificationDeliveryInterval)
+		select {
+		case <-b.quitChannel:
+			goto shutdown
+		case <-timer.C:
+			b.deliverNotificationsLogIfError(b.Clock.Now())
+		case _, open := <-b.forceNotificationDelivery:
+			if !open {
+				goto shutdown
+			}
+
+			b.deliverNotificationsLogIfError(b.Clock.Now())
+		}
+
+		timer.Stop()
+		b.taskRan(notificationDeliveryTask)
+	}
+
+shutdown:
+	if timer != nil {
+		timer.Stop()
+	}
+
+	b.taskStopped(notificationDeliveryTask)
+	logger.Info("shutting down notification delivery")
+	return
+}
+
+func (b *SQLNotificationBackend) startDeliveryRetrier() {
+	var timer *clock.Timer
+
+	logger.Info("started delivery retrier")
+	b.startedOneTask(deliveryRetrierTask)
+
+	if b.NeverSendNotifications {
+		b.taskDisabled(deliveryRetrierTask)
+		logger.Info("we should never send notifications, shutting down...")
+		goto shutdown
+	}
+
+	for {
+		timer = b.Clock.Timer(deliveryRetryInterval)
+		select {
+		case <-b.quitChannel:
+			goto shutdown
+		case <-timer.C:
+			b.retryDeliveriesLogIfError(b.Clock.Now())
+		}
+
+		timer.Stop()
+		b.taskRan(deliveryRetrierTask)
+	}
+
+shutdown:
+	if timer != nil {
+		timer.Stop()
+	}
+
+	b.taskStopped(deliveryRetrierTask)
+	logger.Info("shutting down delivery retrier")
+	return
+}
+
+func (b *SQLNotificationBackend) startOutboxDispatcher() {
+	var timer *clock.Timer
+
+	// Receiving from a nil channel blocks forever, which is what we want if
+	// there is no signal.
+	var wakeups <-chan struct{}
+	if b.OutboxSignal != nil {
+		wakeups = b.OutboxSignal.Wakeups()
+	}
+
+	logger.Info("started outbox dispatcher")
+	b.startedOneTask(outboxDispatcherTask)
+
+	if b.NeverSendNotifications {
+		b.taskDisabled(outboxDispatcherTask)
+		logger.Info("we should never send notifications, shutting down...")
+		goto shutdown
+	}
+
+	// Anything left over from the last run is sent first.
+	if b.ExclusiveDatabase {
+		b.releaseOutboxClaimsLogIfError()
+	}
+	if b.dispatchOutboxLogIfError(b.Clock.Now()) {
+		goto shutdown
+	}
+
+	for {
+		timer = b.Clock.Timer(outboxPollInterval)
+		select {
+		case <-b.quitChannel:
+			goto shutdown
+		case <-b.outboxWakeup:
+			if b.dispatchOutboxLogIfError(b.Clock.Now()) {
+				goto shutdown
+			}
+		case <-wakeups:
+			if b.dispatchOutboxLogIfError(b.Clock.Now()) {
+				goto shutdown
+			}
+		case <-timer.C:
+			if b.dispatchOutboxLogIfError(b.Clock.Now()) {
+				goto shutdown
+			}
+		}
+
+		timer.Stop()
+		b.taskRan(outboxDispatcherTask)
+	}
+
+shutdown:
+	if timer != nil {
+		timer.Stop()
+	}
+
+	b.taskStopped(outboxDispatcherTask)
+	// The workers finish whatever they have been handed and then exit.
+	close(b.outboxJobs)
+	logger.Info("shutting down outbox dispatcher")
+	return
+}
+
+func (b *SQLNotificationBackend) startOutboxWorker() {
+	for entry := range b.outboxJobs {
+		b.processOutboxEntryLogIfError(entry)
+	}
+}
@@ -1,4 +1,4 @@
-package sqlite_backend
+package sql_backend
 
 import (
 	"io/ioutil"
@@ -16,13 +16,13 @@ import (
 
 const testBackgroundTaskTimeout = 5 * time.Second
 
-func (s *SQLiteNotificationBackendSuite) TestStartsConfigReloaderAndNotificationDelivery(c *C) {
+func (s *SQLNotificationBackendSuite) TestStartsConfigReloaderAndNotificationDelivery(c *C) {
 	wg := &sync.WaitGroup{}
 	s.backend.Start(wg)
 	s.backend.BlockUntilReady()
 	defer s.backend.Shutdown()
 
-	c.Assert(logrusTestHook.Logs[logrus.InfoLevel], HasLen, 2)
+	c.Assert(logrusTestHook.Logs[logrus.InfoLevel], HasLen, 6)
 	entries := make(map[string]bool)
 
 	for _, entry := range logrusTestHook.Logs[logrus.InfoLevel] {
@@ -31,6 +31,10 @@ func (s *SQLiteNotificationBackendSuite) TestStartsConfigReloaderAndNotification
 
 	c.Assert(entries["started config reloader"], Equals, true)
 	c.Assert(entries["started notification delivery"], Equals, true)
+	c.Assert(entries["started delivery retrier"], Equals, true)
+	c.Assert(entries["started outbox dispatcher"], Equals, true)
+	c.Assert(entries["started lease keeper"], Equals, true)
+	c.Assert(entries["checking for notification delivery"], Equals, true)
 
 	err := changeTestConfig()
 	c.Assert(err, IsNil)
@@ -56,7 +60,7 @@ func (s *SQLiteNotificationBackendSuite) TestStartsConfigReloaderAndNotification
 	c.Assert(subscribers[1], DeepEquals, s.timmy)
 }
 
-func (s *SQLiteNotificationBackendSuite) TestDoConfigReloadLogOnError(c *C) {
+func (s *SQLNotificationBackendSuite) TestDoConfigReloadLogOnError(c *C) {
 	err := memorizeOriginalConfig()
 	c.Assert(err, IsNil)
 
@@ -83,7 +87,7 @@ func (s *SQLiteNotificationBackendSuite) TestDoConfigReloadLogOnError(c *C) {
 	c.Assert(subscribers[1], DeepEquals, s.jimmy)
 }
 
-func (s *SQLiteNotificationBackendSuite) TestDeliverNotificationsWillNotWithoutNotifications(c *C) {
+func (s *SQLNotificationBackendSuite) TestDeliverNotificationsWillNotWithoutNotifications(c *C) {
 	currentTime, err := time.Parse(time.RFC3339, "2015-09-05T23:59:59Z")
 	c.Assert(err, IsNil)
 	s.backend.deliverNotificationsLogIfError(currentTime)
@@ -133,7 +137,7 @@ func (s *SQLiteNotificationBackendSuite) TestDeliverNotificationsWillNotWithoutN
 	c.Assert(logrusTestHook.Logs[logrus.InfoLevel][0].Message, Equals, "checking for notification delivery")
 }
 
-func (s *SQLiteNotificationBackendSuite) TestDeliverNotificationsDelivers(c *C) {
+func (s *SQLNotificationBackendSuite) TestDeliverNotificationsDelivers(c *C) {
 	notification := s.notification
 	notification.Channel = "Channel2"
 
@@ -155,11 +159,14 @@ func (s *SQLiteNotificationBackendSuite) TestDeliverNotificationsDelivers(c *C)
 	s.backend.deliverNotificationsLogIfError(currentTime)
 
 	timedout := testhelpers.BlockUntilSatisfiedOrTimeout(func() bool {
+		s.notifier.Lock()
+		defer s.notifier.Unlock()
 		return len(s.notifier.Logs) >= 2
 	}, testBackgroundTaskTimeout)
 
 	c.Assert(timedout, Equals, false)
 
+	s.notifier.Lock()
 	c.Assert(s.notifier.Logs, HasLen, 2)
 	c.Assert(s.notifier.Logs[0].Notifications, HasLen, 1)
 	s.checkNotificationEquality(c, s.notifier.Logs[0].Notifications[0], notification)
@@ -176,8 +183,91 @@ func (s *SQLiteNotificationBackendSuite) TestDeliverNotificationsDelivers(c *C)
 		}
 	}
 
+	s.notifier.Unlock()
 	c.Assert(subscribersMatched, Equals, 2)
 
+	// The sending goroutine logs once it is done with all subscribers.
+	timedout = testhelpers.BlockUntilSatisfiedOrTimeout(func() bool {
+		return logrusTestHook.HasMessage(logrus.InfoLevel, "notifications successfully sent")
+	}, testBackgroundTaskTimeout)
+	c.Assert(timedout, Equals, false)
+
+	logrusTestHook.Lock()
+	defer logrusTestHook.Unlock()
 	c.Assert(logrusTestHook.Logs[logrus.WarnLevel], HasLen, 0)
 	c.Assert(logrusTestHook.Logs[logrus.ErrorLevel], HasLen, 0)
 }
+
+func (s *SQLNotificationBackendSuite) TestDeliverNotificationsCatchesUpOnMissedRuns(c *C) {
+	notification := s.notification
+	notification.Channel = "Channel2"
+
+	err := s.backend.DbMap.Insert(&Notification{Notification: notification})
+	c.Assert(err, IsNil)
+
+	// Last delivered 3 days ago, the process was down since.
+	lastRun, err := time.Parse(time.RFC3339, "2015-09-03T00:00:00Z")
+	c.Assert(err, IsNil)
+	err = s.backend.recordChannelRun(s.backend.DbMap, s.channel2, lastRun)
+	c.Assert(err, IsNil)
+
+	// Nowhere near the delivery window of @daily
+	currentTime, err := time.Parse(time.RFC3339, "2015-09-05T12:00:00Z")
+	c.Assert(err, IsNil)
+	s.backend.deliverNotificationsLogIfError(currentTime)
+
+	timedout := testhelpers.BlockUntilSatisfiedOrTimeout(func() bool {
+		s.notifier.Lock()
+		defer s.notifier.Unlock()
+		return len(s.notifier.Logs) >= 2
+	}, testBackgroundTaskTimeout)
+	c.Assert(timedout, Equals, false)
+
+	c.Assert(logrusTestHook.HasMessage(logrus.WarnLevel, "catching up on 2 missed runs with one delivery"), Equals, true)
+
+	expectedRun, err := time.Parse(time.RFC3339, "2015-09-05T00:00:00Z")
+	c.Assert(err, IsNil)
+	run, err := s.backend.getLastChannelRun(s.backend.DbMap, s.channel2, currentTime)
+	c.Assert(err, IsNil)
+	c.Assert(run.Equal(expectedRun), Equals, true)
+
+	// The missed runs are only run once.
+	notification.Subject = "another subject"
+	err = s.backend.DbMap.Insert(&Notification{Notification: notification})
+	c.Assert(err, IsNil)
+
+	s.backend.deliverNotificationsLogIfError(currentTime.Add(time.Minute))
+	time.Sleep(200 * time.Millisecond)
+
+	c.Assert(s.notifier.Logs, HasLen, 2)
+}
+
+func (s *SQLNotificationBackendSuite) TestDeliverNotificationsRunsOncePerWindow(c *C) {
+	notification := s.notification
+	notification.Channel = "Channel2"
+
+	err := s.backend.DbMap.Insert(&Notification{Notification: notification})
+	c.Assert(err, IsNil)
+
+	currentTime, err := time.Parse(time.RFC3339, "2015-09-05T23:59:30Z")
+	c.Assert(err, IsNil)
+	s.backend.deliverNotificationsLogIfError(currentTime)
+
+	timedout := testhelpers.BlockUntilSatisfiedOrTimeout(func() bool {
+		s.notifier.Lock()
+		defer s.notifier.Unlock()
+		return len(s.notifier.Logs) >= 2
+	}, testBackgroundTaskTimeout)
+	c.Assert(timedout, Equals, false)
+
+	// The ticker fires again within the same window, with a new notification.
+	err = s.backend.DbMap.Insert(&Notification{Notification: notification})
+	c.Assert(err, IsNil)
+
+	currentTime, err = time.Parse(time.RFC3339, "2015-09-06T00:00:00Z")
+	c.Assert(err, IsNil)
+	s.backend.deliverNotificationsLogIfError(currentTime)
+	time.Sleep(200 * time.Millisecond)
+
+	c.Assert(s.notifier.Logs, HasLen, 2)
+}
@@ -0,0 +1,72 @@
+package sql_backend
+
+import (
+	"time"
+
+	"gitlab.com/shuhao/towncrier/backend"
+	"gopkg.in/gorp.v1"
+)
+
+// The last scheduled run of a channel that was delivered. This is persisted so
+// that we know which runs were missed across restarts.
+type ChannelRun struct {
+	Channel   string
+	LastRunAt int64 // UnixNano of the scheduled run, not when it happened
+}
+
+// Gets the last run of the channel, in the location of currentTime as the cron
+// expressions are evaluated in that location.
+func (b *SQLNotificationBackend) getLastChannelRun(s gorp.SqlExecutor, channel *Channel, currentTime time.Time) (time.Time, error) {
+	var runs []*ChannelRun
+	_, err := s.Select(&runs, b.rebind("SELECT * FROM channel_runs WHERE Channel = ?"), channel.Name)
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	if len(runs) == 0 {
+		return channel.defaultLastRun(currentTime), nil
+	}
+
+	return time.Unix(0, runs[0].LastRunAt).In(currentTime.Location()), nil
+}
+
+func (b *SQLNotificationBackend) recordChannelRun(s gorp.SqlExecutor, channel *Channel, run time.Time) error {
+	channelRun := &ChannelRun{
+		Channel:   channel.Name,
+		LastRunAt: run.UnixNano(),
+	}
+
+	count, err := s.Update(channelRun)
+	if err != nil {
+		return err
+	}
+
+	if count == 0 {
+		err = s.Insert(channelRun)
+	}
+
+	return err
+}
+
+// Records the run together with the pending deliveries of its notifications.
+// If the process dies before this, the run is caught up on next time. If it
+// dies after, the retrier sends the deliveries once they are not attempted by
+// sendBefore.
+func (b *SQLNotificationBackend) recordChannelRunWithDeliveries(channel *Channel, subscribers []backend.Subscriber, notifications []*Notification, run, sendBefore time.Time) error {
+	tx, err := b.Begin()
+	if err != nil {
+		return err
+	}
+
+	err = b.createPendingDeliveries(tx, notifications, channel, subscribers, sendBefore)
+	if err == nil {
+		err = b.recordChannelRun(tx, channel, run)
+	}
+
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	return tx.Commit()
+}
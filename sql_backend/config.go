@@ -0,0 +1,218 @@
+package sql_backend
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/gorhill/cronexpr"
+	"gitlab.com/shuhao/towncrier/backend"
+)
+
+const (
+	subscribersConfigFileName = "subscribers.conf.json"
+	channelsConfigFileName    = "channels.conf.json"
+
+	ChannelSendImmediately = "@immediately"
+
+	defaultMaxDeliveryAttempts   = 5
+	defaultInitialBackoffSeconds = 60
+	defaultMaxBackoffSeconds     = 60 * 60
+
+	defaultIdempotencyKeyWindowSeconds = 24 * 60 * 60
+
+	maxCatchUpRuns = 10000
+)
+
+type Channel struct {
+	Name         string
+	Subscribers  []string // a list of unique names as specified by the users field
+	Notifiers    []string
+	TimeToNotify string
+}
+
+func (c *Channel) IsTimeToNotifyValid() bool {
+	if c.TimeToNotify == ChannelSendImmediately {
+		return true
+	}
+
+	_, err := cronexpr.Parse(c.TimeToNotify)
+	if err != nil {
+		logger.WithField("time_to_notify", c.TimeToNotify).Warn("failed to parse time to notify")
+	}
+	return err == nil
+}
+
+func (c *Channel) ShouldSendImmediately() bool {
+	return c.TimeToNotify == ChannelSendImmediately
+}
+
+// The delivery window of a given time. The background task checks for delivery
+// every minute, so a run is due once the current time is in the window.
+//
+// the additional -1s is to make sure that the range always had 1 second.
+// example: if you specify 01:00:00, the minute before and minute after will
+// be 01:00:00 and 01:01:00. The next time computed will be an hour from now
+// (in the hourly case). This means that there's a chance that this hour we
+// never send anything. With an additional second it minimize this risk.
+func deliveryWindow(currentTime time.Time) (time.Time, time.Time) {
+	minuteBefore := currentTime.Add(time.Duration(-currentTime.Second()-1) * time.Second)
+	minuteAfter := minuteBefore.Add(time.Minute + time.Second)
+	return minuteBefore, minuteAfter
+}
+
+// Computes the scheduled runs after lastRun that are due at currentTime, which
+// includes the runs in the current delivery window. Returns the latest of them
+// and how many there were, so that missed runs (the process was down, the
+// ticker drifted, etc.) can be caught up with a single delivery.
+//
+// At most maxCatchUpRuns runs are looked at. Any further runs are found on the
+// next call, which starts from the returned run.
+func (c *Channel) DueRunsSince(lastRun, currentTime time.Time) (time.Time, int) {
+	latestRun := time.Time{}
+	if c.ShouldSendImmediately() {
+		return latestRun, 0
+	}
+
+	_, windowEnd := deliveryWindow(currentTime)
+	expression := cronexpr.MustParse(c.TimeToNotify)
+
+	runs := 0
+	nextRun := expression.Next(lastRun)
+	for !nextRun.IsZero() && !nextRun.After(windowEnd) && runs < maxCatchUpRuns {
+		latestRun = nextRun
+		runs++
+		nextRun = expression.Next(nextRun)
+	}
+
+	return latestRun, runs
+}
+
+// Where we start looking for due runs if a channel has never run before. This
+// is the start of the current delivery window, so nothing from before the
+// channel existed is considered missed.
+func (c *Channel) defaultLastRun(currentTime time.Time) time.Time {
+	windowStart, _ := deliveryWindow(currentTime)
+	return windowStart
+}
+
+// Controls how failed deliveries are retried. Zero values are replaced with
+// the defaults when the config is loaded.
+type DeliveryConfig struct {
+	MaxAttempts           int64
+	InitialBackoffSeconds int64
+	MaxBackoffSeconds     int64
+}
+
+func (d DeliveryConfig) withDefaults() DeliveryConfig {
+	if d.MaxAttempts <= 0 {
+		d.MaxAttempts = defaultMaxDeliveryAttempts
+	}
+
+	if d.InitialBackoffSeconds <= 0 {
+		d.InitialBackoffSeconds = defaultInitialBackoffSeconds
+	}
+
+	if d.MaxBackoffSeconds <= 0 {
+		d.MaxBackoffSeconds = defaultMaxBackoffSeconds
+	}
+
+	return d
+}
+
+// Computes how long to wait before the next attempt given the number of
+// attempts already made. The wait doubles with each attempt until it reaches
+// MaxBackoffSeconds.
+func (d DeliveryConfig) Backoff(attempts int64) time.Duration {
+	backoff := time.Duration(d.InitialBackoffSeconds) * time.Second
+	maxBackoff := time.Duration(d.MaxBackoffSeconds) * time.Second
+	for i := int64(1); i < attempts && backoff < maxBackoff; i++ {
+		backoff *= 2
+	}
+
+	if backoff > maxBackoff {
+		backoff = maxBackoff
+	}
+
+	return backoff
+}
+
+type ConfigJSON struct {
+	Channels    []*Channel
+	Subscribers []backend.Subscriber
+	Delivery    DeliveryConfig
+
+	// How long a notification with an idempotency key prevents the same origin
+	// from queueing another one with the same key. Defaults to a day.
+	IdempotencyKeyWindowSeconds int64
+}
+
+type Config struct {
+	// Config has a lock for when it is reloaded, we would like to lock it.
+	// Lock should occur when we find channels and its subscribers as well, when
+	// we want to send messages.
+	*sync.Mutex
+	ConfigPath  string
+	Channels    map[string]*Channel
+	Subscribers map[string]backend.Subscriber
+	Delivery    DeliveryConfig
+
+	IdempotencyKeyWindow time.Duration
+}
+
+func LoadConfig(configPath string) (*Config, error) {
+	config := &Config{
+		Mutex:      &sync.Mutex{},
+		ConfigPath: configPath,
+
+		Channels:    make(map[string]*Channel),
+		Subscribers: make(map[string]backend.Subscriber),
+		Delivery:    DeliveryConfig{}.withDefaults(),
+
+		IdempotencyKeyWindow: defaultIdempotencyKeyWindowSeconds * time.Second,
+	}
+
+	return config, config.Reload()
+}
+
+func (c *Config) Reload() error {
+	file, err := os.Open(c.ConfigPath)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	configJson := &ConfigJSON{}
+
+	err = json.NewDecoder(file).Decode(configJson)
+	if err != nil {
+		return err
+	}
+
+	channels := make(map[string]*Channel)
+	for _, channel := range configJson.Channels {
+		if !channel.IsTimeToNotifyValid() {
+			return fmt.Errorf("channel '%s' has an invalid TimeToNotify", channel.Name)
+		}
+		channels[channel.Name] = channel
+	}
+
+	subscribers := make(map[string]backend.Subscriber)
+	for _, subscriber := range configJson.Subscribers {
+		subscribers[subscriber.UniqueName] = subscriber
+	}
+
+	c.Lock()
+	c.Subscribers = subscribers
+	c.Channels = channels
+	c.Delivery = configJson.Delivery.withDefaults()
+	c.IdempotencyKeyWindow = defaultIdempotencyKeyWindowSeconds * time.Second
+	if configJson.IdempotencyKeyWindowSeconds > 0 {
+		c.IdempotencyKeyWindow = time.Duration(configJson.IdempotencyKeyWindowSeconds) * time.Second
+	}
+	c.Unlock()
+
+	return nil
+}
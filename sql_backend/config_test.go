@@ -1,4 +1,4 @@
-package sqlite_backend
+package sql_backend
 
 import (
 	"bytes"
@@ -8,7 +8,7 @@ import (
 	. "gopkg.in/check.v1"
 )
 
-func (s *SQLiteNotificationBackendSuite) TestConfigReloadWillBlockIfLocked(c *C) {
+func (s *SQLNotificationBackendSuite) TestConfigReloadWillBlockIfLocked(c *C) {
 	s.backend.config.Lock()
 
 	timedout := false
@@ -16,8 +16,8 @@ func (s *SQLiteNotificationBackendSuite) TestConfigReloadWillBlockIfLocked(c *C)
 	go func() {
 		// :troll:
 		time.Sleep(200 * time.Millisecond)
-		s.backend.config.Unlock()
 		timedout = true
+		s.backend.config.Unlock()
 	}()
 
 	err := s.backend.config.Reload()
@@ -25,7 +25,7 @@ func (s *SQLiteNotificationBackendSuite) TestConfigReloadWillBlockIfLocked(c *C)
 	c.Assert(err, IsNil)
 }
 
-func (s *SQLiteNotificationBackendSuite) TestConfigReloadWillFailIfTimeToNotifyIsWrong(c *C) {
+func (s *SQLNotificationBackendSuite) TestConfigReloadWillFailIfTimeToNotifyIsWrong(c *C) {
 	err := memorizeOriginalConfig()
 	c.Assert(err, IsNil)
 
@@ -40,7 +40,30 @@ func (s *SQLiteNotificationBackendSuite) TestConfigReloadWillFailIfTimeToNotifyI
 	c.Assert(err.Error(), Equals, "channel 'Channel1' has an invalid TimeToNotify")
 }
 
-func (s *SQLiteNotificationBackendSuite) TestChannelShouldSendGivenTimeMinutely(c *C) {
+func (s *SQLNotificationBackendSuite) TestConfigIdempotencyKeyWindow(c *C) {
+	c.Assert(s.backend.config.IdempotencyKeyWindow, Equals, 24*time.Hour)
+
+	err := memorizeOriginalConfig()
+	c.Assert(err, IsNil)
+
+	modifiedConfig := bytes.Replace(originalTestConfigContent, []byte(`"Channels"`), []byte(`"IdempotencyKeyWindowSeconds": 600, "Channels"`), 1)
+
+	err = ioutil.WriteFile(standardTestConfigPath, modifiedConfig, 0644)
+	c.Assert(err, IsNil)
+	defer restoreTestConfig()
+
+	err = s.backend.config.Reload()
+	c.Assert(err, IsNil)
+	c.Assert(s.backend.config.IdempotencyKeyWindow, Equals, 10*time.Minute)
+}
+
+// Whether a channel that has never run before has a run due at currentTime.
+func hasDueRun(channel *Channel, currentTime time.Time) bool {
+	_, runs := channel.DueRunsSince(channel.defaultLastRun(currentTime), currentTime)
+	return runs > 0
+}
+
+func (s *SQLNotificationBackendSuite) TestChannelDueRunsGivenTimeMinutely(c *C) {
 
 	channel := &Channel{
 		Name:         "testchannel",
@@ -52,22 +75,22 @@ func (s *SQLiteNotificationBackendSuite) TestChannelShouldSendGivenTimeMinutely(
 	// Minutely pretty much should always be true.
 	currentTime, err := time.Parse(time.RFC3339, "2015-09-05T16:38:00Z")
 	c.Assert(err, IsNil)
-	c.Assert(channel.ShouldSendNowGivenTime(currentTime), Equals, true)
+	c.Assert(hasDueRun(channel, currentTime), Equals, true)
 
 	currentTime, err = time.Parse(time.RFC3339, "2015-09-05T16:38:01Z")
 	c.Assert(err, IsNil)
-	c.Assert(channel.ShouldSendNowGivenTime(currentTime), Equals, true)
+	c.Assert(hasDueRun(channel, currentTime), Equals, true)
 
 	currentTime, err = time.Parse(time.RFC3339, "2015-09-05T16:38:30Z")
 	c.Assert(err, IsNil)
-	c.Assert(channel.ShouldSendNowGivenTime(currentTime), Equals, true)
+	c.Assert(hasDueRun(channel, currentTime), Equals, true)
 
 	currentTime, err = time.Parse(time.RFC3339, "2015-09-05T16:38:59Z")
 	c.Assert(err, IsNil)
-	c.Assert(channel.ShouldSendNowGivenTime(currentTime), Equals, true)
+	c.Assert(hasDueRun(channel, currentTime), Equals, true)
 }
 
-func (s *SQLiteNotificationBackendSuite) TestChannelShouldSendGivenTimeHourly(c *C) {
+func (s *SQLNotificationBackendSuite) TestChannelDueRunsGivenTimeHourly(c *C) {
 	channel := &Channel{
 		Name:         "testchannel",
 		TimeToNotify: "@hourly",
@@ -77,27 +100,27 @@ func (s *SQLiteNotificationBackendSuite) TestChannelShouldSendGivenTimeHourly(c
 
 	currentTime, err := time.Parse(time.RFC3339, "2015-09-05T16:38:00Z")
 	c.Assert(err, IsNil)
-	c.Assert(channel.ShouldSendNowGivenTime(currentTime), Equals, false)
+	c.Assert(hasDueRun(channel, currentTime), Equals, false)
 
 	currentTime, err = time.Parse(time.RFC3339, "2015-09-05T16:58:59Z")
 	c.Assert(err, IsNil)
-	c.Assert(channel.ShouldSendNowGivenTime(currentTime), Equals, false)
+	c.Assert(hasDueRun(channel, currentTime), Equals, false)
 
 	currentTime, err = time.Parse(time.RFC3339, "2015-09-05T16:59:00Z")
 	c.Assert(err, IsNil)
-	c.Assert(channel.ShouldSendNowGivenTime(currentTime), Equals, true)
+	c.Assert(hasDueRun(channel, currentTime), Equals, true)
 
 	currentTime, err = time.Parse(time.RFC3339, "2015-09-05T16:59:30Z")
 	c.Assert(err, IsNil)
-	c.Assert(channel.ShouldSendNowGivenTime(currentTime), Equals, true)
+	c.Assert(hasDueRun(channel, currentTime), Equals, true)
 
 	currentTime, err = time.Parse(time.RFC3339, "2015-09-05T17:00:00Z")
 	c.Assert(err, IsNil)
-	c.Assert(channel.ShouldSendNowGivenTime(currentTime), Equals, true)
+	c.Assert(hasDueRun(channel, currentTime), Equals, true)
 
 	currentTime, err = time.Parse(time.RFC3339, "2015-09-05T17:02:00Z")
 	c.Assert(err, IsNil)
-	c.Assert(channel.ShouldSendNowGivenTime(currentTime), Equals, false)
+	c.Assert(hasDueRun(channel, currentTime), Equals, false)
 
 	channel = &Channel{
 		Name:         "testchannel",
@@ -108,30 +131,30 @@ func (s *SQLiteNotificationBackendSuite) TestChannelShouldSendGivenTimeHourly(c
 
 	currentTime, err = time.Parse(time.RFC3339, "2015-09-05T16:38:00Z")
 	c.Assert(err, IsNil)
-	c.Assert(channel.ShouldSendNowGivenTime(currentTime), Equals, false)
+	c.Assert(hasDueRun(channel, currentTime), Equals, false)
 
 	currentTime, err = time.Parse(time.RFC3339, "2015-09-05T16:13:59Z")
 	c.Assert(err, IsNil)
-	c.Assert(channel.ShouldSendNowGivenTime(currentTime), Equals, false)
+	c.Assert(hasDueRun(channel, currentTime), Equals, false)
 
 	currentTime, err = time.Parse(time.RFC3339, "2015-09-05T16:14:00Z")
 	c.Assert(err, IsNil)
-	c.Assert(channel.ShouldSendNowGivenTime(currentTime), Equals, true)
+	c.Assert(hasDueRun(channel, currentTime), Equals, true)
 
 	currentTime, err = time.Parse(time.RFC3339, "2015-09-05T16:14:30Z")
 	c.Assert(err, IsNil)
-	c.Assert(channel.ShouldSendNowGivenTime(currentTime), Equals, true)
+	c.Assert(hasDueRun(channel, currentTime), Equals, true)
 
 	currentTime, err = time.Parse(time.RFC3339, "2015-09-05T16:15:00Z")
 	c.Assert(err, IsNil)
-	c.Assert(channel.ShouldSendNowGivenTime(currentTime), Equals, true)
+	c.Assert(hasDueRun(channel, currentTime), Equals, true)
 
 	currentTime, err = time.Parse(time.RFC3339, "2015-09-05T16:20:00Z")
 	c.Assert(err, IsNil)
-	c.Assert(channel.ShouldSendNowGivenTime(currentTime), Equals, false)
+	c.Assert(hasDueRun(channel, currentTime), Equals, false)
 }
 
-func (s *SQLiteNotificationBackendSuite) TestChannelShouldSendGivenTimeDaily(c *C) {
+func (s *SQLNotificationBackendSuite) TestChannelDueRunsGivenTimeDaily(c *C) {
 	channel := &Channel{
 		Name:         "testchannel",
 		TimeToNotify: "@daily",
@@ -141,23 +164,23 @@ func (s *SQLiteNotificationBackendSuite) TestChannelShouldSendGivenTimeDaily(c *
 
 	currentTime, err := time.Parse(time.RFC3339, "2015-09-05T16:59:30Z")
 	c.Assert(err, IsNil)
-	c.Assert(channel.ShouldSendNowGivenTime(currentTime), Equals, false)
+	c.Assert(hasDueRun(channel, currentTime), Equals, false)
 
 	currentTime, err = time.Parse(time.RFC3339, "2015-09-05T23:59:00Z")
 	c.Assert(err, IsNil)
-	c.Assert(channel.ShouldSendNowGivenTime(currentTime), Equals, true)
+	c.Assert(hasDueRun(channel, currentTime), Equals, true)
 
 	currentTime, err = time.Parse(time.RFC3339, "2015-09-05T23:59:30Z")
 	c.Assert(err, IsNil)
-	c.Assert(channel.ShouldSendNowGivenTime(currentTime), Equals, true)
+	c.Assert(hasDueRun(channel, currentTime), Equals, true)
 
 	currentTime, err = time.Parse(time.RFC3339, "2015-09-06T00:00:00Z")
 	c.Assert(err, IsNil)
-	c.Assert(channel.ShouldSendNowGivenTime(currentTime), Equals, true)
+	c.Assert(hasDueRun(channel, currentTime), Equals, true)
 
 	currentTime, err = time.Parse(time.RFC3339, "2015-09-06T00:02:00Z")
 	c.Assert(err, IsNil)
-	c.Assert(channel.ShouldSendNowGivenTime(currentTime), Equals, false)
+	c.Assert(hasDueRun(channel, currentTime), Equals, false)
 
 	channel = &Channel{
 		Name:         "testchannel",
@@ -168,26 +191,26 @@ func (s *SQLiteNotificationBackendSuite) TestChannelShouldSendGivenTimeDaily(c *
 
 	currentTime, err = time.Parse(time.RFC3339, "2015-09-05T23:59:59Z")
 	c.Assert(err, IsNil)
-	c.Assert(channel.ShouldSendNowGivenTime(currentTime), Equals, false)
+	c.Assert(hasDueRun(channel, currentTime), Equals, false)
 
 	currentTime, err = time.Parse(time.RFC3339, "2015-09-05T01:14:00Z")
 	c.Assert(err, IsNil)
-	c.Assert(channel.ShouldSendNowGivenTime(currentTime), Equals, true)
+	c.Assert(hasDueRun(channel, currentTime), Equals, true)
 
 	currentTime, err = time.Parse(time.RFC3339, "2015-09-05T01:14:30Z")
 	c.Assert(err, IsNil)
-	c.Assert(channel.ShouldSendNowGivenTime(currentTime), Equals, true)
+	c.Assert(hasDueRun(channel, currentTime), Equals, true)
 
 	currentTime, err = time.Parse(time.RFC3339, "2015-09-05T01:15:00Z")
 	c.Assert(err, IsNil)
-	c.Assert(channel.ShouldSendNowGivenTime(currentTime), Equals, true)
+	c.Assert(hasDueRun(channel, currentTime), Equals, true)
 
 	currentTime, err = time.Parse(time.RFC3339, "2015-09-05T01:20:00Z")
 	c.Assert(err, IsNil)
-	c.Assert(channel.ShouldSendNowGivenTime(currentTime), Equals, false)
+	c.Assert(hasDueRun(channel, currentTime), Equals, false)
 }
 
-func (s *SQLiteNotificationBackendSuite) TestChannelShouldSendGivenTimeWeekly(c *C) {
+func (s *SQLNotificationBackendSuite) TestChannelDueRunsGivenTimeWeekly(c *C) {
 	channel := &Channel{
 		Name:         "testchannel",
 		TimeToNotify: "@weekly",
@@ -197,24 +220,24 @@ func (s *SQLiteNotificationBackendSuite) TestChannelShouldSendGivenTimeWeekly(c
 
 	currentTime, err := time.Parse(time.RFC3339, "2015-09-05T16:59:30Z")
 	c.Assert(err, IsNil)
-	c.Assert(channel.ShouldSendNowGivenTime(currentTime), Equals, false)
+	c.Assert(hasDueRun(channel, currentTime), Equals, false)
 
 	// This is a Saturday -> Sunday transition
 	currentTime, err = time.Parse(time.RFC3339, "2015-09-05T23:59:00Z")
 	c.Assert(err, IsNil)
-	c.Assert(channel.ShouldSendNowGivenTime(currentTime), Equals, true)
+	c.Assert(hasDueRun(channel, currentTime), Equals, true)
 
 	currentTime, err = time.Parse(time.RFC3339, "2015-09-05T23:59:30Z")
 	c.Assert(err, IsNil)
-	c.Assert(channel.ShouldSendNowGivenTime(currentTime), Equals, true)
+	c.Assert(hasDueRun(channel, currentTime), Equals, true)
 
 	currentTime, err = time.Parse(time.RFC3339, "2015-09-06T00:00:00Z")
 	c.Assert(err, IsNil)
-	c.Assert(channel.ShouldSendNowGivenTime(currentTime), Equals, true)
+	c.Assert(hasDueRun(channel, currentTime), Equals, true)
 
 	currentTime, err = time.Parse(time.RFC3339, "2015-09-06T00:02:00Z")
 	c.Assert(err, IsNil)
-	c.Assert(channel.ShouldSendNowGivenTime(currentTime), Equals, false)
+	c.Assert(hasDueRun(channel, currentTime), Equals, false)
 
 	channel = &Channel{
 		Name:         "testchannel",
@@ -225,26 +248,26 @@ func (s *SQLiteNotificationBackendSuite) TestChannelShouldSendGivenTimeWeekly(c
 
 	currentTime, err = time.Parse(time.RFC3339, "2015-09-05T03:14:59Z")
 	c.Assert(err, IsNil)
-	c.Assert(channel.ShouldSendNowGivenTime(currentTime), Equals, false)
+	c.Assert(hasDueRun(channel, currentTime), Equals, false)
 
 	currentTime, err = time.Parse(time.RFC3339, "2015-09-07T03:14:00Z")
 	c.Assert(err, IsNil)
-	c.Assert(channel.ShouldSendNowGivenTime(currentTime), Equals, true)
+	c.Assert(hasDueRun(channel, currentTime), Equals, true)
 
 	currentTime, err = time.Parse(time.RFC3339, "2015-09-07T03:14:30Z")
 	c.Assert(err, IsNil)
-	c.Assert(channel.ShouldSendNowGivenTime(currentTime), Equals, true)
+	c.Assert(hasDueRun(channel, currentTime), Equals, true)
 
 	currentTime, err = time.Parse(time.RFC3339, "2015-09-07T03:15:00Z")
 	c.Assert(err, IsNil)
-	c.Assert(channel.ShouldSendNowGivenTime(currentTime), Equals, true)
+	c.Assert(hasDueRun(channel, currentTime), Equals, true)
 
 	currentTime, err = time.Parse(time.RFC3339, "2015-09-07T03:17:00Z")
 	c.Assert(err, IsNil)
-	c.Assert(channel.ShouldSendNowGivenTime(currentTime), Equals, false)
+	c.Assert(hasDueRun(channel, currentTime), Equals, false)
 }
 
-func (s *SQLiteNotificationBackendSuite) TestChannelShouldSendGivenTimeMonthly(c *C) {
+func (s *SQLNotificationBackendSuite) TestChannelDueRunsGivenTimeMonthly(c *C) {
 	channel := &Channel{
 		Name:         "testchannel",
 		TimeToNotify: "@monthly",
@@ -254,24 +277,24 @@ func (s *SQLiteNotificationBackendSuite) TestChannelShouldSendGivenTimeMonthly(c
 
 	currentTime, err := time.Parse(time.RFC3339, "2015-09-30T16:59:30Z")
 	c.Assert(err, IsNil)
-	c.Assert(channel.ShouldSendNowGivenTime(currentTime), Equals, false)
+	c.Assert(hasDueRun(channel, currentTime), Equals, false)
 
 	// This is a Saturday -> Sunday transition
 	currentTime, err = time.Parse(time.RFC3339, "2015-09-30T23:59:00Z")
 	c.Assert(err, IsNil)
-	c.Assert(channel.ShouldSendNowGivenTime(currentTime), Equals, true)
+	c.Assert(hasDueRun(channel, currentTime), Equals, true)
 
 	currentTime, err = time.Parse(time.RFC3339, "2015-09-30T23:59:30Z")
 	c.Assert(err, IsNil)
-	c.Assert(channel.ShouldSendNowGivenTime(currentTime), Equals, true)
+	c.Assert(hasDueRun(channel, currentTime), Equals, true)
 
 	currentTime, err = time.Parse(time.RFC3339, "2015-10-01T00:00:00Z")
 	c.Assert(err, IsNil)
-	c.Assert(channel.ShouldSendNowGivenTime(currentTime), Equals, true)
+	c.Assert(hasDueRun(channel, currentTime), Equals, true)
 
 	currentTime, err = time.Parse(time.RFC3339, "2015-10-01T00:02:00Z")
 	c.Assert(err, IsNil)
-	c.Assert(channel.ShouldSendNowGivenTime(currentTime), Equals, false)
+	c.Assert(hasDueRun(channel, currentTime), Equals, false)
 
 	channel = &Channel{
 		Name:         "testchannel",
@@ -282,21 +305,53 @@ func (s *SQLiteNotificationBackendSuite) TestChannelShouldSendGivenTimeMonthly(c
 
 	currentTime, err = time.Parse(time.RFC3339, "2015-09-02T03:14:59Z")
 	c.Assert(err, IsNil)
-	c.Assert(channel.ShouldSendNowGivenTime(currentTime), Equals, false)
+	c.Assert(hasDueRun(channel, currentTime), Equals, false)
 
 	currentTime, err = time.Parse(time.RFC3339, "2015-09-05T03:14:00Z")
 	c.Assert(err, IsNil)
-	c.Assert(channel.ShouldSendNowGivenTime(currentTime), Equals, true)
+	c.Assert(hasDueRun(channel, currentTime), Equals, true)
 
 	currentTime, err = time.Parse(time.RFC3339, "2015-09-05T03:14:30Z")
 	c.Assert(err, IsNil)
-	c.Assert(channel.ShouldSendNowGivenTime(currentTime), Equals, true)
+	c.Assert(hasDueRun(channel, currentTime), Equals, true)
 
 	currentTime, err = time.Parse(time.RFC3339, "2015-09-05T03:15:00Z")
 	c.Assert(err, IsNil)
-	c.Assert(channel.ShouldSendNowGivenTime(currentTime), Equals, true)
+	c.Assert(hasDueRun(channel, currentTime), Equals, true)
 
 	currentTime, err = time.Parse(time.RFC3339, "2015-09-05T03:17:00Z")
 	c.Assert(err, IsNil)
-	c.Assert(channel.ShouldSendNowGivenTime(currentTime), Equals, false)
+	c.Assert(hasDueRun(channel, currentTime), Equals, false)
+}
+
+func (s *SQLNotificationBackendSuite) TestChannelDueRunsSince(c *C) {
+	channel := &Channel{
+		Name:         "testchannel",
+		TimeToNotify: "@hourly",
+	}
+
+	lastRun, err := time.Parse(time.RFC3339, "2015-09-05T10:00:00Z")
+	c.Assert(err, IsNil)
+
+	currentTime, err := time.Parse(time.RFC3339, "2015-09-05T10:30:00Z")
+	c.Assert(err, IsNil)
+	_, runs := channel.DueRunsSince(lastRun, currentTime)
+	c.Assert(runs, Equals, 0)
+
+	// Within the delivery window of 11:00
+	currentTime, err = time.Parse(time.RFC3339, "2015-09-05T10:59:30Z")
+	c.Assert(err, IsNil)
+	run, runs := channel.DueRunsSince(lastRun, currentTime)
+	c.Assert(runs, Equals, 1)
+	c.Assert(run.Format(time.RFC3339), Equals, "2015-09-05T11:00:00Z")
+
+	currentTime, err = time.Parse(time.RFC3339, "2015-09-05T13:30:00Z")
+	c.Assert(err, IsNil)
+	run, runs = channel.DueRunsSince(lastRun, currentTime)
+	c.Assert(runs, Equals, 3)
+	c.Assert(run.Format(time.RFC3339), Equals, "2015-09-05T13:00:00Z")
+
+	channel.TimeToNotify = ChannelSendImmediately
+	_, runs = channel.DueRunsSince(lastRun, currentTime)
+	c.Assert(runs, Equals, 0)
 }
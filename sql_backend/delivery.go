@@ -0,0 +1,296 @@
+package sql_backend
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/Sirupsen/logrus"
+
+	"gitlab.com/shuhao/towncrier/backend"
+	"gopkg.in/gorp.v1"
+)
+
+const (
+	DeliveryPending   = "pending"   // not attempted yet, retried from NextAttemptAt if set
+	DeliverySent      = "sent"      // successfully sent
+	DeliveryFailed    = "failed"    // failed, will be retried at NextAttemptAt
+	DeliveryAbandoned = "abandoned" // failed too many times, will not be retried
+)
+
+// A delivery tracks sending one notification to one subscriber via one
+// notifier. This allows us to only retry the failed subscriber/notifier pairs
+// instead of the whole batch.
+type Delivery struct {
+	Id             int64 `db:"id"`
+	NotificationId int64
+	Subscriber     string // the subscriber unique name
+	Notifier       string
+	Status         string
+	Attempts       int64
+	LastError      string
+	NextAttemptAt  int64 // UnixNano
+	CreatedAt      int64 // UnixNano
+	UpdatedAt      int64 // UnixNano
+}
+
+func (d *Delivery) PreInsert(s gorp.SqlExecutor) error {
+	d.CreatedAt = time.Now().UnixNano()
+	d.UpdatedAt = d.CreatedAt
+	return nil
+}
+
+func (d *Delivery) PreUpdate(s gorp.SqlExecutor) error {
+	d.UpdatedAt = time.Now().UnixNano()
+	return nil
+}
+
+// Records the result of an attempt and computes when the next attempt should
+// happen if it failed.
+func (d *Delivery) recordAttempt(sendErr error, currentTime time.Time, deliveryConfig DeliveryConfig) {
+	d.Attempts++
+
+	if sendErr == nil {
+		d.Status = DeliverySent
+		d.LastError = ""
+		d.NextAttemptAt = 0
+		return
+	}
+
+	d.LastError = sendErr.Error()
+	if d.Attempts >= deliveryConfig.MaxAttempts {
+		d.Status = DeliveryAbandoned
+		d.NextAttemptAt = 0
+		return
+	}
+
+	d.Status = DeliveryFailed
+	d.NextAttemptAt = currentTime.Add(deliveryConfig.Backoff(d.Attempts)).UnixNano()
+}
+
+func (d *Delivery) toStatus() *backend.DeliveryStatus {
+	return &backend.DeliveryStatus{
+		Subscriber:    d.Subscriber,
+		Notifier:      d.Notifier,
+		Status:        d.Status,
+		Attempts:      d.Attempts,
+		LastError:     d.LastError,
+		NextAttemptAt: d.NextAttemptAt,
+		UpdatedAt:     d.UpdatedAt,
+	}
+}
+
+func (d *Delivery) abandon(reason string) {
+	d.Status = DeliveryAbandoned
+	d.LastError = reason
+	d.NextAttemptAt = 0
+}
+
+func (b *SQLNotificationBackend) getOrCreateDelivery(s gorp.SqlExecutor, notificationId int64, subscriber, notifier string) (*Delivery, error) {
+	var deliveries []*Delivery
+	_, err := s.Select(&deliveries, b.rebind("SELECT * FROM deliveries WHERE NotificationId = ? AND Subscriber = ? AND Notifier = ?"), notificationId, subscriber, notifier)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(deliveries) > 0 {
+		return deliveries[0], nil
+	}
+
+	delivery := &Delivery{
+		NotificationId: notificationId,
+		Subscriber:     subscriber,
+		Notifier:       notifier,
+		Status:         DeliveryPending,
+	}
+
+	return delivery, s.Insert(delivery)
+}
+
+// Creates the deliveries of the notifications for all subscribers and notifiers
+// of the channel ahead of sending them. Until they are attempted, they are
+// retried from sendBefore on as if they had failed.
+func (b *SQLNotificationBackend) createPendingDeliveries(s gorp.SqlExecutor, notifications []*Notification, channel *Channel, subscribers []backend.Subscriber, sendBefore time.Time) error {
+	for _, subscriber := range subscribers {
+		for _, notifierName := range channel.Notifiers {
+			for _, n := range notifications {
+				delivery, err := b.getOrCreateDelivery(s, n.Id, subscriber.UniqueName, notifierName)
+				if err != nil {
+					return err
+				}
+
+				if delivery.Status != DeliveryPending {
+					continue
+				}
+
+				delivery.NextAttemptAt = sendBefore.UnixNano()
+				_, err = s.Update(delivery)
+				if err != nil {
+					return err
+				}
+			}
+		}
+	}
+
+	return nil
+}
+
+// Sends the notifications to one subscriber via one notifier and records the
+// outcome on each of the deliveries. deliveries[i] must belong to
+// notifications[i].
+func (b *SQLNotificationBackend) attemptDeliveries(deliveries []*Delivery, notifications []*Notification, subscriber backend.Subscriber, notifierName string) error {
+	if len(deliveries) == 0 {
+		return nil
+	}
+
+	localLog := logger.WithFields(logrus.Fields{
+		"subscriber": subscriber.UniqueName,
+		"notifier":   notifierName,
+	})
+
+	backendNotificationObjects := make([]backend.Notification, len(notifications))
+	for i, n := range notifications {
+		backendNotificationObjects[i] = n.Notification
+	}
+
+	var err error
+	notifier := backend.GetNotifier(notifierName)
+	if notifier == nil {
+		localLog.Warnf("cannot find notifier")
+		err = fmt.Errorf("notifier '%s' not found", notifierName)
+	} else {
+		localLog.Info("sending notification")
+		err = notifier.Send(backendNotificationObjects, subscriber)
+		if err != nil {
+			localLog.WithField("error", err).Errorf("failed to send notification")
+		}
+	}
+
+	deliveryAttempts.Add(float64(len(deliveries)), notifierName)
+	if err != nil {
+		deliveryFailures.Add(float64(len(deliveries)), notifierName)
+	}
+
+	b.config.Lock()
+	deliveryConfig := b.config.Delivery
+	b.config.Unlock()
+
+	currentTime := b.Clock.Now()
+	for i, delivery := range deliveries {
+		delivery.recordAttempt(err, currentTime, deliveryConfig)
+		b.updateDeliveryLogIfError(delivery)
+
+		b.hub.Publish(backend.Event{
+			Type:         backend.DeliveryUpdated,
+			Notification: *notifications[i].toStored(),
+			Delivery:     delivery.toStatus(),
+		})
+	}
+
+	return err
+}
+
+func (b *SQLNotificationBackend) updateDeliveryLogIfError(delivery *Delivery) {
+	_, err := b.Update(delivery)
+	if err != nil {
+		logger.WithFields(logrus.Fields{
+			"error":    err,
+			"delivery": delivery.Id,
+		}).Error("failed to record delivery attempt")
+	}
+}
+
+type deliveryGroupKey struct {
+	channel    string
+	subscriber string
+	notifier   string
+}
+
+type deliveryGroup struct {
+	deliveries    []*Delivery
+	notifications []*Notification
+}
+
+// Retries the deliveries that previously failed and are due for another
+// attempt at currentTime, as well as the pending ones of scheduled runs that
+// were never attempted.
+//
+// Deliveries are grouped by channel, subscriber and notifier so that a
+// subscriber gets the same kind of batch it would have gotten originally.
+func (b *SQLNotificationBackend) retryDeliveriesLogIfError(currentTime time.Time) {
+	if !b.isLeader(currentTime) {
+		return
+	}
+
+	var deliveries []*Delivery
+	_, err := b.Select(&deliveries, b.rebind("SELECT * FROM deliveries WHERE Status IN (?, ?) AND NextAttemptAt > 0 AND NextAttemptAt <= ? ORDER BY NotificationId"), DeliveryFailed, DeliveryPending, currentTime.UnixNano())
+	if err != nil {
+		logger.WithField("error", err).Error("cannot select deliveries to retry from the database")
+		return
+	}
+
+	if len(deliveries) == 0 {
+		return
+	}
+
+	logger.Infof("retrying %d failed deliveries", len(deliveries))
+
+	groups := make(map[deliveryGroupKey]*deliveryGroup)
+	keys := make([]deliveryGroupKey, 0)
+
+	for _, delivery := range deliveries {
+		notification, err := b.getNotification(b.DbMap, delivery.NotificationId)
+		if err != nil {
+			logger.WithFields(logrus.Fields{
+				"error":        err,
+				"notification": delivery.NotificationId,
+			}).Error("cannot get notification for delivery")
+			continue
+		}
+
+		if notification == nil {
+			delivery.abandon("notification no longer exists")
+			b.updateDeliveryLogIfError(delivery)
+			continue
+		}
+
+		key := deliveryGroupKey{
+			channel:    notification.Channel,
+			subscriber: delivery.Subscriber,
+			notifier:   delivery.Notifier,
+		}
+
+		group, found := groups[key]
+		if !found {
+			group = &deliveryGroup{}
+			groups[key] = group
+			keys = append(keys, key)
+		}
+
+		group.deliveries = append(group.deliveries, delivery)
+		group.notifications = append(group.notifications, notification)
+	}
+
+	for _, key := range keys {
+		group := groups[key]
+
+		subscriber, found := b.getSubscriber(key.subscriber)
+		if !found {
+			logger.WithField("subscriber", key.subscriber).Warnf("subscriber not found, abandoning deliveries")
+			for _, delivery := range group.deliveries {
+				delivery.abandon("subscriber no longer exists")
+				b.updateDeliveryLogIfError(delivery)
+			}
+			continue
+		}
+
+		err := b.attemptDeliveries(group.deliveries, group.notifications, subscriber, key.notifier)
+		if err != nil {
+			logger.WithFields(logrus.Fields{
+				"error":      err,
+				"channel":    key.channel,
+				"subscriber": key.subscriber,
+				"notifier":   key.notifier,
+			}).Error("failed to retry delivery")
+		}
+	}
+}
@@ -0,0 +1,158 @@
+package sql_backend
+
+import (
+	"errors"
+	"time"
+
+	"gitlab.com/shuhao/towncrier/backend"
+
+	. "gopkg.in/check.v1"
+)
+
+func (s *SQLNotificationBackendSuite) getDelivery(c *C, notificationId int64, subscriber string) *Delivery {
+	var deliveries []*Delivery
+	_, err := s.backend.Select(&deliveries, "SELECT * FROM deliveries WHERE NotificationId = ? AND Subscriber = ?", notificationId, subscriber)
+	c.Assert(err, IsNil)
+	c.Assert(deliveries, HasLen, 1)
+	return deliveries[0]
+}
+
+func (s *SQLNotificationBackendSuite) insertChannel2Notification(c *C) (*Notification, *Channel, []backend.Subscriber) {
+	notification := &Notification{Notification: s.notification}
+	notification.Channel = "Channel2"
+
+	err := notification.insert(s.backend.DbMap)
+	c.Assert(err, IsNil)
+
+	channel, subscribers := s.backend.GetChannelAndItsSubscribers("Channel2")
+	c.Assert(channel, NotNil)
+	c.Assert(subscribers, HasLen, 2)
+
+	return notification, channel, subscribers
+}
+
+func (s *SQLNotificationBackendSuite) TestDeliveryBackoff(c *C) {
+	deliveryConfig := DeliveryConfig{
+		MaxAttempts:           5,
+		InitialBackoffSeconds: 60,
+		MaxBackoffSeconds:     300,
+	}
+
+	c.Assert(deliveryConfig.Backoff(1), Equals, time.Minute)
+	c.Assert(deliveryConfig.Backoff(2), Equals, 2*time.Minute)
+	c.Assert(deliveryConfig.Backoff(3), Equals, 4*time.Minute)
+	c.Assert(deliveryConfig.Backoff(4), Equals, 5*time.Minute)
+	c.Assert(deliveryConfig.Backoff(100), Equals, 5*time.Minute)
+}
+
+func (s *SQLNotificationBackendSuite) TestDeliveryConfigDefaults(c *C) {
+	c.Assert(s.backend.config.Delivery, DeepEquals, DeliveryConfig{
+		MaxAttempts:           defaultMaxDeliveryAttempts,
+		InitialBackoffSeconds: defaultInitialBackoffSeconds,
+		MaxBackoffSeconds:     defaultMaxBackoffSeconds,
+	})
+}
+
+func (s *SQLNotificationBackendSuite) TestSendNotificationsOnlyRetriesFailedDeliveries(c *C) {
+	s.notifier.FailFor("bob", errors.New("bob is away"))
+
+	notification, channel, subscribers := s.insertChannel2Notification(c)
+
+	beforeSend := time.Now()
+	err := s.backend.sendNotifications([]*Notification{notification}, channel, subscribers)
+	c.Assert(err, NotNil)
+
+	failedToSendError, ok := err.(*NotificationFailedtoSendToSomeSubscribers)
+	c.Assert(ok, Equals, true)
+	c.Assert(failedToSendError.Errors, HasLen, 1)
+	c.Assert(failedToSendError.Errors["bob"], ErrorMatches, "bob is away")
+
+	c.Assert(s.notifier.Logs, HasLen, 1)
+	c.Assert(s.notifier.Logs[0].Subscriber, DeepEquals, s.jimmy)
+
+	jimmyDelivery := s.getDelivery(c, notification.Id, "jimmy")
+	c.Assert(jimmyDelivery.Status, Equals, DeliverySent)
+	c.Assert(jimmyDelivery.Attempts, Equals, int64(1))
+
+	bobDelivery := s.getDelivery(c, notification.Id, "bob")
+	c.Assert(bobDelivery.Status, Equals, DeliveryFailed)
+	c.Assert(bobDelivery.Attempts, Equals, int64(1))
+	c.Assert(bobDelivery.LastError, Equals, "bob is away")
+	c.Assert(bobDelivery.NextAttemptAt >= beforeSend.Add(time.Minute).UnixNano(), Equals, true)
+
+	obj, err := s.backend.Get(Notification{}, notification.Id)
+	c.Assert(err, IsNil)
+	c.Assert(obj.(*Notification).Delivered, Equals, true)
+
+	// Not due yet, so nothing should happen.
+	s.notifier.StopFailingFor("bob")
+	s.backend.retryDeliveriesLogIfError(time.Now())
+	c.Assert(s.notifier.Logs, HasLen, 1)
+
+	s.backend.retryDeliveriesLogIfError(time.Now().Add(2 * time.Minute))
+	c.Assert(s.notifier.Logs, HasLen, 2)
+	c.Assert(s.notifier.Logs[1].Subscriber, DeepEquals, s.bob)
+	c.Assert(s.notifier.Logs[1].Notifications, HasLen, 1)
+	expectedNotification := s.notification
+	expectedNotification.Channel = "Channel2"
+	s.checkNotificationEquality(c, s.notifier.Logs[1].Notifications[0], expectedNotification)
+
+	bobDelivery = s.getDelivery(c, notification.Id, "bob")
+	c.Assert(bobDelivery.Status, Equals, DeliverySent)
+	c.Assert(bobDelivery.Attempts, Equals, int64(2))
+	c.Assert(bobDelivery.LastError, Equals, "")
+
+	// Jimmy should never get it twice.
+	jimmyDelivery = s.getDelivery(c, notification.Id, "jimmy")
+	c.Assert(jimmyDelivery.Attempts, Equals, int64(1))
+}
+
+func (s *SQLNotificationBackendSuite) TestRetryDeliveriesAbandonsAfterMaxAttempts(c *C) {
+	s.notifier.FailFor("bob", errors.New("bob is away"))
+
+	notification, channel, subscribers := s.insertChannel2Notification(c)
+
+	err := s.backend.sendNotifications([]*Notification{notification}, channel, subscribers)
+	c.Assert(err, NotNil)
+
+	retryTime := time.Now()
+	for i := int64(1); i < defaultMaxDeliveryAttempts; i++ {
+		retryTime = retryTime.Add(2 * time.Duration(defaultMaxBackoffSeconds) * time.Second)
+		s.backend.retryDeliveriesLogIfError(retryTime)
+	}
+
+	bobDelivery := s.getDelivery(c, notification.Id, "bob")
+	c.Assert(bobDelivery.Status, Equals, DeliveryAbandoned)
+	c.Assert(bobDelivery.Attempts, Equals, int64(defaultMaxDeliveryAttempts))
+	c.Assert(bobDelivery.LastError, Equals, "bob is away")
+
+	s.notifier.StopFailingFor("bob")
+	s.backend.retryDeliveriesLogIfError(retryTime.Add(24 * time.Hour))
+	c.Assert(s.notifier.Logs, HasLen, 1)
+	c.Assert(s.notifier.Logs[0].Subscriber, DeepEquals, s.jimmy)
+}
+
+func (s *SQLNotificationBackendSuite) TestRetryDeliveriesSendsScheduledRunsThatWereNeverSent(c *C) {
+	notification, channel, subscribers := s.insertChannel2Notification(c)
+
+	// The process dies right after recording the run, before sending.
+	currentTime := time.Now()
+	err := s.backend.recordChannelRunWithDeliveries(channel, subscribers, []*Notification{notification}, currentTime, currentTime.Add(scheduledDeliveryTimeout))
+	c.Assert(err, IsNil)
+
+	c.Assert(s.getDelivery(c, notification.Id, "bob").Status, Equals, DeliveryPending)
+
+	// They could still be being sent.
+	s.backend.retryDeliveriesLogIfError(currentTime.Add(time.Minute))
+	c.Assert(s.notifier.Logs, HasLen, 0)
+
+	s.backend.retryDeliveriesLogIfError(currentTime.Add(scheduledDeliveryTimeout))
+	c.Assert(s.notifier.Logs, HasLen, 2)
+	c.Assert(s.getDelivery(c, notification.Id, "bob").Status, Equals, DeliverySent)
+	c.Assert(s.getDelivery(c, notification.Id, "jimmy").Status, Equals, DeliverySent)
+
+	// The next run only marks the notification as delivered.
+	err = s.backend.sendNotifications([]*Notification{notification}, channel, subscribers)
+	c.Assert(err, IsNil)
+	c.Assert(s.notifier.Logs, HasLen, 2)
+}
@@ -1,4 +1,4 @@
-package sqlite_backend
+package sql_backend
 
 import (
 	"fmt"
@@ -0,0 +1,263 @@
+package sql_backend
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"gitlab.com/shuhao/towncrier/backend"
+)
+
+const (
+	leaseKeeperTask          = "lease keeper"
+	configReloaderTask       = "config reloader"
+	notificationDeliveryTask = "notification delivery"
+	deliveryRetrierTask      = "delivery retrier"
+	outboxDispatcherTask     = "outbox dispatcher"
+
+	// A task is considered stuck if it has not run for this many of its
+	// intervals.
+	missedRunsBeforeStuck = 3
+
+	databaseCheckTimeout = 5 * time.Second
+)
+
+var backgroundTaskIntervals = map[string]time.Duration{
+	leaseKeeperTask:          leaseRenewInterval,
+	configReloaderTask:       reloadConfigInterval,
+	notificationDeliveryTask: notificationDeliveryInterval,
+	deliveryRetrierTask:      deliveryRetryInterval,
+	outboxDispatcherTask:     outboxPollInterval,
+}
+
+type taskState struct {
+	started  bool
+	disabled bool
+	stopped  bool
+	lastRun  time.Time
+}
+
+// What the background tasks and the config reloads last did, for the health
+// checks.
+type healthMonitor struct {
+	sync.Mutex
+	tasks map[string]*taskState
+
+	configLoadedAt     time.Time
+	configReloadedAt   time.Time
+	configReloadFailed error
+}
+
+func newHealthMonitor(configLoadedAt time.Time) *healthMonitor {
+	tasks := make(map[string]*taskState)
+	for name := range backgroundTaskIntervals {
+		tasks[name] = &taskState{}
+	}
+
+	return &healthMonitor{
+		tasks:          tasks,
+		configLoadedAt: configLoadedAt,
+	}
+}
+
+// Called by the tasks every time they wake up.
+func (b *SQLNotificationBackend) taskRan(name string) {
+	b.health.Lock()
+	defer b.health.Unlock()
+
+	task := b.health.tasks[name]
+	task.started = true
+	task.lastRun = b.Clock.Now()
+}
+
+// The tasks that do nothing with NeverSendNotifications are not expected to
+// run.
+func (b *SQLNotificationBackend) taskDisabled(name string) {
+	b.health.Lock()
+	defer b.health.Unlock()
+
+	b.health.tasks[name].disabled = true
+}
+
+func (b *SQLNotificationBackend) taskStopped(name string) {
+	b.health.Lock()
+	defer b.health.Unlock()
+
+	b.health.tasks[name].stopped = true
+}
+
+func (b *SQLNotificationBackend) configReloaded(err error) {
+	b.health.Lock()
+	defer b.health.Unlock()
+
+	now := b.Clock.Now()
+	b.health.configReloadedAt = now
+	b.health.configReloadFailed = err
+	if err == nil {
+		b.health.configLoadedAt = now
+	}
+}
+
+// Only the background tasks are checked, as they are what a restart fixes.
+func (b *SQLNotificationBackend) CheckLiveness() []backend.HealthCheck {
+	b.health.Lock()
+	defer b.health.Unlock()
+
+	names := make([]string, 0, len(b.health.tasks))
+	for name := range b.health.tasks {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	now := b.Clock.Now()
+	checks := make([]backend.HealthCheck, len(names))
+	for i, name := range names {
+		task := b.health.tasks[name]
+		interval := backgroundTaskIntervals[name]
+		check := backend.HealthCheck{Name: name, Status: backend.HealthOK}
+
+		switch {
+		case task.disabled:
+			check.Message = "disabled as notifications are never sent"
+		case task.stopped:
+			check.Status = backend.HealthFailing
+			check.Message = "stopped"
+		case !task.started:
+			check.Message = "starting"
+		default:
+			sinceLastRun := now.Sub(task.lastRun)
+			check.Message = fmt.Sprintf("last ran %ds ago", int64(sinceLastRun.Seconds()))
+			if sinceLastRun > missedRunsBeforeStuck*interval {
+				check.Status = backend.HealthFailing
+				check.Message += fmt.Sprintf(", expected every %v", interval)
+			}
+		}
+
+		checks[i] = check
+	}
+
+	return checks
+}
+
+func (b *SQLNotificationBackend) CheckReadiness() []backend.HealthCheck {
+	checks := []backend.HealthCheck{
+		b.checkStarted(),
+		b.checkDatabase(),
+		b.checkConfig(),
+		b.checkNotifiers(),
+	}
+
+	return append(checks, b.CheckLiveness()...)
+}
+
+func (b *SQLNotificationBackend) checkStarted() backend.HealthCheck {
+	b.health.Lock()
+	defer b.health.Unlock()
+
+	var starting []string
+	for name, task := range b.health.tasks {
+		if !task.started && !task.disabled {
+			starting = append(starting, name)
+		}
+	}
+
+	if len(starting) > 0 {
+		sort.Strings(starting)
+		return backend.HealthCheck{
+			Name:    "started",
+			Status:  backend.HealthFailing,
+			Message: "waiting for " + strings.Join(starting, ", "),
+		}
+	}
+
+	return backend.HealthCheck{Name: "started", Status: backend.HealthOK, Message: "all background tasks started"}
+}
+
+// Checks that the database can be written to, with a statement that changes
+// nothing in a transaction that is rolled back. A database that does not
+// answer in time is failing, rather than blocking the check.
+func (b *SQLNotificationBackend) checkDatabase() backend.HealthCheck {
+	result := make(chan error, 1)
+	go func() {
+		result <- b.probeDatabase()
+	}()
+
+	check := backend.HealthCheck{Name: "database", Status: backend.HealthOK, Message: "writable"}
+
+	select {
+	case err := <-result:
+		if err != nil {
+			check.Status = backend.HealthFailing
+			check.Message = err.Error()
+		}
+	case <-time.After(databaseCheckTimeout):
+		check.Status = backend.HealthFailing
+		check.Message = fmt.Sprintf("no answer within %v", databaseCheckTimeout)
+	}
+
+	return check
+}
+
+func (b *SQLNotificationBackend) probeDatabase() error {
+	err := b.Db.Ping()
+	if err != nil {
+		return err
+	}
+
+	tx, err := b.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.Exec("DELETE FROM leases WHERE 1 = 0")
+	return err
+}
+
+// A failed reload leaves the previous config in use, so the backend still
+// works and is only degraded.
+func (b *SQLNotificationBackend) checkConfig() backend.HealthCheck {
+	b.health.Lock()
+	defer b.health.Unlock()
+
+	loadedAt := b.health.configLoadedAt.UTC().Format(time.RFC3339)
+	if b.health.configReloadFailed != nil {
+		return backend.HealthCheck{
+			Name:    "config",
+			Status:  backend.HealthDegraded,
+			Message: fmt.Sprintf("reload at %s failed: %v, still using the config loaded at %s", b.health.configReloadedAt.UTC().Format(time.RFC3339), b.health.configReloadFailed, loadedAt),
+		}
+	}
+
+	return backend.HealthCheck{Name: "config", Status: backend.HealthOK, Message: "loaded at " + loadedAt}
+}
+
+// The notifications of channels whose notifiers are not registered are stored,
+// but cannot be sent until they are.
+func (b *SQLNotificationBackend) checkNotifiers() backend.HealthCheck {
+	if b.NeverSendNotifications {
+		return backend.HealthCheck{Name: "notifiers", Status: backend.HealthOK, Message: "notifications are never sent"}
+	}
+
+	var missing []string
+	for _, channel := range b.GetChannels() {
+		for _, notifier := range channel.Notifiers {
+			if backend.GetNotifier(notifier) == nil {
+				missing = append(missing, fmt.Sprintf("'%s' of channel '%s'", notifier, channel.Name))
+			}
+		}
+	}
+
+	if len(missing) > 0 {
+		sort.Strings(missing)
+		return backend.HealthCheck{
+			Name:    "notifiers",
+			Status:  backend.HealthDegraded,
+			Message: "not registered: " + strings.Join(missing, ", "),
+		}
+	}
+
+	return backend.HealthCheck{Name: "notifiers", Status: backend.HealthOK, Message: "all registered"}
+}
@@ -0,0 +1,125 @@
+package sql_backend
+
+import (
+	"time"
+
+	"gitlab.com/shuhao/towncrier/backend"
+	"gitlab.com/shuhao/towncrier/testhelpers"
+	. "gopkg.in/check.v1"
+)
+
+func findHealthCheck(c *C, checks []backend.HealthCheck, name string) backend.HealthCheck {
+	for _, check := range checks {
+		if check.Name == name {
+			return check
+		}
+	}
+
+	c.Fatalf("health check %s not found in %v", name, checks)
+	return backend.HealthCheck{}
+}
+
+func (s *SQLNotificationBackendSuite) TestCheckReadinessBeforeStart(c *C) {
+	checks := s.backend.CheckReadiness()
+	c.Assert(backend.WorstHealthStatus(checks), Equals, backend.HealthFailing)
+
+	started := findHealthCheck(c, checks, "started")
+	c.Assert(started.Status, Equals, backend.HealthFailing)
+	c.Assert(started.Message, Equals, "waiting for config reloader, delivery retrier, lease keeper, notification delivery, outbox dispatcher")
+
+	c.Assert(findHealthCheck(c, checks, "database").Status, Equals, backend.HealthOK)
+	c.Assert(backend.WorstHealthStatus(s.backend.CheckLiveness()), Equals, backend.HealthOK)
+}
+
+func (s *SQLNotificationBackendSuite) TestHealthWhileRunning(c *C) {
+	wg := s.startBackend()
+
+	checks := s.backend.CheckReadiness()
+	c.Assert(checks, HasLen, 4+len(backgroundTaskIntervals))
+	for _, check := range checks {
+		c.Assert(check.Status, Equals, backend.HealthOK, Commentf("%v", check))
+	}
+
+	c.Assert(s.backend.CheckLiveness(), HasLen, len(backgroundTaskIntervals))
+
+	s.backend.Shutdown()
+	wg.Wait()
+
+	liveness := s.backend.CheckLiveness()
+	c.Assert(backend.WorstHealthStatus(liveness), Equals, backend.HealthFailing)
+	c.Assert(findHealthCheck(c, liveness, outboxDispatcherTask).Message, Equals, "stopped")
+}
+
+func (s *SQLNotificationBackendSuite) TestLivenessStuckTask(c *C) {
+	s.startBackend()
+	defer s.backend.Shutdown()
+
+	s.backend.health.Lock()
+	s.backend.health.tasks[deliveryRetrierTask].lastRun = s.backend.Clock.Now().Add(-100 * time.Second)
+	s.backend.health.Unlock()
+
+	liveness := s.backend.CheckLiveness()
+	c.Assert(backend.WorstHealthStatus(liveness), Equals, backend.HealthFailing)
+
+	check := findHealthCheck(c, liveness, deliveryRetrierTask)
+	c.Assert(check.Status, Equals, backend.HealthFailing)
+	c.Assert(check.Message, Equals, "last ran 100s ago, expected every 30s")
+	c.Assert(findHealthCheck(c, liveness, configReloaderTask).Status, Equals, backend.HealthOK)
+}
+
+func (s *SQLNotificationBackendSuite) TestLivenessNeverSendNotifications(c *C) {
+	s.backend.NeverSendNotifications = true
+	defer func() { s.backend.NeverSendNotifications = false }()
+
+	s.startBackend()
+	defer s.backend.Shutdown()
+
+	disabledTasks := []string{leaseKeeperTask, notificationDeliveryTask, deliveryRetrierTask, outboxDispatcherTask}
+
+	// The tasks are disabled right after they say they started.
+	var checks []backend.HealthCheck
+	timedout := testhelpers.BlockUntilSatisfiedOrTimeout(func() bool {
+		checks = s.backend.CheckReadiness()
+		for _, task := range disabledTasks {
+			if findHealthCheck(c, checks, task).Message != "disabled as notifications are never sent" {
+				return false
+			}
+		}
+		return true
+	}, testQueueNotificationSendTimeout)
+	c.Assert(timedout, Equals, false)
+
+	c.Assert(backend.WorstHealthStatus(checks), Equals, backend.HealthOK)
+	c.Assert(findHealthCheck(c, checks, "notifiers").Message, Equals, "notifications are never sent")
+}
+
+func (s *SQLNotificationBackendSuite) TestReadinessConfigReloadFailed(c *C) {
+	s.backend.config.ConfigPath = "test_config/missing.conf.json"
+	s.backend.doConfigReloadLogIfError()
+
+	check := findHealthCheck(c, s.backend.CheckReadiness(), "config")
+	c.Assert(check.Status, Equals, backend.HealthDegraded)
+	c.Assert(check.Message, Matches, "reload at .* failed: open test_config/missing.conf.json: no such file or directory, still using the config loaded at .*")
+
+	s.backend.config.ConfigPath = standardTestConfigPath
+	s.backend.doConfigReloadLogIfError()
+
+	c.Assert(findHealthCheck(c, s.backend.CheckReadiness(), "config").Status, Equals, backend.HealthOK)
+}
+
+func (s *SQLNotificationBackendSuite) TestReadinessMissingNotifier(c *C) {
+	backend.ClearAllNotifiers()
+
+	checks := s.backend.CheckReadiness()
+	check := findHealthCheck(c, checks, "notifiers")
+	c.Assert(check.Status, Equals, backend.HealthDegraded)
+	c.Assert(check.Message, Equals, "not registered: 'testnotify' of channel 'Channel1', 'testnotify' of channel 'Channel2'")
+}
+
+func (s *SQLNotificationBackendSuite) TestReadinessDatabaseClosed(c *C) {
+	c.Assert(s.backend.Db.Close(), IsNil)
+
+	check := findHealthCheck(c, s.backend.CheckReadiness(), "database")
+	c.Assert(check.Status, Equals, backend.HealthFailing)
+	c.Assert(check.Message, Equals, "sql: database is closed")
+}
@@ -0,0 +1,126 @@
+package sql_backend
+
+import (
+	"fmt"
+	"math/rand"
+	"os"
+	"time"
+)
+
+const (
+	// Only the holder of this lease delivers the scheduled notifications and
+	// retries the failed ones, so that several towncrier processes can share a
+	// database without sending everything more than once.
+	schedulerLeaseName = "scheduler"
+
+	leaseDuration      = 30 * time.Second
+	leaseRenewInterval = 10 * time.Second
+)
+
+// A name that is unique to this process, used as the holder of the lease if
+// NodeName is not set.
+func defaultNodeName() string {
+	hostname, err := os.Hostname()
+	if err != nil {
+		hostname = "unknown"
+	}
+
+	return fmt.Sprintf("%s-%d-%d", hostname, os.Getpid(), rand.Int63())
+}
+
+// Acquires or renews the lease. The lease is taken over from another node only
+// if that node has not renewed it before it expired, which is what happens if
+// it died.
+//
+// Returns true if we hold the lease until currentTime + leaseDuration.
+func (b *SQLNotificationBackend) renewLease(currentTime time.Time) (bool, error) {
+	expiresAt := currentTime.Add(leaseDuration).UnixNano()
+
+	result, err := b.Exec(b.rebind("UPDATE leases SET Holder = ?, ExpiresAt = ? WHERE Name = ? AND (Holder = ? OR ExpiresAt <= ?)"), b.NodeName, expiresAt, schedulerLeaseName, b.NodeName, currentTime.UnixNano())
+	if err != nil {
+		return false, err
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+
+	if affected > 0 {
+		return true, nil
+	}
+
+	count, err := b.SelectInt(b.rebind("SELECT COUNT(*) FROM leases WHERE Name = ?"), schedulerLeaseName)
+	if err != nil {
+		return false, err
+	}
+
+	if count > 0 {
+		return false, nil
+	}
+
+	// Nobody ever held it. If another node inserts it first, this fails on
+	// the primary key and that node is the leader.
+	_, err = b.Exec(b.rebind("INSERT INTO leases (Name, Holder, ExpiresAt) VALUES (?, ?, ?)"), schedulerLeaseName, b.NodeName, expiresAt)
+	if err == nil {
+		return true, nil
+	}
+
+	if b.IsUniqueViolation != nil && b.IsUniqueViolation(err) {
+		return false, nil
+	}
+
+	return false, err
+}
+
+// Lets the lease expire right away so another node can take over without
+// waiting for it.
+func (b *SQLNotificationBackend) releaseLease() error {
+	_, err := b.Exec(b.rebind("UPDATE leases SET ExpiresAt = 0 WHERE Name = ? AND Holder = ?"), schedulerLeaseName, b.NodeName)
+	return err
+}
+
+func (b *SQLNotificationBackend) renewLeaseLogIfError(currentTime time.Time) {
+	leader, err := b.renewLease(currentTime)
+	if err != nil {
+		// We might still hold it, which we find out on the next renewal. Until
+		// then, we only consider ourselves leader until it would expire.
+		logger.WithField("error", err).Error("cannot renew the lease")
+		return
+	}
+
+	b.leaseLock.Lock()
+	wasLeader := currentTime.Before(b.leaseExpiresAt)
+	if leader {
+		b.leaseExpiresAt = currentTime.Add(leaseDuration)
+	} else {
+		b.leaseExpiresAt = time.Time{}
+	}
+	b.leaseLock.Unlock()
+
+	if leader && !wasLeader {
+		logger.WithField("node", b.NodeName).Info("became the leader, delivering scheduled notifications")
+	} else if !leader && wasLeader {
+		logger.WithField("node", b.NodeName).Warn("lost the lease, no longer delivering scheduled notifications")
+	}
+}
+
+func (b *SQLNotificationBackend) releaseLeaseLogIfError() {
+	b.leaseLock.Lock()
+	b.leaseExpiresAt = time.Time{}
+	b.leaseLock.Unlock()
+
+	err := b.releaseLease()
+	if err != nil {
+		logger.WithField("error", err).Error("cannot release the lease")
+	}
+}
+
+// Whether we are the leader. We stop considering ourselves the leader at the
+// time the lease expires, even if we could not find out if it was renewed.
+func (b *SQLNotificationBackend) isLeader(currentTime time.Time) bool {
+	b.leaseLock.Lock()
+	defer b.leaseLock.Unlock()
+
+	return currentTime.Before(b.leaseExpiresAt)
+}
@@ -0,0 +1,128 @@
+package sql_backend
+
+import (
+	"time"
+
+	"github.com/Sirupsen/logrus"
+
+	. "gopkg.in/check.v1"
+)
+
+func (s *SQLNotificationBackendSuite) TestRenewLeaseTakesOverExpiredLease(c *C) {
+	now := time.Now()
+
+	s.backend.NodeName = "node1"
+	leader, err := s.backend.renewLease(now)
+	c.Assert(err, IsNil)
+	c.Assert(leader, Equals, true)
+
+	s.backend.NodeName = "node2"
+	leader, err = s.backend.renewLease(now.Add(10 * time.Second))
+	c.Assert(err, IsNil)
+	c.Assert(leader, Equals, false)
+
+	s.backend.NodeName = "node1"
+	leader, err = s.backend.renewLease(now.Add(20 * time.Second))
+	c.Assert(err, IsNil)
+	c.Assert(leader, Equals, true)
+
+	// node1 stopped renewing
+	s.backend.NodeName = "node2"
+	leader, err = s.backend.renewLease(now.Add(20*time.Second + leaseDuration))
+	c.Assert(err, IsNil)
+	c.Assert(leader, Equals, true)
+
+	s.backend.NodeName = "node1"
+	leader, err = s.backend.renewLease(now.Add(30*time.Second + leaseDuration))
+	c.Assert(err, IsNil)
+	c.Assert(leader, Equals, false)
+}
+
+func (s *SQLNotificationBackendSuite) TestReleaseLeaseLetsOthersTakeOver(c *C) {
+	now := time.Now()
+
+	s.backend.NodeName = "node1"
+	leader, err := s.backend.renewLease(now)
+	c.Assert(err, IsNil)
+	c.Assert(leader, Equals, true)
+
+	s.backend.NodeName = "node2"
+	c.Assert(s.backend.releaseLease(), IsNil)
+
+	s.backend.NodeName = "node1"
+	leader, err = s.backend.renewLease(now)
+	c.Assert(err, IsNil)
+	c.Assert(leader, Equals, true)
+
+	c.Assert(s.backend.releaseLease(), IsNil)
+
+	s.backend.NodeName = "node2"
+	leader, err = s.backend.renewLease(now)
+	c.Assert(err, IsNil)
+	c.Assert(leader, Equals, true)
+}
+
+func (s *SQLNotificationBackendSuite) TestRenewLeaseLosesInsertRace(c *C) {
+	// node1 inserts the lease between our check and our insert, which makes
+	// ours fail on the primary key.
+	_, err := s.backend.Exec("CREATE TRIGGER lease_race BEFORE INSERT ON leases WHEN NEW.Holder = 'node2' BEGIN INSERT INTO leases (Name, Holder, ExpiresAt) VALUES (NEW.Name, 'node1', NEW.ExpiresAt); END")
+	c.Assert(err, IsNil)
+
+	s.backend.NodeName = "node2"
+	leader, err := s.backend.renewLease(time.Now())
+	c.Assert(err, IsNil)
+	c.Assert(leader, Equals, false)
+}
+
+func (s *SQLNotificationBackendSuite) TestRenewLeaseReturnsDatabaseErrors(c *C) {
+	_, err := s.backend.Exec("CREATE TRIGGER lease_broken BEFORE INSERT ON leases BEGIN SELECT RAISE(ABORT, 'disk I/O error'); END")
+	c.Assert(err, IsNil)
+
+	leader, err := s.backend.renewLease(time.Now())
+	c.Assert(err, ErrorMatches, "disk I/O error")
+	c.Assert(leader, Equals, false)
+
+	s.backend.renewLeaseLogIfError(time.Now())
+	c.Assert(logrusTestHook.HasMessage(logrus.ErrorLevel, "cannot renew the lease"), Equals, true)
+}
+
+func (s *SQLNotificationBackendSuite) TestOnlyLeaderDeliversNotifications(c *C) {
+	s.backend.leaseExpiresAt = time.Time{}
+
+	notification := &Notification{Notification: s.notification}
+	notification.Channel = "Channel2"
+
+	err := notification.insert(s.backend.DbMap)
+	c.Assert(err, IsNil)
+
+	currentTime, err := time.Parse(time.RFC3339, "2015-09-05T23:59:59Z")
+	c.Assert(err, IsNil)
+
+	s.backend.NodeName = "node1"
+	_, err = s.backend.Exec("INSERT INTO leases (Name, Holder, ExpiresAt) VALUES (?, ?, ?)", schedulerLeaseName, "node2", currentTime.Add(time.Minute).UnixNano())
+	c.Assert(err, IsNil)
+
+	s.backend.renewLeaseLogIfError(currentTime)
+	s.backend.deliverNotificationsLogIfError(currentTime)
+	time.Sleep(200 * time.Millisecond)
+
+	c.Assert(s.notifier.Logs, HasLen, 0)
+	c.Assert(logrusTestHook.Logs[logrus.InfoLevel], HasLen, 0)
+
+	// node2 died
+	currentTime = currentTime.Add(time.Minute)
+	s.backend.renewLeaseLogIfError(currentTime)
+	c.Assert(s.backend.isLeader(currentTime), Equals, true)
+	c.Assert(logrusTestHook.Logs[logrus.InfoLevel], HasLen, 1)
+	c.Assert(logrusTestHook.Logs[logrus.InfoLevel][0].Message, Equals, "became the leader, delivering scheduled notifications")
+	c.Assert(s.backend.isLeader(currentTime.Add(leaseDuration)), Equals, false)
+}
+
+func (s *SQLNotificationBackendSuite) TestShutdownReleasesLease(c *C) {
+	s.startBackend()
+	s.backend.Shutdown()
+
+	expiresAt, err := s.backend.SelectInt("SELECT ExpiresAt FROM leases WHERE Name = ?", schedulerLeaseName)
+	c.Assert(err, IsNil)
+	c.Assert(expiresAt, Equals, int64(0))
+}
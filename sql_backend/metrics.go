@@ -0,0 +1,79 @@
+package sql_backend
+
+import (
+	"gitlab.com/shuhao/towncrier/metrics"
+)
+
+var (
+	insertDuration = metrics.NewHistogramVec(
+		"towncrier_backend_insert_duration_seconds",
+		"How long it took to store queued notifications, per transaction.",
+		metrics.DefaultBuckets,
+	)
+
+	deliveryAttempts = metrics.NewCounterVec(
+		"towncrier_delivery_attempts_total",
+		"Attempts to deliver a notification to a subscriber.",
+		"notifier",
+	)
+
+	deliveryFailures = metrics.NewCounterVec(
+		"towncrier_delivery_failures_total",
+		"Attempts to deliver a notification to a subscriber that failed.",
+		"notifier",
+	)
+
+	configReloads = metrics.NewCounterVec(
+		"towncrier_config_reloads_total",
+		"Reloads of the channels and subscribers config.",
+		"result",
+	)
+)
+
+type undeliveredCount struct {
+	Channel string
+	Count   int64
+}
+
+// The gauges are looked up in the database of this backend when the metrics
+// are collected.
+func (b *SQLNotificationBackend) registerGauges() {
+	metrics.RegisterGaugeFunc(
+		"towncrier_undelivered_notifications",
+		"Notifications stored but not delivered yet.",
+		[]string{"channel"},
+		func() ([]metrics.Sample, error) {
+			var counts []*undeliveredCount
+			_, err := b.Select(&counts, b.rebind("SELECT Channel, COUNT(*) AS Count FROM notifications WHERE Delivered = ? GROUP BY Channel ORDER BY Channel"), false)
+			if err != nil {
+				return nil, err
+			}
+
+			samples := make([]metrics.Sample, len(counts))
+			for i, count := range counts {
+				samples[i] = metrics.Sample{LabelValues: []string{count.Channel}, Value: float64(count.Count)}
+			}
+			return samples, nil
+		},
+	)
+
+	metrics.RegisterGaugeFunc(
+		"towncrier_channel_last_run_age_seconds",
+		"Time since the last scheduled run of the channel that was delivered.",
+		[]string{"channel"},
+		func() ([]metrics.Sample, error) {
+			var runs []*ChannelRun
+			_, err := b.Select(&runs, "SELECT * FROM channel_runs ORDER BY Channel")
+			if err != nil {
+				return nil, err
+			}
+
+			now := b.Clock.Now().UnixNano()
+			samples := make([]metrics.Sample, len(runs))
+			for i, run := range runs {
+				samples[i] = metrics.Sample{LabelValues: []string{run.Channel}, Value: float64(now-run.LastRunAt) / 1e9}
+			}
+			return samples, nil
+		},
+	)
+}
@@ -0,0 +1,59 @@
+package sql_backend
+
+import (
+	"bytes"
+	"strings"
+	"time"
+
+	"gitlab.com/shuhao/towncrier/metrics"
+	"gitlab.com/shuhao/towncrier/testhelpers"
+
+	. "gopkg.in/check.v1"
+)
+
+func (s *SQLNotificationBackendSuite) TestMetricsGauges(c *C) {
+	notification := s.notification
+	notification.Channel = s.channel2.Name
+	c.Assert(s.backend.QueueNotification(notification), IsNil)
+	c.Assert(s.backend.QueueNotification(notification), IsNil)
+
+	c.Assert(s.backend.recordChannelRun(s.backend.DbMap, s.channel2, s.backend.Clock.Now().Add(-90*time.Second)), IsNil)
+
+	var buf bytes.Buffer
+	c.Assert(metrics.WriteTo(&buf), IsNil)
+	output := buf.String()
+
+	for _, line := range []string{
+		`towncrier_undelivered_notifications{channel="Channel2"} 2`,
+	} {
+		c.Assert(strings.Contains(output, line+"\n"), Equals, true, Commentf(line))
+	}
+
+	// The age keeps growing with the real clock.
+	c.Assert(strings.Contains(output, `towncrier_channel_last_run_age_seconds{channel="Channel2"} 90`), Equals, true)
+}
+
+func (s *SQLNotificationBackendSuite) TestMetricsCounters(c *C) {
+	attempts := deliveryAttempts.Value("testnotify")
+	failures := deliveryFailures.Value("testnotify")
+	inserts := insertDuration.Count()
+	reloads := configReloads.Value("success")
+
+	s.startBackend()
+
+	notification := s.notification
+	notification.Channel = s.channel1.Name
+	c.Assert(s.backend.QueueNotification(notification), IsNil)
+
+	timedout := testhelpers.BlockUntilSatisfiedOrTimeout(func() bool {
+		return deliveryAttempts.Value("testnotify") > attempts
+	}, testQueueNotificationSendTimeout)
+	c.Assert(timedout, Equals, false)
+
+	c.Assert(deliveryAttempts.Value("testnotify"), Equals, attempts+1)
+	c.Assert(deliveryFailures.Value("testnotify"), Equals, failures)
+	c.Assert(insertDuration.Count(), Equals, inserts+1)
+
+	s.backend.doConfigReloadLogIfError()
+	c.Assert(configReloads.Value("success"), Equals, reloads+1)
+}
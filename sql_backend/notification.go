@@ -0,0 +1,175 @@
+package sql_backend
+
+import (
+	"encoding/json"
+	"strings"
+	"time"
+
+	"github.com/Sirupsen/logrus"
+
+	"gitlab.com/shuhao/towncrier/backend"
+	"gopkg.in/gorp.v1"
+)
+
+type Notification struct {
+	Id           int64 `db:"id"`
+	TagsString   string
+	LabelsString string // JSON
+	PriorityInt  int64
+	Delivered    bool
+	backend.Notification
+}
+
+func (n *Notification) predatabaseOp() error {
+	if n.Tags == nil || len(n.Tags) == 0 {
+		n.TagsString = ""
+	} else {
+		n.TagsString = strings.Join(n.Tags, ",")
+	}
+
+	if len(n.Labels) == 0 {
+		n.LabelsString = ""
+	} else {
+		labels, err := json.Marshal(n.Labels)
+		if err != nil {
+			return err
+		}
+		n.LabelsString = string(labels)
+	}
+
+	n.PriorityInt = int64(n.Priority)
+	return nil
+}
+
+func (n *Notification) PreInsert(s gorp.SqlExecutor) error {
+	// The backend sets it from its clock when it queues the notification.
+	if n.CreatedAt == 0 {
+		n.CreatedAt = time.Now().UnixNano()
+	}
+	n.UpdatedAt = n.CreatedAt
+	return n.predatabaseOp()
+}
+
+func (n *Notification) PreUpdate(s gorp.SqlExecutor) error {
+	n.UpdatedAt = time.Now().UnixNano()
+	return n.predatabaseOp()
+}
+
+func (n *Notification) PostGet(s gorp.SqlExecutor) error {
+	n.Tags = strings.Split(n.TagsString, ",")
+	n.Priority = backend.Priority(n.PriorityInt)
+
+	n.Labels = nil
+	if n.LabelsString != "" {
+		return json.Unmarshal([]byte(n.LabelsString), &n.Labels)
+	}
+
+	return nil
+}
+
+// Returns nil if there is no notification with that id.
+//
+// This is used instead of gorp's Get, which builds its query on first use and
+// caches it in the shared table map without locking, so the outbox workers
+// would race each other on it.
+func (b *SQLNotificationBackend) getNotification(s gorp.SqlExecutor, id int64) (*Notification, error) {
+	var notifications []*Notification
+	_, err := s.Select(&notifications, b.rebind("SELECT * FROM notifications WHERE id = ?"), id)
+	if err != nil || len(notifications) == 0 {
+		return nil, err
+	}
+
+	return notifications[0], nil
+}
+
+func (n *Notification) toStored() *backend.StoredNotification {
+	stored := &backend.StoredNotification{
+		Id:           n.Id,
+		Delivered:    n.Delivered,
+		Notification: n.Notification,
+	}
+
+	if n.TagsString == "" {
+		stored.Tags = []string{}
+	}
+
+	return stored
+}
+
+func (n *Notification) insert(s gorp.SqlExecutor) error {
+	return s.Insert(n)
+}
+
+func (n *Notification) setDelivered(dbmap *gorp.DbMap) error {
+	n.Delivered = true
+	_, err := dbmap.Update(n)
+	return err
+}
+
+// Sends the notifications to every subscriber via every notifier of the
+// channel. Each subscriber/notifier pair is tracked as its own delivery, so a
+// failure only affects that pair: it will be retried by the delivery retrier
+// while the other subscribers are not sent the same notification twice.
+//
+// The notifications are marked as delivered once all of their deliveries have
+// been attempted, regardless of the outcome.
+func (b *SQLNotificationBackend) sendNotifications(notifications []*Notification, channel *Channel, subscribers []backend.Subscriber) error {
+	failedToSendError := NewNotificationFailedToSendToSubscribersError(notifications)
+
+	for _, subscriber := range subscribers {
+		for _, notifierName := range channel.Notifiers {
+			deliveries := make([]*Delivery, 0, len(notifications))
+			pendingNotifications := make([]*Notification, 0, len(notifications))
+
+			for _, n := range notifications {
+				delivery, err := b.getOrCreateDelivery(b.DbMap, n.Id, subscriber.UniqueName, notifierName)
+				if err != nil {
+					logger.WithFields(logrus.Fields{
+						"error":        err,
+						"notification": n.Id,
+						"subscriber":   subscriber.UniqueName,
+						"notifier":     notifierName,
+					}).Error("failed to create delivery")
+					failedToSendError.AddError(subscriber.UniqueName, err)
+					continue
+				}
+
+				// Anything else has already been attempted.
+				if delivery.Status != DeliveryPending {
+					continue
+				}
+
+				deliveries = append(deliveries, delivery)
+				pendingNotifications = append(pendingNotifications, n)
+			}
+
+			err := b.attemptDeliveries(deliveries, pendingNotifications, subscriber, notifierName)
+			if err != nil {
+				failedToSendError.AddError(subscriber.UniqueName, err)
+			}
+		}
+	}
+
+	var err error = nil
+	for _, n := range notifications {
+		err = n.setDelivered(b.DbMap)
+		if err != nil {
+			logger.WithFields(logrus.Fields{
+				"error":        err,
+				"notification": n.Id,
+			}).Error("failed to set notification to be delivered")
+			continue
+		}
+
+		b.hub.Publish(backend.Event{
+			Type:         backend.NotificationDelivered,
+			Notification: *n.toStored(),
+		})
+	}
+
+	if failedToSendError.HasError() {
+		return failedToSendError
+	}
+
+	return err
+}
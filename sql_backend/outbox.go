@@ -0,0 +1,158 @@
+package sql_backend
+
+import (
+	"time"
+
+	"github.com/Sirupsen/logrus"
+	"gopkg.in/gorp.v1"
+)
+
+// An outbox entry is a notification that has been accepted and needs to be
+// sent as soon as possible (immediate channels and urgent notifications).
+//
+// The entry is inserted in the same transaction as the notification and is
+// only removed once the notification has been sent, so a notification that
+// got accepted is always attempted, even if the process dies in between.
+type OutboxEntry struct {
+	Id             int64 `db:"id"`
+	NotificationId int64
+	ClaimedUntil   int64 // UnixNano, the entry is being worked on until then
+	NotBefore      int64 // UnixNano, the SendAt of the notification
+	CreatedAt      int64 // UnixNano
+}
+
+func (e *OutboxEntry) PreInsert(s gorp.SqlExecutor) error {
+	e.CreatedAt = time.Now().UnixNano()
+	return nil
+}
+
+// Claims the entry so that it is not handed out to another worker while it is
+// being processed. The claim expires at claimUntil in case the worker dies.
+//
+// Returns false if someone else holds the claim.
+func (b *SQLNotificationBackend) claimOutboxEntry(s gorp.SqlExecutor, e *OutboxEntry, currentTime, claimUntil time.Time) (bool, error) {
+	result, err := s.Exec(b.rebind("UPDATE outbox SET ClaimedUntil = ? WHERE id = ? AND ClaimedUntil <= ?"), claimUntil.UnixNano(), e.Id, currentTime.UnixNano())
+	if err != nil {
+		return false, err
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+
+	if affected == 0 {
+		return false, nil
+	}
+
+	e.ClaimedUntil = claimUntil.UnixNano()
+	return true, nil
+}
+
+func (b *SQLNotificationBackend) releaseOutboxEntry(s gorp.SqlExecutor, e *OutboxEntry) error {
+	_, err := s.Exec(b.rebind("UPDATE outbox SET ClaimedUntil = 0 WHERE id = ?"), e.Id)
+	return err
+}
+
+func (b *SQLNotificationBackend) removeOutboxEntry(s gorp.SqlExecutor, e *OutboxEntry) error {
+	_, err := s.Exec(b.rebind("DELETE FROM outbox WHERE id = ?"), e.Id)
+	return err
+}
+
+// Wakes up the outbox dispatcher without blocking. The wakeup channel has a
+// buffer of one, so multiple wakeups before the dispatcher gets to it are
+// collapsed into one.
+func (b *SQLNotificationBackend) wakeOutboxDispatcher() {
+	select {
+	case b.outboxWakeup <- struct{}{}:
+	default:
+	}
+}
+
+// Claims all available outbox entries and hands them to the workers. This
+// blocks while all the workers are busy.
+//
+// Returns true if the backend is shutting down.
+func (b *SQLNotificationBackend) dispatchOutboxLogIfError(currentTime time.Time) bool {
+	var entries []*OutboxEntry
+	_, err := b.Select(&entries, b.rebind("SELECT * FROM outbox WHERE ClaimedUntil <= ? AND NotBefore <= ? ORDER BY id"), currentTime.UnixNano(), currentTime.UnixNano())
+	if err != nil {
+		logger.WithField("error", err).Error("cannot select outbox entries from the database")
+		return false
+	}
+
+	for _, entry := range entries {
+		claimed, err := b.claimOutboxEntry(b.DbMap, entry, currentTime, currentTime.Add(outboxClaimTimeout))
+		if err != nil {
+			logger.WithFields(logrus.Fields{
+				"error":  err,
+				"outbox": entry.Id,
+			}).Error("cannot claim outbox entry")
+			continue
+		}
+
+		if !claimed {
+			continue
+		}
+
+		select {
+		case b.outboxJobs <- entry:
+		case <-b.quitChannel:
+			// Give it back so it is picked up right away next time.
+			err = b.releaseOutboxEntry(b.DbMap, entry)
+			if err != nil {
+				logger.WithFields(logrus.Fields{
+					"error":  err,
+					"outbox": entry.Id,
+				}).Error("cannot release outbox entry")
+			}
+			return true
+		}
+	}
+
+	return false
+}
+
+// Only used when the database is exclusive to this process, as otherwise the
+// claims could be held by other processes.
+func (b *SQLNotificationBackend) releaseOutboxClaimsLogIfError() {
+	_, err := b.Exec("UPDATE outbox SET ClaimedUntil = 0")
+	if err != nil {
+		logger.WithField("error", err).Error("cannot release outbox claims")
+	}
+}
+
+// Sends the notification of the entry. The entry is removed afterwards even if
+// some of the deliveries failed, as those are retried by the delivery retrier.
+//
+// If we cannot even get to sending it, the claim is left to expire so that the
+// entry is attempted again later.
+func (b *SQLNotificationBackend) processOutboxEntryLogIfError(entry *OutboxEntry) {
+	localLog := logger.WithFields(logrus.Fields{
+		"outbox":       entry.Id,
+		"notification": entry.NotificationId,
+	})
+
+	notification, err := b.getNotification(b.DbMap, entry.NotificationId)
+	if err != nil {
+		localLog.WithField("error", err).Error("cannot get notification for outbox entry")
+		return
+	}
+
+	if notification != nil {
+		channel, subscribers := b.GetChannelAndItsSubscribers(notification.Channel)
+		if channel == nil {
+			localLog.WithField("channel", notification.Channel).Warnf("channel disappeared during sending, ignoring")
+		} else {
+			err = b.sendNotifications([]*Notification{notification}, channel, subscribers)
+			if err != nil {
+				localLog.WithField("error", err).Error("failed to send notification")
+			}
+		}
+	}
+
+	err = b.removeOutboxEntry(b.DbMap, entry)
+	if err != nil {
+		localLog.WithField("error", err).Error("cannot remove outbox entry")
+	}
+}
@@ -0,0 +1,138 @@
+package sql_backend
+
+import (
+	"time"
+
+	"gitlab.com/shuhao/towncrier/backend"
+	"gitlab.com/shuhao/towncrier/testhelpers"
+
+	. "gopkg.in/check.v1"
+)
+
+func (s *SQLNotificationBackendSuite) outboxEntries(c *C) []*OutboxEntry {
+	var entries []*OutboxEntry
+	_, err := s.backend.Select(&entries, "SELECT * FROM outbox ORDER BY id")
+	c.Assert(err, IsNil)
+	return entries
+}
+
+func (s *SQLNotificationBackendSuite) TestQueueNotificationPutsImmediateNotificationsInOutbox(c *C) {
+	notification := s.notification
+	notification.Channel = "Channel1"
+
+	err := s.backend.QueueNotification(notification)
+	c.Assert(err, IsNil)
+
+	notification.Channel = "Channel2"
+	err = s.backend.QueueNotification(notification)
+	c.Assert(err, IsNil)
+
+	notification.Priority = backend.UrgentPriority
+	err = s.backend.QueueNotification(notification)
+	c.Assert(err, IsNil)
+
+	// Nothing is sent until the backend is started.
+	c.Assert(s.notifier.Logs, HasLen, 0)
+
+	entries := s.outboxEntries(c)
+	c.Assert(entries, HasLen, 2)
+	c.Assert(entries[0].NotificationId, Equals, int64(1))
+	c.Assert(entries[0].ClaimedUntil, Equals, int64(0))
+	c.Assert(entries[1].NotificationId, Equals, int64(3))
+}
+
+// This is what happens when the process is restarted before the outbox got to
+// send the notifications.
+func (s *SQLNotificationBackendSuite) TestOutboxSendsLeftOverEntriesOnStart(c *C) {
+	notification := s.notification
+	notification.Channel = "Channel1"
+
+	err := s.backend.QueueNotification(notification)
+	c.Assert(err, IsNil)
+
+	// Claimed by a process that died.
+	_, err = s.backend.Exec("UPDATE outbox SET ClaimedUntil = ?", time.Now().Add(time.Hour).UnixNano())
+	c.Assert(err, IsNil)
+
+	s.startBackend()
+
+	timedout := testhelpers.BlockUntilSatisfiedOrTimeout(func() bool {
+		s.notifier.Lock()
+		defer s.notifier.Unlock()
+		return len(s.notifier.Logs) >= 1
+	}, testQueueNotificationSendTimeout)
+	c.Assert(timedout, Equals, false)
+
+	s.backend.Shutdown()
+
+	c.Assert(s.notifier.Logs, HasLen, 1)
+	c.Assert(s.notifier.Logs[0].Subscriber, DeepEquals, s.jimmy)
+	c.Assert(s.outboxEntries(c), HasLen, 0)
+}
+
+func (s *SQLNotificationBackendSuite) TestOutboxEntryCanOnlyBeClaimedOnce(c *C) {
+	notification := s.notification
+	notification.Channel = "Channel1"
+
+	err := s.backend.QueueNotification(notification)
+	c.Assert(err, IsNil)
+
+	entries := s.outboxEntries(c)
+	c.Assert(entries, HasLen, 1)
+
+	now := time.Now()
+	claimed, err := s.backend.claimOutboxEntry(s.backend.DbMap, entries[0], now, now.Add(time.Minute))
+	c.Assert(err, IsNil)
+	c.Assert(claimed, Equals, true)
+
+	claimed, err = s.backend.claimOutboxEntry(s.backend.DbMap, entries[0], now, now.Add(time.Minute))
+	c.Assert(err, IsNil)
+	c.Assert(claimed, Equals, false)
+
+	// The claim expired.
+	claimed, err = s.backend.claimOutboxEntry(s.backend.DbMap, entries[0], now.Add(2*time.Minute), now.Add(3*time.Minute))
+	c.Assert(err, IsNil)
+	c.Assert(claimed, Equals, true)
+}
+
+func (s *SQLNotificationBackendSuite) TestShutdownWaitsForOutboxWorkers(c *C) {
+	s.notifier.Delay = 300 * time.Millisecond
+
+	s.startBackend()
+
+	notification := s.notification
+	notification.Channel = "Channel1"
+
+	err := s.backend.QueueNotification(notification)
+	c.Assert(err, IsNil)
+
+	// Let the dispatcher hand it to a worker.
+	timedout := testhelpers.BlockUntilSatisfiedOrTimeout(func() bool {
+		entries := []*OutboxEntry{}
+		_, err := s.backend.Select(&entries, "SELECT * FROM outbox WHERE ClaimedUntil > 0")
+		return err == nil && len(entries) == 1
+	}, testQueueNotificationSendTimeout)
+	c.Assert(timedout, Equals, false)
+
+	s.backend.Shutdown()
+
+	c.Assert(s.notifier.Logs, HasLen, 1)
+	c.Assert(s.outboxEntries(c), HasLen, 0)
+}
+
+func (s *SQLNotificationBackendSuite) TestDeliverNotificationsSkipsNotificationsInOutbox(c *C) {
+	notification := s.notification
+	notification.Channel = "Channel2"
+	notification.Priority = backend.UrgentPriority
+
+	err := s.backend.QueueNotification(notification)
+	c.Assert(err, IsNil)
+	c.Assert(s.outboxEntries(c), HasLen, 1)
+
+	currentTime, err := time.Parse(time.RFC3339, "2015-09-05T23:59:59Z")
+	c.Assert(err, IsNil)
+	s.backend.deliverNotificationsLogIfError(currentTime)
+	time.Sleep(200 * time.Millisecond)
+
+	c.Assert(s.notifier.Logs, HasLen, 0)
+}
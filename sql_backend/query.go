@@ -0,0 +1,156 @@
+package sql_backend
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"gitlab.com/shuhao/towncrier/backend"
+)
+
+// The tags are stored joined by commas, so a tag matches if it is the whole
+// column or is delimited by commas.
+//
+// The wildcards in the tag are escaped with !, as backslash is not an escape
+// character in every database.
+func tagConditions(tag string) (string, []interface{}) {
+	escaped := strings.NewReplacer("!", "!!", "%", "!%", "_", "!_").Replace(tag)
+	condition := "(TagsString = ? OR TagsString LIKE ? ESCAPE '!' OR TagsString LIKE ? ESCAPE '!' OR TagsString LIKE ? ESCAPE '!')"
+	return condition, []interface{}{tag, escaped + ",%", "%," + escaped, "%," + escaped + ",%"}
+}
+
+func (b *SQLNotificationBackend) QueryNotifications(query backend.NotificationQuery) ([]*backend.StoredNotification, error) {
+	conditions := []string{}
+	args := []interface{}{}
+
+	if query.Channel != "" {
+		conditions = append(conditions, "Channel = ?")
+		args = append(args, query.Channel)
+	}
+
+	if len(query.Channels) > 0 {
+		placeholders := make([]string, len(query.Channels))
+		for i, channel := range query.Channels {
+			placeholders[i] = "?"
+			args = append(args, channel)
+		}
+		conditions = append(conditions, "Channel IN ("+strings.Join(placeholders, ", ")+")")
+	}
+
+	if query.Origin != "" {
+		conditions = append(conditions, "Origin = ?")
+		args = append(args, query.Origin)
+	}
+
+	if query.Tag != "" {
+		condition, tagArgs := tagConditions(query.Tag)
+		conditions = append(conditions, condition)
+		args = append(args, tagArgs...)
+	}
+
+	if query.Priority != 0 {
+		conditions = append(conditions, "PriorityInt = ?")
+		args = append(args, int64(query.Priority))
+	}
+
+	if query.Delivered != nil {
+		conditions = append(conditions, "Delivered = ?")
+		args = append(args, *query.Delivered)
+	}
+
+	if query.Since != 0 {
+		conditions = append(conditions, "CreatedAt >= ?")
+		args = append(args, query.Since)
+	}
+
+	if query.Until != 0 {
+		conditions = append(conditions, "CreatedAt < ?")
+		args = append(args, query.Until)
+	}
+
+	if query.BeforeId != 0 {
+		conditions = append(conditions, "id < ?")
+		args = append(args, query.BeforeId)
+	}
+
+	sql := "SELECT * FROM notifications"
+	if len(conditions) > 0 {
+		sql += " WHERE " + strings.Join(conditions, " AND ")
+	}
+
+	sql += " ORDER BY id DESC"
+
+	if query.Limit > 0 {
+		sql += fmt.Sprintf(" LIMIT %d", query.Limit)
+	}
+
+	var notifications []*Notification
+	_, err := b.Select(&notifications, b.rebind(sql), args...)
+	if err != nil {
+		return nil, err
+	}
+
+	storedNotifications := make([]*backend.StoredNotification, len(notifications))
+	for i, n := range notifications {
+		storedNotifications[i] = n.toStored()
+	}
+
+	return storedNotifications, nil
+}
+
+func (b *SQLNotificationBackend) GetNotification(id int64) (*backend.StoredNotification, error) {
+	notification, err := b.getNotification(b.DbMap, id)
+	if err != nil {
+		return nil, err
+	}
+
+	if notification == nil {
+		return nil, backend.NotificationNotFound{Id: id}
+	}
+
+	return notification.toStored(), nil
+}
+
+func (b *SQLNotificationBackend) ListChannels() []backend.ChannelInfo {
+	b.config.Lock()
+	channels := make([]backend.ChannelInfo, 0, len(b.config.Channels))
+	for _, channel := range b.config.Channels {
+		channels = append(channels, backend.ChannelInfo{
+			Name:         channel.Name,
+			TimeToNotify: channel.TimeToNotify,
+			Subscribers:  channel.Subscribers,
+			Notifiers:    channel.Notifiers,
+		})
+	}
+	b.config.Unlock()
+
+	sort.Sort(channelInfosByName(channels))
+	return channels
+}
+
+type channelInfosByName []backend.ChannelInfo
+
+func (c channelInfosByName) Len() int           { return len(c) }
+func (c channelInfosByName) Less(i, j int) bool { return c[i].Name < c[j].Name }
+func (c channelInfosByName) Swap(i, j int)      { c[i], c[j] = c[j], c[i] }
+
+func (b *SQLNotificationBackend) ListDeliveries(notificationId int64) ([]*backend.DeliveryStatus, error) {
+	var deliveries []*Delivery
+	_, err := b.Select(&deliveries, b.rebind("SELECT * FROM deliveries WHERE NotificationId = ? ORDER BY id"), notificationId)
+	if err != nil {
+		return nil, err
+	}
+
+	statuses := make([]*backend.DeliveryStatus, len(deliveries))
+	for i, d := range deliveries {
+		statuses[i] = d.toStatus()
+	}
+
+	return statuses, nil
+}
+
+func (b *SQLNotificationBackend) ListOrigins() ([]string, error) {
+	var origins []string
+	_, err := b.Select(&origins, "SELECT DISTINCT Origin FROM notifications WHERE Origin <> '' ORDER BY Origin")
+	return origins, err
+}
@@ -0,0 +1,152 @@
+package sql_backend
+
+import (
+	"gitlab.com/shuhao/towncrier/backend"
+
+	. "gopkg.in/check.v1"
+)
+
+func (s *SQLNotificationBackendSuite) insertNotifications(c *C, notifications ...backend.Notification) []int64 {
+	ids := make([]int64, len(notifications))
+	for i, n := range notifications {
+		notification := &Notification{Notification: n}
+		err := notification.insert(s.backend.DbMap)
+		c.Assert(err, IsNil)
+		ids[i] = notification.Id
+	}
+
+	return ids
+}
+
+func (s *SQLNotificationBackendSuite) TestQueryNotificationsFilters(c *C) {
+	n1 := s.notification
+	n1.Channel = "Channel1"
+	n1.Tags = []string{"disk", "db%"}
+
+	n2 := s.notification
+	n2.Channel = "Channel2"
+	n2.Origin = "other"
+	n2.Tags = []string{"diskette"}
+	n2.Priority = backend.UrgentPriority
+
+	n3 := s.notification
+	n3.Channel = "Channel2"
+	n3.Tags = []string{"web", "disk"}
+
+	ids := s.insertNotifications(c, n1, n2, n3)
+
+	_, err := s.backend.Exec("UPDATE notifications SET Delivered = ?, CreatedAt = id WHERE id = ?", true, ids[2])
+	c.Assert(err, IsNil)
+
+	queryIds := func(query backend.NotificationQuery) []int64 {
+		notifications, err := s.backend.QueryNotifications(query)
+		c.Assert(err, IsNil)
+
+		result := []int64{}
+		for _, n := range notifications {
+			result = append(result, n.Id)
+		}
+		return result
+	}
+
+	delivered := true
+	undelivered := false
+
+	c.Assert(queryIds(backend.NotificationQuery{}), DeepEquals, []int64{ids[2], ids[1], ids[0]})
+	c.Assert(queryIds(backend.NotificationQuery{Channel: "Channel2"}), DeepEquals, []int64{ids[2], ids[1]})
+	c.Assert(queryIds(backend.NotificationQuery{Origin: "other"}), DeepEquals, []int64{ids[1]})
+	c.Assert(queryIds(backend.NotificationQuery{Tag: "disk"}), DeepEquals, []int64{ids[2], ids[0]})
+	c.Assert(queryIds(backend.NotificationQuery{Tag: "db%"}), DeepEquals, []int64{ids[0]})
+	c.Assert(queryIds(backend.NotificationQuery{Tag: "d%"}), DeepEquals, []int64{})
+	c.Assert(queryIds(backend.NotificationQuery{Priority: backend.UrgentPriority}), DeepEquals, []int64{ids[1]})
+	c.Assert(queryIds(backend.NotificationQuery{Delivered: &delivered}), DeepEquals, []int64{ids[2]})
+	c.Assert(queryIds(backend.NotificationQuery{Delivered: &undelivered}), DeepEquals, []int64{ids[1], ids[0]})
+	c.Assert(queryIds(backend.NotificationQuery{Until: ids[2] + 1}), DeepEquals, []int64{ids[2]})
+	c.Assert(queryIds(backend.NotificationQuery{Since: ids[2] + 1}), DeepEquals, []int64{ids[1], ids[0]})
+	c.Assert(queryIds(backend.NotificationQuery{Channel: "Channel2", Tag: "disk"}), DeepEquals, []int64{ids[2]})
+}
+
+func (s *SQLNotificationBackendSuite) TestQueryNotificationsPaginates(c *C) {
+	ids := s.insertNotifications(c, s.notification, s.notification, s.notification)
+
+	notifications, err := s.backend.QueryNotifications(backend.NotificationQuery{Limit: 2})
+	c.Assert(err, IsNil)
+	c.Assert(notifications, HasLen, 2)
+	c.Assert(notifications[0].Id, Equals, ids[2])
+	c.Assert(notifications[1].Id, Equals, ids[1])
+
+	notifications, err = s.backend.QueryNotifications(backend.NotificationQuery{Limit: 2, BeforeId: notifications[1].Id})
+	c.Assert(err, IsNil)
+	c.Assert(notifications, HasLen, 1)
+	c.Assert(notifications[0].Id, Equals, ids[0])
+}
+
+func (s *SQLNotificationBackendSuite) TestGetNotification(c *C) {
+	n := s.notification
+	n.Tags = nil
+	ids := s.insertNotifications(c, n)
+
+	notification, err := s.backend.GetNotification(ids[0])
+	c.Assert(err, IsNil)
+	c.Assert(notification.Id, Equals, ids[0])
+	c.Assert(notification.Subject, Equals, "subject")
+	c.Assert(notification.Tags, DeepEquals, []string{})
+	c.Assert(notification.Delivered, Equals, false)
+
+	_, err = s.backend.GetNotification(ids[0] + 1)
+	c.Assert(err, DeepEquals, backend.NotificationNotFound{Id: ids[0] + 1})
+}
+
+func (s *SQLNotificationBackendSuite) TestListChannels(c *C) {
+	channels := s.backend.ListChannels()
+	c.Assert(channels, DeepEquals, []backend.ChannelInfo{
+		{Name: "Channel1", TimeToNotify: "@immediately", Subscribers: []string{"jimmy"}, Notifiers: []string{"testnotify"}},
+		{Name: "Channel2", TimeToNotify: "@daily", Subscribers: []string{"jimmy", "bob"}, Notifiers: []string{"testnotify"}},
+	})
+}
+
+func (s *SQLNotificationBackendSuite) TestListDeliveries(c *C) {
+	ids := s.insertNotifications(c, s.notification, s.notification)
+
+	deliveries, err := s.backend.ListDeliveries(ids[0])
+	c.Assert(err, IsNil)
+	c.Assert(deliveries, HasLen, 0)
+
+	for _, subscriber := range []string{"jimmy", "bob"} {
+		err = s.backend.Insert(&Delivery{NotificationId: ids[0], Subscriber: subscriber, Notifier: "testnotify", Status: DeliveryFailed, Attempts: 1, LastError: "nope"})
+		c.Assert(err, IsNil)
+	}
+
+	err = s.backend.Insert(&Delivery{NotificationId: ids[1], Subscriber: "jimmy", Notifier: "testnotify", Status: DeliverySent})
+	c.Assert(err, IsNil)
+
+	deliveries, err = s.backend.ListDeliveries(ids[0])
+	c.Assert(err, IsNil)
+	c.Assert(deliveries, HasLen, 2)
+	c.Assert(deliveries[0].Subscriber, Equals, "jimmy")
+	c.Assert(deliveries[0].Status, Equals, DeliveryFailed)
+	c.Assert(deliveries[0].Attempts, Equals, int64(1))
+	c.Assert(deliveries[0].LastError, Equals, "nope")
+	c.Assert(deliveries[1].Subscriber, Equals, "bob")
+}
+
+func (s *SQLNotificationBackendSuite) TestListOrigins(c *C) {
+	origins, err := s.backend.ListOrigins()
+	c.Assert(err, IsNil)
+	c.Assert(origins, HasLen, 0)
+
+	n1 := s.notification
+	n1.Origin = "zed"
+
+	n2 := s.notification
+	n2.Origin = "abc"
+
+	n3 := s.notification
+	n3.Origin = ""
+
+	s.insertNotifications(c, n1, n2, n1, n3)
+
+	origins, err = s.backend.ListOrigins()
+	c.Assert(err, IsNil)
+	c.Assert(origins, DeepEquals, []string{"abc", "zed"})
+}
@@ -0,0 +1,148 @@
+package sql_backend
+
+import (
+	"bytes"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/Sirupsen/logrus"
+	"gitlab.com/shuhao/towncrier/backend"
+	"gopkg.in/gorp.v1"
+)
+
+// The notifications of an origin that were suppressed by the rate limit of a
+// channel, until their summary is queued. Every receiver sharing the database
+// counts on the same rows, so there is one summary no matter which of them
+// refused the notifications.
+type SuppressedNotifications struct {
+	Channel     string
+	Origin      string
+	Count       int64
+	Since       int64 // UnixNano of the first one
+	SummarizeAt int64 // UnixNano
+}
+
+func (b *SQLNotificationBackend) SuppressNotification(notification backend.Notification, retryAfter time.Duration) error {
+	counted, err := b.countSuppressed(notification)
+	if err != nil || counted {
+		return err
+	}
+
+	// The first of the origin is summarized along with the others of the
+	// channel, if there are any already.
+	currentTime := b.Clock.Now()
+	summarizeAt, err := b.SelectInt(b.rebind("SELECT COALESCE(MIN(SummarizeAt), 0) FROM suppressed_notifications WHERE Channel = ?"), notification.Channel)
+	if err != nil {
+		return err
+	}
+
+	if summarizeAt == 0 {
+		summarizeAt = currentTime.Add(retryAfter).UnixNano()
+	}
+
+	err = b.Insert(&SuppressedNotifications{
+		Channel:     notification.Channel,
+		Origin:      notification.Origin,
+		Count:       1,
+		Since:       currentTime.UnixNano(),
+		SummarizeAt: summarizeAt,
+	})
+
+	// Another process counted the first one just before us.
+	if err != nil && b.IsUniqueViolation != nil && b.IsUniqueViolation(err) {
+		_, err = b.countSuppressed(notification)
+	}
+
+	return err
+}
+
+// Adds the notification to the count of its channel and origin, if there is
+// one.
+func (b *SQLNotificationBackend) countSuppressed(notification backend.Notification) (bool, error) {
+	result, err := b.Exec(b.rebind("UPDATE suppressed_notifications SET Count = Count + 1 WHERE Channel = ? AND Origin = ?"), notification.Channel, notification.Origin)
+	if err != nil {
+		return false, err
+	}
+
+	affected, err := result.RowsAffected()
+	return affected > 0, err
+}
+
+func suppressedSummary(channel string, suppressed []*SuppressedNotifications) backend.Notification {
+	var count int64
+	since := suppressed[0].Since
+	for _, s := range suppressed {
+		count += s.Count
+		if s.Since < since {
+			since = s.Since
+		}
+	}
+
+	var content bytes.Buffer
+	fmt.Fprintf(&content, "%d notifications to %s were not stored nor sent since %s, as the channel was over its rate limit.\n\nBy origin:\n", count, channel, time.Unix(0, since).UTC().Format(time.RFC3339))
+	for _, s := range suppressed {
+		fmt.Fprintf(&content, "  %s: %d\n", s.Origin, s.Count)
+	}
+
+	return backend.Notification{
+		Subject:  fmt.Sprintf("%d notifications suppressed", count),
+		Content:  content.String(),
+		Channel:  channel,
+		Origin:   backend.SuppressedSummaryOrigin,
+		Tags:     []string{"suppressed"},
+		Labels:   map[string]string{"suppressed": strconv.FormatInt(count, 10)},
+		Priority: backend.NormalPriority,
+	}
+}
+
+// Queues the summary of the notifications suppressed in the channel and takes
+// what it counts off the counts in the same transaction. The ones suppressed in
+// the meantime are left for the next summary.
+func (b *SQLNotificationBackend) queueSuppressedSummary(channel string) error {
+	var suppressed []*SuppressedNotifications
+	_, err := b.Select(&suppressed, b.rebind("SELECT * FROM suppressed_notifications WHERE Channel = ? ORDER BY Origin"), channel)
+	if err != nil || len(suppressed) == 0 {
+		return err
+	}
+
+	results, err := b.queueNotificationsWith([]backend.Notification{suppressedSummary(channel, suppressed)}, func(tx *gorp.Transaction) error {
+		for _, s := range suppressed {
+			_, err := tx.Exec(b.rebind("UPDATE suppressed_notifications SET Count = Count - ? WHERE Channel = ? AND Origin = ?"), s.Count, s.Channel, s.Origin)
+			if err != nil {
+				return err
+			}
+		}
+
+		_, err := tx.Exec(b.rebind("DELETE FROM suppressed_notifications WHERE Channel = ? AND Count <= 0"), channel)
+		return err
+	})
+
+	if err != nil {
+		return err
+	}
+
+	// The counts are dropped anyway, as there is nowhere to send the summary.
+	return results[0].Error
+}
+
+// Queues the summaries that are due. Only the leader does it, so that there is
+// one per channel.
+func (b *SQLNotificationBackend) queueSuppressedSummariesLogIfError(currentTime time.Time) {
+	var channels []string
+	_, err := b.Select(&channels, b.rebind("SELECT DISTINCT Channel FROM suppressed_notifications WHERE SummarizeAt <= ? ORDER BY Channel"), currentTime.UnixNano())
+	if err != nil {
+		logger.WithField("error", err).Error("cannot select suppressed notifications from the database")
+		return
+	}
+
+	for _, channel := range channels {
+		err = b.queueSuppressedSummary(channel)
+		if err != nil {
+			logger.WithFields(logrus.Fields{
+				"channel": channel,
+				"error":   err,
+			}).Error("failed to queue the summary of the suppressed notifications")
+		}
+	}
+}
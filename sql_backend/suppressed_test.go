@@ -0,0 +1,97 @@
+package sql_backend
+
+import (
+	"strings"
+	"time"
+
+	"github.com/facebookgo/clock"
+	"gitlab.com/shuhao/towncrier/backend"
+
+	. "gopkg.in/check.v1"
+)
+
+func (s *SQLNotificationBackendSuite) suppressedNotifications(c *C) []*SuppressedNotifications {
+	var suppressed []*SuppressedNotifications
+	_, err := s.backend.Select(&suppressed, "SELECT * FROM suppressed_notifications ORDER BY Channel, Origin")
+	c.Assert(err, IsNil)
+	return suppressed
+}
+
+func newSuppressedTestClock() *clock.Mock {
+	mock := clock.NewMock()
+	mock.Add(time.Date(2015, 10, 12, 10, 0, 0, 0, time.UTC).Sub(mock.Now()))
+	return mock
+}
+
+func (s *SQLNotificationBackendSuite) TestSuppressNotificationCountsByOrigin(c *C) {
+	mock := newSuppressedTestClock()
+	s.backend.Clock = mock
+	first := mock.Now()
+
+	c.Assert(s.backend.SuppressNotification(backend.Notification{Channel: "Channel2", Origin: "cron"}, time.Minute), IsNil)
+	mock.Add(10 * time.Second)
+	c.Assert(s.backend.SuppressNotification(backend.Notification{Channel: "Channel2", Origin: "backup"}, time.Minute), IsNil)
+	c.Assert(s.backend.SuppressNotification(backend.Notification{Channel: "Channel2", Origin: "cron"}, 5*time.Second), IsNil)
+	c.Assert(s.backend.SuppressNotification(backend.Notification{Channel: "Channel1", Origin: "cron"}, 5*time.Second), IsNil)
+
+	// The channel is summarized once, when the first one can be retried.
+	c.Assert(s.suppressedNotifications(c), DeepEquals, []*SuppressedNotifications{
+		{Channel: "Channel1", Origin: "cron", Count: 1, Since: mock.Now().UnixNano(), SummarizeAt: mock.Now().Add(5 * time.Second).UnixNano()},
+		{Channel: "Channel2", Origin: "backup", Count: 1, Since: mock.Now().UnixNano(), SummarizeAt: first.Add(time.Minute).UnixNano()},
+		{Channel: "Channel2", Origin: "cron", Count: 2, Since: first.UnixNano(), SummarizeAt: first.Add(time.Minute).UnixNano()},
+	})
+}
+
+func (s *SQLNotificationBackendSuite) TestQueueSuppressedSummaries(c *C) {
+	mock := newSuppressedTestClock()
+	s.backend.Clock = mock
+
+	for _, origin := range []string{"cron", "backup", "cron"} {
+		c.Assert(s.backend.SuppressNotification(backend.Notification{Channel: "Channel2", Origin: origin}, time.Minute), IsNil)
+	}
+
+	s.backend.queueSuppressedSummariesLogIfError(mock.Now().Add(59 * time.Second))
+
+	notifications, err := s.backend.QueryNotifications(backend.NotificationQuery{})
+	c.Assert(err, IsNil)
+	c.Assert(notifications, HasLen, 0)
+
+	s.backend.queueSuppressedSummariesLogIfError(mock.Now().Add(time.Minute))
+
+	notifications, err = s.backend.QueryNotifications(backend.NotificationQuery{})
+	c.Assert(err, IsNil)
+	c.Assert(notifications, HasLen, 1)
+	c.Assert(notifications[0].Channel, Equals, "Channel2")
+	c.Assert(notifications[0].Subject, Equals, "3 notifications suppressed")
+	c.Assert(notifications[0].Origin, Equals, backend.SuppressedSummaryOrigin)
+	c.Assert(notifications[0].Labels, DeepEquals, map[string]string{"suppressed": "3"})
+	c.Assert(strings.Contains(notifications[0].Content, "since 2015-10-12T10:00:00Z"), Equals, true)
+	c.Assert(strings.Contains(notifications[0].Content, "  backup: 1\n  cron: 2\n"), Equals, true)
+	c.Assert(s.suppressedNotifications(c), HasLen, 0)
+
+	// Nothing is left to summarize.
+	s.backend.queueSuppressedSummariesLogIfError(mock.Now().Add(time.Hour))
+
+	notifications, err = s.backend.QueryNotifications(backend.NotificationQuery{})
+	c.Assert(err, IsNil)
+	c.Assert(notifications, HasLen, 1)
+}
+
+func (s *SQLNotificationBackendSuite) TestSuppressedSummaryOfRemovedChannelIsDropped(c *C) {
+	c.Assert(s.backend.SuppressNotification(backend.Notification{Channel: "Removed", Origin: "cron"}, time.Minute), IsNil)
+
+	err := s.backend.queueSuppressedSummary("Removed")
+	c.Assert(err, DeepEquals, backend.ChannelNotFound{ChannelName: "Removed"})
+	c.Assert(s.suppressedNotifications(c), HasLen, 0)
+}
+
+func (s *SQLNotificationBackendSuite) TestDeliveryQueuesDueSuppressedSummaries(c *C) {
+	c.Assert(s.backend.SuppressNotification(backend.Notification{Channel: "Channel2", Origin: "cron"}, time.Minute), IsNil)
+
+	s.backend.deliverNotificationsLogIfError(time.Now().Add(time.Minute))
+
+	notifications, err := s.backend.QueryNotifications(backend.NotificationQuery{Origin: backend.SuppressedSummaryOrigin})
+	c.Assert(err, IsNil)
+	c.Assert(notifications, HasLen, 1)
+	c.Assert(notifications[0].Subject, Equals, "1 notifications suppressed")
+}
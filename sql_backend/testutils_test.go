@@ -1,11 +1,15 @@
-package sqlite_backend
+package sql_backend
 
 import (
+	"database/sql"
 	"io/ioutil"
 	"strings"
+	"sync"
 
+	"github.com/mattn/go-sqlite3"
 	"gitlab.com/shuhao/towncrier/backend"
 	. "gopkg.in/check.v1"
+	"gopkg.in/gorp.v1"
 )
 
 const (
@@ -13,13 +17,38 @@ const (
 	changedTestConfigPath  = "test_config/changed.conf.json"
 )
 
-func (s *SQLiteNotificationBackendSuite) checkNotificationEquality(c *C, obtained, expected backend.Notification) {
+// The tests here run against an in memory SQLite database, the same way the
+// sqlite backend sets it up.
+func initializeTestBackend(b *SQLNotificationBackend) error {
+	db, err := sql.Open("sqlite3", ":memory:")
+	if err != nil {
+		return err
+	}
+
+	db.SetMaxOpenConns(1)
+	b.IsUniqueViolation = func(err error) bool {
+		sqliteErr, ok := err.(sqlite3.Error)
+		return ok && sqliteErr.ExtendedCode == sqlite3.ErrConstraintPrimaryKey
+	}
+
+	return b.InitializeWithDb(db, gorp.SqliteDialect{}, standardTestConfigPath)
+}
+
+func (s *SQLNotificationBackendSuite) checkNotificationEquality(c *C, obtained, expected backend.Notification) {
 	obtained.CreatedAt = 0
 	obtained.UpdatedAt = 0
 
 	c.Assert(obtained, DeepEquals, expected)
 }
 
+// Starts the background tasks. The caller must call Shutdown.
+func (s *SQLNotificationBackendSuite) startBackend() *sync.WaitGroup {
+	wg := &sync.WaitGroup{}
+	s.backend.Start(wg)
+	s.backend.BlockUntilReady()
+	return wg
+}
+
 var originalTestConfigContent []byte = nil
 
 func memorizeOriginalConfig() error {
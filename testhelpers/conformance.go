@@ -0,0 +1,343 @@
+package testhelpers
+
+import (
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/facebookgo/clock"
+	"gitlab.com/shuhao/towncrier/backend"
+
+	. "gopkg.in/check.v1"
+)
+
+const conformanceTimeout = 5 * time.Second
+
+// The behavior every backend.NotificationBackend has to honor. Backend packages
+// run it against their own constructor:
+//
+//     var _ = Suite(&testhelpers.BackendConformanceSuite{
+//         NewBackend: func(c *C, clock clock.Clock) backend.NotificationBackend {
+//             ...
+//         },
+//     })
+//
+// NewBackend must return an initialized backend with an empty database that
+// uses the clock for all of its scheduling. It can skip the test with c.Skip
+// if its database is not available. The backend must be configured with:
+//
+// - the subscribers jimmy and bob
+// - Channel1, sent @immediately to jimmy
+// - Channel2, sent @daily to jimmy and bob
+// - both channels sending via the testnotify notifier
+type BackendConformanceSuite struct {
+	NewBackend func(c *C, clock clock.Clock) backend.NotificationBackend
+
+	backend  backend.NotificationBackend
+	clock    *clock.Mock
+	notifier *TestNotifier
+	wg       *sync.WaitGroup
+	shutdown bool
+}
+
+func (s *BackendConformanceSuite) SetUpTest(c *C) {
+	s.notifier = NewTestNotifier()
+	backend.ClearAllNotifiers()
+	backend.RegisterNotifier(s.notifier)
+
+	// Noon, far away from the daily run of Channel2.
+	s.clock = clock.NewMock()
+	s.clock.Add(time.Date(2015, 10, 1, 12, 0, 0, 0, time.Local).Sub(s.clock.Now()))
+
+	s.backend = s.NewBackend(c, s.clock)
+	s.wg = &sync.WaitGroup{}
+	s.shutdown = false
+	s.backend.Start(s.wg)
+	s.backend.BlockUntilReady()
+}
+
+func (s *BackendConformanceSuite) TearDownTest(c *C) {
+	if !s.shutdown {
+		s.backend.Shutdown()
+	}
+}
+
+func (s *BackendConformanceSuite) notification(channel string) backend.Notification {
+	return backend.Notification{
+		Channel:  channel,
+		Subject:  "subject",
+		Content:  "content",
+		Origin:   "origin",
+		Tags:     []string{"tag1", "tag2"},
+		Priority: backend.NormalPriority,
+	}
+}
+
+func (s *BackendConformanceSuite) sent() int {
+	s.notifier.Lock()
+	defer s.notifier.Unlock()
+	return len(s.notifier.Logs)
+}
+
+func (s *BackendConformanceSuite) attempts() int {
+	s.notifier.Lock()
+	defer s.notifier.Unlock()
+	return s.notifier.Attempts
+}
+
+// Moves the clock forward by step every time the condition is checked.
+func (s *BackendConformanceSuite) advanceUntil(step time.Duration, condition func() bool) bool {
+	return BlockUntilSatisfiedOrTimeout(func() bool {
+		s.clock.Add(step)
+		return condition()
+	}, conformanceTimeout)
+}
+
+func (s *BackendConformanceSuite) TestQueueNotificationSendsImmediately(c *C) {
+	err := s.backend.QueueNotification(s.notification("Channel1"))
+	c.Assert(err, IsNil)
+
+	timedout := BlockUntilSatisfiedOrTimeout(func() bool {
+		return s.sent() >= 1
+	}, conformanceTimeout)
+	c.Assert(timedout, Equals, false)
+
+	s.notifier.Lock()
+	defer s.notifier.Unlock()
+	c.Assert(s.notifier.Logs, HasLen, 1)
+	c.Assert(s.notifier.Logs[0].Subscriber.UniqueName, Equals, "jimmy")
+	c.Assert(s.notifier.Logs[0].Notifications, HasLen, 1)
+	c.Assert(s.notifier.Logs[0].Notifications[0].Subject, Equals, "subject")
+	c.Assert(s.notifier.Logs[0].Notifications[0].Tags, DeepEquals, []string{"tag1", "tag2"})
+}
+
+func (s *BackendConformanceSuite) TestQueueNotificationChannelNotFound(c *C) {
+	err := s.backend.QueueNotification(s.notification("invalid-channel"))
+	c.Assert(err, NotNil)
+
+	channelNotFoundErr, ok := err.(backend.ChannelNotFound)
+	c.Assert(ok, Equals, true)
+	c.Assert(channelNotFoundErr.ChannelName, Equals, "invalid-channel")
+}
+
+func (s *BackendConformanceSuite) TestQueueNotifications(c *C) {
+	scheduled := s.notification("Channel2")
+	scheduled.Subject = "scheduled"
+
+	results, err := s.backend.QueueNotifications([]backend.Notification{
+		s.notification("Channel1"),
+		s.notification("invalid-channel"),
+		scheduled,
+	})
+	c.Assert(err, IsNil)
+	c.Assert(results, HasLen, 3)
+	c.Assert(results[0].Error, IsNil)
+	c.Assert(results[1].Error, DeepEquals, backend.ChannelNotFound{ChannelName: "invalid-channel"})
+	c.Assert(results[1].Id, Equals, int64(0))
+	c.Assert(results[2].Error, IsNil)
+
+	notification, err := s.backend.GetNotification(results[2].Id)
+	c.Assert(err, IsNil)
+	c.Assert(notification.Subject, Equals, "scheduled")
+
+	notifications, err := s.backend.QueryNotifications(backend.NotificationQuery{})
+	c.Assert(err, IsNil)
+	c.Assert(notifications, HasLen, 2)
+
+	timedout := BlockUntilSatisfiedOrTimeout(func() bool {
+		return s.sent() >= 1
+	}, conformanceTimeout)
+	c.Assert(timedout, Equals, false)
+}
+
+func (s *BackendConformanceSuite) TestQueueNotificationsWithIdempotencyKey(c *C) {
+	notification := s.notification("Channel2")
+	notification.IdempotencyKey = "key"
+
+	otherOrigin := notification
+	otherOrigin.Origin = "other-origin"
+
+	results, err := s.backend.QueueNotifications([]backend.Notification{notification, notification, otherOrigin})
+	c.Assert(err, IsNil)
+	c.Assert(results, HasLen, 3)
+	c.Assert(results[0].Duplicate, Equals, false)
+	c.Assert(results[1], DeepEquals, backend.QueueResult{Id: results[0].Id, Duplicate: true})
+	c.Assert(results[2].Duplicate, Equals, false)
+	c.Assert(results[2].Id, Not(Equals), results[0].Id)
+	firstId := results[0].Id
+
+	err = s.backend.QueueNotification(notification)
+	c.Assert(err, IsNil)
+
+	results, err = s.backend.QueueNotifications([]backend.Notification{notification})
+	c.Assert(err, IsNil)
+	c.Assert(results[0], DeepEquals, backend.QueueResult{Id: firstId, Duplicate: true})
+
+	notifications, err := s.backend.QueryNotifications(backend.NotificationQuery{})
+	c.Assert(err, IsNil)
+	c.Assert(notifications, HasLen, 2)
+	c.Assert(notifications[1].IdempotencyKey, Equals, "key")
+}
+
+func (s *BackendConformanceSuite) TestQueueNotificationWaitsForSchedule(c *C) {
+	err := s.backend.QueueNotification(s.notification("Channel2"))
+	c.Assert(err, IsNil)
+	err = s.backend.QueueNotification(s.notification("Channel2"))
+	c.Assert(err, IsNil)
+
+	s.clock.Add(11*time.Hour + 58*time.Minute)
+	time.Sleep(200 * time.Millisecond)
+	c.Assert(s.attempts(), Equals, 0)
+
+	timedout := s.advanceUntil(30*time.Second, func() bool {
+		return s.sent() >= 2
+	})
+	c.Assert(timedout, Equals, false)
+
+	// Both notifications go out together, once per subscriber.
+	s.notifier.Lock()
+	defer s.notifier.Unlock()
+	c.Assert(s.notifier.Logs, HasLen, 2)
+	for _, log := range s.notifier.Logs {
+		c.Assert(log.Notifications, HasLen, 2)
+	}
+}
+
+func (s *BackendConformanceSuite) TestUrgentNotificationSkipsSchedule(c *C) {
+	notification := s.notification("Channel2")
+	notification.Priority = backend.UrgentPriority
+
+	err := s.backend.QueueNotification(notification)
+	c.Assert(err, IsNil)
+
+	timedout := BlockUntilSatisfiedOrTimeout(func() bool {
+		return s.sent() >= 2
+	}, conformanceTimeout)
+	c.Assert(timedout, Equals, false)
+}
+
+func (s *BackendConformanceSuite) TestQueueNotificationWaitsForSendAt(c *C) {
+	sendAt := s.clock.Now().Add(10 * time.Minute)
+
+	notification := s.notification("Channel1")
+	notification.SendAt = sendAt.UnixNano()
+	err := s.backend.QueueNotification(notification)
+	c.Assert(err, IsNil)
+
+	s.clock.Add(9 * time.Minute)
+	time.Sleep(200 * time.Millisecond)
+	c.Assert(s.attempts(), Equals, 0)
+
+	timedout := s.advanceUntil(30*time.Second, func() bool {
+		return s.sent() >= 1
+	})
+	c.Assert(timedout, Equals, false)
+	c.Assert(s.clock.Now().Before(sendAt), Equals, false)
+}
+
+func (s *BackendConformanceSuite) TestFailedDeliveryIsRetried(c *C) {
+	s.notifier.FailFor("jimmy", errors.New("jimmy is away"))
+
+	err := s.backend.QueueNotification(s.notification("Channel1"))
+	c.Assert(err, IsNil)
+
+	timedout := BlockUntilSatisfiedOrTimeout(func() bool {
+		return s.attempts() >= 1
+	}, conformanceTimeout)
+	c.Assert(timedout, Equals, false)
+	c.Assert(s.sent(), Equals, 0)
+
+	s.notifier.StopFailingFor("jimmy")
+
+	timedout = s.advanceUntil(30*time.Second, func() bool {
+		return s.sent() >= 1
+	})
+	c.Assert(timedout, Equals, false)
+
+	// The first attempt never made it, so it is only sent once.
+	time.Sleep(200 * time.Millisecond)
+	c.Assert(s.sent(), Equals, 1)
+}
+
+func (s *BackendConformanceSuite) TestShutdownWaitsForNotificationsBeingSent(c *C) {
+	s.notifier.Delay = 200 * time.Millisecond
+
+	err := s.backend.QueueNotification(s.notification("Channel1"))
+	c.Assert(err, IsNil)
+
+	timedout := BlockUntilSatisfiedOrTimeout(func() bool {
+		return s.attempts() >= 1
+	}, conformanceTimeout)
+	c.Assert(timedout, Equals, false)
+
+	s.backend.Shutdown()
+	s.shutdown = true
+	c.Assert(s.sent(), Equals, 1)
+
+	done := make(chan struct{})
+	go func() {
+		s.wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(conformanceTimeout):
+		c.Fatal("background tasks did not stop after shutdown")
+	}
+}
+
+func (s *BackendConformanceSuite) TestQueryNotifications(c *C) {
+	first := s.notification("Channel2")
+	first.Subject = "first"
+	second := s.notification("Channel2")
+	second.Subject = "second"
+
+	c.Assert(s.backend.QueueNotification(first), IsNil)
+	c.Assert(s.backend.QueueNotification(second), IsNil)
+	c.Assert(s.backend.QueueNotification(s.notification("Channel1")), IsNil)
+
+	notifications, err := s.backend.QueryNotifications(backend.NotificationQuery{Channel: "Channel2"})
+	c.Assert(err, IsNil)
+	c.Assert(notifications, HasLen, 2)
+	c.Assert(notifications[0].Subject, Equals, "second")
+	c.Assert(notifications[1].Subject, Equals, "first")
+	c.Assert(notifications[1].Tags, DeepEquals, []string{"tag1", "tag2"})
+	c.Assert(notifications[1].Delivered, Equals, false)
+
+	notifications, err = s.backend.QueryNotifications(backend.NotificationQuery{Channel: "Channel2", Limit: 1, BeforeId: notifications[0].Id})
+	c.Assert(err, IsNil)
+	c.Assert(notifications, HasLen, 1)
+	c.Assert(notifications[0].Subject, Equals, "first")
+
+	notifications, err = s.backend.QueryNotifications(backend.NotificationQuery{Channels: []string{"Channel1", "Channel3"}})
+	c.Assert(err, IsNil)
+	c.Assert(notifications, HasLen, 1)
+	c.Assert(notifications[0].Channel, Equals, "Channel1")
+
+	notifications, err = s.backend.QueryNotifications(backend.NotificationQuery{Channel: "Channel2", Limit: 1})
+	c.Assert(err, IsNil)
+	c.Assert(notifications, HasLen, 1)
+
+	notification, err := s.backend.GetNotification(notifications[0].Id)
+	c.Assert(err, IsNil)
+	c.Assert(notification, DeepEquals, notifications[0])
+
+	_, err = s.backend.GetNotification(-1)
+	c.Assert(err, DeepEquals, backend.NotificationNotFound{Id: -1})
+}
+
+func (s *BackendConformanceSuite) TestLabelsAreStored(c *C) {
+	labelled := s.notification("Channel2")
+	labelled.Subject = "labelled"
+	labelled.Labels = map[string]string{"host": "db1", "env": "production"}
+	c.Assert(s.backend.QueueNotification(labelled), IsNil)
+	c.Assert(s.backend.QueueNotification(s.notification("Channel2")), IsNil)
+
+	notifications, err := s.backend.QueryNotifications(backend.NotificationQuery{})
+	c.Assert(err, IsNil)
+	c.Assert(notifications, HasLen, 2)
+	c.Assert(notifications[0].Labels, HasLen, 0)
+	c.Assert(notifications[1].Subject, Equals, "labelled")
+	c.Assert(notifications[1].Labels, DeepEquals, labelled.Labels)
+}
@@ -1,13 +1,20 @@
 package testhelpers
 
-import "github.com/Sirupsen/logrus"
+import (
+	"sync"
 
+	"github.com/Sirupsen/logrus"
+)
+
+// Entries are logged from the background tasks, so Logs must only be read
+// while holding the lock if any of them are still running.
 type LogrusTestHook struct {
+	*sync.Mutex
 	Logs map[logrus.Level][]*logrus.Entry
 }
 
 func NewLogrusTestHook() *LogrusTestHook {
-	hook := &LogrusTestHook{}
+	hook := &LogrusTestHook{Mutex: &sync.Mutex{}}
 
 	levels := hook.Levels()
 	hook.Logs = make(map[logrus.Level][]*logrus.Entry, len(levels))
@@ -19,6 +26,8 @@ func NewLogrusTestHook() *LogrusTestHook {
 }
 
 func (h *LogrusTestHook) Fire(entry *logrus.Entry) error {
+	h.Lock()
+	defer h.Unlock()
 	h.Logs[entry.Level] = append(h.Logs[entry.Level], entry)
 	return nil
 }
@@ -35,10 +44,15 @@ func (h *LogrusTestHook) Levels() []logrus.Level {
 }
 
 func (h *LogrusTestHook) ClearLogs() {
+	h.Lock()
+	defer h.Unlock()
 	h.Logs = make(map[logrus.Level][]*logrus.Entry, len(h.Levels()))
 }
 
 func (h *LogrusTestHook) HasMessage(level logrus.Level, message string) bool {
+	h.Lock()
+	defer h.Unlock()
+
 	for _, entry := range h.Logs[level] {
 		if entry.Message == message {
 			return true
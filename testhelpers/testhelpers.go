@@ -11,16 +11,59 @@ import (
 )
 
 func ResetTestDatabase(dbmap *gorp.DbMap) {
+	migrateTestDatabase(dbmap, filepath.Join("..", "db", "migrations"), goose.DBDriver{
+		Name:    "sqlite3",
+		OpenStr: ":memory:", // this is actually never used as we just migrate dbmap.Db
+		Import:  "github.com/mattn/go-sqlite3",
+		Dialect: &goose.Sqlite3Dialect{},
+	})
+}
+
+// Unlike SQLite, the PostgreSQL database is not thrown away after the test, so
+// everything in it is dropped before migrating.
+func ResetPostgresTestDatabase(dbmap *gorp.DbMap) {
+	_, err := dbmap.Exec("DROP SCHEMA public CASCADE; CREATE SCHEMA public")
+	if err != nil {
+		panic(fmt.Sprintf("cannot drop the test database: %v\n", err))
+	}
+
+	migrateTestDatabase(dbmap, filepath.Join("..", "db", "postgres", "migrations"), goose.DBDriver{
+		Name:    "postgres",
+		OpenStr: "", // this is actually never used as we just migrate dbmap.Db
+		Import:  "github.com/lib/pq",
+		Dialect: &goose.PostgresDialect{},
+	})
+}
+
+// Same as for PostgreSQL, but MySQL cannot drop everything at once.
+func ResetMySQLTestDatabase(dbmap *gorp.DbMap) {
+	var tables []string
+	_, err := dbmap.Select(&tables, "SELECT table_name FROM information_schema.tables WHERE table_schema = DATABASE()")
+	if err != nil {
+		panic(fmt.Sprintf("cannot list the tables of the test database: %v\n", err))
+	}
+
+	for _, table := range tables {
+		_, err = dbmap.Exec("DROP TABLE `" + table + "`")
+		if err != nil {
+			panic(fmt.Sprintf("cannot drop table %s of the test database: %v\n", table, err))
+		}
+	}
+
+	migrateTestDatabase(dbmap, filepath.Join("..", "db", "mysql", "migrations"), goose.DBDriver{
+		Name:    "mysql",
+		OpenStr: "", // this is actually never used as we just migrate dbmap.Db
+		Import:  "github.com/go-sql-driver/mysql",
+		Dialect: &goose.MySqlDialect{},
+	})
+}
+
+func migrateTestDatabase(dbmap *gorp.DbMap, migrationsDir string, driver goose.DBDriver) {
 	conf := &goose.DBConf{
-		MigrationsDir: filepath.Join("..", "db", "migrations"),
+		MigrationsDir: migrationsDir,
 		Env:           "test",
-		Driver: goose.DBDriver{
-			Name:    "sqlite3",
-			OpenStr: ":memory:", // this is actually never used as we just migrate dbmap.Db
-			Import:  "github.com/mattn/go-sqlite3",
-			Dialect: &goose.Sqlite3Dialect{},
-		},
-		PgSchema: "",
+		Driver:        driver,
+		PgSchema:      "",
 	}
 
 	// Not merged yet but for future:
@@ -38,13 +81,14 @@ func ResetTestDatabase(dbmap *gorp.DbMap) {
 }
 
 func BlockUntilSatisfiedOrTimeout(condition func() bool, timeout time.Duration) bool {
+	timedout := time.After(timeout)
 	for {
 		select {
 		case <-time.After(20 * time.Millisecond):
 			if condition() {
 				return false
 			}
-		case <-time.After(timeout):
+		case <-timedout:
 			return true
 		}
 	}
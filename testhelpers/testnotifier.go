@@ -2,6 +2,7 @@ package testhelpers
 
 import (
 	"sync"
+	"time"
 
 	"gitlab.com/shuhao/towncrier/backend"
 )
@@ -14,15 +15,38 @@ type NotificationSubscriberCombo struct {
 type TestNotifier struct {
 	*sync.Mutex
 	Logs []*NotificationSubscriberCombo
+
+	// The number of sends, including the ones that failed or are in progress.
+	Attempts int
+
+	// Every send takes this long, to simulate a slow notifier.
+	Delay time.Duration
+
+	// Sending to these subscribers (by unique name) fails with the error.
+	// Failed sends are not logged.
+	errors map[string]error
 }
 
 func NewTestNotifier() *TestNotifier {
 	return &TestNotifier{
-		Mutex: &sync.Mutex{},
-		Logs:  []*NotificationSubscriberCombo{},
+		Mutex:  &sync.Mutex{},
+		Logs:   []*NotificationSubscriberCombo{},
+		errors: make(map[string]error),
 	}
 }
 
+func (n *TestNotifier) FailFor(subscriberName string, err error) {
+	n.Lock()
+	n.errors[subscriberName] = err
+	n.Unlock()
+}
+
+func (n *TestNotifier) StopFailingFor(subscriberName string) {
+	n.Lock()
+	delete(n.errors, subscriberName)
+	n.Unlock()
+}
+
 func (n *TestNotifier) Name() string {
 	return "testnotify"
 }
@@ -33,11 +57,22 @@ func (n *TestNotifier) ShouldSendImmediately() bool {
 
 func (n *TestNotifier) Send(notifications []backend.Notification, subscriber backend.Subscriber) error {
 	n.Lock()
+	n.Attempts++
+	n.Unlock()
+
+	time.Sleep(n.Delay)
+
+	n.Lock()
+	defer n.Unlock()
+
+	if err, found := n.errors[subscriber.UniqueName]; found {
+		return err
+	}
+
 	n.Logs = append(n.Logs, &NotificationSubscriberCombo{
 		Notifications: notifications,
 		Subscriber:    subscriber,
 	})
-	n.Unlock()
 
 	return nil
 }
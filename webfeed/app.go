@@ -0,0 +1,251 @@
+package webfeed
+
+import (
+	"crypto/subtle"
+	"html/template"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"gitlab.com/shuhao/towncrier/backend"
+
+	"github.com/Sirupsen/logrus"
+	"github.com/gorilla/mux"
+)
+
+// The webfeed app displays the notifications that were received, it never
+// changes anything. Receiving the notifications is the job of the webreceiver
+// package.
+
+const notificationsPerPage = 50
+
+// The choices of the priority filter, as in backend.PriorityMap.
+var priorityNames = []string{"low", "normal", "urgent"}
+
+var realLogger = logrus.New()
+var logger = realLogger.WithField("component", "webfeed")
+
+type App struct {
+	router  *mux.Router
+	config  FeedConfig
+	backend backend.NotificationBackend
+}
+
+func NewApp(be backend.NotificationBackend, config FeedConfig) *App {
+	app := &App{
+		config:  config,
+		backend: be,
+	}
+
+	app.router = mux.NewRouter()
+	subrouter := app.router.PathPrefix(app.config.PathPrefix).Subrouter()
+	subrouter.Methods("GET").Path("/").HandlerFunc(app.NotificationsHandler)
+	subrouter.Methods("GET").Path("/notifications/{id:[0-9]+}").HandlerFunc(app.NotificationHandler)
+	subrouter.Methods("GET").Path("/channels").HandlerFunc(app.ChannelsHandler)
+	subrouter.Methods("GET").Path("/stream").HandlerFunc(app.StreamHandler)
+	subrouter.Methods("GET").Path("/stream/websocket").HandlerFunc(app.WebSocketStreamHandler)
+	subrouter.Methods("GET").Path("/feeds").HandlerFunc(app.FeedsHandler)
+	// The name is escaped in the links, but the router sees it unescaped, with
+	// any slash it contains.
+	subrouter.Methods("GET").Path("/feeds/{kind:channels|origins}/{name:.+}/{secret:[0-9a-f]+}.{format:atom|rss}").HandlerFunc(app.FeedHandler)
+
+	return app
+}
+
+func (a *App) isAuthenticated(r *http.Request) bool {
+	if len(a.config.Users) == 0 {
+		return true
+	}
+
+	username, password, ok := r.BasicAuth()
+	if !ok {
+		return false
+	}
+
+	expected, found := a.config.Users[username]
+	return found && subtle.ConstantTimeCompare([]byte(password), []byte(expected)) == 1
+}
+
+func (a *App) render(w http.ResponseWriter, t *template.Template, data interface{}) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	err := t.Execute(w, data)
+	if err != nil {
+		logger.WithField("error", err).Error("failed to render page")
+	}
+}
+
+// The filters as they were submitted, to fill the form back in.
+type filters struct {
+	Channel   string
+	Origin    string
+	Tag       string
+	Priority  string
+	Delivered string
+}
+
+type notificationsPage struct {
+	Prefix        string
+	Channels      []backend.ChannelInfo
+	Priorities    []string
+	Filters       filters
+	Notifications []*backend.StoredNotification
+	NextPage      string
+}
+
+type notificationPage struct {
+	Prefix       string
+	Notification *backend.StoredNotification
+	Deliveries   []*backend.DeliveryStatus
+}
+
+type channelsPage struct {
+	Prefix   string
+	Channels []backend.ChannelInfo
+}
+
+func parseFilters(params url.Values) (filters, backend.NotificationQuery, bool) {
+	f := filters{
+		Channel:   params.Get("channel"),
+		Origin:    params.Get("origin"),
+		Tag:       params.Get("tag"),
+		Priority:  params.Get("priority"),
+		Delivered: params.Get("delivered"),
+	}
+
+	query := backend.NotificationQuery{
+		Channel: f.Channel,
+		Origin:  f.Origin,
+		Tag:     f.Tag,
+		Limit:   notificationsPerPage + 1,
+	}
+
+	if f.Priority != "" {
+		priority, found := backend.PriorityMap[f.Priority]
+		if !found {
+			return f, query, false
+		}
+		query.Priority = priority
+	}
+
+	if f.Delivered != "" {
+		delivered, err := strconv.ParseBool(f.Delivered)
+		if err != nil {
+			return f, query, false
+		}
+		query.Delivered = &delivered
+	}
+
+	if v := params.Get("before"); v != "" {
+		beforeId, err := strconv.ParseInt(v, 10, 64)
+		if err != nil {
+			return f, query, false
+		}
+		query.BeforeId = beforeId
+	}
+
+	return f, query, true
+}
+
+func (a *App) NotificationsHandler(w http.ResponseWriter, r *http.Request) {
+	if !a.isAuthenticated(r) {
+		w.Header().Set("WWW-Authenticate", `Basic realm="towncrier"`)
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	params := r.URL.Query()
+	f, query, ok := parseFilters(params)
+	if !ok {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	notifications, err := a.backend.QueryNotifications(query)
+	if err != nil {
+		logger.WithField("error", err).Error("failed to query notifications")
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	page := notificationsPage{
+		Prefix:        a.config.PathPrefix,
+		Channels:      a.backend.ListChannels(),
+		Priorities:    priorityNames,
+		Filters:       f,
+		Notifications: notifications,
+	}
+
+	// We asked for one more to know if there are older notifications.
+	if len(notifications) > notificationsPerPage {
+		page.Notifications = notifications[:notificationsPerPage]
+
+		params.Set("before", strconv.FormatInt(page.Notifications[notificationsPerPage-1].Id, 10))
+		page.NextPage = a.config.PathPrefix + "/?" + params.Encode()
+	}
+
+	a.render(w, notificationsTemplate, page)
+}
+
+func (a *App) NotificationHandler(w http.ResponseWriter, r *http.Request) {
+	if !a.isAuthenticated(r) {
+		w.Header().Set("WWW-Authenticate", `Basic realm="towncrier"`)
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	id, err := strconv.ParseInt(mux.Vars(r)["id"], 10, 64)
+	if err != nil {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	notification, err := a.backend.GetNotification(id)
+	if err != nil {
+		if _, ok := err.(backend.NotificationNotFound); ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+
+		logger.WithField("error", err).Error("failed to get notification")
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	deliveries, err := a.backend.ListDeliveries(id)
+	if err != nil {
+		logger.WithField("error", err).Error("failed to list deliveries")
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	a.render(w, notificationTemplate, notificationPage{
+		Prefix:       a.config.PathPrefix,
+		Notification: notification,
+		Deliveries:   deliveries,
+	})
+}
+
+func (a *App) ChannelsHandler(w http.ResponseWriter, r *http.Request) {
+	if !a.isAuthenticated(r) {
+		w.Header().Set("WWW-Authenticate", `Basic realm="towncrier"`)
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	a.render(w, channelsTemplate, channelsPage{
+		Prefix:   a.config.PathPrefix,
+		Channels: a.backend.ListChannels(),
+	})
+}
+
+func (a *App) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	start := time.Now()
+
+	a.router.ServeHTTP(w, r)
+
+	logger.WithFields(logrus.Fields{
+		"path": r.RequestURI,
+		"time": time.Now().Sub(start),
+	}).Info("served request")
+}
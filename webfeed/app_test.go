@@ -0,0 +1,168 @@
+package webfeed
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync"
+	"testing"
+
+	"gitlab.com/shuhao/towncrier/backend"
+	"gitlab.com/shuhao/towncrier/sql_backend"
+	"gitlab.com/shuhao/towncrier/sqlite_backend"
+	"gitlab.com/shuhao/towncrier/testhelpers"
+
+	. "gopkg.in/check.v1"
+)
+
+func Test(t *testing.T) {
+	TestingT(t)
+}
+
+type WebFeedAppSuite struct {
+	config  FeedConfig
+	backend *sqlite_backend.SQLiteNotificationBackend
+	server  *httptest.Server
+}
+
+var _ = Suite(&WebFeedAppSuite{})
+
+func (s *WebFeedAppSuite) SetUpSuite(c *C) {
+	s.config = FeedConfig{
+		ListenHost: "127.0.0.1",
+		ListenPort: 3922,
+		PathPrefix: "/feed",
+		Users: map[string]string{
+			"jimmy": "meow",
+		},
+		FeedSecret: "s3cret",
+		BaseURL:    "https://towncrier.example.com",
+	}
+}
+
+func (s *WebFeedAppSuite) SetUpTest(c *C) {
+	backend.ClearAllNotifiers()
+	backend.RegisterNotifier(testhelpers.NewTestNotifier())
+
+	s.backend = backend.GetBackend(sqlite_backend.BackendName).(*sqlite_backend.SQLiteNotificationBackend)
+	err := s.backend.Initialize(":memory:,../sql_backend/test_config/standard.conf.json")
+	c.Assert(err, IsNil)
+
+	testhelpers.ResetTestDatabase(s.backend.DbMap)
+
+	s.backend.Start(&sync.WaitGroup{})
+	s.backend.BlockUntilReady()
+
+	s.server = httptest.NewServer(NewApp(s.backend, s.config))
+}
+
+func (s *WebFeedAppSuite) TearDownTest(c *C) {
+	s.server.Close()
+	s.backend.Shutdown()
+}
+
+func (s *WebFeedAppSuite) get(c *C, path string) (int, string) {
+	req, err := http.NewRequest("GET", s.server.URL+path, nil)
+	c.Assert(err, IsNil)
+	req.SetBasicAuth("jimmy", "meow")
+
+	resp, err := http.DefaultClient.Do(req)
+	c.Assert(err, IsNil)
+	defer resp.Body.Close()
+
+	body, err := ioutil.ReadAll(resp.Body)
+	c.Assert(err, IsNil)
+	return resp.StatusCode, string(body)
+}
+
+func (s *WebFeedAppSuite) TestNotAuthenticated(c *C) {
+	for _, path := range []string{"/feed/", "/feed/channels", "/feed/notifications/1"} {
+		req, err := http.NewRequest("GET", s.server.URL+path, nil)
+		c.Assert(err, IsNil)
+		req.SetBasicAuth("jimmy", "woof")
+
+		resp, err := http.DefaultClient.Do(req)
+		c.Assert(err, IsNil)
+		c.Assert(resp.StatusCode, Equals, http.StatusUnauthorized)
+		c.Assert(resp.Header.Get("WWW-Authenticate"), Not(Equals), "")
+		resp.Body.Close()
+	}
+}
+
+func (s *WebFeedAppSuite) TestChannels(c *C) {
+	status, body := s.get(c, "/feed/channels")
+	c.Assert(status, Equals, http.StatusOK)
+	c.Assert(body, Matches, `(?s).*<a href="/feed/\?channel=Channel1">Channel1</a>.*@immediately.*jimmy.*`)
+	c.Assert(body, Matches, `(?s).*<a href="/feed/\?channel=Channel2">Channel2</a>.*@daily.*jimmy, bob.*`)
+}
+
+func (s *WebFeedAppSuite) TestNotifications(c *C) {
+	err := s.backend.QueueNotification(backend.Notification{Channel: "Channel2", Subject: "disk <full>", Origin: "abc", Tags: []string{"disk"}, Priority: backend.NormalPriority})
+	c.Assert(err, IsNil)
+
+	err = s.backend.QueueNotification(backend.Notification{Channel: "Channel2", Subject: "web down", Origin: "abc", Priority: backend.LowPriority})
+	c.Assert(err, IsNil)
+
+	status, body := s.get(c, "/feed/")
+	c.Assert(status, Equals, http.StatusOK)
+	c.Assert(body, Matches, `(?s).*web down.*disk &lt;full&gt;.*`)
+	c.Assert(body, Not(Matches), `(?s).*Older notifications.*`)
+
+	status, body = s.get(c, "/feed/?tag=disk&priority=normal&delivered=false")
+	c.Assert(status, Equals, http.StatusOK)
+	c.Assert(body, Matches, `(?s).*disk &lt;full&gt;.*`)
+	c.Assert(body, Not(Matches), `(?s).*web down.*`)
+	c.Assert(body, Matches, `(?s).*<option value="normal" selected>.*`)
+
+	status, _ = s.get(c, "/feed/?priority=whatever")
+	c.Assert(status, Equals, http.StatusBadRequest)
+}
+
+func (s *WebFeedAppSuite) TestNotificationsPaginates(c *C) {
+	for i := 0; i < notificationsPerPage+1; i++ {
+		err := s.backend.QueueNotification(backend.Notification{Channel: "Channel2", Subject: "subject " + strconv.Itoa(i), Priority: backend.NormalPriority})
+		c.Assert(err, IsNil)
+	}
+
+	status, body := s.get(c, "/feed/?channel=Channel2")
+	c.Assert(status, Equals, http.StatusOK)
+	c.Assert(body, Matches, `(?s).*subject 50<.*`)
+	c.Assert(body, Not(Matches), `(?s).*subject 0<.*`)
+	c.Assert(body, Matches, `(?s).*<a href="/feed/\?before=[0-9]+&amp;channel=Channel2">Older notifications</a>.*`)
+
+	var notifications []*sql_backend.Notification
+	_, err := s.backend.Select(&notifications, "SELECT * FROM notifications WHERE Subject = ?", "subject 1")
+	c.Assert(err, IsNil)
+	c.Assert(notifications, HasLen, 1)
+
+	status, body = s.get(c, "/feed/?channel=Channel2&before="+strconv.FormatInt(notifications[0].Id, 10))
+	c.Assert(status, Equals, http.StatusOK)
+	c.Assert(body, Matches, `(?s).*subject 0<.*`)
+	c.Assert(body, Not(Matches), `(?s).*subject 1<.*`)
+}
+
+func (s *WebFeedAppSuite) TestNotification(c *C) {
+	err := s.backend.QueueNotification(backend.Notification{Channel: "Channel2", Subject: "disk full", Content: "/ is at 100%", Priority: backend.NormalPriority})
+	c.Assert(err, IsNil)
+
+	var notifications []*sql_backend.Notification
+	_, err = s.backend.Select(&notifications, "SELECT * FROM notifications")
+	c.Assert(err, IsNil)
+	c.Assert(notifications, HasLen, 1)
+
+	path := "/feed/notifications/" + strconv.FormatInt(notifications[0].Id, 10)
+	status, body := s.get(c, path)
+	c.Assert(status, Equals, http.StatusOK)
+	c.Assert(body, Matches, `(?s).*<h1>disk full</h1>.*/ is at 100%.*Not sent yet.*`)
+
+	err = s.backend.Insert(&sql_backend.Delivery{NotificationId: notifications[0].Id, Subscriber: "bob", Notifier: "testnotify", Status: sql_backend.DeliveryFailed, Attempts: 2, LastError: "mailbox full"})
+	c.Assert(err, IsNil)
+
+	status, body = s.get(c, path)
+	c.Assert(status, Equals, http.StatusOK)
+	c.Assert(body, Matches, `(?s).*<td>bob</td>.*<td class="status-failed">failed</td>.*<td>2</td>.*mailbox full.*`)
+
+	status, _ = s.get(c, "/feed/notifications/123456")
+	c.Assert(status, Equals, http.StatusNotFound)
+}
@@ -0,0 +1,24 @@
+package webfeed
+
+type FeedConfig struct {
+	ListenHost string
+	ListenPort int
+	PathPrefix string // Without the trailing slash
+
+	// username => password, for HTTP basic auth. The dashboard is open to
+	// anyone that can reach it if there are none.
+	Users map[string]string
+
+	// Signs the secret URLs of the Atom and RSS feeds, which are listed on the
+	// dashboard. Changing it changes every URL. The feeds are not served if it
+	// is not set.
+	FeedSecret string
+
+	// Where the feeds link back to the dashboard, such as
+	// https://towncrier.example.com. Defaults to the host of the request.
+	BaseURL string // Without the trailing slash
+
+	// Origins such as https://status.example.com whose pages may open the
+	// WebSocket stream, besides the dashboard itself.
+	AllowedOrigins []string
+}
@@ -0,0 +1,316 @@
+package webfeed
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/xml"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"gitlab.com/shuhao/towncrier/backend"
+
+	"github.com/gorilla/mux"
+)
+
+// The Atom and RSS feeds are meant for feed readers, which can't do much more
+// than GET a URL. Instead of the basic auth of the dashboard, each feed has its
+// own URL containing a secret derived from FeedSecret, so it can be given out
+// without giving access to anything else.
+
+const (
+	notificationsPerFeed = 50
+
+	channelFeed = "channels"
+	originFeed  = "origins"
+
+	// The length of the secret in the URL, in hex characters.
+	feedSecretLength = 32
+)
+
+// The secret in the URL of a feed, which is a HMAC of the kind of feed and its
+// name so it can be verified without storing anything.
+func (a *App) feedSecret(kind, name string) string {
+	mac := hmac.New(sha256.New, []byte(a.config.FeedSecret))
+	mac.Write([]byte(kind + "\x00" + name))
+	return hex.EncodeToString(mac.Sum(nil))[:feedSecretLength]
+}
+
+func (a *App) feedPath(kind, name, format string) string {
+	return fmt.Sprintf("%s/feeds/%s/%s/%s.%s", a.config.PathPrefix, kind, url.PathEscape(name), a.feedSecret(kind, name), format)
+}
+
+func (a *App) baseURL(r *http.Request) string {
+	if a.config.BaseURL != "" {
+		return a.config.BaseURL
+	}
+
+	scheme := "http"
+	if r.TLS != nil {
+		scheme = "https"
+	}
+
+	return scheme + "://" + r.Host
+}
+
+type atomFeed struct {
+	XMLName xml.Name    `xml:"http://www.w3.org/2005/Atom feed"`
+	Title   string      `xml:"title"`
+	Id      string      `xml:"id"`
+	Updated string      `xml:"updated"`
+	Links   []atomLink  `xml:"link"`
+	Entries []atomEntry `xml:"entry"`
+}
+
+type atomLink struct {
+	Href string `xml:"href,attr"`
+	Rel  string `xml:"rel,attr,omitempty"`
+}
+
+type atomPerson struct {
+	Name string `xml:"name"`
+}
+
+type atomCategory struct {
+	Term string `xml:"term,attr"`
+}
+
+type atomContent struct {
+	Type string `xml:"type,attr"`
+	Body string `xml:",chardata"`
+}
+
+type atomEntry struct {
+	Title      string         `xml:"title"`
+	Id         string         `xml:"id"`
+	Updated    string         `xml:"updated"`
+	Published  string         `xml:"published"`
+	Author     atomPerson     `xml:"author"`
+	Link       atomLink       `xml:"link"`
+	Categories []atomCategory `xml:"category"`
+	Content    atomContent    `xml:"content"`
+}
+
+type rssFeed struct {
+	XMLName xml.Name   `xml:"rss"`
+	Version string     `xml:"version,attr"`
+	Channel rssChannel `xml:"channel"`
+}
+
+type rssChannel struct {
+	Title       string    `xml:"title"`
+	Link        string    `xml:"link"`
+	Description string    `xml:"description"`
+	Items       []rssItem `xml:"item"`
+}
+
+type rssGUID struct {
+	IsPermaLink string `xml:"isPermaLink,attr"`
+	Value       string `xml:",chardata"`
+}
+
+type rssItem struct {
+	Title       string   `xml:"title"`
+	Link        string   `xml:"link"`
+	Description string   `xml:"description"`
+	Categories  []string `xml:"category"`
+	GUID        rssGUID  `xml:"guid"`
+	PubDate     string   `xml:"pubDate"`
+}
+
+func subjectOrPlaceholder(n *backend.StoredNotification) string {
+	if n.Subject == "" {
+		return "(no subject)"
+	}
+
+	return n.Subject
+}
+
+func newAtomFeed(title, id, selfURL, dashboardURL string, notifications []*backend.StoredNotification) atomFeed {
+	feed := atomFeed{
+		Title:   title,
+		Id:      id,
+		Updated: time.Now().UTC().Format(time.RFC3339),
+		Links: []atomLink{
+			{Href: selfURL, Rel: "self"},
+			{Href: dashboardURL, Rel: "alternate"},
+		},
+		Entries: []atomEntry{},
+	}
+
+	if len(notifications) > 0 {
+		feed.Updated = time.Unix(0, notifications[0].UpdatedAt).UTC().Format(time.RFC3339)
+	}
+
+	for _, n := range notifications {
+		link := dashboardURL + "notifications/" + strconv.FormatInt(n.Id, 10)
+
+		author := n.Origin
+		if author == "" {
+			author = "towncrier"
+		}
+
+		entry := atomEntry{
+			Title:     subjectOrPlaceholder(n),
+			Id:        link,
+			Updated:   time.Unix(0, n.UpdatedAt).UTC().Format(time.RFC3339),
+			Published: time.Unix(0, n.CreatedAt).UTC().Format(time.RFC3339),
+			Author:    atomPerson{Name: author},
+			Link:      atomLink{Href: link, Rel: "alternate"},
+			Content:   atomContent{Type: "text", Body: n.Content},
+		}
+
+		for _, tag := range n.Tags {
+			entry.Categories = append(entry.Categories, atomCategory{Term: tag})
+		}
+
+		feed.Entries = append(feed.Entries, entry)
+	}
+
+	return feed
+}
+
+func newRSSFeed(title, dashboardURL string, notifications []*backend.StoredNotification) rssFeed {
+	feed := rssFeed{
+		Version: "2.0",
+		Channel: rssChannel{
+			Title:       title,
+			Link:        dashboardURL,
+			Description: title,
+			Items:       []rssItem{},
+		},
+	}
+
+	for _, n := range notifications {
+		link := dashboardURL + "notifications/" + strconv.FormatInt(n.Id, 10)
+		feed.Channel.Items = append(feed.Channel.Items, rssItem{
+			Title:       subjectOrPlaceholder(n),
+			Link:        link,
+			Description: n.Content,
+			Categories:  n.Tags,
+			GUID:        rssGUID{IsPermaLink: "true", Value: link},
+			PubDate:     time.Unix(0, n.CreatedAt).UTC().Format(time.RFC1123Z),
+		})
+	}
+
+	return feed
+}
+
+func (a *App) FeedHandler(w http.ResponseWriter, r *http.Request) {
+	urlParams := mux.Vars(r)
+	kind := urlParams["kind"]
+	name := urlParams["name"]
+
+	// Without a secret to sign them, every feed URL could be guessed.
+	if a.config.FeedSecret == "" || !hmac.Equal([]byte(urlParams["secret"]), []byte(a.feedSecret(kind, name))) {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	query := backend.NotificationQuery{Limit: notificationsPerFeed}
+	var title string
+
+	switch kind {
+	case channelFeed:
+		found := false
+		for _, channel := range a.backend.ListChannels() {
+			found = found || channel.Name == name
+		}
+
+		if !found {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+
+		query.Channel = name
+		title = fmt.Sprintf("Towncrier: %s", name)
+	case originFeed:
+		query.Origin = name
+		title = fmt.Sprintf("Towncrier: notifications from %s", name)
+	}
+
+	notifications, err := a.backend.QueryNotifications(query)
+	if err != nil {
+		logger.WithField("error", err).Error("failed to query notifications")
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	baseURL := a.baseURL(r)
+	dashboardURL := baseURL + a.config.PathPrefix + "/"
+
+	var feed interface{}
+	switch urlParams["format"] {
+	case "atom":
+		w.Header().Set("Content-Type", "application/atom+xml; charset=utf-8")
+		feedId := fmt.Sprintf("%s%s/feeds/%s/%s", baseURL, a.config.PathPrefix, kind, url.PathEscape(name))
+		feed = newAtomFeed(title, feedId, baseURL+a.feedPath(kind, name, "atom"), dashboardURL, notifications)
+	case "rss":
+		w.Header().Set("Content-Type", "application/rss+xml; charset=utf-8")
+		feed = newRSSFeed(title, dashboardURL, notifications)
+	}
+
+	w.Write([]byte(xml.Header))
+	err = xml.NewEncoder(w).Encode(feed)
+	if err != nil {
+		logger.WithField("error", err).Error("failed to write feed")
+	}
+}
+
+type feedLink struct {
+	Name string
+	Atom string
+	RSS  string
+}
+
+type feedsPage struct {
+	Prefix   string
+	Enabled  bool
+	Channels []feedLink
+	Origins  []feedLink
+}
+
+// Lists the secret URLs of the feeds, behind the basic auth of the dashboard.
+func (a *App) FeedsHandler(w http.ResponseWriter, r *http.Request) {
+	if !a.isAuthenticated(r) {
+		w.Header().Set("WWW-Authenticate", `Basic realm="towncrier"`)
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	page := feedsPage{
+		Prefix:  a.config.PathPrefix,
+		Enabled: a.config.FeedSecret != "",
+	}
+
+	if page.Enabled {
+		origins, err := a.backend.ListOrigins()
+		if err != nil {
+			logger.WithField("error", err).Error("failed to list origins")
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+
+		baseURL := a.baseURL(r)
+		link := func(kind, name string) feedLink {
+			return feedLink{
+				Name: name,
+				Atom: baseURL + a.feedPath(kind, name, "atom"),
+				RSS:  baseURL + a.feedPath(kind, name, "rss"),
+			}
+		}
+
+		for _, channel := range a.backend.ListChannels() {
+			page.Channels = append(page.Channels, link(channelFeed, channel.Name))
+		}
+
+		for _, origin := range origins {
+			page.Origins = append(page.Origins, link(originFeed, origin))
+		}
+	}
+
+	a.render(w, feedsTemplate, page)
+}
@@ -0,0 +1,149 @@
+package webfeed
+
+import (
+	"encoding/xml"
+	"net/http"
+	"regexp"
+	"strings"
+
+	"gitlab.com/shuhao/towncrier/backend"
+
+	. "gopkg.in/check.v1"
+)
+
+var feedURLRegexp = regexp.MustCompile(`https://towncrier\.example\.com(/feed/feeds/[a-z]+/[^/]+/[0-9a-f]+\.(atom|rss))`)
+
+func (s *WebFeedAppSuite) queueFeedNotifications(c *C) {
+	for _, n := range []backend.Notification{
+		{Channel: "Channel2", Subject: "disk full", Content: "/ is at 100%", Origin: "db_server", Tags: []string{"disk"}, Priority: backend.LowPriority},
+		{Channel: "Channel2", Subject: "web down", Origin: "web_server", Priority: backend.LowPriority},
+	} {
+		c.Assert(s.backend.QueueNotification(n), IsNil)
+	}
+}
+
+// The paths of the feeds listed on the dashboard.
+func (s *WebFeedAppSuite) feedPaths(c *C) []string {
+	status, body := s.get(c, "/feed/feeds")
+	c.Assert(status, Equals, http.StatusOK)
+
+	paths := []string{}
+	for _, match := range feedURLRegexp.FindAllStringSubmatch(body, -1) {
+		paths = append(paths, match[1])
+	}
+
+	return paths
+}
+
+func (s *WebFeedAppSuite) TestFeedsAreListed(c *C) {
+	s.queueFeedNotifications(c)
+
+	paths := s.feedPaths(c)
+	c.Assert(paths, HasLen, 8)
+	c.Assert(strings.HasPrefix(paths[0], "/feed/feeds/channels/Channel1/"), Equals, true)
+	c.Assert(strings.HasSuffix(paths[0], ".atom"), Equals, true)
+	c.Assert(strings.HasPrefix(paths[5], "/feed/feeds/origins/db_server/"), Equals, true)
+	c.Assert(strings.HasSuffix(paths[5], ".rss"), Equals, true)
+}
+
+func (s *WebFeedAppSuite) TestAtomFeed(c *C) {
+	s.queueFeedNotifications(c)
+
+	// Feed readers do not do basic auth, the secret in the URL is enough.
+	resp, err := http.Get(s.server.URL + s.app().feedPath(channelFeed, "Channel2", "atom"))
+	c.Assert(err, IsNil)
+	defer resp.Body.Close()
+	c.Assert(resp.StatusCode, Equals, http.StatusOK)
+	c.Assert(resp.Header.Get("Content-Type"), Equals, "application/atom+xml; charset=utf-8")
+
+	var feed atomFeed
+	c.Assert(xml.NewDecoder(resp.Body).Decode(&feed), IsNil)
+	c.Assert(feed.Title, Equals, "Towncrier: Channel2")
+	c.Assert(feed.Id, Equals, "https://towncrier.example.com/feed/feeds/channels/Channel2")
+	c.Assert(feed.Entries, HasLen, 2)
+	c.Assert(feed.Entries[0].Title, Equals, "web down")
+	c.Assert(feed.Entries[1].Title, Equals, "disk full")
+	c.Assert(feed.Entries[1].Author.Name, Equals, "db_server")
+	c.Assert(feed.Entries[1].Content.Body, Equals, "/ is at 100%")
+	c.Assert(feed.Entries[1].Categories, DeepEquals, []atomCategory{{Term: "disk"}})
+	c.Assert(feed.Entries[1].Link.Href, Matches, `https://towncrier\.example\.com/feed/notifications/[0-9]+`)
+}
+
+func (s *WebFeedAppSuite) TestRSSFeed(c *C) {
+	s.queueFeedNotifications(c)
+
+	resp, err := http.Get(s.server.URL + s.app().feedPath(originFeed, "db_server", "rss"))
+	c.Assert(err, IsNil)
+	defer resp.Body.Close()
+	c.Assert(resp.StatusCode, Equals, http.StatusOK)
+	c.Assert(resp.Header.Get("Content-Type"), Equals, "application/rss+xml; charset=utf-8")
+
+	var feed rssFeed
+	c.Assert(xml.NewDecoder(resp.Body).Decode(&feed), IsNil)
+	c.Assert(feed.Version, Equals, "2.0")
+	c.Assert(feed.Channel.Items, HasLen, 1)
+	c.Assert(feed.Channel.Items[0].Title, Equals, "disk full")
+	c.Assert(feed.Channel.Items[0].Description, Equals, "/ is at 100%")
+	c.Assert(feed.Channel.Items[0].Categories, DeepEquals, []string{"disk"})
+	c.Assert(feed.Channel.Items[0].GUID.Value, Equals, feed.Channel.Items[0].Link)
+}
+
+func (s *WebFeedAppSuite) TestFeedForNameWithSlash(c *C) {
+	c.Assert(s.backend.QueueNotification(backend.Notification{Channel: "Channel2", Subject: "build failed", Origin: "ci/main", Priority: backend.LowPriority}), IsNil)
+
+	var feedPath string
+	for _, path := range s.feedPaths(c) {
+		if strings.HasPrefix(path, "/feed/feeds/origins/ci%2Fmain/") && strings.HasSuffix(path, ".atom") {
+			feedPath = path
+		}
+	}
+	c.Assert(feedPath, Not(Equals), "")
+
+	resp, err := http.Get(s.server.URL + feedPath)
+	c.Assert(err, IsNil)
+	defer resp.Body.Close()
+	c.Assert(resp.StatusCode, Equals, http.StatusOK)
+
+	var feed atomFeed
+	c.Assert(xml.NewDecoder(resp.Body).Decode(&feed), IsNil)
+	c.Assert(feed.Title, Equals, "Towncrier: notifications from ci/main")
+	c.Assert(feed.Entries, HasLen, 1)
+	c.Assert(feed.Entries[0].Title, Equals, "build failed")
+}
+
+func (s *WebFeedAppSuite) TestFeedWithWrongSecret(c *C) {
+	app := s.app()
+
+	for _, path := range []string{
+		// The secret of another feed
+		strings.Replace(app.feedPath(channelFeed, "Channel1", "atom"), "Channel1", "Channel2", 1),
+		"/feed/feeds/channels/Channel2/0123456789abcdef0123456789abcdef.atom",
+		// Signed but does not exist
+		app.feedPath(channelFeed, "Channel3", "atom"),
+	} {
+		resp, err := http.Get(s.server.URL + path)
+		c.Assert(err, IsNil)
+		c.Assert(resp.StatusCode, Equals, http.StatusNotFound, Commentf(path))
+		resp.Body.Close()
+	}
+}
+
+func (s *WebFeedAppSuite) TestFeedsDisabledWithoutSecret(c *C) {
+	config := s.config
+	config.FeedSecret = ""
+	app := NewApp(s.backend, config)
+
+	s.server.Config.Handler = app
+	resp, err := http.Get(s.server.URL + app.feedPath(channelFeed, "Channel1", "atom"))
+	c.Assert(err, IsNil)
+	c.Assert(resp.StatusCode, Equals, http.StatusNotFound)
+	resp.Body.Close()
+
+	status, body := s.get(c, "/feed/feeds")
+	c.Assert(status, Equals, http.StatusOK)
+	c.Assert(body, Matches, `(?s).*The feeds are disabled.*`)
+}
+
+func (s *WebFeedAppSuite) app() *App {
+	return NewApp(s.backend, s.config)
+}
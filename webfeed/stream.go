@@ -0,0 +1,238 @@
+package webfeed
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+
+	"gitlab.com/shuhao/towncrier/backend"
+)
+
+// The live stream of what happens to the notifications, as Server-Sent Events
+// or over a WebSocket. Every event is a JSON object such as:
+//
+//     {"type": "queued", "notification": {...}}
+//     {"type": "delivery", "notification": {...}, "delivery": {...}}
+//
+// See the backend package for the types of events.
+
+// Something is sent at least this often so proxies do not time out the
+// connection.
+const streamKeepAliveInterval = 30 * time.Second
+
+type streamNotificationJSON struct {
+	Id        int64    `json:"id"`
+	Channel   string   `json:"channel"`
+	Subject   string   `json:"subject"`
+	Content   string   `json:"content"`
+	Origin    string   `json:"origin"`
+	Tags      []string `json:"tags"`
+	Priority  string   `json:"priority"`
+	Delivered bool     `json:"delivered"`
+	CreatedAt string   `json:"created_at"` // RFC3339
+}
+
+type streamDeliveryJSON struct {
+	Subscriber string `json:"subscriber"`
+	Notifier   string `json:"notifier"`
+	Status     string `json:"status"`
+	Attempts   int64  `json:"attempts"`
+	LastError  string `json:"last_error,omitempty"`
+}
+
+type streamEventJSON struct {
+	Type         string                 `json:"type"`
+	Notification streamNotificationJSON `json:"notification"`
+	Delivery     *streamDeliveryJSON    `json:"delivery,omitempty"`
+}
+
+func newStreamEventJSON(event backend.Event) streamEventJSON {
+	n := event.Notification
+	tags := n.Tags
+	if tags == nil {
+		tags = []string{}
+	}
+
+	e := streamEventJSON{
+		Type: event.Type,
+		Notification: streamNotificationJSON{
+			Id:        n.Id,
+			Channel:   n.Channel,
+			Subject:   n.Subject,
+			Content:   n.Content,
+			Origin:    n.Origin,
+			Tags:      tags,
+			Priority:  n.Priority.String(),
+			Delivered: n.Delivered,
+			CreatedAt: time.Unix(0, n.CreatedAt).UTC().Format(time.RFC3339Nano),
+		},
+	}
+
+	if event.Delivery != nil {
+		e.Delivery = &streamDeliveryJSON{
+			Subscriber: event.Delivery.Subscriber,
+			Notifier:   event.Delivery.Notifier,
+			Status:     event.Delivery.Status,
+			Attempts:   event.Delivery.Attempts,
+			LastError:  event.Delivery.LastError,
+		}
+	}
+
+	return e
+}
+
+// The stream can be filtered by channel, tag and priority, which is the lowest
+// priority to receive.
+func parseEventFilter(params url.Values) (backend.EventFilter, bool) {
+	filter := backend.EventFilter{
+		Channel: params.Get("channel"),
+		Tag:     params.Get("tag"),
+	}
+
+	if v := params.Get("priority"); v != "" {
+		priority, found := backend.PriorityMap[v]
+		if !found {
+			return filter, false
+		}
+		filter.MinPriority = priority
+	}
+
+	return filter, true
+}
+
+func (a *App) StreamHandler(w http.ResponseWriter, r *http.Request) {
+	if !a.isAuthenticated(r) {
+		w.Header().Set("WWW-Authenticate", `Basic realm="towncrier"`)
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	filter, ok := parseEventFilter(r.URL.Query())
+	if !ok {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		logger.Error("cannot stream as the response cannot be flushed")
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	subscription := a.backend.Hub().Subscribe(filter)
+	defer subscription.Close()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	ticker := time.NewTicker(streamKeepAliveInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case event, open := <-subscription.Events():
+			if !open {
+				return
+			}
+
+			data, err := json.Marshal(newStreamEventJSON(event))
+			if err != nil {
+				logger.WithField("error", err).Error("failed to encode event")
+				continue
+			}
+
+			_, err = fmt.Fprintf(w, "event: %s\ndata: %s\n\n", event.Type, data)
+			if err != nil {
+				return
+			}
+		case <-ticker.C:
+			_, err := fmt.Fprint(w, ": keepalive\n\n")
+			if err != nil {
+				return
+			}
+		case <-r.Context().Done():
+			return
+		}
+
+		flusher.Flush()
+	}
+}
+
+func (a *App) WebSocketStreamHandler(w http.ResponseWriter, r *http.Request) {
+	if !a.isAuthenticated(r) {
+		w.Header().Set("WWW-Authenticate", `Basic realm="towncrier"`)
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	if !websocketOriginAllowed(r, a.config.AllowedOrigins) {
+		logger.WithField("origin", r.Header.Get("Origin")).Warn("refused websocket from another origin")
+		w.WriteHeader(http.StatusForbidden)
+		return
+	}
+
+	filter, ok := parseEventFilter(r.URL.Query())
+	if !ok {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	// Subscribed first so nothing is missed once the client is connected.
+	subscription := a.backend.Hub().Subscribe(filter)
+	defer subscription.Close()
+
+	conn, err := upgradeWebSocket(w, r)
+	if err != nil {
+		if err == errNotWebSocket {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		// The connection may have been taken over already.
+		logger.WithField("error", err).Error("failed to upgrade to websocket")
+		return
+	}
+	defer conn.Close()
+
+	closed := make(chan struct{})
+	go func() {
+		conn.readUntilClosed()
+		close(closed)
+	}()
+
+	ticker := time.NewTicker(streamKeepAliveInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case event, open := <-subscription.Events():
+			if !open {
+				conn.writeClose(websocketCloseGoingAway)
+				return
+			}
+
+			data, err := json.Marshal(newStreamEventJSON(event))
+			if err != nil {
+				logger.WithField("error", err).Error("failed to encode event")
+				continue
+			}
+
+			err = conn.writeText(data)
+			if err != nil {
+				return
+			}
+		case <-ticker.C:
+			err := conn.writePing()
+			if err != nil {
+				return
+			}
+		case <-closed:
+			return
+		}
+	}
+}
@@ -0,0 +1,235 @@
+package webfeed
+
+import (
+	"bufio"
+	"encoding/binary"
+	"encoding/json"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"time"
+
+	"gitlab.com/shuhao/towncrier/backend"
+
+	. "gopkg.in/check.v1"
+)
+
+const testStreamTimeout = 5 * time.Second
+
+func (s *WebFeedAppSuite) TestStreamFilters(c *C) {
+	req, err := http.NewRequest("GET", s.server.URL+"/feed/stream?channel=Channel2&priority=normal", nil)
+	c.Assert(err, IsNil)
+	req.SetBasicAuth("jimmy", "meow")
+
+	resp, err := http.DefaultClient.Do(req)
+	c.Assert(err, IsNil)
+	defer resp.Body.Close()
+	c.Assert(resp.StatusCode, Equals, http.StatusOK)
+	c.Assert(resp.Header.Get("Content-Type"), Equals, "text/event-stream")
+
+	for _, n := range []backend.Notification{
+		{Channel: "Channel1", Subject: "other channel", Priority: backend.UrgentPriority},
+		{Channel: "Channel2", Subject: "too low", Priority: backend.LowPriority},
+		{Channel: "Channel2", Subject: "disk full", Tags: []string{"disk"}, Priority: backend.NormalPriority},
+	} {
+		c.Assert(s.backend.QueueNotification(n), IsNil)
+	}
+
+	lines := make(chan string)
+	go func() {
+		scanner := bufio.NewScanner(resp.Body)
+		for scanner.Scan() {
+			lines <- scanner.Text()
+		}
+		close(lines)
+	}()
+
+	readLine := func() string {
+		select {
+		case line := <-lines:
+			return line
+		case <-time.After(testStreamTimeout):
+			c.Fatal("timed out waiting for the stream")
+			return ""
+		}
+	}
+
+	c.Assert(readLine(), Equals, "event: queued")
+
+	data := readLine()
+	c.Assert(strings.HasPrefix(data, "data: "), Equals, true)
+
+	var event streamEventJSON
+	c.Assert(json.Unmarshal([]byte(strings.TrimPrefix(data, "data: ")), &event), IsNil)
+	c.Assert(event.Type, Equals, backend.NotificationQueued)
+	c.Assert(event.Notification.Subject, Equals, "disk full")
+	c.Assert(event.Notification.Tags, DeepEquals, []string{"disk"})
+	c.Assert(event.Notification.Priority, Equals, "normal")
+	c.Assert(event.Delivery, IsNil)
+
+	c.Assert(readLine(), Equals, "")
+}
+
+func (s *WebFeedAppSuite) TestStreamBadFilter(c *C) {
+	status, _ := s.get(c, "/feed/stream?priority=whatever")
+	c.Assert(status, Equals, http.StatusBadRequest)
+
+	status, _ = s.get(c, "/feed/stream/websocket")
+	c.Assert(status, Equals, http.StatusBadRequest)
+}
+
+// A client side frame, which has to be masked.
+func writeTestWebSocketFrame(c *C, conn net.Conn, opcode byte, payload []byte) {
+	writeTestWebSocketRawFrame(c, conn, 0x80|opcode, payload)
+}
+
+// The first byte is written as is, with the FIN bit and the opcode.
+func writeTestWebSocketRawFrame(c *C, conn net.Conn, first byte, payload []byte) {
+	mask := []byte{1, 2, 3, 4}
+	frame := []byte{first}
+	if len(payload) < 126 {
+		frame = append(frame, 0x80|byte(len(payload)))
+	} else {
+		frame = append(frame, 0x80|126, 0, 0)
+		binary.BigEndian.PutUint16(frame[2:], uint16(len(payload)))
+	}
+	frame = append(frame, mask...)
+	for i, b := range payload {
+		frame = append(frame, b^mask[i%4])
+	}
+
+	_, err := conn.Write(frame)
+	c.Assert(err, IsNil)
+}
+
+func readTestWebSocketFrame(c *C, r *bufio.Reader) (byte, []byte) {
+	header := make([]byte, 2)
+	_, err := io.ReadFull(r, header)
+	c.Assert(err, IsNil)
+	c.Assert(header[1]&0x80, Equals, byte(0))
+
+	length := int(header[1])
+	if length == 126 {
+		extended := make([]byte, 2)
+		_, err = io.ReadFull(r, extended)
+		c.Assert(err, IsNil)
+		length = int(binary.BigEndian.Uint16(extended))
+	}
+
+	payload := make([]byte, length)
+	_, err = io.ReadFull(r, payload)
+	c.Assert(err, IsNil)
+	return header[0] & 0x0f, payload
+}
+
+// Opens a websocket to the stream and returns the response to the handshake.
+func (s *WebFeedAppSuite) dialWebSocket(c *C, query, origin string) (net.Conn, *bufio.Reader, *http.Response) {
+	conn, err := net.Dial("tcp", strings.TrimPrefix(s.server.URL, "http://"))
+	c.Assert(err, IsNil)
+	conn.SetDeadline(time.Now().Add(testStreamTimeout))
+
+	req, err := http.NewRequest("GET", s.server.URL+"/feed/stream/websocket"+query, nil)
+	c.Assert(err, IsNil)
+	req.SetBasicAuth("jimmy", "meow")
+	req.Header.Set("Connection", "Upgrade")
+	req.Header.Set("Upgrade", "websocket")
+	req.Header.Set("Sec-WebSocket-Version", "13")
+	req.Header.Set("Sec-WebSocket-Key", "dGhlIHNhbXBsZSBub25jZQ==")
+	if origin != "" {
+		req.Header.Set("Origin", origin)
+	}
+	c.Assert(req.Write(conn), IsNil)
+
+	r := bufio.NewReader(conn)
+	resp, err := http.ReadResponse(r, req)
+	c.Assert(err, IsNil)
+	return conn, r, resp
+}
+
+func (s *WebFeedAppSuite) TestWebSocketStream(c *C) {
+	conn, r, resp := s.dialWebSocket(c, "?tag=disk", "")
+	defer conn.Close()
+	c.Assert(resp.StatusCode, Equals, http.StatusSwitchingProtocols)
+	// The example of RFC 6455
+	c.Assert(resp.Header.Get("Sec-WebSocket-Accept"), Equals, "s3pPLMBiTxaQ9kYGzzhZRbK+xOo=")
+
+	c.Assert(s.backend.QueueNotification(backend.Notification{Channel: "Channel1", Subject: "web down", Priority: backend.NormalPriority}), IsNil)
+	c.Assert(s.backend.QueueNotification(backend.Notification{Channel: "Channel1", Subject: "disk full", Tags: []string{"disk"}, Priority: backend.NormalPriority}), IsNil)
+
+	// Channel1 sends immediately, so the delivery follows.
+	types := []string{}
+	for len(types) < 3 {
+		opcode, payload := readTestWebSocketFrame(c, r)
+		c.Assert(opcode, Equals, byte(websocketOpText))
+
+		var event streamEventJSON
+		c.Assert(json.Unmarshal(payload, &event), IsNil)
+		c.Assert(event.Notification.Subject, Equals, "disk full")
+		types = append(types, event.Type)
+
+		if event.Type == backend.DeliveryUpdated {
+			c.Assert(event.Delivery.Subscriber, Equals, "jimmy")
+			c.Assert(event.Delivery.Status, Equals, "sent")
+		}
+	}
+	c.Assert(types, DeepEquals, []string{backend.NotificationQueued, backend.DeliveryUpdated, backend.NotificationDelivered})
+
+	writeTestWebSocketFrame(c, conn, websocketOpPing, []byte("hi"))
+	opcode, payload := readTestWebSocketFrame(c, r)
+	c.Assert(opcode, Equals, byte(websocketOpPong))
+	c.Assert(string(payload), Equals, "hi")
+
+	writeTestWebSocketFrame(c, conn, websocketOpClose, []byte{0x03, 0xe8})
+	opcode, payload = readTestWebSocketFrame(c, r)
+	c.Assert(opcode, Equals, byte(websocketOpClose))
+	c.Assert(payload, DeepEquals, []byte{0x03, 0xe8})
+}
+
+func (s *WebFeedAppSuite) TestWebSocketOrigin(c *C) {
+	s.server.Close()
+	config := s.config
+	config.AllowedOrigins = []string{"https://status.example.com/"}
+	s.server = httptest.NewServer(NewApp(s.backend, config))
+
+	for _, test := range []struct {
+		origin string
+		status int
+	}{
+		{"", http.StatusSwitchingProtocols},
+		{s.server.URL, http.StatusSwitchingProtocols},
+		{"https://status.example.com", http.StatusSwitchingProtocols},
+		{"https://evil.example.com", http.StatusForbidden},
+		{"https://status.example.com.evil.example.com", http.StatusForbidden},
+		{"null", http.StatusForbidden},
+	} {
+		conn, _, resp := s.dialWebSocket(c, "", test.origin)
+		c.Check(resp.StatusCode, Equals, test.status, Commentf("origin %q", test.origin))
+		conn.Close()
+	}
+}
+
+func (s *WebFeedAppSuite) TestWebSocketClosesOnProtocolErrors(c *C) {
+	for _, test := range []struct {
+		name    string
+		first   byte
+		payload []byte
+	}{
+		{"fragmented text", websocketOpText, []byte("part")},
+		{"continuation", 0x80 | websocketOpContinuation, []byte("part")},
+		{"fragmented ping", websocketOpPing, []byte("hi")},
+		{"large ping", 0x80 | websocketOpPing, make([]byte, 126)},
+		{"reserved bits", 0xc0 | websocketOpText, []byte("hi")},
+		{"unknown opcode", 0x80 | 0x3, []byte("hi")},
+	} {
+		conn, r, resp := s.dialWebSocket(c, "", "")
+		c.Assert(resp.StatusCode, Equals, http.StatusSwitchingProtocols)
+
+		writeTestWebSocketRawFrame(c, conn, test.first, test.payload)
+		opcode, payload := readTestWebSocketFrame(c, r)
+		c.Check(opcode, Equals, byte(websocketOpClose), Commentf(test.name))
+		c.Check(payload, DeepEquals, []byte{0x03, 0xea}, Commentf(test.name))
+		conn.Close()
+	}
+}
@@ -0,0 +1,155 @@
+package webfeed
+
+import (
+	"html/template"
+	"time"
+)
+
+const layoutTemplateText = `<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>{{template "title" .}} - Towncrier</title>
+<style>
+body { font-family: sans-serif; margin: 0 auto; max-width: 70em; padding: 0 1em; }
+nav a { margin-right: 1em; }
+table { border-collapse: collapse; width: 100%; }
+th, td { border-bottom: 1px solid #ddd; padding: 0.3em; text-align: left; vertical-align: top; }
+pre { background: #f6f6f6; padding: 1em; white-space: pre-wrap; }
+.urgent { color: #c00; font-weight: bold; }
+.status-failed, .status-abandoned { color: #c00; }
+.status-sent { color: #080; }
+</style>
+</head>
+<body>
+<nav><a href="{{.Prefix}}/">Notifications</a><a href="{{.Prefix}}/channels">Channels</a><a href="{{.Prefix}}/feeds">Feeds</a></nav>
+{{template "content" .}}
+</body>
+</html>
+`
+
+const notificationsTemplateText = `{{define "title"}}Notifications{{end}}
+{{define "content"}}
+<h1>Notifications</h1>
+<form method="get" action="{{.Prefix}}/">
+<select name="channel">
+<option value="">All channels</option>
+{{range .Channels}}<option value="{{.Name}}"{{if eq .Name $.Filters.Channel}} selected{{end}}>{{.Name}}</option>
+{{end}}</select>
+<input type="text" name="origin" placeholder="Origin" value="{{.Filters.Origin}}">
+<input type="text" name="tag" placeholder="Tag" value="{{.Filters.Tag}}">
+<select name="priority">
+<option value="">Any priority</option>
+{{range .Priorities}}<option value="{{.}}"{{if eq . $.Filters.Priority}} selected{{end}}>{{.}}</option>
+{{end}}</select>
+<select name="delivered">
+<option value="">Delivered or not</option>
+<option value="true"{{if eq .Filters.Delivered "true"}} selected{{end}}>Delivered</option>
+<option value="false"{{if eq .Filters.Delivered "false"}} selected{{end}}>Not delivered</option>
+</select>
+<input type="submit" value="Filter">
+</form>
+<table>
+<tr><th>Received</th><th>Channel</th><th>Origin</th><th>Subject</th><th>Tags</th><th>Priority</th><th>Delivered</th></tr>
+{{range .Notifications}}<tr>
+<td>{{time .CreatedAt}}</td>
+<td><a href="{{$.Prefix}}/?channel={{.Channel}}">{{.Channel}}</a></td>
+<td>{{.Origin}}</td>
+<td><a href="{{$.Prefix}}/notifications/{{.Id}}">{{if .Subject}}{{.Subject}}{{else}}(no subject){{end}}</a></td>
+<td>{{range $i, $tag := .Tags}}{{if $i}}, {{end}}<a href="{{$.Prefix}}/?tag={{$tag}}">{{$tag}}</a>{{end}}</td>
+<td class="{{.Priority}}">{{.Priority}}</td>
+<td>{{if .Delivered}}yes{{else}}no{{end}}</td>
+</tr>
+{{else}}<tr><td colspan="7">No notifications.</td></tr>
+{{end}}</table>
+{{if .NextPage}}<p><a href="{{.NextPage}}">Older notifications</a></p>{{end}}
+{{end}}
+`
+
+const notificationTemplateText = `{{define "title"}}{{.Notification.Subject}}{{end}}
+{{define "content"}}
+{{with .Notification}}
+<h1>{{if .Subject}}{{.Subject}}{{else}}(no subject){{end}}</h1>
+<table>
+<tr><th>Channel</th><td><a href="{{$.Prefix}}/?channel={{.Channel}}">{{.Channel}}</a></td></tr>
+<tr><th>Origin</th><td>{{.Origin}}</td></tr>
+<tr><th>Tags</th><td>{{range $i, $tag := .Tags}}{{if $i}}, {{end}}<a href="{{$.Prefix}}/?tag={{$tag}}">{{$tag}}</a>{{end}}</td></tr>
+<tr><th>Labels</th><td>{{range $name, $value := .Labels}}{{$name}}={{$value}} {{end}}</td></tr>
+<tr><th>Priority</th><td class="{{.Priority}}">{{.Priority}}</td></tr>
+<tr><th>Received</th><td>{{time .CreatedAt}}</td></tr>
+{{if .SendAt}}<tr><th>Not sent before</th><td>{{time .SendAt}}</td></tr>{{end}}
+<tr><th>Delivered</th><td>{{if .Delivered}}yes{{else}}no{{end}}</td></tr>
+</table>
+<pre>{{.Content}}</pre>
+{{end}}
+<h2>Deliveries</h2>
+<table>
+<tr><th>Subscriber</th><th>Notifier</th><th>Status</th><th>Attempts</th><th>Last error</th><th>Next attempt</th><th>Updated</th></tr>
+{{range .Deliveries}}<tr>
+<td>{{.Subscriber}}</td>
+<td>{{.Notifier}}</td>
+<td class="status-{{.Status}}">{{.Status}}</td>
+<td>{{.Attempts}}</td>
+<td>{{.LastError}}</td>
+<td>{{if .NextAttemptAt}}{{time .NextAttemptAt}}{{end}}</td>
+<td>{{time .UpdatedAt}}</td>
+</tr>
+{{else}}<tr><td colspan="7">Not sent yet.</td></tr>
+{{end}}</table>
+{{end}}
+`
+
+const channelsTemplateText = `{{define "title"}}Channels{{end}}
+{{define "content"}}
+<h1>Channels</h1>
+<table>
+<tr><th>Name</th><th>Time to notify</th><th>Subscribers</th><th>Notifiers</th></tr>
+{{range .Channels}}<tr>
+<td><a href="{{$.Prefix}}/?channel={{.Name}}">{{.Name}}</a></td>
+<td>{{.TimeToNotify}}</td>
+<td>{{range $i, $s := .Subscribers}}{{if $i}}, {{end}}{{$s}}{{end}}</td>
+<td>{{range $i, $n := .Notifiers}}{{if $i}}, {{end}}{{$n}}{{end}}</td>
+</tr>
+{{else}}<tr><td colspan="4">No channels.</td></tr>
+{{end}}</table>
+{{end}}
+`
+
+const feedsTemplateText = `{{define "title"}}Feeds{{end}}
+{{define "content"}}
+<h1>Feeds</h1>
+{{if .Enabled}}
+<p>Anyone with the URL of a feed can read it, so only share it with those who should.</p>
+<h2>Channels</h2>
+<table>
+{{range .Channels}}<tr><td>{{.Name}}</td><td><a href="{{.Atom}}">Atom</a></td><td><a href="{{.RSS}}">RSS</a></td></tr>
+{{else}}<tr><td>No channels.</td></tr>
+{{end}}</table>
+<h2>Origins</h2>
+<table>
+{{range .Origins}}<tr><td>{{.Name}}</td><td><a href="{{.Atom}}">Atom</a></td><td><a href="{{.RSS}}">RSS</a></td></tr>
+{{else}}<tr><td>No notifications were received yet.</td></tr>
+{{end}}</table>
+{{else}}
+<p>The feeds are disabled, set FeedSecret in the configuration to enable them.</p>
+{{end}}
+{{end}}
+`
+
+var templateFuncs = template.FuncMap{
+	"time": func(unixNano int64) string {
+		return time.Unix(0, unixNano).Format("2006-01-02 15:04:05 MST")
+	},
+}
+
+var layoutTemplate = template.Must(template.New("layout").Funcs(templateFuncs).Parse(layoutTemplateText))
+
+var notificationsTemplate = pageTemplate(notificationsTemplateText)
+var notificationTemplate = pageTemplate(notificationTemplateText)
+var channelsTemplate = pageTemplate(channelsTemplateText)
+var feedsTemplate = pageTemplate(feedsTemplateText)
+
+// Every page is the layout with its own title and content.
+func pageTemplate(text string) *template.Template {
+	return template.Must(template.Must(layoutTemplate.Clone()).Parse(text))
+}
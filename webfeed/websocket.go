@@ -0,0 +1,289 @@
+package webfeed
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Just enough of RFC 6455 for the server to push messages to the client. The
+// messages of the client are read and thrown away, other than to answer the
+// pings and the close. Fragmented messages are not supported, the connection is
+// closed as a protocol error if the client sends one.
+
+const (
+	websocketGUID = "258EAFA5-E914-47DA-95CA-C5AB0DC85B11"
+
+	websocketOpContinuation = 0x0
+	websocketOpText         = 0x1
+	websocketOpBinary       = 0x2
+	websocketOpClose        = 0x8
+	websocketOpPing         = 0x9
+	websocketOpPong         = 0xa
+
+	websocketMaxPayload        = 64 * 1024
+	websocketMaxControlPayload = 125
+	websocketWriteTimeout      = 10 * time.Second
+
+	websocketCloseGoingAway     = 1001
+	websocketCloseProtocolError = 1002
+	websocketCloseTooBig        = 1009
+)
+
+var errNotWebSocket = errors.New("not a websocket handshake")
+
+// A frame the client should not have sent. The connection is closed with the
+// code.
+type websocketCloseError struct {
+	code   uint16
+	reason string
+}
+
+func (e websocketCloseError) Error() string {
+	return e.reason
+}
+
+func websocketProtocolError(reason string) error {
+	return websocketCloseError{code: websocketCloseProtocolError, reason: reason}
+}
+
+type websocketConn struct {
+	conn      net.Conn
+	rw        *bufio.ReadWriter
+	writeLock sync.Mutex
+}
+
+func headerContainsToken(header http.Header, name, token string) bool {
+	for _, value := range header[name] {
+		for _, t := range strings.Split(value, ",") {
+			if strings.EqualFold(strings.TrimSpace(t), token) {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+func websocketAccept(key string) string {
+	h := sha1.New()
+	io.WriteString(h, key+websocketGUID)
+	return base64.StdEncoding.EncodeToString(h.Sum(nil))
+}
+
+// Browsers send the Origin of the page opening the WebSocket, and do not stop
+// other sites from opening one with the credentials of the user. Other clients
+// usually do not send it at all, which is allowed.
+func websocketOriginAllowed(r *http.Request, allowedOrigins []string) bool {
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		return true
+	}
+
+	u, err := url.Parse(origin)
+	if err == nil && strings.EqualFold(u.Host, r.Host) {
+		return true
+	}
+
+	for _, allowed := range allowedOrigins {
+		if strings.EqualFold(strings.TrimRight(allowed, "/"), origin) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Takes over the connection of the request. Nothing is written if it is not a
+// valid handshake, so the caller can still respond.
+func upgradeWebSocket(w http.ResponseWriter, r *http.Request) (*websocketConn, error) {
+	if !headerContainsToken(r.Header, "Connection", "upgrade") || !headerContainsToken(r.Header, "Upgrade", "websocket") {
+		return nil, errNotWebSocket
+	}
+
+	key := r.Header.Get("Sec-WebSocket-Key")
+	if r.Header.Get("Sec-WebSocket-Version") != "13" || key == "" {
+		return nil, errNotWebSocket
+	}
+
+	hijacker, ok := w.(http.Hijacker)
+	if !ok {
+		return nil, errors.New("the connection cannot be taken over")
+	}
+
+	conn, rw, err := hijacker.Hijack()
+	if err != nil {
+		return nil, err
+	}
+
+	c := &websocketConn{conn: conn, rw: rw}
+	c.writeLock.Lock()
+	defer c.writeLock.Unlock()
+
+	conn.SetWriteDeadline(time.Now().Add(websocketWriteTimeout))
+	rw.WriteString("HTTP/1.1 101 Switching Protocols\r\n")
+	rw.WriteString("Upgrade: websocket\r\n")
+	rw.WriteString("Connection: Upgrade\r\n")
+	rw.WriteString("Sec-WebSocket-Accept: " + websocketAccept(key) + "\r\n\r\n")
+	err = rw.Flush()
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	return c, nil
+}
+
+func (c *websocketConn) writeFrame(opcode byte, payload []byte) error {
+	c.writeLock.Lock()
+	defer c.writeLock.Unlock()
+
+	header := []byte{0x80 | opcode}
+	switch {
+	case len(payload) < 126:
+		header = append(header, byte(len(payload)))
+	case len(payload) <= 0xffff:
+		header = append(header, 126, 0, 0)
+		binary.BigEndian.PutUint16(header[2:], uint16(len(payload)))
+	default:
+		header = append(header, 127, 0, 0, 0, 0, 0, 0, 0, 0)
+		binary.BigEndian.PutUint64(header[2:], uint64(len(payload)))
+	}
+
+	c.conn.SetWriteDeadline(time.Now().Add(websocketWriteTimeout))
+	c.rw.Write(header)
+	c.rw.Write(payload)
+	return c.rw.Flush()
+}
+
+func (c *websocketConn) writeText(payload []byte) error {
+	return c.writeFrame(websocketOpText, payload)
+}
+
+func (c *websocketConn) writePing() error {
+	return c.writeFrame(websocketOpPing, nil)
+}
+
+func (c *websocketConn) writeClose(code uint16) error {
+	payload := make([]byte, 2)
+	binary.BigEndian.PutUint16(payload, code)
+	return c.writeFrame(websocketOpClose, payload)
+}
+
+// Frames from the client are always masked. Anything this connection does not
+// support is returned as a websocketCloseError.
+func (c *websocketConn) readFrame() (byte, []byte, error) {
+	header := make([]byte, 2)
+	_, err := io.ReadFull(c.rw, header)
+	if err != nil {
+		return 0, nil, err
+	}
+
+	fin := header[0]&0x80 != 0
+	opcode := header[0] & 0x0f
+	if header[0]&0x70 != 0 {
+		return 0, nil, websocketProtocolError("no extension was negotiated")
+	}
+
+	if header[1]&0x80 == 0 {
+		return 0, nil, websocketProtocolError("frame from the client is not masked")
+	}
+
+	control := opcode&0x8 != 0
+	switch opcode {
+	case websocketOpContinuation:
+		return 0, nil, websocketProtocolError("fragmented messages are not supported")
+	case websocketOpText, websocketOpBinary, websocketOpClose, websocketOpPing, websocketOpPong:
+	default:
+		return 0, nil, websocketProtocolError("unknown opcode")
+	}
+
+	if !fin {
+		if control {
+			return 0, nil, websocketProtocolError("control frame is fragmented")
+		}
+		return 0, nil, websocketProtocolError("fragmented messages are not supported")
+	}
+
+	length := uint64(header[1] & 0x7f)
+	switch length {
+	case 126:
+		extended := make([]byte, 2)
+		_, err = io.ReadFull(c.rw, extended)
+		length = uint64(binary.BigEndian.Uint16(extended))
+	case 127:
+		extended := make([]byte, 8)
+		_, err = io.ReadFull(c.rw, extended)
+		length = binary.BigEndian.Uint64(extended)
+	}
+
+	if err != nil {
+		return 0, nil, err
+	}
+
+	if control && length > websocketMaxControlPayload {
+		return 0, nil, websocketProtocolError("control frame is too large")
+	}
+
+	if length > websocketMaxPayload {
+		return 0, nil, websocketCloseError{code: websocketCloseTooBig, reason: "frame from the client is too large"}
+	}
+
+	mask := make([]byte, 4)
+	_, err = io.ReadFull(c.rw, mask)
+	if err != nil {
+		return 0, nil, err
+	}
+
+	payload := make([]byte, length)
+	_, err = io.ReadFull(c.rw, payload)
+	if err != nil {
+		return 0, nil, err
+	}
+
+	for i := range payload {
+		payload[i] ^= mask[i%4]
+	}
+
+	return opcode, payload, nil
+}
+
+// Returns once the client closed the connection or went away.
+func (c *websocketConn) readUntilClosed() {
+	for {
+		opcode, payload, err := c.readFrame()
+		if closeErr, ok := err.(websocketCloseError); ok {
+			logger.WithField("error", closeErr).Warn("closing websocket after a bad frame")
+			c.writeClose(closeErr.code)
+			return
+		}
+
+		if err != nil {
+			return
+		}
+
+		switch opcode {
+		case websocketOpPing:
+			c.writeFrame(websocketOpPong, payload)
+		case websocketOpClose:
+			if len(payload) > 2 {
+				payload = payload[:2]
+			}
+			c.writeFrame(websocketOpClose, payload)
+			return
+		}
+	}
+}
+
+func (c *websocketConn) Close() error {
+	return c.conn.Close()
+}
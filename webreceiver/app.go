@@ -1,8 +1,11 @@
 package webreceiver
 
 import (
+	"errors"
+	"fmt"
 	"io/ioutil"
 	"net/http"
+	"strconv"
 	"strings"
 	"time"
 
@@ -15,6 +18,8 @@ import (
 // The webreceiver app simply receives and queues the notifications.
 // Displaying the notification is the job of the webfeed package
 
+const maxIdempotencyKeyLength = 255
+
 var realLogger = logrus.New()
 var logger = realLogger.WithField("component", "webreceiver")
 
@@ -22,27 +27,55 @@ type App struct {
 	router  *mux.Router
 	config  ReceiverConfig
 	backend backend.NotificationBackend
+	nonces  *nonceCache
+
+	rateLimiter *rateLimiter
 }
 
 func NewApp(be backend.NotificationBackend, config ReceiverConfig) *App {
 	app := &App{
 		config:  config,
 		backend: be,
+		nonces:  newNonceCache(),
+
+		rateLimiter: newRateLimiter(),
 	}
 
 	app.router = mux.NewRouter()
-	subrouter := app.router.PathPrefix(app.config.PathPrefix)
+	app.router.Methods("GET").Path("/metrics").HandlerFunc(app.MetricsHandler)
+	app.router.Methods("GET").Path("/healthz").HandlerFunc(app.HealthzHandler)
+	app.router.Methods("GET").Path("/readyz").HandlerFunc(app.ReadyzHandler)
+	subrouter := app.router.PathPrefix(app.config.PathPrefix).Subrouter()
+	// Before the channels so it is not taken as one.
+	subrouter.Methods("POST").Path("/notifications/batch").HandlerFunc(app.PostNotificationBatchHandler)
 	subrouter.Methods("POST").Path("/notifications/{channel}").HandlerFunc(app.PostNotificationHandler)
+	subrouter.Methods("GET").Path("/notifications").HandlerFunc(app.GetNotificationsHandler)
+	subrouter.Methods("GET").Path("/notifications/{id:[0-9]+}").HandlerFunc(app.GetNotificationHandler)
 
 	return app
 }
 
+// Requests are authenticated with either a token or a signature, see
+// signature.go. The token is empty for signed requests.
 func (a *App) isAuthenticated(r *http.Request) (authenticated bool, token string, origin string) {
 	auth := r.Header.Get("Authorization")
 	if auth == "" {
 		return false, "", ""
 	}
 
+	if params, signed := parseSignatureAuthorization(auth); signed {
+		origin, err := a.verifySignature(r, params)
+		if err != nil {
+			logger.WithFields(logrus.Fields{
+				"origin": params["origin"],
+				"error":  err,
+			}).Warn("rejected signed request")
+			return false, "", ""
+		}
+
+		return true, "", origin
+	}
+
 	authArray := strings.Split(auth, " ")
 	if len(authArray) != 2 || authArray[0] != "Token" {
 		return false, "", ""
@@ -54,32 +87,77 @@ func (a *App) isAuthenticated(r *http.Request) (authenticated bool, token string
 	}
 
 	token = tokenArray[1]
-	origin, found := a.config.Tokens[token]
-	return found, token, origin
+	tokenConfig, found := a.config.Tokens[token]
+	return found, token, tokenConfig.Origin
 }
 
-func (a *App) PostNotificationHandler(w http.ResponseWriter, r *http.Request) {
-	authenticated, _, origin := a.isAuthenticated(r)
+// Authenticates the request and checks that it can come from where it does.
+// If not, the response is written and false is returned.
+func (a *App) authorize(w http.ResponseWriter, r *http.Request, jsonResponse bool) (origin string, permissions TokenPermissions, ok bool) {
+	authenticated, token, origin := a.isAuthenticated(r)
 	if !authenticated {
 		w.WriteHeader(http.StatusForbidden)
-		return
+		return "", permissions, false
 	}
 
-	urlParams := mux.Vars(r)
+	permissions = a.permissions(token, origin)
+	err := permissions.checkSource(r)
+	if err != nil {
+		writePermissionDenied(w, jsonResponse, err)
+		return "", permissions, false
+	}
+
+	return origin, permissions, true
+}
+
+// Unlike the other errors, what was denied is explained to every client.
+func writePermissionDenied(w http.ResponseWriter, jsonResponse bool, err error) {
+	if jsonResponse {
+		writeJSON(w, http.StatusForbidden, errorJSON{Error: err.Error()})
+	} else {
+		http.Error(w, err.Error(), http.StatusForbidden)
+	}
+}
+
+// Retries of a request with the same key as one sent before by the same
+// origin are not queued again. Both headers are accepted as many clients only
+// know one of them.
+func readIdempotencyKey(r *http.Request) (string, error) {
+	key := r.Header.Get("Idempotency-Key")
+	if key == "" {
+		key = r.Header.Get("X-Towncrier-Idempotency-Key")
+	}
+
+	return key, validateIdempotencyKey(key)
+}
+
+func validateIdempotencyKey(key string) error {
+	if len(key) > maxIdempotencyKeyLength {
+		return fmt.Errorf("the idempotency key is longer than %d bytes", maxIdempotencyKeyLength)
+	}
 
+	return nil
+}
+
+// The notification as given with the X-Towncrier headers, with the body as the
+// content.
+func readNotificationHeaders(r *http.Request, channel, origin string) (backend.Notification, error) {
 	notification := backend.Notification{}
 
 	notificationContentBytes, err := ioutil.ReadAll(r.Body)
 	if err != nil {
-		w.WriteHeader(http.StatusBadRequest)
-		return
+		return notification, err
 	}
 
 	notification.Content = strings.TrimSpace(string(notificationContentBytes))
 
 	notification.Subject = r.Header.Get("X-Towncrier-Subject")
-	notification.Tags = strings.Split(r.Header.Get("X-Towncrier-Tags"), ",")
-	notification.Channel = urlParams["channel"]
+	// Without the header there are no tags rather than one empty tag, so the
+	// DefaultTags of the token apply. Both are stored the same way.
+	if tags := r.Header.Get("X-Towncrier-Tags"); tags != "" {
+		notification.Tags = strings.Split(tags, ",")
+	}
+	notification.Channel = channel
 	notification.Origin = origin
 
 	var found bool
@@ -88,19 +166,116 @@ func (a *App) PostNotificationHandler(w http.ResponseWriter, r *http.Request) {
 		notification.Priority = backend.NormalPriority
 	}
 
-	err = a.backend.QueueNotification(notification)
+	return notification, nil
+}
+
+func (a *App) PostNotificationHandler(w http.ResponseWriter, r *http.Request) {
+	urlParams := mux.Vars(r)
+
+	var origin string
+	var notification backend.Notification
+	recorder := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+	w = recorder
+	defer func() {
+		countReceived(a.metricChannels(), urlParams["channel"], origin, notification.Priority, recorder.status)
+	}()
+
+	jsonRequest := isJSONRequest(r)
+	origin, permissions, ok := a.authorize(w, r, jsonRequest)
+	if !ok {
+		return
+	}
+
+	// The errors are only explained to the clients posting JSON, the others
+	// would not expect a body.
+	writeError := func(status int, err error) {
+		if jsonRequest {
+			writeJSON(w, status, errorJSON{Error: err.Error()})
+		} else {
+			w.WriteHeader(status)
+		}
+	}
+
+	var err error
+	if jsonRequest {
+		notification, err = readNotificationJSON(w, r, urlParams["channel"], origin)
+	} else {
+		notification, err = readNotificationHeaders(r, urlParams["channel"], origin)
+	}
+
+	if err == nil {
+		notification.IdempotencyKey, err = readIdempotencyKey(r)
+	}
+
+	if err != nil {
+		writeError(http.StatusBadRequest, err)
+		return
+	}
+
+	err = permissions.checkNotification(&notification)
+	if err != nil {
+		writePermissionDenied(w, jsonRequest, err)
+		return
+	}
+
+	// A retry gets the same response as the original request, even if the
+	// rate limits would refuse a new notification now.
+	if notification.IdempotencyKey != "" {
+		id, err := a.backend.FindIdempotentNotification(origin, notification.IdempotencyKey)
+		if err != nil {
+			logger.WithField("error", err).Error("failed to look up the idempotency key")
+			writeError(http.StatusInternalServerError, errors.New("failed to queue notification"))
+			return
+		}
+
+		if id != 0 {
+			writeQueued(w, jsonRequest, backend.QueueResult{Id: id, Duplicate: true})
+			return
+		}
+	}
+
+	err = a.checkOriginRateLimit(origin, 1)
+	if err == nil {
+		err = a.checkChannelRateLimit(notification)
+	}
+
+	if err != nil {
+		writeRateLimited(w, jsonRequest, err.(RateLimited))
+		return
+	}
+
+	results, err := a.backend.QueueNotifications([]backend.Notification{notification})
+	if err == nil {
+		err = results[0].Error
+	}
+
 	if err != nil {
 		if _, ok := err.(backend.ChannelNotFound); ok {
-			w.WriteHeader(http.StatusNotFound)
+			writeError(http.StatusNotFound, err)
 			return
 		}
 
 		logger.WithField("error", err).Error("failed to queue notification")
-		w.WriteHeader(http.StatusInternalServerError)
+		writeError(http.StatusInternalServerError, errors.New("failed to queue notification"))
 		return
 	}
 
-	w.WriteHeader(http.StatusAccepted)
+	writeQueued(w, jsonRequest, results[0])
+}
+
+// A duplicate is answered as the original notification was, with
+// Idempotent-Replayed on top.
+func writeQueued(w http.ResponseWriter, jsonResponse bool, result backend.QueueResult) {
+	w.Header().Set("X-Towncrier-Notification-Id", strconv.FormatInt(result.Id, 10))
+	if result.Duplicate {
+		w.Header().Set("Idempotent-Replayed", "true")
+	}
+
+	if jsonResponse {
+		writeJSON(w, http.StatusAccepted, queuedJSON{Id: result.Id})
+	} else {
+		w.WriteHeader(http.StatusAccepted)
+	}
 }
 
 func (a *App) ServeHTTP(w http.ResponseWriter, r *http.Request) {
@@ -4,10 +4,12 @@ import (
 	"bytes"
 	"net/http"
 	"net/http/httptest"
+	"sync"
 	"testing"
 	"time"
 
 	"gitlab.com/shuhao/towncrier/backend"
+	"gitlab.com/shuhao/towncrier/sql_backend"
 	"gitlab.com/shuhao/towncrier/sqlite_backend"
 	"gitlab.com/shuhao/towncrier/testhelpers"
 
@@ -34,8 +36,25 @@ func (s *WebReceiverAppSuite) SetUpSuite(c *C) {
 		ListenHost: "127.0.0.1",
 		ListenPort: 3921,
 		PathPrefix: "/receiver",
-		Tokens: map[string]string{
-			"abc": "abc_client",
+		Tokens: map[string]TokenConfig{
+			"abc": {Origin: "abc_client"},
+			"restricted": {
+				Origin: "restricted_client",
+				TokenPermissions: TokenPermissions{
+					Channels:    []string{"Channel2", "Other*"},
+					MaxPriority: "normal",
+					DefaultTags: []string{"restricted"},
+				},
+			},
+			"elsewhere": {
+				Origin: "elsewhere_client",
+				TokenPermissions: TokenPermissions{
+					AllowedIPs: []string{"10.0.0.0/8", "192.168.1.10"},
+				},
+			},
+		},
+		SigningSecrets: map[string]string{
+			"signed_client": "s3cret",
 		},
 	}
 }
@@ -46,19 +65,21 @@ func (s *WebReceiverAppSuite) SetUpTest(c *C) {
 	backend.RegisterNotifier(s.notifier)
 
 	s.backend = backend.GetBackend(sqlite_backend.BackendName).(*sqlite_backend.SQLiteNotificationBackend)
-	err := s.backend.Initialize(":memory:,../sqlite_backend/test_config/standard.conf.json")
+	err := s.backend.Initialize(":memory:,../sql_backend/test_config/standard.conf.json")
 	c.Assert(err, IsNil)
 
-	// TODO: start the backend
-
 	testhelpers.ResetTestDatabase(s.backend.DbMap)
 
+	s.backend.Start(&sync.WaitGroup{})
+	s.backend.BlockUntilReady()
+
 	s.app = NewApp(s.backend, s.config)
 	s.server = httptest.NewServer(s.app)
 }
 
 func (s *WebReceiverAppSuite) TearDownTest(c *C) {
 	s.server.Close()
+	s.backend.Shutdown()
 }
 
 func (s *WebReceiverAppSuite) url(path string) string {
@@ -83,6 +104,41 @@ func (s *WebReceiverAppSuite) postNotification(channel, token, subject, content,
 	return client.Do(req)
 }
 
+func (s *WebReceiverAppSuite) TestReadNotificationHeadersTags(c *C) {
+	req, err := http.NewRequest("POST", s.url("/receiver/notifications/Channel1"), bytes.NewBufferString("content"))
+	c.Assert(err, IsNil)
+
+	notification, err := readNotificationHeaders(req, "Channel1", "abc_client")
+	c.Assert(err, IsNil)
+	c.Assert(notification.Tags, IsNil)
+
+	req, err = http.NewRequest("POST", s.url("/receiver/notifications/Channel1"), bytes.NewBufferString("content"))
+	c.Assert(err, IsNil)
+	req.Header.Set("X-Towncrier-Tags", "tag1,tag2")
+
+	notification, err = readNotificationHeaders(req, "Channel1", "abc_client")
+	c.Assert(err, IsNil)
+	c.Assert(notification.Tags, DeepEquals, []string{"tag1", "tag2"})
+}
+
+func (s *WebReceiverAppSuite) TestPostNotificationWithoutTagsHeader(c *C) {
+	req, err := http.NewRequest("POST", s.url("/receiver/notifications/Channel2"), bytes.NewBufferString("content"))
+	c.Assert(err, IsNil)
+	req.Header.Add("Authorization", "Token token=restricted")
+	req.Header.Add("X-Towncrier-Subject", "no tags")
+
+	resp, err := http.DefaultClient.Do(req)
+	c.Assert(err, IsNil)
+	resp.Body.Close()
+	c.Assert(resp.StatusCode, Equals, http.StatusAccepted)
+
+	var notifications []*sql_backend.Notification
+	_, err = s.backend.Select(&notifications, "SELECT * FROM notifications WHERE Channel = ?", "Channel2")
+	c.Assert(err, IsNil)
+	c.Assert(notifications, HasLen, 1)
+	c.Assert(notifications[0].Tags, DeepEquals, []string{"restricted"})
+}
+
 func (s *WebReceiverAppSuite) TestPostNotificationNotAuthenticated(c *C) {
 	resp, err := s.postNotification("Channel1", "invalid-token", "subject", "content", "tag1,tag2", "normal")
 	c.Assert(err, IsNil)
@@ -104,15 +160,14 @@ func (s *WebReceiverAppSuite) TestPostNotificationSuccess(c *C) {
 	c.Assert(err, IsNil)
 	c.Assert(resp.StatusCode, Equals, http.StatusAccepted)
 
+	var notifications []*sql_backend.Notification
 	timedout := testhelpers.BlockUntilSatisfiedOrTimeout(func() bool {
-		return len(s.notifier.Logs) >= 1
+		notifications = nil
+		_, err = s.backend.Select(&notifications, "SELECT * FROM notifications WHERE Channel = ?", "Channel1")
+		return err == nil && len(notifications) == 1 && notifications[0].Delivered
 	}, 5*time.Second)
 	c.Assert(timedout, Equals, false)
 
-	var notifications []*sqlite_backend.Notification
-	_, err = s.backend.Select(&notifications, "SELECT * FROM notifications WHERE Channel = ?", "Channel1")
-	c.Assert(err, IsNil)
-
 	c.Assert(notifications, HasLen, 1)
 	c.Assert(notifications[0].Subject, Equals, "subject")
 	c.Assert(notifications[0].Content, Equals, "content")
@@ -0,0 +1,231 @@
+package webreceiver
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"mime"
+	"net/http"
+
+	"gitlab.com/shuhao/towncrier/backend"
+)
+
+// Many notifications can be posted at once to POST /notifications/batch,
+// either as a JSON array or as newline delimited JSON (with the
+// application/x-ndjson content type). Every notification is given as with the
+// JSON format of a single notification, plus its channel:
+//
+//     [
+//       {"channel": "Channel1", "subject": "Disk almost full"},
+//       {"channel": "Channel2", "subject": "Backup done", "priority": "low"}
+//     ]
+//
+// Each notification can have an idempotency_key, which works like the
+// Idempotency-Key header of a single notification. The valid notifications are
+// queued in one transaction. The response has a result for each notification,
+// in order:
+//
+//     {"results": [{"status": 202, "id": 12}, {"status": 404, "error": "..."}]}
+
+const (
+	maxBatchBodySize = 10 << 20
+	maxBatchSize     = 1000
+)
+
+type batchItemJSON struct {
+	Channel        string `json:"channel"`
+	IdempotencyKey string `json:"idempotency_key"`
+	notificationRequestJSON
+}
+
+type batchResultJSON struct {
+	Status    int    `json:"status"`
+	Id        int64  `json:"id,omitempty"`
+	Duplicate bool   `json:"duplicate,omitempty"`
+	Error     string `json:"error,omitempty"`
+}
+
+type batchResponseJSON struct {
+	Results []batchResultJSON `json:"results"`
+}
+
+func isNDJSONRequest(r *http.Request) bool {
+	mediaType, _, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	return err == nil && mediaType == "application/x-ndjson"
+}
+
+// Splits the body into the raw notifications, which are decoded one by one so
+// an invalid one does not fail the others.
+func readBatch(w http.ResponseWriter, r *http.Request) ([]json.RawMessage, error) {
+	body := http.MaxBytesReader(w, r.Body, maxBatchBodySize)
+	items := []json.RawMessage{}
+
+	if isNDJSONRequest(r) {
+		scanner := bufio.NewScanner(body)
+		scanner.Buffer(make([]byte, 64*1024), maxNotificationBodySize)
+		for scanner.Scan() {
+			line := bytes.TrimSpace(scanner.Bytes())
+			if len(line) == 0 {
+				continue
+			}
+
+			items = append(items, json.RawMessage(append([]byte{}, line...)))
+		}
+
+		if err := scanner.Err(); err != nil {
+			return nil, fmt.Errorf("invalid ndjson: %v", err)
+		}
+	} else {
+		err := decodeStrictJSON(body, &items)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if len(items) == 0 {
+		return nil, errors.New("the batch is empty")
+	}
+
+	if len(items) > maxBatchSize {
+		return nil, fmt.Errorf("the batch has more than %d notifications", maxBatchSize)
+	}
+
+	return items, nil
+}
+
+func (a *App) PostNotificationBatchHandler(w http.ResponseWriter, r *http.Request) {
+	origin, permissions, ok := a.authorize(w, r, true)
+	if !ok {
+		return
+	}
+
+	items, err := readBatch(w, r)
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, errorJSON{Error: err.Error()})
+		return
+	}
+
+	results := make([]batchResultJSON, len(items))
+
+	// Only the valid notifications are handed to the backend, queued[i] being
+	// the index of the ith of them in the batch.
+	notifications := make([]backend.Notification, 0, len(items))
+	queued := make([]int, 0, len(items))
+
+	// For the metrics, as far as they are known.
+	channels := make([]string, len(items))
+	priorities := make([]backend.Priority, len(items))
+	countAll := func(status int) {
+		metricChannels := a.metricChannels()
+		for i := range items {
+			itemStatus := status
+			if results[i].Status != 0 {
+				itemStatus = results[i].Status
+			}
+			countReceived(metricChannels, channels[i], origin, priorities[i], itemStatus)
+		}
+	}
+
+	for i, item := range items {
+		var request batchItemJSON
+		err := decodeStrictJSON(bytes.NewReader(item), &request)
+		channels[i] = request.Channel
+		if err == nil && request.Channel == "" {
+			err = errors.New("channel is required")
+		}
+
+		if err == nil {
+			err = validateIdempotencyKey(request.IdempotencyKey)
+		}
+
+		var notification backend.Notification
+		if err == nil {
+			notification, err = request.toNotification(request.Channel, origin)
+			notification.IdempotencyKey = request.IdempotencyKey
+		}
+
+		if err != nil {
+			results[i] = batchResultJSON{Status: http.StatusBadRequest, Error: err.Error()}
+			continue
+		}
+		priorities[i] = notification.Priority
+
+		err = permissions.checkNotification(&notification)
+		if err != nil {
+			results[i] = batchResultJSON{Status: http.StatusForbidden, Error: err.Error()}
+			continue
+		}
+
+		// The retries of notifications that were already queued are answered
+		// right away and do not count against the rate limits.
+		if notification.IdempotencyKey != "" {
+			id, err := a.backend.FindIdempotentNotification(origin, notification.IdempotencyKey)
+			if err != nil {
+				results[i] = batchResultJSON{Status: http.StatusInternalServerError, Error: err.Error()}
+				continue
+			}
+
+			if id != 0 {
+				results[i] = batchResultJSON{Status: http.StatusAccepted, Id: id, Duplicate: true}
+				continue
+			}
+		}
+
+		notifications = append(notifications, notification)
+		queued = append(queued, i)
+	}
+
+	// The whole batch counts against the limit of the origin, but only the
+	// notifications to the channels over their limit are refused.
+	if len(notifications) > 0 {
+		err := a.checkOriginRateLimit(origin, len(notifications))
+		if err != nil {
+			countAll(http.StatusTooManyRequests)
+			writeRateLimited(w, true, err.(RateLimited))
+			return
+		}
+
+		allowed := notifications[:0]
+		allowedIndexes := queued[:0]
+		for j, notification := range notifications {
+			err := a.checkChannelRateLimit(notification)
+			if err != nil {
+				results[queued[j]] = batchResultJSON{Status: http.StatusTooManyRequests, Error: err.Error()}
+				continue
+			}
+
+			allowed = append(allowed, notification)
+			allowedIndexes = append(allowedIndexes, queued[j])
+		}
+
+		notifications = allowed
+		queued = allowedIndexes
+	}
+
+	if len(notifications) > 0 {
+		queueResults, err := a.backend.QueueNotifications(notifications)
+		if err != nil {
+			logger.WithField("error", err).Error("failed to queue notifications")
+			countAll(http.StatusInternalServerError)
+			writeJSON(w, http.StatusInternalServerError, errorJSON{Error: "failed to queue notifications"})
+			return
+		}
+
+		for j, result := range queueResults {
+			i := queued[j]
+			switch result.Error.(type) {
+			case nil:
+				results[i] = batchResultJSON{Status: http.StatusAccepted, Id: result.Id, Duplicate: result.Duplicate}
+			case backend.ChannelNotFound:
+				results[i] = batchResultJSON{Status: http.StatusNotFound, Error: result.Error.Error()}
+			default:
+				results[i] = batchResultJSON{Status: http.StatusInternalServerError, Error: result.Error.Error()}
+			}
+		}
+	}
+
+	countAll(http.StatusOK)
+	writeJSON(w, http.StatusOK, batchResponseJSON{Results: results})
+}
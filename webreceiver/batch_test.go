@@ -0,0 +1,119 @@
+package webreceiver
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+
+	"gitlab.com/shuhao/towncrier/backend"
+
+	. "gopkg.in/check.v1"
+)
+
+func (s *WebReceiverAppSuite) postBatch(c *C, contentType, body string) (int, batchResponseJSON) {
+	req, err := http.NewRequest("POST", s.url("/receiver/notifications/batch"), bytes.NewBufferString(body))
+	c.Assert(err, IsNil)
+	req.Header.Add("Authorization", "Token token=abc")
+	req.Header.Add("Content-Type", contentType)
+
+	resp, err := http.DefaultClient.Do(req)
+	c.Assert(err, IsNil)
+	defer resp.Body.Close()
+
+	var response batchResponseJSON
+	if resp.StatusCode == http.StatusOK {
+		c.Assert(json.NewDecoder(resp.Body).Decode(&response), IsNil)
+	}
+
+	return resp.StatusCode, response
+}
+
+func (s *WebReceiverAppSuite) TestPostNotificationBatch(c *C) {
+	status, response := s.postBatch(c, "application/json", `[
+		{"channel": "Channel2", "subject": "first", "tags": ["disk"]},
+		{"channel": "InvalidChannel", "subject": "second"},
+		{"channel": "Channel2", "subject": "third", "priority": "whenever"},
+		{"subject": "fourth"},
+		{"channel": "Channel2", "subject": "fifth", "priority": "low"}
+	]`)
+	c.Assert(status, Equals, http.StatusOK)
+	c.Assert(response.Results, HasLen, 5)
+
+	c.Assert(response.Results[0].Status, Equals, http.StatusAccepted)
+	c.Assert(response.Results[0].Id, Not(Equals), int64(0))
+	c.Assert(response.Results[1], DeepEquals, batchResultJSON{Status: http.StatusNotFound, Error: "channel 'InvalidChannel' not found"})
+	c.Assert(response.Results[2], DeepEquals, batchResultJSON{Status: http.StatusBadRequest, Error: "unknown priority 'whenever'"})
+	c.Assert(response.Results[3], DeepEquals, batchResultJSON{Status: http.StatusBadRequest, Error: "channel is required"})
+	c.Assert(response.Results[4].Status, Equals, http.StatusAccepted)
+
+	notification, err := s.backend.GetNotification(response.Results[0].Id)
+	c.Assert(err, IsNil)
+	c.Assert(notification.Subject, Equals, "first")
+	c.Assert(notification.Tags, DeepEquals, []string{"disk"})
+	c.Assert(notification.Origin, Equals, "abc_client")
+
+	notification, err = s.backend.GetNotification(response.Results[4].Id)
+	c.Assert(err, IsNil)
+	c.Assert(notification.Subject, Equals, "fifth")
+	c.Assert(notification.Priority, Equals, backend.LowPriority)
+
+	notifications, err := s.backend.QueryNotifications(backend.NotificationQuery{})
+	c.Assert(err, IsNil)
+	c.Assert(notifications, HasLen, 2)
+}
+
+func (s *WebReceiverAppSuite) TestPostNotificationBatchNDJSON(c *C) {
+	status, response := s.postBatch(c, "application/x-ndjson", `{"channel": "Channel2", "subject": "first"}
+
+{"channel": "Channel2", "subject": "second", "unknown": true}
+not json
+{"channel": "Channel2", "subject": "third"}
+`)
+	c.Assert(status, Equals, http.StatusOK)
+	c.Assert(response.Results, HasLen, 4)
+	c.Assert(response.Results[0].Status, Equals, http.StatusAccepted)
+	c.Assert(response.Results[1].Status, Equals, http.StatusBadRequest)
+	c.Assert(response.Results[2].Status, Equals, http.StatusBadRequest)
+	c.Assert(response.Results[3].Status, Equals, http.StatusAccepted)
+
+	notifications, err := s.backend.QueryNotifications(backend.NotificationQuery{})
+	c.Assert(err, IsNil)
+	c.Assert(notifications, HasLen, 2)
+	c.Assert(notifications[0].Subject, Equals, "third")
+	c.Assert(notifications[1].Subject, Equals, "first")
+}
+
+func (s *WebReceiverAppSuite) TestPostNotificationBatchInvalid(c *C) {
+	for _, body := range []string{
+		``,
+		`[]`,
+		`{"channel": "Channel2", "subject": "first"}`,
+		`[{"channel": "Channel2", "subject": "first"}] []`,
+	} {
+		status, _ := s.postBatch(c, "application/json", body)
+		c.Assert(status, Equals, http.StatusBadRequest, Commentf(body))
+	}
+
+	status, _ := s.postBatch(c, "application/x-ndjson", "\n\n")
+	c.Assert(status, Equals, http.StatusBadRequest)
+}
+
+func (s *WebReceiverAppSuite) TestPostNotificationBatchNotAuthenticated(c *C) {
+	resp, err := http.Post(s.url("/receiver/notifications/batch"), "application/json", bytes.NewBufferString(`[{"channel": "Channel2", "subject": "first"}]`))
+	c.Assert(err, IsNil)
+	c.Assert(resp.StatusCode, Equals, http.StatusForbidden)
+}
+
+func (s *WebReceiverAppSuite) TestPostNotificationBatchIdempotencyKey(c *C) {
+	status, response := s.postBatch(c, "application/json", `[
+		{"channel": "Channel2", "subject": "first", "idempotency_key": "key"},
+		{"channel": "Channel2", "subject": "first", "idempotency_key": "key"}
+	]`)
+	c.Assert(status, Equals, http.StatusOK)
+	c.Assert(response.Results[0].Duplicate, Equals, false)
+	c.Assert(response.Results[1], DeepEquals, batchResultJSON{Status: http.StatusAccepted, Id: response.Results[0].Id, Duplicate: true})
+
+	notifications, err := s.backend.QueryNotifications(backend.NotificationQuery{})
+	c.Assert(err, IsNil)
+	c.Assert(notifications, HasLen, 1)
+}
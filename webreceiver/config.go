@@ -3,6 +3,27 @@ package webreceiver
 type ReceiverConfig struct {
 	ListenHost string
 	ListenPort int
-	PathPrefix string            // Without the trailing slash
-	Tokens     map[string]string // api token => origin name
+	PathPrefix string                 // Without the trailing slash
+	Tokens     map[string]TokenConfig // api token => its origin and permissions
+
+	// Origin name => secret, for the clients that sign their requests instead
+	// of sending a token. See signature.go.
+	SigningSecrets map[string]string
+
+	// Origin name => the permissions of its signed requests, which are not
+	// restricted if the origin is not in there.
+	SigningPermissions map[string]TokenPermissions
+
+	// How far the timestamp of a signed request can be from the time of the
+	// receiver. Defaults to 5 minutes.
+	SignatureMaxSkewSeconds int64
+
+	// Limits of the notifications posted, by origin name and by channel name.
+	// See ratelimit.go.
+	OriginRateLimits  map[string]RateLimit
+	ChannelRateLimits map[string]RateLimit
+
+	// The addresses, as IPs or CIDRs, that can get the metrics at /metrics.
+	// Anyone can if it is empty.
+	MetricsAllowedIPs []string
 }
@@ -0,0 +1,54 @@
+package webreceiver
+
+import (
+	"net/http"
+
+	"gitlab.com/shuhao/towncrier/backend"
+)
+
+// /healthz tells supervisors whether the process should be restarted, and
+// /readyz tells load balancers whether it should be sent notifications. Both
+// answer 503 if any of their checks is failing, but not if they are only
+// degraded. Like the metrics, they are not authenticated.
+
+type healthCheckJSON struct {
+	Name    string `json:"name"`
+	Status  string `json:"status"`
+	Message string `json:"message"`
+}
+
+type healthJSON struct {
+	Status string            `json:"status"`
+	Checks []healthCheckJSON `json:"checks"`
+}
+
+func writeHealth(w http.ResponseWriter, checks []backend.HealthCheck) {
+	body := healthJSON{
+		Status: string(backend.WorstHealthStatus(checks)),
+		Checks: make([]healthCheckJSON, len(checks)),
+	}
+
+	for i, check := range checks {
+		body.Checks[i] = healthCheckJSON{
+			Name:    check.Name,
+			Status:  string(check.Status),
+			Message: check.Message,
+		}
+	}
+
+	status := http.StatusOK
+	if body.Status == string(backend.HealthFailing) {
+		status = http.StatusServiceUnavailable
+	}
+
+	w.Header().Set("Cache-Control", "no-store")
+	writeJSON(w, status, body)
+}
+
+func (a *App) HealthzHandler(w http.ResponseWriter, r *http.Request) {
+	writeHealth(w, a.backend.CheckLiveness())
+}
+
+func (a *App) ReadyzHandler(w http.ResponseWriter, r *http.Request) {
+	writeHealth(w, a.backend.CheckReadiness())
+}
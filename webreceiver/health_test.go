@@ -0,0 +1,75 @@
+package webreceiver
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"gitlab.com/shuhao/towncrier/backend"
+
+	. "gopkg.in/check.v1"
+)
+
+func (s *WebReceiverAppSuite) getHealth(c *C, path string) (int, healthJSON) {
+	resp, err := http.Get(s.url(path))
+	c.Assert(err, IsNil)
+	defer resp.Body.Close()
+
+	c.Assert(resp.Header.Get("Content-Type"), Equals, "application/json; charset=utf-8")
+
+	var body healthJSON
+	c.Assert(json.NewDecoder(resp.Body).Decode(&body), IsNil)
+	return resp.StatusCode, body
+}
+
+func (s *WebReceiverAppSuite) TestHealthz(c *C) {
+	status, body := s.getHealth(c, "/healthz")
+	c.Assert(status, Equals, http.StatusOK)
+	c.Assert(body.Status, Equals, "ok")
+	c.Assert(len(body.Checks) > 0, Equals, true)
+
+	for _, check := range body.Checks {
+		c.Assert(check.Status, Equals, "ok", Commentf("%v", check))
+	}
+}
+
+func (s *WebReceiverAppSuite) TestReadyz(c *C) {
+	status, body := s.getHealth(c, "/readyz")
+	c.Assert(status, Equals, http.StatusOK)
+	c.Assert(body.Status, Equals, "ok")
+
+	names := make([]string, 0, len(body.Checks))
+	for _, check := range body.Checks {
+		names = append(names, check.Name)
+	}
+	c.Assert(names[:4], DeepEquals, []string{"started", "database", "config", "notifiers"})
+}
+
+func (s *WebReceiverAppSuite) TestReadyzDegraded(c *C) {
+	backend.ClearAllNotifiers()
+
+	status, body := s.getHealth(c, "/readyz")
+	c.Assert(status, Equals, http.StatusOK)
+	c.Assert(body.Status, Equals, "degraded")
+	c.Assert(body.Checks[3], DeepEquals, healthCheckJSON{
+		Name:    "notifiers",
+		Status:  "degraded",
+		Message: "not registered: 'testnotify' of channel 'Channel1', 'testnotify' of channel 'Channel2'",
+	})
+}
+
+func (s *WebReceiverAppSuite) TestReadyzFailing(c *C) {
+	c.Assert(s.backend.Db.Close(), IsNil)
+
+	status, body := s.getHealth(c, "/readyz")
+	c.Assert(status, Equals, http.StatusServiceUnavailable)
+	c.Assert(body.Status, Equals, "failing")
+	c.Assert(body.Checks[1], DeepEquals, healthCheckJSON{
+		Name:    "database",
+		Status:  "failing",
+		Message: "sql: database is closed",
+	})
+
+	// The process does not need to be restarted for it.
+	status, _ = s.getHealth(c, "/healthz")
+	c.Assert(status, Equals, http.StatusOK)
+}
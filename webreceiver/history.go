@@ -0,0 +1,240 @@
+package webreceiver
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"gitlab.com/shuhao/towncrier/backend"
+
+	"github.com/gorilla/mux"
+)
+
+const (
+	defaultHistoryLimit = 50
+	maxHistoryLimit     = 500
+)
+
+type notificationJSON struct {
+	Id        int64             `json:"id"`
+	Channel   string            `json:"channel"`
+	Subject   string            `json:"subject"`
+	Content   string            `json:"content"`
+	Origin    string            `json:"origin"`
+	Tags      []string          `json:"tags"`
+	Labels    map[string]string `json:"labels"`
+	Priority  string            `json:"priority"`
+	Delivered bool              `json:"delivered"`
+	SendAt    string            `json:"send_at,omitempty"` // RFC3339
+	CreatedAt string            `json:"created_at"`        // RFC3339
+	UpdatedAt string            `json:"updated_at"`        // RFC3339
+}
+
+func newNotificationJSON(n *backend.StoredNotification) notificationJSON {
+	tags := n.Tags
+	if tags == nil {
+		tags = []string{}
+	}
+
+	labels := n.Labels
+	if labels == nil {
+		labels = map[string]string{}
+	}
+
+	j := notificationJSON{
+		Id:        n.Id,
+		Channel:   n.Channel,
+		Subject:   n.Subject,
+		Content:   n.Content,
+		Origin:    n.Origin,
+		Tags:      tags,
+		Labels:    labels,
+		Priority:  n.Priority.String(),
+		Delivered: n.Delivered,
+		CreatedAt: time.Unix(0, n.CreatedAt).UTC().Format(time.RFC3339Nano),
+		UpdatedAt: time.Unix(0, n.UpdatedAt).UTC().Format(time.RFC3339Nano),
+	}
+
+	if n.SendAt != 0 {
+		j.SendAt = time.Unix(0, n.SendAt).UTC().Format(time.RFC3339Nano)
+	}
+
+	return j
+}
+
+type notificationsPageJSON struct {
+	Notifications []notificationJSON `json:"notifications"`
+
+	// Pass as the cursor parameter to get the next page. Not set on the last
+	// page.
+	NextCursor string `json:"next_cursor,omitempty"`
+}
+
+type errorJSON struct {
+	Error string `json:"error"`
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(status)
+
+	err := json.NewEncoder(w).Encode(v)
+	if err != nil {
+		logger.WithField("error", err).Error("failed to write json response")
+	}
+}
+
+// Parses the query parameters of GET /notifications:
+//
+// - channel, origin, tag: exact match
+// - priority: low, normal or urgent
+// - delivered: true or false
+// - since, until: RFC3339 times, on when the notification was received
+// - limit: the page size, up to maxHistoryLimit
+// - cursor: the next_cursor of the previous page
+func parseNotificationQuery(r *http.Request) (backend.NotificationQuery, error) {
+	params := r.URL.Query()
+	query := backend.NotificationQuery{
+		Channel: params.Get("channel"),
+		Origin:  params.Get("origin"),
+		Tag:     params.Get("tag"),
+		Limit:   defaultHistoryLimit,
+	}
+
+	if v := params.Get("priority"); v != "" {
+		priority, found := backend.PriorityMap[v]
+		if !found {
+			return query, fmt.Errorf("unknown priority '%s'", v)
+		}
+		query.Priority = priority
+	}
+
+	if v := params.Get("delivered"); v != "" {
+		delivered, err := strconv.ParseBool(v)
+		if err != nil {
+			return query, fmt.Errorf("delivered must be true or false")
+		}
+		query.Delivered = &delivered
+	}
+
+	for name, field := range map[string]*int64{"since": &query.Since, "until": &query.Until} {
+		v := params.Get(name)
+		if v == "" {
+			continue
+		}
+
+		t, err := time.Parse(time.RFC3339, v)
+		if err != nil {
+			return query, fmt.Errorf("%s must be an RFC3339 time", name)
+		}
+		*field = t.UnixNano()
+	}
+
+	if v := params.Get("limit"); v != "" {
+		limit, err := strconv.Atoi(v)
+		if err != nil || limit <= 0 || limit > maxHistoryLimit {
+			return query, fmt.Errorf("limit must be between 1 and %d", maxHistoryLimit)
+		}
+		query.Limit = limit
+	}
+
+	if v := params.Get("cursor"); v != "" {
+		beforeId, err := strconv.ParseInt(v, 10, 64)
+		if err != nil || beforeId <= 0 {
+			return query, fmt.Errorf("invalid cursor")
+		}
+		query.BeforeId = beforeId
+	}
+
+	return query, nil
+}
+
+// A token restricted to some channels only sees the notifications of those
+// channels, which excludes the ones of channels no longer configured.
+func (a *App) GetNotificationsHandler(w http.ResponseWriter, r *http.Request) {
+	_, permissions, ok := a.authorize(w, r, true)
+	if !ok {
+		return
+	}
+
+	query, err := parseNotificationQuery(r)
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, errorJSON{Error: err.Error()})
+		return
+	}
+
+	page := notificationsPageJSON{
+		Notifications: []notificationJSON{},
+	}
+
+	if query.Channel != "" {
+		if !permissions.canUseChannel(query.Channel) {
+			writePermissionDenied(w, true, PermissionDenied{Reason: fmt.Sprintf("cannot read channel '%s'", query.Channel)})
+			return
+		}
+	} else {
+		query.Channels = permissions.usableChannels(a.backend.ListChannels())
+		if query.Channels != nil && len(query.Channels) == 0 {
+			writeJSON(w, http.StatusOK, page)
+			return
+		}
+	}
+
+	// One more than asked tells us if there is a next page.
+	limit := query.Limit
+	query.Limit++
+
+	notifications, err := a.backend.QueryNotifications(query)
+	if err != nil {
+		logger.WithField("error", err).Error("failed to query notifications")
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	if len(notifications) > limit {
+		notifications = notifications[:limit]
+		page.NextCursor = strconv.FormatInt(notifications[limit-1].Id, 10)
+	}
+
+	for _, n := range notifications {
+		page.Notifications = append(page.Notifications, newNotificationJSON(n))
+	}
+
+	writeJSON(w, http.StatusOK, page)
+}
+
+// The notifications of channels the token cannot use are not found, so their
+// ids are not confirmed either.
+func (a *App) GetNotificationHandler(w http.ResponseWriter, r *http.Request) {
+	_, permissions, ok := a.authorize(w, r, true)
+	if !ok {
+		return
+	}
+
+	id, err := strconv.ParseInt(mux.Vars(r)["id"], 10, 64)
+	if err != nil {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	notification, err := a.backend.GetNotification(id)
+	if err != nil {
+		if _, ok := err.(backend.NotificationNotFound); ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+
+		logger.WithField("error", err).Error("failed to get notification")
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	if !permissions.canUseChannel(notification.Channel) {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, newNotificationJSON(notification))
+}
@@ -0,0 +1,195 @@
+package webreceiver
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+
+	"gitlab.com/shuhao/towncrier/backend"
+
+	. "gopkg.in/check.v1"
+)
+
+func (s *WebReceiverAppSuite) get(path, token string) (*http.Response, error) {
+	req, err := http.NewRequest("GET", s.url(path), nil)
+	if err != nil {
+		return nil, err
+	}
+
+	if token != "" {
+		req.Header.Add("Authorization", "Token token="+token)
+	}
+
+	return http.DefaultClient.Do(req)
+}
+
+func (s *WebReceiverAppSuite) getNotifications(c *C, path string) notificationsPageJSON {
+	resp, err := s.get(path, "abc")
+	c.Assert(err, IsNil)
+	defer resp.Body.Close()
+	c.Assert(resp.StatusCode, Equals, http.StatusOK)
+	c.Assert(resp.Header.Get("Content-Type"), Equals, "application/json; charset=utf-8")
+
+	var page notificationsPageJSON
+	c.Assert(json.NewDecoder(resp.Body).Decode(&page), IsNil)
+	return page
+}
+
+func (s *WebReceiverAppSuite) queueNotifications(c *C) {
+	for _, n := range []backend.Notification{
+		{Channel: "Channel2", Subject: "first", Origin: "abc_client", Tags: []string{"db"}, Priority: backend.NormalPriority},
+		{Channel: "Channel2", Subject: "second", Origin: "other_client", Tags: []string{"web", "db"}, Priority: backend.UrgentPriority},
+		{Channel: "Channel2", Subject: "third", Origin: "abc_client", Priority: backend.LowPriority},
+	} {
+		c.Assert(s.backend.QueueNotification(n), IsNil)
+	}
+}
+
+func (s *WebReceiverAppSuite) TestGetNotificationsNotAuthenticated(c *C) {
+	resp, err := s.get("/receiver/notifications", "invalid-token")
+	c.Assert(err, IsNil)
+	c.Assert(resp.StatusCode, Equals, http.StatusForbidden)
+
+	resp, err = s.get("/receiver/notifications/1", "")
+	c.Assert(err, IsNil)
+	c.Assert(resp.StatusCode, Equals, http.StatusForbidden)
+}
+
+func (s *WebReceiverAppSuite) TestGetNotifications(c *C) {
+	s.queueNotifications(c)
+
+	page := s.getNotifications(c, "/receiver/notifications")
+	c.Assert(page.NextCursor, Equals, "")
+	c.Assert(page.Notifications, HasLen, 3)
+	c.Assert(page.Notifications[0].Subject, Equals, "third")
+	c.Assert(page.Notifications[0].Tags, DeepEquals, []string{})
+	c.Assert(page.Notifications[0].Priority, Equals, "low")
+	c.Assert(page.Notifications[0].Delivered, Equals, false)
+	c.Assert(page.Notifications[1].Subject, Equals, "second")
+	c.Assert(page.Notifications[1].Tags, DeepEquals, []string{"web", "db"})
+	c.Assert(page.Notifications[2].Subject, Equals, "first")
+	c.Assert(page.Notifications[2].Channel, Equals, "Channel2")
+	c.Assert(page.Notifications[2].Origin, Equals, "abc_client")
+
+	page = s.getNotifications(c, "/receiver/notifications?origin=abc_client&tag=db")
+	c.Assert(page.Notifications, HasLen, 1)
+	c.Assert(page.Notifications[0].Subject, Equals, "first")
+
+	page = s.getNotifications(c, "/receiver/notifications?priority=urgent")
+	c.Assert(page.Notifications, HasLen, 1)
+	c.Assert(page.Notifications[0].Subject, Equals, "second")
+
+	page = s.getNotifications(c, "/receiver/notifications?priority=low&delivered=false")
+	c.Assert(page.Notifications, HasLen, 1)
+	c.Assert(page.Notifications[0].Subject, Equals, "third")
+
+	page = s.getNotifications(c, "/receiver/notifications?channel=Channel1")
+	c.Assert(page.Notifications, HasLen, 0)
+
+	page = s.getNotifications(c, "/receiver/notifications?since=2000-01-01T00:00:00Z&until=2001-01-01T00:00:00Z")
+	c.Assert(page.Notifications, HasLen, 0)
+}
+
+func (s *WebReceiverAppSuite) TestGetNotificationsPaginates(c *C) {
+	s.queueNotifications(c)
+
+	subjects := []string{}
+	path := "/receiver/notifications?limit=2"
+	for pages := 0; ; pages++ {
+		c.Assert(pages < 3, Equals, true)
+
+		page := s.getNotifications(c, path)
+		for _, n := range page.Notifications {
+			subjects = append(subjects, n.Subject)
+		}
+
+		if page.NextCursor == "" {
+			break
+		}
+		path = "/receiver/notifications?limit=2&cursor=" + page.NextCursor
+	}
+
+	c.Assert(subjects, DeepEquals, []string{"third", "second", "first"})
+}
+
+func (s *WebReceiverAppSuite) TestGetNotificationsBadParameters(c *C) {
+	for _, query := range []string{
+		"priority=whatever",
+		"delivered=maybe",
+		"since=yesterday",
+		"limit=0",
+		"limit=501",
+		"cursor=abc",
+	} {
+		resp, err := s.get("/receiver/notifications?"+query, "abc")
+		c.Assert(err, IsNil)
+		c.Assert(resp.StatusCode, Equals, http.StatusBadRequest, Commentf(query))
+
+		var body errorJSON
+		c.Assert(json.NewDecoder(resp.Body).Decode(&body), IsNil)
+		c.Assert(body.Error, Not(Equals), "")
+		resp.Body.Close()
+	}
+}
+
+func (s *WebReceiverAppSuite) TestGetNotification(c *C) {
+	s.queueNotifications(c)
+
+	page := s.getNotifications(c, "/receiver/notifications?limit=1")
+	c.Assert(page.Notifications, HasLen, 1)
+
+	id := page.Notifications[0].Id
+	resp, err := s.get("/receiver/notifications/"+strconv.FormatInt(id, 10), "abc")
+	c.Assert(err, IsNil)
+	defer resp.Body.Close()
+	c.Assert(resp.StatusCode, Equals, http.StatusOK)
+
+	var notification notificationJSON
+	c.Assert(json.NewDecoder(resp.Body).Decode(&notification), IsNil)
+	c.Assert(notification, DeepEquals, page.Notifications[0])
+
+	resp, err = s.get("/receiver/notifications/123456", "abc")
+	c.Assert(err, IsNil)
+	c.Assert(resp.StatusCode, Equals, http.StatusNotFound)
+}
+
+func (s *WebReceiverAppSuite) TestGetNotificationsOfUsableChannelsOnly(c *C) {
+	s.queueNotifications(c)
+	c.Assert(s.backend.QueueNotification(backend.Notification{Channel: "Channel1", Subject: "elsewhere", Priority: backend.NormalPriority}), IsNil)
+
+	resp, err := s.get("/receiver/notifications", "restricted")
+	c.Assert(err, IsNil)
+	c.Assert(resp.StatusCode, Equals, http.StatusOK)
+
+	var page notificationsPageJSON
+	c.Assert(json.NewDecoder(resp.Body).Decode(&page), IsNil)
+	resp.Body.Close()
+	c.Assert(page.Notifications, HasLen, 3)
+	for _, n := range page.Notifications {
+		c.Assert(n.Channel, Equals, "Channel2")
+	}
+
+	resp, err = s.get("/receiver/notifications?channel=Channel1", "restricted")
+	c.Assert(err, IsNil)
+	c.Assert(resp.StatusCode, Equals, http.StatusForbidden)
+
+	var body errorJSON
+	c.Assert(json.NewDecoder(resp.Body).Decode(&body), IsNil)
+	resp.Body.Close()
+	c.Assert(body.Error, Equals, "permission denied: cannot read channel 'Channel1'")
+
+	// The unrestricted token sees everything.
+	page = s.getNotifications(c, "/receiver/notifications")
+	c.Assert(page.Notifications, HasLen, 4)
+	c.Assert(page.Notifications[0].Subject, Equals, "elsewhere")
+
+	resp, err = s.get("/receiver/notifications/"+strconv.FormatInt(page.Notifications[0].Id, 10), "restricted")
+	c.Assert(err, IsNil)
+	resp.Body.Close()
+	c.Assert(resp.StatusCode, Equals, http.StatusNotFound)
+
+	resp, err = s.get("/receiver/notifications/"+strconv.FormatInt(page.Notifications[1].Id, 10), "restricted")
+	c.Assert(err, IsNil)
+	resp.Body.Close()
+	c.Assert(resp.StatusCode, Equals, http.StatusOK)
+}
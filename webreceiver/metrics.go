@@ -0,0 +1,71 @@
+package webreceiver
+
+import (
+	"net/http"
+	"strconv"
+
+	"gitlab.com/shuhao/towncrier/backend"
+	"gitlab.com/shuhao/towncrier/metrics"
+)
+
+var notificationsReceived = metrics.NewCounterVec(
+	"towncrier_notifications_received_total",
+	"Notifications posted to the receiver, by the status they were answered with.",
+	"channel", "origin", "priority", "code",
+)
+
+// What the channel and origin are counted as when they are not the ones of the
+// config, as anyone can post to any name and each would get its own series.
+const unknownMetricLabel = "unknown"
+
+// The channels counted under their own name.
+func (a *App) metricChannels() map[string]bool {
+	channels := make(map[string]bool)
+	for _, channel := range a.backend.ListChannels() {
+		channels[channel.Name] = true
+	}
+
+	return channels
+}
+
+// The origin is empty if the request was not authenticated, in which case the
+// channel is not counted either. The priority is left empty if the
+// notification could not be read.
+func countReceived(channels map[string]bool, channel, origin string, priority backend.Priority, status int) {
+	if origin == "" || !channels[channel] {
+		channel = unknownMetricLabel
+	}
+
+	if origin == "" {
+		origin = unknownMetricLabel
+	}
+
+	priorityName := ""
+	if priority != 0 {
+		priorityName = priority.String()
+	}
+
+	notificationsReceived.Inc(channel, origin, priorityName, strconv.Itoa(status))
+}
+
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (r *statusRecorder) WriteHeader(status int) {
+	r.status = status
+	r.ResponseWriter.WriteHeader(status)
+}
+
+// Metrics are not authenticated, as Prometheus does not send tokens, but they
+// can be limited to the addresses in MetricsAllowedIPs.
+func (a *App) MetricsHandler(w http.ResponseWriter, r *http.Request) {
+	err := TokenPermissions{AllowedIPs: a.config.MetricsAllowedIPs}.checkSource(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusForbidden)
+		return
+	}
+
+	metrics.Handler().ServeHTTP(w, r)
+}
@@ -0,0 +1,103 @@
+package webreceiver
+
+import (
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"time"
+
+	"gitlab.com/shuhao/towncrier/testhelpers"
+
+	. "gopkg.in/check.v1"
+)
+
+func (s *WebReceiverAppSuite) TestMetrics(c *C) {
+	accepted := notificationsReceived.Value("Channel2", "abc_client", "normal", "202")
+	batchAccepted := notificationsReceived.Value("Channel2", "abc_client", "urgent", "202")
+	notFound := notificationsReceived.Value("unknown", "abc_client", "normal", "404")
+	batchInvalid := notificationsReceived.Value("Channel2", "abc_client", "", "400")
+
+	resp, err := s.postNotification("Channel2", "abc", "subject", "content", "", "normal")
+	c.Assert(err, IsNil)
+	c.Assert(resp.StatusCode, Equals, http.StatusAccepted)
+
+	resp, err = s.postNotification("InvalidChannel", "abc", "subject", "content", "", "normal")
+	c.Assert(err, IsNil)
+	c.Assert(resp.StatusCode, Equals, http.StatusNotFound)
+
+	status, _ := s.postBatch(c, "application/json", `[{"channel": "Channel2", "subject": "subject", "priority": "urgent"}, {"channel": "Channel2"}]`)
+	c.Assert(status, Equals, http.StatusOK)
+
+	c.Assert(notificationsReceived.Value("Channel2", "abc_client", "normal", "202"), Equals, accepted+1)
+	c.Assert(notificationsReceived.Value("Channel2", "abc_client", "urgent", "202"), Equals, batchAccepted+1)
+	c.Assert(notificationsReceived.Value("unknown", "abc_client", "normal", "404"), Equals, notFound+1)
+	c.Assert(notificationsReceived.Value("Channel2", "abc_client", "", "400"), Equals, batchInvalid+1)
+
+	// Channel2 is sent daily, so only the urgent notification is delivered.
+	timedout := testhelpers.BlockUntilSatisfiedOrTimeout(func() bool {
+		delivered, err := s.backend.SelectInt("SELECT COUNT(*) FROM notifications WHERE Channel = ? AND Delivered = ?", "Channel2", true)
+		return err == nil && delivered == 1
+	}, 5*time.Second)
+	c.Assert(timedout, Equals, false)
+
+	resp, err = http.Get(s.url("/metrics"))
+	c.Assert(err, IsNil)
+	defer resp.Body.Close()
+	c.Assert(resp.StatusCode, Equals, http.StatusOK)
+
+	body, err := ioutil.ReadAll(resp.Body)
+	c.Assert(err, IsNil)
+	for _, line := range []string{
+		"# TYPE towncrier_notifications_received_total counter",
+		`towncrier_notifications_received_total{channel="unknown",origin="abc_client",priority="normal",code="404"}`,
+		"# TYPE towncrier_backend_insert_duration_seconds histogram",
+		`towncrier_undelivered_notifications{channel="Channel2"} 1` + "\n",
+	} {
+		c.Assert(strings.Contains(string(body), line), Equals, true, Commentf(line))
+	}
+}
+
+func (s *WebReceiverAppSuite) TestMetricsOnlyCountKnownNames(c *C) {
+	notAuthenticated := notificationsReceived.Value("unknown", "unknown", "", "403")
+	notFound := notificationsReceived.Value("unknown", "abc_client", "normal", "404")
+
+	resp, err := s.postNotification("MadeUpChannel1", "madeuptoken", "subject", "content", "", "normal")
+	c.Assert(err, IsNil)
+	c.Assert(resp.StatusCode, Equals, http.StatusForbidden)
+
+	resp, err = s.postNotification("MadeUpChannel2", "abc", "subject", "content", "", "normal")
+	c.Assert(err, IsNil)
+	c.Assert(resp.StatusCode, Equals, http.StatusNotFound)
+
+	status, response := s.postBatch(c, "application/json", `[{"channel": "MadeUpChannel3", "subject": "subject"}]`)
+	c.Assert(status, Equals, http.StatusOK)
+	c.Assert(response.Results[0].Status, Equals, http.StatusNotFound)
+
+	c.Assert(notificationsReceived.Value("unknown", "unknown", "", "403"), Equals, notAuthenticated+1)
+	c.Assert(notificationsReceived.Value("unknown", "abc_client", "normal", "404"), Equals, notFound+2)
+
+	resp, err = http.Get(s.url("/metrics"))
+	c.Assert(err, IsNil)
+	defer resp.Body.Close()
+
+	body, err := ioutil.ReadAll(resp.Body)
+	c.Assert(err, IsNil)
+	c.Assert(strings.Contains(string(body), "MadeUpChannel"), Equals, false)
+	c.Assert(strings.Contains(string(body), "madeuptoken"), Equals, false)
+}
+
+func (s *WebReceiverAppSuite) TestMetricsAllowedIPs(c *C) {
+	s.app.config.MetricsAllowedIPs = []string{"10.0.0.0/8"}
+
+	resp, err := http.Get(s.url("/metrics"))
+	c.Assert(err, IsNil)
+	resp.Body.Close()
+	c.Assert(resp.StatusCode, Equals, http.StatusForbidden)
+
+	s.app.config.MetricsAllowedIPs = []string{"127.0.0.1"}
+
+	resp, err = http.Get(s.url("/metrics"))
+	c.Assert(err, IsNil)
+	resp.Body.Close()
+	c.Assert(resp.StatusCode, Equals, http.StatusOK)
+}
@@ -0,0 +1,122 @@
+package webreceiver
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"strings"
+	"time"
+
+	"gitlab.com/shuhao/towncrier/backend"
+)
+
+// Notifications can be posted as JSON instead of with the X-Towncrier headers:
+//
+//     {
+//       "subject": "Disk almost full",
+//       "content": "/ is at 95%",
+//       "tags": ["disk"],
+//       "priority": "urgent",
+//       "labels": {"host": "db1"},
+//       "send_at": "2015-10-10T09:00:00Z"
+//     }
+//
+// Only the subject is required. Unlike the headers, the fields are validated
+// strictly: anything unknown or invalid is rejected with a JSON error.
+
+const maxNotificationBodySize = 1 << 20
+
+type notificationRequestJSON struct {
+	Subject  string            `json:"subject"`
+	Content  string            `json:"content"`
+	Tags     []string          `json:"tags"`
+	Priority string            `json:"priority"`
+	Labels   map[string]string `json:"labels"`
+	SendAt   string            `json:"send_at"` // RFC3339
+}
+
+// The response to the notifications posted as JSON.
+type queuedJSON struct {
+	Id int64 `json:"id"`
+}
+
+func isJSONRequest(r *http.Request) bool {
+	mediaType, _, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	return err == nil && mediaType == "application/json"
+}
+
+// Decodes exactly one JSON value from the reader, rejecting unknown fields.
+func decodeStrictJSON(r io.Reader, v interface{}) error {
+	decoder := json.NewDecoder(r)
+	decoder.DisallowUnknownFields()
+
+	err := decoder.Decode(v)
+	if err != nil {
+		return fmt.Errorf("invalid json: %v", err)
+	}
+
+	_, err = decoder.Token()
+	if err != io.EOF {
+		return fmt.Errorf("invalid json: unexpected data after the notification")
+	}
+
+	return nil
+}
+
+func (n notificationRequestJSON) toNotification(channel, origin string) (backend.Notification, error) {
+	notification := backend.Notification{
+		Subject:  n.Subject,
+		Content:  n.Content,
+		Channel:  channel,
+		Origin:   origin,
+		Tags:     n.Tags,
+		Labels:   n.Labels,
+		Priority: backend.NormalPriority,
+	}
+
+	if strings.TrimSpace(n.Subject) == "" {
+		return notification, fmt.Errorf("subject is required")
+	}
+
+	for _, tag := range n.Tags {
+		if tag == "" || strings.Contains(tag, ",") {
+			return notification, fmt.Errorf("tags cannot be empty or contain a comma")
+		}
+	}
+
+	for name, _ := range n.Labels {
+		if name == "" {
+			return notification, fmt.Errorf("label names cannot be empty")
+		}
+	}
+
+	if n.Priority != "" {
+		priority, found := backend.PriorityMap[n.Priority]
+		if !found {
+			return notification, fmt.Errorf("unknown priority '%s'", n.Priority)
+		}
+		notification.Priority = priority
+	}
+
+	if n.SendAt != "" {
+		sendAt, err := time.Parse(time.RFC3339, n.SendAt)
+		if err != nil {
+			return notification, fmt.Errorf("send_at must be an RFC3339 time")
+		}
+		notification.SendAt = sendAt.UnixNano()
+	}
+
+	return notification, nil
+}
+
+func readNotificationJSON(w http.ResponseWriter, r *http.Request, channel, origin string) (backend.Notification, error) {
+	var request notificationRequestJSON
+	err := decodeStrictJSON(http.MaxBytesReader(w, r.Body, maxNotificationBodySize), &request)
+	if err != nil {
+		return backend.Notification{}, err
+	}
+
+	return request.toNotification(channel, origin)
+}
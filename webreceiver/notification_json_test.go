@@ -0,0 +1,167 @@
+package webreceiver
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"time"
+
+	"gitlab.com/shuhao/towncrier/backend"
+	"gitlab.com/shuhao/towncrier/testhelpers"
+
+	. "gopkg.in/check.v1"
+)
+
+func (s *WebReceiverAppSuite) postNotificationJSON(channel, token, body string) (*http.Response, error) {
+	req, err := http.NewRequest("POST", s.url("/receiver/notifications/"+channel), bytes.NewBufferString(body))
+	if err != nil {
+		return nil, err
+	}
+
+	req.Header.Add("Authorization", "Token token="+token)
+	req.Header.Add("Content-Type", "application/json; charset=utf-8")
+
+	return http.DefaultClient.Do(req)
+}
+
+func (s *WebReceiverAppSuite) TestPostNotificationJSON(c *C) {
+	resp, err := s.postNotificationJSON("Channel2", "abc", `{
+		"subject": "Disque presque plein\nvraiment",
+		"content": "/ est à 95%",
+		"tags": ["disk", "db"],
+		"priority": "low",
+		"labels": {"host": "db1"},
+		"send_at": "2030-01-02T03:04:05Z"
+	}`)
+	c.Assert(err, IsNil)
+	c.Assert(resp.StatusCode, Equals, http.StatusAccepted)
+
+	notifications, err := s.backend.QueryNotifications(backend.NotificationQuery{})
+	c.Assert(err, IsNil)
+	c.Assert(notifications, HasLen, 1)
+
+	n := notifications[0]
+	c.Assert(n.Subject, Equals, "Disque presque plein\nvraiment")
+	c.Assert(n.Content, Equals, "/ est à 95%")
+	c.Assert(n.Tags, DeepEquals, []string{"disk", "db"})
+	c.Assert(n.Priority, Equals, backend.LowPriority)
+	c.Assert(n.Labels, DeepEquals, map[string]string{"host": "db1"})
+	c.Assert(n.SendAt, Equals, time.Date(2030, 1, 2, 3, 4, 5, 0, time.UTC).UnixNano())
+	c.Assert(n.Channel, Equals, "Channel2")
+	c.Assert(n.Origin, Equals, "abc_client")
+}
+
+func (s *WebReceiverAppSuite) TestPostNotificationJSONDefaults(c *C) {
+	resp, err := s.postNotificationJSON("Channel1", "abc", `{"subject": "subject"}`)
+	c.Assert(err, IsNil)
+	c.Assert(resp.StatusCode, Equals, http.StatusAccepted)
+
+	var notifications []*backend.StoredNotification
+	timedout := testhelpers.BlockUntilSatisfiedOrTimeout(func() bool {
+		notifications, err = s.backend.QueryNotifications(backend.NotificationQuery{})
+		return err == nil && len(notifications) == 1 && notifications[0].Delivered
+	}, 5*time.Second)
+	c.Assert(timedout, Equals, false)
+
+	c.Assert(notifications[0].Subject, Equals, "subject")
+	c.Assert(notifications[0].Content, Equals, "")
+	c.Assert(notifications[0].Priority, Equals, backend.NormalPriority)
+	c.Assert(notifications[0].SendAt, Equals, int64(0))
+
+	c.Assert(s.notifier.Logs, HasLen, 1)
+	c.Assert(s.notifier.Logs[0].Notifications[0].Subject, Equals, "subject")
+}
+
+func (s *WebReceiverAppSuite) TestPostNotificationJSONInvalid(c *C) {
+	for _, body := range []string{
+		``,
+		`not json`,
+		`{"subject": "subject"} {"subject": "subject"}`,
+		`{"subject": "subject", "unknown": 1}`,
+		`{"subject": ""}`,
+		`{"subject": "subject", "tags": "disk"}`,
+		`{"subject": "subject", "tags": ["a,b"]}`,
+		`{"subject": "subject", "tags": [""]}`,
+		`{"subject": "subject", "priority": "whenever"}`,
+		`{"subject": "subject", "labels": {"": "value"}}`,
+		`{"subject": "subject", "labels": {"count": 1}}`,
+		`{"subject": "subject", "send_at": "tomorrow"}`,
+	} {
+		resp, err := s.postNotificationJSON("Channel1", "abc", body)
+		c.Assert(err, IsNil)
+		c.Assert(resp.StatusCode, Equals, http.StatusBadRequest, Commentf(body))
+		c.Assert(resp.Header.Get("Content-Type"), Equals, "application/json; charset=utf-8")
+
+		var errorBody errorJSON
+		c.Assert(json.NewDecoder(resp.Body).Decode(&errorBody), IsNil)
+		c.Assert(errorBody.Error, Not(Equals), "", Commentf(body))
+		resp.Body.Close()
+	}
+
+	notifications, err := s.backend.QueryNotifications(backend.NotificationQuery{})
+	c.Assert(err, IsNil)
+	c.Assert(notifications, HasLen, 0)
+}
+
+func (s *WebReceiverAppSuite) TestPostNotificationJSONChannelNotFound(c *C) {
+	resp, err := s.postNotificationJSON("InvalidChannel", "abc", `{"subject": "subject"}`)
+	c.Assert(err, IsNil)
+	defer resp.Body.Close()
+	c.Assert(resp.StatusCode, Equals, http.StatusNotFound)
+
+	var errorBody errorJSON
+	c.Assert(json.NewDecoder(resp.Body).Decode(&errorBody), IsNil)
+	c.Assert(errorBody.Error, Equals, "channel 'InvalidChannel' not found")
+}
+
+func (s *WebReceiverAppSuite) TestPostNotificationIdempotencyKey(c *C) {
+	post := func(header, key string) *http.Response {
+		req, err := http.NewRequest("POST", s.url("/receiver/notifications/Channel2"), bytes.NewBufferString("content"))
+		c.Assert(err, IsNil)
+		req.Header.Add("Authorization", "Token token=abc")
+		req.Header.Add("X-Towncrier-Subject", "subject")
+		req.Header.Add(header, key)
+
+		resp, err := http.DefaultClient.Do(req)
+		c.Assert(err, IsNil)
+		resp.Body.Close()
+		return resp
+	}
+
+	resp := post("Idempotency-Key", "key")
+	c.Assert(resp.StatusCode, Equals, http.StatusAccepted)
+	c.Assert(resp.Header.Get("Idempotent-Replayed"), Equals, "")
+	id := resp.Header.Get("X-Towncrier-Notification-Id")
+	c.Assert(id, Not(Equals), "")
+
+	resp = post("X-Towncrier-Idempotency-Key", "key")
+	c.Assert(resp.StatusCode, Equals, http.StatusAccepted)
+	c.Assert(resp.Header.Get("Idempotent-Replayed"), Equals, "true")
+	c.Assert(resp.Header.Get("X-Towncrier-Notification-Id"), Equals, id)
+
+	resp = post("Idempotency-Key", "other key")
+	c.Assert(resp.StatusCode, Equals, http.StatusAccepted)
+	c.Assert(resp.Header.Get("X-Towncrier-Notification-Id"), Not(Equals), id)
+
+	resp = post("Idempotency-Key", strings.Repeat("k", 256))
+	c.Assert(resp.StatusCode, Equals, http.StatusBadRequest)
+
+	notifications, err := s.backend.QueryNotifications(backend.NotificationQuery{})
+	c.Assert(err, IsNil)
+	c.Assert(notifications, HasLen, 2)
+}
+
+func (s *WebReceiverAppSuite) TestPostNotificationJSONReturnsId(c *C) {
+	resp, err := s.postNotificationJSON("Channel2", "abc", `{"subject": "subject"}`)
+	c.Assert(err, IsNil)
+	defer resp.Body.Close()
+	c.Assert(resp.StatusCode, Equals, http.StatusAccepted)
+
+	var body queuedJSON
+	c.Assert(json.NewDecoder(resp.Body).Decode(&body), IsNil)
+
+	notification, err := s.backend.GetNotification(body.Id)
+	c.Assert(err, IsNil)
+	c.Assert(notification.Subject, Equals, "subject")
+}
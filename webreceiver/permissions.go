@@ -0,0 +1,201 @@
+package webreceiver
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"path"
+
+	"gitlab.com/shuhao/towncrier/backend"
+)
+
+// A token is either just the name of its origin, as it used to be, or an
+// object restricting what can be done with it:
+//
+//     "Tokens": {
+//       "abc": "backup_server",
+//       "def": {
+//         "Origin": "cron",
+//         "Channels": ["reports", "cron-*"],
+//         "MaxPriority": "normal",
+//         "DefaultTags": ["cron"],
+//         "AllowedIPs": ["10.0.0.0/8", "192.168.1.10"]
+//       }
+//     }
+//
+// Anything left out is not restricted.
+type TokenConfig struct {
+	Origin string
+	TokenPermissions
+}
+
+type TokenPermissions struct {
+	// Patterns of the channels that can be posted to, as matched by path.Match.
+	Channels []string
+
+	// The highest priority that can be given, a name from backend.PriorityMap.
+	MaxPriority string
+
+	// Given to the notifications posted without tags.
+	DefaultTags []string
+
+	// The addresses the requests can come from, as IPs or CIDRs.
+	AllowedIPs []string
+}
+
+// Why a request was refused, which is explained to the client.
+type PermissionDenied struct {
+	Reason string
+}
+
+func (e PermissionDenied) Error() string {
+	return "permission denied: " + e.Reason
+}
+
+func (t *TokenConfig) UnmarshalJSON(data []byte) error {
+	if len(data) > 0 && data[0] == '"' {
+		*t = TokenConfig{}
+		return json.Unmarshal(data, &t.Origin)
+	}
+
+	origin := struct {
+		Origin string
+	}{}
+
+	err := json.Unmarshal(data, &origin)
+	if err != nil {
+		return err
+	}
+
+	t.Origin = origin.Origin
+	return json.Unmarshal(data, &t.TokenPermissions)
+}
+
+func (p *TokenPermissions) UnmarshalJSON(data []byte) error {
+	type tokenPermissionsJSON TokenPermissions
+	err := json.Unmarshal(data, (*tokenPermissionsJSON)(p))
+	if err != nil {
+		return err
+	}
+
+	return p.validate()
+}
+
+func (p TokenPermissions) validate() error {
+	for _, pattern := range p.Channels {
+		_, err := path.Match(pattern, "")
+		if err != nil {
+			return fmt.Errorf("invalid channel pattern '%s'", pattern)
+		}
+	}
+
+	if _, found := backend.PriorityMap[p.MaxPriority]; p.MaxPriority != "" && !found {
+		return fmt.Errorf("unknown priority '%s'", p.MaxPriority)
+	}
+
+	for _, allowed := range p.AllowedIPs {
+		if parseIPNet(allowed) == nil {
+			return fmt.Errorf("invalid ip or cidr '%s'", allowed)
+		}
+	}
+
+	return nil
+}
+
+// A single IP is a network of its own.
+func parseIPNet(s string) *net.IPNet {
+	_, ipNet, err := net.ParseCIDR(s)
+	if err == nil {
+		return ipNet
+	}
+
+	ip := net.ParseIP(s)
+	if ip == nil {
+		return nil
+	}
+
+	bits := 8 * len(ip)
+	return &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)}
+}
+
+// Checks where the request comes from. The address of the connection is used,
+// as headers such as X-Forwarded-For can be set by anyone.
+func (p TokenPermissions) checkSource(r *http.Request) error {
+	if len(p.AllowedIPs) == 0 {
+		return nil
+	}
+
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+
+	ip := net.ParseIP(host)
+	for _, allowed := range p.AllowedIPs {
+		ipNet := parseIPNet(allowed)
+		if ip != nil && ipNet != nil && ipNet.Contains(ip) {
+			return nil
+		}
+	}
+
+	return PermissionDenied{Reason: fmt.Sprintf("requests from %s are not allowed", host)}
+}
+
+func (p TokenPermissions) canUseChannel(channel string) bool {
+	if len(p.Channels) == 0 {
+		return true
+	}
+
+	for _, pattern := range p.Channels {
+		if matched, _ := path.Match(pattern, channel); matched {
+			return true
+		}
+	}
+
+	return false
+}
+
+// The configured channels that can be used, or nil if every channel can.
+func (p TokenPermissions) usableChannels(channels []backend.ChannelInfo) []string {
+	if len(p.Channels) == 0 {
+		return nil
+	}
+
+	usable := []string{}
+	for _, channel := range channels {
+		if p.canUseChannel(channel.Name) {
+			usable = append(usable, channel.Name)
+		}
+	}
+
+	return usable
+}
+
+// Checks that the notification can be posted, after giving it the default
+// tags if it has none.
+func (p TokenPermissions) checkNotification(notification *backend.Notification) error {
+	if !p.canUseChannel(notification.Channel) {
+		return PermissionDenied{Reason: fmt.Sprintf("cannot post to channel '%s'", notification.Channel)}
+	}
+
+	if maxPriority, found := backend.PriorityMap[p.MaxPriority]; found && notification.Priority > maxPriority {
+		return PermissionDenied{Reason: fmt.Sprintf("cannot post with a priority above '%s'", p.MaxPriority)}
+	}
+
+	if len(notification.Tags) == 0 && len(p.DefaultTags) > 0 {
+		notification.Tags = append([]string{}, p.DefaultTags...)
+	}
+
+	return nil
+}
+
+// The permissions of the client authenticated with the token, or of the origin
+// if the request was signed.
+func (a *App) permissions(token, origin string) TokenPermissions {
+	if token != "" {
+		return a.config.Tokens[token].TokenPermissions
+	}
+
+	return a.config.SigningPermissions[origin]
+}
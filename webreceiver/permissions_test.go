@@ -0,0 +1,143 @@
+package webreceiver
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+
+	"gitlab.com/shuhao/towncrier/backend"
+
+	. "gopkg.in/check.v1"
+)
+
+func (s *WebReceiverAppSuite) TestTokenConfigUnmarshal(c *C) {
+	var config ReceiverConfig
+	err := json.Unmarshal([]byte(`{
+		"Tokens": {
+			"abc": "abc_client",
+			"def": {"Origin": "def_client", "Channels": ["cron-*"], "MaxPriority": "normal", "AllowedIPs": ["10.0.0.1"]}
+		}
+	}`), &config)
+	c.Assert(err, IsNil)
+	c.Assert(config.Tokens, DeepEquals, map[string]TokenConfig{
+		"abc": {Origin: "abc_client"},
+		"def": {
+			Origin: "def_client",
+			TokenPermissions: TokenPermissions{
+				Channels:    []string{"cron-*"},
+				MaxPriority: "normal",
+				AllowedIPs:  []string{"10.0.0.1"},
+			},
+		},
+	})
+
+	for _, token := range []string{
+		`{"Origin": "o", "MaxPriority": "whenever"}`,
+		`{"Origin": "o", "Channels": ["[cron"]}`,
+		`{"Origin": "o", "AllowedIPs": ["10.0.0"]}`,
+		`1`,
+	} {
+		err = json.Unmarshal([]byte(`{"Tokens": {"abc": `+token+`}}`), &config)
+		c.Assert(err, NotNil, Commentf(token))
+	}
+}
+
+func (s *WebReceiverAppSuite) TestUsableChannels(c *C) {
+	channels := []backend.ChannelInfo{{Name: "Channel1"}, {Name: "Channel2"}, {Name: "cron-daily"}}
+
+	c.Assert(TokenPermissions{}.usableChannels(channels), IsNil)
+	c.Assert(TokenPermissions{Channels: []string{"cron-*", "Channel2"}}.usableChannels(channels), DeepEquals, []string{"Channel2", "cron-daily"})
+	c.Assert(TokenPermissions{Channels: []string{"reports"}}.usableChannels(channels), DeepEquals, []string{})
+}
+
+func (s *WebReceiverAppSuite) TestPostNotificationPermissions(c *C) {
+	resp, err := s.postNotification("Channel1", "restricted", "subject", "content", "", "normal")
+	c.Assert(err, IsNil)
+	c.Assert(resp.StatusCode, Equals, http.StatusForbidden)
+	body, err := ioutil.ReadAll(resp.Body)
+	c.Assert(err, IsNil)
+	c.Assert(string(body), Equals, "permission denied: cannot post to channel 'Channel1'\n")
+
+	resp, err = s.postNotification("Channel2", "restricted", "subject", "content", "", "urgent")
+	c.Assert(err, IsNil)
+	c.Assert(resp.StatusCode, Equals, http.StatusForbidden)
+	body, err = ioutil.ReadAll(resp.Body)
+	c.Assert(err, IsNil)
+	c.Assert(string(body), Equals, "permission denied: cannot post with a priority above 'normal'\n")
+
+	resp, err = s.postNotificationJSON("Channel1", "restricted", `{"subject": "subject"}`)
+	c.Assert(err, IsNil)
+	c.Assert(resp.StatusCode, Equals, http.StatusForbidden)
+	var errorBody errorJSON
+	c.Assert(json.NewDecoder(resp.Body).Decode(&errorBody), IsNil)
+	c.Assert(errorBody.Error, Equals, "permission denied: cannot post to channel 'Channel1'")
+
+	resp, err = s.postNotification("Channel2", "restricted", "low", "content", "", "low")
+	c.Assert(err, IsNil)
+	c.Assert(resp.StatusCode, Equals, http.StatusAccepted)
+
+	resp, err = s.postNotification("Channel2", "restricted", "tagged", "content", "mine", "normal")
+	c.Assert(err, IsNil)
+	c.Assert(resp.StatusCode, Equals, http.StatusAccepted)
+
+	notifications, err := s.backend.QueryNotifications(backend.NotificationQuery{})
+	c.Assert(err, IsNil)
+	c.Assert(notifications, HasLen, 2)
+	c.Assert(notifications[0].Subject, Equals, "tagged")
+	c.Assert(notifications[0].Tags, DeepEquals, []string{"mine"})
+	c.Assert(notifications[1].Subject, Equals, "low")
+	c.Assert(notifications[1].Tags, DeepEquals, []string{"restricted"})
+	c.Assert(notifications[1].Origin, Equals, "restricted_client")
+}
+
+func (s *WebReceiverAppSuite) TestPostNotificationBatchPermissions(c *C) {
+	req, err := http.NewRequest("POST", s.url("/receiver/notifications/batch"), bytes.NewBufferString(`[
+		{"channel": "Channel2", "subject": "allowed"},
+		{"channel": "Channel1", "subject": "other channel"},
+		{"channel": "Channel2", "subject": "too urgent", "priority": "urgent"}
+	]`))
+	c.Assert(err, IsNil)
+	req.Header.Add("Authorization", "Token token=restricted")
+
+	resp, err := http.DefaultClient.Do(req)
+	c.Assert(err, IsNil)
+	defer resp.Body.Close()
+	c.Assert(resp.StatusCode, Equals, http.StatusOK)
+
+	var response batchResponseJSON
+	c.Assert(json.NewDecoder(resp.Body).Decode(&response), IsNil)
+	c.Assert(response.Results, HasLen, 3)
+	c.Assert(response.Results[0].Status, Equals, http.StatusAccepted)
+	c.Assert(response.Results[1], DeepEquals, batchResultJSON{Status: http.StatusForbidden, Error: "permission denied: cannot post to channel 'Channel1'"})
+	c.Assert(response.Results[2], DeepEquals, batchResultJSON{Status: http.StatusForbidden, Error: "permission denied: cannot post with a priority above 'normal'"})
+}
+
+func (s *WebReceiverAppSuite) TestAllowedIPs(c *C) {
+	resp, err := s.postNotification("Channel2", "elsewhere", "subject", "content", "", "normal")
+	c.Assert(err, IsNil)
+	c.Assert(resp.StatusCode, Equals, http.StatusForbidden)
+	body, err := ioutil.ReadAll(resp.Body)
+	c.Assert(err, IsNil)
+	c.Assert(string(body), Equals, "permission denied: requests from 127.0.0.1 are not allowed\n")
+
+	req, err := http.NewRequest("GET", s.url("/receiver/notifications"), nil)
+	c.Assert(err, IsNil)
+	req.Header.Add("Authorization", "Token token=elsewhere")
+	req.Header.Add("X-Forwarded-For", "10.0.0.1")
+	resp, err = http.DefaultClient.Do(req)
+	c.Assert(err, IsNil)
+	c.Assert(resp.StatusCode, Equals, http.StatusForbidden)
+
+	permissions := TokenPermissions{AllowedIPs: []string{"10.0.0.0/8", "192.168.1.10", "::1"}}
+	for remoteAddr, allowed := range map[string]bool{
+		"10.1.2.3:1234":     true,
+		"192.168.1.10:1234": true,
+		"192.168.1.11:1234": false,
+		"[::1]:1234":        true,
+		"127.0.0.1:1234":    false,
+	} {
+		err := permissions.checkSource(&http.Request{RemoteAddr: remoteAddr})
+		c.Assert(err == nil, Equals, allowed, Commentf(remoteAddr))
+	}
+}
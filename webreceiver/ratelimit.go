@@ -0,0 +1,152 @@
+package webreceiver
+
+import (
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"gitlab.com/shuhao/towncrier/backend"
+
+	"github.com/Sirupsen/logrus"
+)
+
+// The notifications posted can be limited by origin and by channel, each with
+// a token bucket:
+//
+//     "OriginRateLimits": {"cron": {"PerMinute": 10, "Burst": 30}},
+//     "ChannelRateLimits": {"alerts": {"PerMinute": 5}}
+//
+// The requests over a limit are refused with 429 and a Retry-After. The
+// notifications refused because of a channel limit are not lost entirely: they
+// are counted by the backend, which queues a single notification saying how
+// many were suppressed once the channel is under its limit again.
+
+type RateLimit struct {
+	PerMinute float64
+
+	// How many notifications can be posted at once. Defaults to PerMinute.
+	Burst int
+}
+
+func (l RateLimit) burst() float64 {
+	if l.Burst > 0 {
+		return float64(l.Burst)
+	}
+
+	return math.Max(l.PerMinute, 1)
+}
+
+type tokenBucket struct {
+	tokens    float64
+	updatedAt time.Time
+}
+
+type rateLimiter struct {
+	sync.Mutex
+	buckets map[string]*tokenBucket
+}
+
+func newRateLimiter() *rateLimiter {
+	return &rateLimiter{
+		buckets: make(map[string]*tokenBucket),
+	}
+}
+
+// Takes n tokens from the bucket of the key if it has enough of them.
+// Otherwise, returns how long until it does.
+func (l *rateLimiter) take(key string, limit RateLimit, n int, now time.Time) (bool, time.Duration) {
+	l.Lock()
+	defer l.Unlock()
+
+	burst := limit.burst()
+	bucket, found := l.buckets[key]
+	if !found {
+		bucket = &tokenBucket{tokens: burst, updatedAt: now}
+		l.buckets[key] = bucket
+	}
+
+	perSecond := limit.PerMinute / 60
+	bucket.tokens = math.Min(burst, bucket.tokens+now.Sub(bucket.updatedAt).Seconds()*perSecond)
+	bucket.updatedAt = now
+
+	if bucket.tokens >= float64(n) {
+		bucket.tokens -= float64(n)
+		return true, 0
+	}
+
+	// The bucket never holds n tokens, or never refills.
+	if float64(n) > burst || perSecond <= 0 {
+		return false, time.Hour
+	}
+
+	missing := float64(n) - bucket.tokens
+	return false, time.Duration(missing / perSecond * float64(time.Second))
+}
+
+// A rate limited request or notification.
+type RateLimited struct {
+	Reason     string
+	RetryAfter time.Duration
+}
+
+func (e RateLimited) Error() string {
+	return "rate limited: " + e.Reason
+}
+
+func writeRateLimited(w http.ResponseWriter, jsonResponse bool, err RateLimited) {
+	w.Header().Set("Retry-After", strconv.FormatInt(int64(math.Ceil(err.RetryAfter.Seconds())), 10))
+	if jsonResponse {
+		writeJSON(w, http.StatusTooManyRequests, errorJSON{Error: err.Error()})
+	} else {
+		http.Error(w, err.Error(), http.StatusTooManyRequests)
+	}
+}
+
+// Takes n notifications from the limit of the origin, if it has one.
+func (a *App) checkOriginRateLimit(origin string, n int) error {
+	limit, found := a.config.OriginRateLimits[origin]
+	if !found {
+		return nil
+	}
+
+	ok, retryAfter := a.rateLimiter.take("origin\n"+origin, limit, n, time.Now())
+	if ok {
+		return nil
+	}
+
+	return RateLimited{
+		Reason:     fmt.Sprintf("origin '%s' is over its limit", origin),
+		RetryAfter: retryAfter,
+	}
+}
+
+// Takes the notification from the limit of its channel, if it has one. If the
+// channel is over its limit, the notification is counted as suppressed.
+func (a *App) checkChannelRateLimit(notification backend.Notification) error {
+	limit, found := a.config.ChannelRateLimits[notification.Channel]
+	if !found {
+		return nil
+	}
+
+	ok, retryAfter := a.rateLimiter.take("channel\n"+notification.Channel, limit, 1, time.Now())
+	if ok {
+		return nil
+	}
+
+	err := a.backend.SuppressNotification(notification, retryAfter)
+	if err != nil {
+		logger.WithFields(logrus.Fields{
+			"channel": notification.Channel,
+			"origin":  notification.Origin,
+			"error":   err,
+		}).Error("failed to count the suppressed notification")
+	}
+
+	return RateLimited{
+		Reason:     fmt.Sprintf("channel '%s' is over its limit", notification.Channel),
+		RetryAfter: retryAfter,
+	}
+}
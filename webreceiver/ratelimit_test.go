@@ -0,0 +1,154 @@
+package webreceiver
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"time"
+
+	"gitlab.com/shuhao/towncrier/backend"
+	"gitlab.com/shuhao/towncrier/sql_backend"
+
+	. "gopkg.in/check.v1"
+)
+
+func (s *WebReceiverAppSuite) TestRateLimiterTake(c *C) {
+	limiter := newRateLimiter()
+	limit := RateLimit{PerMinute: 60, Burst: 2}
+	now := time.Now()
+
+	ok, _ := limiter.take("key", limit, 1, now)
+	c.Assert(ok, Equals, true)
+	ok, _ = limiter.take("key", limit, 1, now)
+	c.Assert(ok, Equals, true)
+
+	ok, retryAfter := limiter.take("key", limit, 1, now)
+	c.Assert(ok, Equals, false)
+	c.Assert(retryAfter, Equals, time.Second)
+
+	ok, _ = limiter.take("other key", limit, 2, now)
+	c.Assert(ok, Equals, true)
+
+	ok, _ = limiter.take("key", limit, 1, now.Add(time.Second))
+	c.Assert(ok, Equals, true)
+
+	// Never refills over the burst.
+	ok, _ = limiter.take("key", limit, 2, now.Add(time.Hour))
+	c.Assert(ok, Equals, true)
+	ok, retryAfter = limiter.take("key", limit, 3, now.Add(2*time.Hour))
+	c.Assert(ok, Equals, false)
+	c.Assert(retryAfter, Equals, time.Hour)
+}
+
+func (s *WebReceiverAppSuite) TestOriginRateLimit(c *C) {
+	s.app.config.OriginRateLimits = map[string]RateLimit{
+		"abc_client": {PerMinute: 1, Burst: 1},
+	}
+
+	resp, err := s.postNotification("Channel2", "abc", "first", "content", "", "normal")
+	c.Assert(err, IsNil)
+	c.Assert(resp.StatusCode, Equals, http.StatusAccepted)
+
+	resp, err = s.postNotificationJSON("Channel2", "abc", `{"subject": "second"}`)
+	c.Assert(err, IsNil)
+	defer resp.Body.Close()
+	c.Assert(resp.StatusCode, Equals, http.StatusTooManyRequests)
+	c.Assert(resp.Header.Get("Retry-After"), Equals, "60")
+
+	var errorBody errorJSON
+	c.Assert(json.NewDecoder(resp.Body).Decode(&errorBody), IsNil)
+	c.Assert(errorBody.Error, Equals, "rate limited: origin 'abc_client' is over its limit")
+
+	notifications, err := s.backend.QueryNotifications(backend.NotificationQuery{})
+	c.Assert(err, IsNil)
+	c.Assert(notifications, HasLen, 1)
+	c.Assert(notifications[0].Subject, Equals, "first")
+
+	// Only the channels over their limit get a summary.
+	suppressed, err := s.backend.SelectInt("SELECT COUNT(*) FROM suppressed_notifications")
+	c.Assert(err, IsNil)
+	c.Assert(suppressed, Equals, int64(0))
+}
+
+func (s *WebReceiverAppSuite) TestChannelRateLimitSuppressesNotifications(c *C) {
+	s.app.config.ChannelRateLimits = map[string]RateLimit{
+		"Channel2": {PerMinute: 1},
+	}
+
+	for i, expected := range []int{http.StatusAccepted, http.StatusTooManyRequests, http.StatusTooManyRequests} {
+		resp, err := s.postNotification("Channel2", "abc", "subject", "content", "", "normal")
+		c.Assert(err, IsNil)
+		c.Assert(resp.StatusCode, Equals, expected, Commentf("request %d", i))
+	}
+
+	status, response := s.postBatch(c, "application/json", `[
+		{"channel": "Channel1", "subject": "other channel"},
+		{"channel": "Channel2", "subject": "suppressed"}
+	]`)
+	c.Assert(status, Equals, http.StatusOK)
+	c.Assert(response.Results[0].Status, Equals, http.StatusAccepted)
+	c.Assert(response.Results[1], DeepEquals, batchResultJSON{Status: http.StatusTooManyRequests, Error: "rate limited: channel 'Channel2' is over its limit"})
+
+	notifications, err := s.backend.QueryNotifications(backend.NotificationQuery{Channel: "Channel2"})
+	c.Assert(err, IsNil)
+	c.Assert(notifications, HasLen, 1)
+
+	// The backend queues the summary once the channel is under its limit.
+	var suppressed []*sql_backend.SuppressedNotifications
+	_, err = s.backend.Select(&suppressed, "SELECT * FROM suppressed_notifications")
+	c.Assert(err, IsNil)
+	c.Assert(suppressed, HasLen, 1)
+	c.Assert(suppressed[0].Channel, Equals, "Channel2")
+	c.Assert(suppressed[0].Origin, Equals, "abc_client")
+	c.Assert(suppressed[0].Count, Equals, int64(3))
+	c.Assert(time.Duration(suppressed[0].SummarizeAt-suppressed[0].Since) > 50*time.Second, Equals, true)
+}
+
+func (s *WebReceiverAppSuite) TestIdempotentRetryIsNotRateLimited(c *C) {
+	s.app.config.ChannelRateLimits = map[string]RateLimit{
+		"Channel2": {PerMinute: 1},
+	}
+
+	post := func(key string) *http.Response {
+		req, err := http.NewRequest("POST", s.url("/receiver/notifications/Channel2"), bytes.NewBufferString("content"))
+		c.Assert(err, IsNil)
+		req.Header.Add("Authorization", "Token token=abc")
+		req.Header.Add("X-Towncrier-Subject", "subject")
+		req.Header.Add("Idempotency-Key", key)
+
+		resp, err := http.DefaultClient.Do(req)
+		c.Assert(err, IsNil)
+		resp.Body.Close()
+		return resp
+	}
+
+	resp := post("key")
+	c.Assert(resp.StatusCode, Equals, http.StatusAccepted)
+	id := resp.Header.Get("X-Towncrier-Notification-Id")
+	notificationId, err := strconv.ParseInt(id, 10, 64)
+	c.Assert(err, IsNil)
+
+	resp = post("other key")
+	c.Assert(resp.StatusCode, Equals, http.StatusTooManyRequests)
+
+	resp = post("key")
+	c.Assert(resp.StatusCode, Equals, http.StatusAccepted)
+	c.Assert(resp.Header.Get("Idempotent-Replayed"), Equals, "true")
+	c.Assert(resp.Header.Get("X-Towncrier-Notification-Id"), Equals, id)
+
+	status, response := s.postBatch(c, "application/json", `[
+		{"channel": "Channel2", "subject": "subject", "idempotency_key": "key"}
+	]`)
+	c.Assert(status, Equals, http.StatusOK)
+	c.Assert(response.Results[0], DeepEquals, batchResultJSON{Status: http.StatusAccepted, Id: notificationId, Duplicate: true})
+
+	notifications, err := s.backend.QueryNotifications(backend.NotificationQuery{})
+	c.Assert(err, IsNil)
+	c.Assert(notifications, HasLen, 1)
+
+	// Only the new notification is counted as suppressed.
+	suppressed, err := s.backend.SelectInt("SELECT Count FROM suppressed_notifications")
+	c.Assert(err, IsNil)
+	c.Assert(suppressed, Equals, int64(1))
+}
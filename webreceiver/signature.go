@@ -0,0 +1,170 @@
+package webreceiver
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Instead of a token, which can be replayed by anyone seeing the request, the
+// clients can sign their requests with the secret of their origin:
+//
+//     Authorization: Towncrier-HMAC-SHA256 origin=<origin>, timestamp=<unix seconds>, nonce=<random>, signature=<hex>
+//
+// The signature is the hex encoded HMAC-SHA256, keyed with the secret, of:
+//
+//     <method>\n<path and query>\n<timestamp>\n<nonce>\n<hex encoded SHA256 of the body>
+//
+// The timestamp has to be within the skew window of the time of the receiver,
+// and a nonce can only be used once by an origin within that window.
+
+const (
+	signatureScheme = "Towncrier-HMAC-SHA256"
+
+	defaultSignatureMaxSkewSeconds = 5 * 60
+
+	// Nonces are at most this long so they cannot be used to fill up the
+	// memory.
+	maxNonceLength = 128
+)
+
+// The nonces seen recently. They only need to be remembered while their
+// timestamp is within the skew window, as the requests are rejected
+// afterwards anyway.
+//
+// This is only for this process. If several receivers serve the same
+// origins, a request can be replayed once against each of them.
+type nonceCache struct {
+	sync.Mutex
+	expiresAt map[string]time.Time // origin and nonce => when it can be forgotten
+	pruneAt   time.Time
+}
+
+func newNonceCache() *nonceCache {
+	return &nonceCache{
+		expiresAt: make(map[string]time.Time),
+	}
+}
+
+// Returns false if the nonce was already used by the origin.
+func (c *nonceCache) use(origin, nonce string, now time.Time, ttl time.Duration) bool {
+	c.Lock()
+	defer c.Unlock()
+
+	if !now.Before(c.pruneAt) {
+		for key, expiresAt := range c.expiresAt {
+			if !now.Before(expiresAt) {
+				delete(c.expiresAt, key)
+			}
+		}
+		c.pruneAt = now.Add(ttl)
+	}
+
+	key := origin + "\n" + nonce
+	if expiresAt, found := c.expiresAt[key]; found && now.Before(expiresAt) {
+		return false
+	}
+
+	c.expiresAt[key] = now.Add(ttl)
+	return true
+}
+
+func stringToSign(method, path, timestamp, nonce string, body []byte) string {
+	bodyHash := sha256.Sum256(body)
+	return strings.Join([]string{method, path, timestamp, nonce, hex.EncodeToString(bodyHash[:])}, "\n")
+}
+
+// The signature of a request, as a client has to compute it.
+func signRequest(secret, method, path, timestamp, nonce string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	io.WriteString(mac, stringToSign(method, path, timestamp, nonce, body))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// Parses the parameters of the signature scheme, returning false if the
+// authorization is not of that scheme.
+func parseSignatureAuthorization(auth string) (map[string]string, bool) {
+	if !strings.HasPrefix(auth, signatureScheme+" ") {
+		return nil, false
+	}
+
+	params := make(map[string]string)
+	for _, param := range strings.Split(strings.TrimPrefix(auth, signatureScheme+" "), ",") {
+		keyValue := strings.SplitN(strings.TrimSpace(param), "=", 2)
+		if len(keyValue) != 2 {
+			return nil, true
+		}
+		params[keyValue[0]] = keyValue[1]
+	}
+
+	return params, true
+}
+
+func (a *App) signatureMaxSkew() time.Duration {
+	if a.config.SignatureMaxSkewSeconds <= 0 {
+		return defaultSignatureMaxSkewSeconds * time.Second
+	}
+
+	return time.Duration(a.config.SignatureMaxSkewSeconds) * time.Second
+}
+
+// Checks the signature of the request and returns its origin. The body is
+// read to be hashed, so it is replaced with a copy for the handlers.
+func (a *App) verifySignature(r *http.Request, params map[string]string) (string, error) {
+	origin := params["origin"]
+	secret, found := a.config.SigningSecrets[origin]
+	if origin == "" || !found {
+		return "", errors.New("unknown origin")
+	}
+
+	timestamp := params["timestamp"]
+	seconds, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return "", errors.New("invalid timestamp")
+	}
+
+	maxSkew := a.signatureMaxSkew()
+	now := time.Now()
+	skew := now.Sub(time.Unix(seconds, 0))
+	if skew > maxSkew || skew < -maxSkew {
+		return "", errors.New("timestamp outside of the skew window")
+	}
+
+	nonce := params["nonce"]
+	if nonce == "" || len(nonce) > maxNonceLength {
+		return "", errors.New("invalid nonce")
+	}
+
+	// Anything larger is rejected by the handlers anyway.
+	body, err := ioutil.ReadAll(io.LimitReader(r.Body, maxBatchBodySize+1))
+	if err != nil {
+		return "", err
+	}
+	if len(body) > maxBatchBodySize {
+		return "", errors.New("body too large")
+	}
+	r.Body = ioutil.NopCloser(bytes.NewReader(body))
+
+	expected := signRequest(secret, r.Method, r.URL.RequestURI(), timestamp, nonce, body)
+	if !hmac.Equal([]byte(expected), []byte(strings.ToLower(params["signature"]))) {
+		return "", errors.New("invalid signature")
+	}
+
+	// Only the valid signatures use up the nonce, otherwise anyone could burn
+	// the nonces of a client. The window covers the skew on both sides.
+	if !a.nonces.use(origin, nonce, now, 2*maxSkew) {
+		return "", fmt.Errorf("nonce '%s' was already used", nonce)
+	}
+
+	return origin, nil
+}
@@ -0,0 +1,131 @@
+package webreceiver
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"gitlab.com/shuhao/towncrier/backend"
+
+	. "gopkg.in/check.v1"
+)
+
+func (s *WebReceiverAppSuite) signedRequest(c *C, method, path, secret string, timestamp time.Time, nonce, body string) *http.Request {
+	req, err := http.NewRequest(method, s.url(path), bytes.NewBufferString(body))
+	c.Assert(err, IsNil)
+
+	ts := strconv.FormatInt(timestamp.Unix(), 10)
+	signature := signRequest(secret, method, path, ts, nonce, []byte(body))
+	req.Header.Add("Authorization", fmt.Sprintf("%s origin=signed_client, timestamp=%s, nonce=%s, signature=%s", signatureScheme, ts, nonce, signature))
+	req.Header.Add("Content-Type", "application/json")
+	return req
+}
+
+func (s *WebReceiverAppSuite) do(c *C, req *http.Request) int {
+	resp, err := http.DefaultClient.Do(req)
+	c.Assert(err, IsNil)
+	resp.Body.Close()
+	return resp.StatusCode
+}
+
+func (s *WebReceiverAppSuite) TestSignedRequest(c *C) {
+	req := s.signedRequest(c, "POST", "/receiver/notifications/Channel2", "s3cret", time.Now(), "nonce1", `{"subject": "signed"}`)
+	c.Assert(s.do(c, req), Equals, http.StatusAccepted)
+
+	notifications, err := s.backend.QueryNotifications(backend.NotificationQuery{})
+	c.Assert(err, IsNil)
+	c.Assert(notifications, HasLen, 1)
+	c.Assert(notifications[0].Subject, Equals, "signed")
+	c.Assert(notifications[0].Origin, Equals, "signed_client")
+
+	req = s.signedRequest(c, "GET", "/receiver/notifications?channel=Channel2", "s3cret", time.Now(), "nonce2", "")
+	resp, err := http.DefaultClient.Do(req)
+	c.Assert(err, IsNil)
+	defer resp.Body.Close()
+	c.Assert(resp.StatusCode, Equals, http.StatusOK)
+
+	var list notificationsPageJSON
+	c.Assert(json.NewDecoder(resp.Body).Decode(&list), IsNil)
+	c.Assert(list.Notifications, HasLen, 1)
+}
+
+func (s *WebReceiverAppSuite) TestSignedRequestReplay(c *C) {
+	req := s.signedRequest(c, "POST", "/receiver/notifications/Channel2", "s3cret", time.Now(), "nonce", `{"subject": "signed"}`)
+	c.Assert(s.do(c, req), Equals, http.StatusAccepted)
+
+	req = s.signedRequest(c, "POST", "/receiver/notifications/Channel2", "s3cret", time.Now(), "nonce", `{"subject": "signed"}`)
+	c.Assert(s.do(c, req), Equals, http.StatusForbidden)
+
+	notifications, err := s.backend.QueryNotifications(backend.NotificationQuery{})
+	c.Assert(err, IsNil)
+	c.Assert(notifications, HasLen, 1)
+}
+
+func (s *WebReceiverAppSuite) TestSignedRequestRejected(c *C) {
+	path := "/receiver/notifications/Channel2"
+	body := `{"subject": "signed"}`
+
+	// Wrong secret
+	req := s.signedRequest(c, "POST", path, "wrong", time.Now(), "nonce1", body)
+	c.Assert(s.do(c, req), Equals, http.StatusForbidden)
+
+	// Outside of the skew window
+	req = s.signedRequest(c, "POST", path, "s3cret", time.Now().Add(-6*time.Minute), "nonce2", body)
+	c.Assert(s.do(c, req), Equals, http.StatusForbidden)
+	req = s.signedRequest(c, "POST", path, "s3cret", time.Now().Add(6*time.Minute), "nonce3", body)
+	c.Assert(s.do(c, req), Equals, http.StatusForbidden)
+
+	// Tampered body
+	req = s.signedRequest(c, "POST", path, "s3cret", time.Now(), "nonce4", body)
+	req.Body.Close()
+	req.Body = ioutil.NopCloser(bytes.NewBufferString(`{"subject": "tampered"}`))
+	req.ContentLength = -1
+	c.Assert(s.do(c, req), Equals, http.StatusForbidden)
+
+	// Signed for another path
+	req = s.signedRequest(c, "POST", "/receiver/notifications/Channel1", "s3cret", time.Now(), "nonce5", body)
+	req.URL.Path = path
+	c.Assert(s.do(c, req), Equals, http.StatusForbidden)
+
+	// Missing nonce
+	req = s.signedRequest(c, "POST", path, "s3cret", time.Now(), "", body)
+	c.Assert(s.do(c, req), Equals, http.StatusForbidden)
+
+	// Unknown origin
+	req = s.signedRequest(c, "POST", path, "s3cret", time.Now(), "nonce6", body)
+	req.Header.Set("Authorization", strings.Replace(req.Header.Get("Authorization"), "signed_client", "abc_client", 1))
+	c.Assert(s.do(c, req), Equals, http.StatusForbidden)
+
+	notifications, err := s.backend.QueryNotifications(backend.NotificationQuery{})
+	c.Assert(err, IsNil)
+	c.Assert(notifications, HasLen, 0)
+}
+
+func (s *WebReceiverAppSuite) TestNonceCacheForgetsExpiredNonces(c *C) {
+	cache := newNonceCache()
+	now := time.Now()
+
+	c.Assert(cache.use("origin", "nonce", now, time.Minute), Equals, true)
+	c.Assert(cache.use("origin", "nonce", now.Add(30*time.Second), time.Minute), Equals, false)
+	c.Assert(cache.use("other", "nonce", now, time.Minute), Equals, true)
+
+	c.Assert(cache.use("origin", "nonce", now.Add(time.Minute), time.Minute), Equals, true)
+	c.Assert(cache.expiresAt, HasLen, 1)
+}
+
+func (s *WebReceiverAppSuite) TestSignedRequestPermissions(c *C) {
+	s.app.config.SigningPermissions = map[string]TokenPermissions{
+		"signed_client": {Channels: []string{"Channel2"}},
+	}
+
+	req := s.signedRequest(c, "POST", "/receiver/notifications/Channel1", "s3cret", time.Now(), "nonce1", `{"subject": "signed"}`)
+	c.Assert(s.do(c, req), Equals, http.StatusForbidden)
+
+	req = s.signedRequest(c, "POST", "/receiver/notifications/Channel2", "s3cret", time.Now(), "nonce2", `{"subject": "signed"}`)
+	c.Assert(s.do(c, req), Equals, http.StatusAccepted)
+}